@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Environment variables naming the files GitHub Actions reads step outputs and the job
+// summary from
+const (
+	githubOutputEnv      = "GITHUB_OUTPUT"
+	githubStepSummaryEnv = "GITHUB_STEP_SUMMARY"
+)
+
+// annotationLevels maps finding levels to workflow command annotations
+var annotationLevels = map[string]string{
+	levelError:   "error",
+	levelWarning: "warning",
+	levelNote:    "notice",
+}
+
+// escapeWorkflowData escapes the message of a workflow command
+func escapeWorkflowData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeWorkflowProperty escapes a property value of a workflow command
+func escapeWorkflowProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// writeAnnotation writes a workflow command annotating a line of a file, or the whole
+// file when line is 0
+func writeAnnotation(w io.Writer, level, file string, line int, title, message string) {
+	properties := "file=" + escapeWorkflowProperty(file)
+	if line > 0 {
+		properties += fmt.Sprintf(",line=%d", line)
+	}
+	if title != "" {
+		properties += ",title=" + escapeWorkflowProperty(title)
+	}
+	fmt.Fprintf(w, "::%s %s::%s\n", level, properties, escapeWorkflowData(message))
+}
+
+// writeAnnotations annotates the files of a run: failed files and lookups as errors, held
+// back updates as warnings, digest changes as notices and findings at their level
+func writeAnnotations(w io.Writer, reports []*RunReport, checkOnly bool) {
+	changeTitle := "Digest updated"
+	if checkOnly {
+		changeTitle = "Digest update available"
+	}
+	for _, report := range reports {
+		file := displayPath(report.Containerfile)
+		if report.Error != "" {
+			writeAnnotation(w, "error", file, 0, "Failed to process file", report.Error)
+		}
+		for _, image := range report.Images {
+			switch {
+			case image.Error != "":
+				writeAnnotation(w, "error", file, image.Line, "Failed to resolve digest", fmt.Sprintf("%s: %s", image.Image, image.Error))
+			case image.Skipped != "":
+				// Policy reasons for skipping are reported as findings
+			case image.Held != "":
+				writeAnnotation(w, "warning", file, image.Line, "Update held back", fmt.Sprintf("%s: %s", image.Image, image.Held))
+			case image.Changed:
+				message := fmt.Sprintf("%s: %s → %s", image.Image, shortDigest(image.PreviousDigest), shortDigest(image.Digest))
+				if description := image.Release.describe(); description != "" {
+					message += " (" + description + ")"
+				}
+				writeAnnotation(w, "notice", file, image.Line, changeTitle, message)
+			}
+		}
+		for _, finding := range report.Findings {
+			writeAnnotation(w, annotationLevels[finding.Level], file, finding.Line, finding.Rule, finding.Message)
+		}
+	}
+}
+
+// writeStepSummary writes the run summary and the changed images as markdown tables
+func writeStepSummary(w io.Writer, summary RunSummary, checkOnly bool) {
+	heading, updated := "Container image updates", "Updated"
+	if checkOnly {
+		heading, updated = "Container image update check", "Updates available"
+	}
+
+	fmt.Fprintf(w, "### %s\n\n", heading)
+	fmt.Fprintf(w, "| Files | Images | %s | Unchanged | Skipped | Held back | Errors |\n", updated)
+	fmt.Fprintln(w, "|---:|---:|---:|---:|---:|---:|---:|")
+	fmt.Fprintf(w, "| %d | %d | %d | %d | %d | %d | %d |\n", summary.Files, summary.Images, summary.Updated, summary.Unchanged, summary.Skipped, summary.Held, summary.Errors)
+	if len(summary.Changes) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\n| Image | Location | Change | Version |")
+	fmt.Fprintln(w, "|---|---|---|---|")
+	for _, change := range summary.Changes {
+		version := ""
+		if description := (&ReleaseInfo{Version: change.Version, Revision: change.Revision}).describe(); description != "" {
+			version = "`" + description + "`"
+		}
+		fmt.Fprintf(w, "| `%s` | `%s:%d` | `%s` → `%s` | %s |\n", change.Image, change.File, change.Line, shortDigest(change.PreviousDigest), shortDigest(change.Digest), version)
+	}
+}
+
+// writeStepOutputs writes the totals of a run as step outputs, with the changes as JSON
+// for later steps to read with fromJSON
+func writeStepOutputs(w io.Writer, summary RunSummary) error {
+	changes, err := json.Marshal(summary.Changes)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "files=%d\n", summary.Files)
+	fmt.Fprintf(w, "images=%d\n", summary.Images)
+	fmt.Fprintf(w, "updated=%d\n", summary.Updated)
+	fmt.Fprintf(w, "unchanged=%d\n", summary.Unchanged)
+	fmt.Fprintf(w, "skipped=%d\n", summary.Skipped)
+	fmt.Fprintf(w, "held=%d\n", summary.Held)
+	fmt.Fprintf(w, "errors=%d\n", summary.Errors)
+	fmt.Fprintf(w, "changed=%t\n", summary.Updated > 0)
+	_, err = fmt.Fprintf(w, "changes=%s\n", changes)
+	return err
+}
+
+// appendToEnvFile appends the output of write to the file named by an environment
+// variable. Without the variable, e.g. outside GitHub Actions, nothing is written.
+func appendToEnvFile(env string, write func(io.Writer) error) error {
+	path := os.Getenv(env)
+	if path == "" {
+		slog.Warn("Not writing GitHub Actions results, variable is not set", "variable", env)
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeGitHubActions reports the outcome of a run to GitHub Actions: annotations on out
+// (none if nil), step outputs to $GITHUB_OUTPUT and a markdown summary to $GITHUB_STEP_SUMMARY
+func writeGitHubActions(out io.Writer, reports []*RunReport, summary RunSummary, checkOnly bool) error {
+	if out != nil {
+		writeAnnotations(out, reports, checkOnly)
+	}
+	if err := appendToEnvFile(githubOutputEnv, func(w io.Writer) error {
+		return writeStepOutputs(w, summary)
+	}); err != nil {
+		return fmt.Errorf("failed to write step outputs: %w", err)
+	}
+	if err := appendToEnvFile(githubStepSummaryEnv, func(w io.Writer) error {
+		writeStepSummary(w, summary, checkOnly)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to write step summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteAnnotation(t *testing.T) {
+	var out bytes.Buffer
+	writeAnnotation(&out, "error", "dir,a/Containerfile", 3, "rule: one", "50% failed\nretry")
+	expected := "::error file=dir%2Ca/Containerfile,line=3,title=rule%3A one::50%25 failed%0Aretry\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	writeAnnotation(&out, "warning", "Containerfile", 0, "", "whole file")
+	if expected := "::warning file=Containerfile::whole file\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestGitHubActionsRun(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/app:1.0")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	content := "FROM " + host + "/app:1.0\nFROM " + host + "/missing:1.0\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputs := filepath.Join(dir, "output")
+	stepSummary := filepath.Join(dir, "summary")
+	t.Setenv(githubOutputEnv, outputs)
+	t.Setenv(githubStepSummaryEnv, stepSummary)
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	var out bytes.Buffer
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, checkOnly: true, github: true, out: &out}
+	if exitCode := run.run(); exitCode != exitError {
+		t.Fatalf("Expected exit code %d, got %d", exitError, exitCode)
+	}
+
+	annotations := out.String()
+	for _, expected := range []string{
+		"::notice file=" + escapeWorkflowProperty(displayPath(path)) + ",line=1,title=Digest update available::" + host + "/app:1.0: ",
+		",line=2,title=Failed to resolve digest::" + host + "/missing:1.0: ",
+		",line=1,title=unpinned-image::",
+	} {
+		if !strings.Contains(annotations, expected) {
+			t.Errorf("Annotations missing %q:\n%s", expected, annotations)
+		}
+	}
+
+	data, err := os.ReadFile(outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		values[key] = value
+	}
+	if values["updated"] != "1" || values["errors"] != "1" || values["changed"] != "true" {
+		t.Errorf("Unexpected step outputs:\n%s", data)
+	}
+	var changes []ChangeSummary
+	if err := json.Unmarshal([]byte(values["changes"]), &changes); err != nil {
+		t.Fatalf("Invalid changes output: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Digest != digest.String() || changes[0].Line != 1 {
+		t.Errorf("Unexpected changes output: %+v", changes)
+	}
+
+	data, err = os.ReadFile(stepSummary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"### Container image update check",
+		"| 1 | 2 | 1 | 0 | 0 | 0 | 1 |",
+		"| `" + host + "/app:1.0` | `" + displayPath(path) + ":1` | `unpinned` → `" + shortDigest(digest.String()) + "` |",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Step summary missing %q:\n%s", expected, data)
+		}
+	}
+}
+
+func TestGitHubActionsMachineReadableOutput(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/app:1.0")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM "+host+"/app:1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputs := filepath.Join(dir, "output")
+	t.Setenv(githubOutputEnv, outputs)
+	t.Setenv(githubStepSummaryEnv, filepath.Join(dir, "summary"))
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	for _, output := range []string{outputJSON, outputSARIF} {
+		os.Remove(outputs)
+		var out bytes.Buffer
+		run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: output, checkOnly: true, github: true, out: &out}
+		if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+			t.Fatalf("%s: expected exit code %d, got %d", output, exitUpdatesNeeded, exitCode)
+		}
+
+		// Stdout holds nothing but the document
+		decoder := json.NewDecoder(bytes.NewReader(out.Bytes()))
+		var document map[string]any
+		if err := decoder.Decode(&document); err != nil {
+			t.Fatalf("%s: invalid document on stdout: %v", output, err)
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			t.Errorf("%s: unexpected output after the document:\n%s", output, out.String())
+		}
+
+		// Step outputs are still written
+		if data, err := os.ReadFile(outputs); err != nil || !strings.Contains(string(data), "updated=1\n") {
+			t.Errorf("%s: expected step outputs, got %q (%v)", output, data, err)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ociRefNameAnnotation names an image in an OCI layout's index
+const ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// airgapImage is an image with the digest an --offline update pins it to
+type airgapImage struct {
+	key    string // registry/repository:tag, as in digest files
+	image  *ImageReference
+	digest string
+}
+
+// resolveAirgapImages returns every image of the files once, with its digest taken from the
+// digest file when given and resolved from the registries otherwise, so it matches what an
+// --offline update with the same digest file pins. It reports whether all of them resolved.
+func resolveAirgapImages(paths []string, cfg *Config, format string, pinSyntax bool, digests DigestSource) ([]airgapImage, bool) {
+	var images []airgapImage
+	seen := make(map[string]bool)
+	ok := true
+	for _, path := range paths {
+		fileFormat, err := resolveFormat(format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return nil, false
+		}
+		updater := NewContainerfileUpdaterWithConfig(path, cfg)
+		updater.format = fileFormat
+		updater.pinSyntax = pinSyntax
+		updater.digests = digests
+		commands, err := updater.extractImages()
+		if err != nil {
+			slog.Error("Failed to extract images", "path", path, "error", err)
+			ok = false
+			continue
+		}
+
+		runCtx, cancelRun := updater.runContext()
+		for _, cmd := range commands {
+			key := digestKey(cmd.Image)
+			if seen[key] || cmd.SkipReason != "" {
+				continue
+			}
+			seen[key] = true
+			digest, err := updater.exportDigest(runCtx, cmd.Image)
+			if err != nil {
+				slog.Error("Failed to resolve digest", "image", cmd.Image.Original, "error", err)
+				ok = false
+				continue
+			}
+			images = append(images, airgapImage{key: key, image: cmd.Image, digest: digest})
+		}
+		cancelRun()
+	}
+	return images, ok
+}
+
+// writeOCILayout copies every image, with all its platforms, into an OCI image layout
+// directory, naming each after its tag
+func writeOCILayout(dir string, images []airgapImage, cfg *Config) error {
+	layoutPath, err := layout.FromPath(dir)
+	if err != nil {
+		if layoutPath, err = layout.Write(dir, empty.Index); err != nil {
+			return fmt.Errorf("failed to create OCI layout %s: %w", dir, err)
+		}
+	}
+
+	updater := NewContainerfileUpdaterWithConfig(dir, cfg)
+	runCtx, cancelRun := updater.runContext()
+	defer cancelRun()
+	for _, image := range images {
+		ref, err := name.ParseReference(image.key+"@"+image.digest, referenceOptions(cfg, image.image.Registry)...)
+		if err != nil {
+			return err
+		}
+		// Copying layers can take much longer than a lookup, so only the run's deadline applies
+		options, err := updater.remoteOptions(runCtx, image.image.Registry)
+		if err != nil {
+			return err
+		}
+		descriptor, err := remote.Get(ref, options...)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", image.key, err)
+		}
+
+		annotations := layout.WithAnnotations(map[string]string{ociRefNameAnnotation: image.key})
+		if descriptor.MediaType.IsIndex() {
+			index, err := descriptor.ImageIndex()
+			if err == nil {
+				err = layoutPath.AppendIndex(index, annotations)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy %s: %w", image.key, err)
+			}
+		} else {
+			img, err := descriptor.Image()
+			if err == nil {
+				err = layoutPath.AppendImage(img, annotations)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy %s: %w", image.key, err)
+			}
+		}
+		slog.Info("Exported image", "image", image.key, "digest", image.digest, "layout", dir)
+	}
+	return nil
+}
+
+// writeImageList prints one registry/repository:tag@digest reference per image, the input
+// skopeo sync, crane copy and similar tools take
+func writeImageList(w io.Writer, images []airgapImage) {
+	for _, image := range images {
+		fmt.Fprintf(w, "%s@%s\n", image.key, image.digest)
+	}
+}
+
+// loadOptionalDigestFile reads a digest file if a path is given
+func loadOptionalDigestFile(path string) (DigestSource, error) {
+	if path == "" {
+		return nil, nil
+	}
+	digests, err := LoadDigestFile(path)
+	if err != nil {
+		// A nil *DigestFile would make a non-nil source
+		return nil, err
+	}
+	return digests, nil
+}
+
+// runExportImages implements the export-images subcommand
+func runExportImages(args []string) int {
+	fs := flag.NewFlagSet("export-images", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	digestFile := fs.String("digest-file", "", "Export the digests recorded by export-digests instead of resolving the tags")
+	ociLayout := fs.String("oci-layout", "", "Copy the images into this OCI image layout directory instead of listing them")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also export the frontend image of # syntax= directives")
+	scanRun := fs.Bool("scan-run", false, "Also export images pulled inside RUN instructions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export-images [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "List every resolved image as registry/repository:tag@digest, or copy them into an OCI")
+		fmt.Fprintln(fs.Output(), "layout, to be imported into an air-gapped registry.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("info"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to update", "error", err)
+		return exitError
+	}
+	digests, err := loadOptionalDigestFile(*digestFile)
+	if err != nil {
+		slog.Error("Failed to load digest file", "error", err)
+		return exitError
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+
+	exitCode := exitOK
+	images, ok := resolveAirgapImages(paths, cfg, *format, *pinSyntax, digests)
+	if !ok {
+		exitCode = exitError
+	}
+	if *ociLayout == "" {
+		writeImageList(os.Stdout, images)
+		return exitCode
+	}
+	if err := writeOCILayout(*ociLayout, images, cfg); err != nil {
+		slog.Error("Failed to export images", "error", err)
+		return exitError
+	}
+	return exitCode
+}
+
+// importedImage returns the registry host and reference an image has once imported into
+// an internal registry: the one given as host[/prefix], or else the image registry's mirror
+func (du *ContainerfileUpdater) importedImage(image airgapImage, internal string) (string, string) {
+	host, repository := du.mirrorImage(image.image)
+	if internal != "" {
+		var prefix string
+		host, prefix, _ = strings.Cut(strings.TrimSuffix(internal, "/"), "/")
+		repository = path.Join(prefix, image.image.Repository)
+	}
+	if host == "" {
+		return "", ""
+	}
+	return host, fmt.Sprintf("%s/%s@%s", host, repository, image.digest)
+}
+
+// checkImported reports the images whose digest the internal registry doesn't serve yet,
+// returning the exit code: 1 when a digest is missing, 2 when one could not be checked
+func checkImported(w io.Writer, images []airgapImage, cfg *Config, internal string) int {
+	updater := NewContainerfileUpdaterWithConfig("", cfg)
+	runCtx, cancelRun := updater.runContext()
+	defer cancelRun()
+
+	exitCode := exitOK
+	missing := 0
+	for _, image := range images {
+		host, ref := updater.importedImage(image, internal)
+		if host == "" {
+			slog.Error("No internal registry to check, pass --registry or configure a mirror", "image", image.key)
+			exitCode = exitError
+			continue
+		}
+		ctx, cancel, err := updater.lookupContext(runCtx, host)
+		if err == nil {
+			_, err = updater.resolveDigest(ctx, host, ref)
+			cancel()
+		}
+		switch {
+		case err == nil:
+			slog.Debug("Digest imported", "image", image.key, "reference", ref)
+		case isNotFound(err):
+			fmt.Fprintf(w, "missing %s (%s)\n", ref, image.key)
+			missing++
+			exitCode = max(exitCode, exitUpdatesNeeded)
+		default:
+			slog.Error("Failed to check internal registry", "image", image.key, "reference", ref, "error", err)
+			exitCode = exitError
+		}
+	}
+
+	if missing > 0 {
+		fmt.Fprintf(w, "\n%d of %d digests not imported yet\n", missing, len(images))
+	} else if exitCode == exitOK {
+		fmt.Fprintf(w, "All %d digests imported\n", len(images))
+	}
+	return exitCode
+}
+
+// runImportCheck implements the import-check subcommand
+func runImportCheck(args []string) int {
+	fs := flag.NewFlagSet("import-check", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	digestFile := fs.String("digest-file", "", "Check the digests recorded by export-digests instead of resolving the tags")
+	internal := fs.String("registry", "", "Internal registry (host with optional path prefix) the images were imported into (defaults to each registry's mirror)")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also check the frontend image of # syntax= directives")
+	scanRun := fs.Bool("scan-run", false, "Also check images pulled inside RUN instructions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import-check [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Check that the internal registry serves the digest of every image before the files are")
+		fmt.Fprintln(fs.Output(), "pinned to it.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = every digest imported, 1 = a digest is missing, 2 = a digest could not be resolved or checked")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("info"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+	if *internal != "" {
+		if err := validateMirror(*internal); err != nil {
+			slog.Error("Invalid --registry", "error", err)
+			return exitError
+		}
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to update", "error", err)
+		return exitError
+	}
+	digests, err := loadOptionalDigestFile(*digestFile)
+	if err != nil {
+		slog.Error("Failed to load digest file", "error", err)
+		return exitError
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+
+	images, ok := resolveAirgapImages(paths, cfg, *format, *pinSyntax, digests)
+	exitCode := checkImported(os.Stdout, images, cfg, *internal)
+	if !ok {
+		exitCode = exitError
+	}
+	return exitCode
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestAirgapExportAndImportCheck(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	_, internalHost := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/team/app:1.0")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM "+host+"/team/app:1.0\nFROM "+host+"/team/app:1.0 AS again\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.RegistryOrCreate(internalHost).Insecure = true
+
+	images, ok := resolveAirgapImages([]string{path}, cfg, formatAuto, false, nil)
+	if !ok || len(images) != 1 {
+		t.Fatalf("Expected one resolved image, got %d (ok=%t)", len(images), ok)
+	}
+	var list bytes.Buffer
+	writeImageList(&list, images)
+	if expected := host + "/team/app:1.0@" + digest.String() + "\n"; list.String() != expected {
+		t.Errorf("Expected list %q, got %q", expected, list.String())
+	}
+
+	// Digest files take precedence over the registries
+	recorded := &DigestFile{Version: digestFileVersion, Digests: map[string]string{host + "/team/app:1.0": "sha256:" + strings.Repeat("a", 64)}}
+	if images, _ := resolveAirgapImages([]string{path}, cfg, formatAuto, false, recorded); len(images) != 1 || images[0].digest != recorded.Digests[host+"/team/app:1.0"] {
+		t.Errorf("Expected the recorded digest, got %+v", images)
+	}
+
+	layoutDir := filepath.Join(dir, "layout")
+	if err := writeOCILayout(layoutDir, images, cfg); err != nil {
+		t.Fatal(err)
+	}
+	layoutPath, err := layout.FromPath(layoutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := layoutPath.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Manifests) != 1 || manifest.Manifests[0].Digest != digest || manifest.Manifests[0].Annotations[ociRefNameAnnotation] != host+"/team/app:1.0" {
+		t.Fatalf("Unexpected layout index %+v", manifest.Manifests)
+	}
+
+	// Nothing imported yet
+	var out bytes.Buffer
+	if exitCode := checkImported(&out, images, cfg, internalHost+"/mirror"); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d:\n%s", exitUpdatesNeeded, exitCode, out.String())
+	}
+	if !strings.Contains(out.String(), "missing "+internalHost+"/mirror/team/app@"+digest.String()) {
+		t.Errorf("Missing digest not reported:\n%s", out.String())
+	}
+
+	// Import the layout, as the air-gapped side would
+	img, err := layoutPath.Image(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(internalHost+"/mirror/team/app:1.0", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if exitCode := checkImported(&out, images, cfg, internalHost+"/mirror"); exitCode != exitOK {
+		t.Fatalf("Expected exit code %d, got %d:\n%s", exitOK, exitCode, out.String())
+	}
+
+	// Without --registry the configured mirror is checked
+	if exitCode := checkImported(&out, images, cfg, ""); exitCode != exitError {
+		t.Errorf("Expected exit code %d without an internal registry, got %d", exitError, exitCode)
+	}
+	cfg.RegistryOrCreate(host).Mirror = internalHost + "/mirror"
+	if exitCode := checkImported(&out, images, cfg, ""); exitCode != exitOK {
+		t.Errorf("Expected exit code %d with a mirror, got %d", exitOK, exitCode)
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// annotationPrefix marks comments carrying per-image directives, e.g.
+//
+//	# containerfile-updater: ignore
+//	FROM internal.corp/base:stable
+const annotationPrefix = "containerfile-updater:"
+
+// Pin modes controlling how a resolved image reference is written
+const (
+	pinDigest    = "digest"     // repository@digest (default)
+	pinTagDigest = "tag-digest" // repository:tag@digest
+	pinTagOnly   = "tag-only"   // repository:tag, never pinned to a digest
+)
+
+// ImageAnnotations holds directives parsed from the comments preceding a FROM instruction
+type ImageAnnotations struct {
+	Ignore bool   // Leave the image untouched
+	Pin    string // Pin mode (digest, tag-digest or tag-only)
+	Track  string // Tag whose digest is pinned instead of the written tag's
+}
+
+// parseAnnotations extracts containerfile-updater directives from the comments
+// BuildKit attaches to an instruction. Other comments are ignored.
+func parseAnnotations(comments []string) (*ImageAnnotations, error) {
+	annotations := &ImageAnnotations{}
+
+	for _, comment := range comments {
+		directives, ok := strings.CutPrefix(strings.TrimSpace(comment), annotationPrefix)
+		if !ok {
+			continue
+		}
+
+		for _, directive := range strings.FieldsFunc(directives, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			key, value, _ := strings.Cut(directive, "=")
+			switch strings.ToLower(key) {
+			case "ignore":
+				annotations.Ignore = true
+			case "pin":
+				switch value {
+				case pinDigest, pinTagDigest, pinTagOnly:
+					annotations.Pin = value
+				default:
+					return nil, fmt.Errorf("unknown pin mode %q (expected digest, tag-digest or tag-only)", value)
+				}
+			case "track":
+				if !tagPattern.MatchString(value) {
+					return nil, fmt.Errorf("invalid tracking tag %q", value)
+				}
+				annotations.Track = value
+			default:
+				return nil, fmt.Errorf("unknown directive %q", directive)
+			}
+		}
+	}
+
+	return annotations, nil
+}
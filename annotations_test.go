@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments []string
+		expected ImageAnnotations
+		wantErr  bool
+	}{
+		{name: "No comments", comments: nil, expected: ImageAnnotations{}},
+		{name: "Unrelated comments", comments: []string{"Base image for the build"}, expected: ImageAnnotations{}},
+		{name: "Ignore", comments: []string{"containerfile-updater: ignore"}, expected: ImageAnnotations{Ignore: true}},
+		{name: "Pin mode", comments: []string{"Runtime image", "containerfile-updater: pin=tag-only"}, expected: ImageAnnotations{Pin: pinTagOnly}},
+		{name: "Multiple directives", comments: []string{"containerfile-updater: pin=tag-digest, ignore"}, expected: ImageAnnotations{Ignore: true, Pin: pinTagDigest}},
+		{name: "Tracking tag", comments: []string{"containerfile-updater: track=stable pin=tag-digest"}, expected: ImageAnnotations{Pin: pinTagDigest, Track: "stable"}},
+		{name: "Invalid tracking tag", comments: []string{"containerfile-updater: track=:stable"}, wantErr: true},
+		{name: "Unknown pin mode", comments: []string{"containerfile-updater: pin=semver"}, wantErr: true},
+		{name: "Unknown directive", comments: []string{"containerfile-updater: skip"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			annotations, err := parseAnnotations(tt.comments)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if *annotations != tt.expected {
+				t.Errorf("Annotations: got %+v, want %+v", *annotations, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnnotatedContainerfileReconstruction(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	originalContent := `# containerfile-updater: ignore
+FROM internal.corp/base:stable AS base
+
+# containerfile-updater: pin=tag-digest
+FROM ubuntu:20.04 AS build
+
+# containerfile-updater: pin=tag-only
+FROM alpine@sha256:0000000000000000000000000000000000000000000000000000000000000000 AS tools
+
+FROM stagex/core-filesystem:latest
+`
+
+	expectedContent := `# containerfile-updater: ignore
+FROM internal.corp/base:stable AS base
+
+# containerfile-updater: pin=tag-digest
+FROM library/ubuntu:20.04@sha256:test-digest AS build
+
+# containerfile-updater: pin=tag-only
+FROM alpine:latest AS tools
+
+FROM stagex/core-filesystem@sha256:test-digest
+`
+
+	tmpDir := t.TempDir()
+	containerfilePath := filepath.Join(tmpDir, "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to create test containerfile: %v", err)
+	}
+
+	updater := NewContainerfileUpdater(containerfilePath)
+	result, err := updater.parseContainerfile()
+	if err != nil {
+		t.Fatalf("Failed to parse containerfile: %v", err)
+	}
+
+	fromCommands, err := updater.extractFromCommands(result.AST)
+	if err != nil {
+		t.Fatalf("Failed to extract FROM commands: %v", err)
+	}
+	updater.fromCommands = fromCommands
+
+	if len(fromCommands) != 4 {
+		t.Fatalf("Expected 4 FROM commands, got %d", len(fromCommands))
+	}
+	if fromCommands[0].SkipReason == "" {
+		t.Error("Expected ignored image to be skipped")
+	}
+
+	for _, cmd := range fromCommands {
+		if cmd.SkipReason == "" {
+			cmd.Image.Digest = "sha256:test-digest"
+		}
+	}
+
+	if err := updater.reconstructAndWriteContainerfile(fromCommands); err != nil {
+		t.Fatalf("Failed to reconstruct containerfile: %v", err)
+	}
+
+	updatedContent, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read updated containerfile: %v", err)
+	}
+	if strings.TrimSpace(string(updatedContent)) != strings.TrimSpace(expectedContent) {
+		t.Errorf("Containerfile content mismatch.\nExpected:\n%s\n\nGot:\n%s", expectedContent, updatedContent)
+	}
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// argReference matches a FROM image that is nothing but a build argument: $NAME or ${NAME}
+var argReference = regexp.MustCompile(`^\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)\})$`)
+
+// BaseArg is an image build argument defined in a base file, the single source of truth
+// for the Containerfiles that declare the same argument
+type BaseArg struct {
+	Name  string
+	Value string // Image reference the argument defaults to
+	Path  string // Base file defining the argument
+	Line  int
+}
+
+// argDefinition is one NAME=value pair of an ARG instruction
+type argDefinition struct {
+	name  string
+	value string
+}
+
+// argDefinitions returns the arguments of an ARG instruction that have a default value,
+// with surrounding quotes removed
+func argDefinitions(node *parser.Node) []argDefinition {
+	var definitions []argDefinition
+	for next := node.Next; next != nil; next = next.Next {
+		key, value, ok := strings.Cut(next.Value, "=")
+		if !ok {
+			continue
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		definitions = append(definitions, argDefinition{name: key, value: value})
+	}
+	return definitions
+}
+
+// globalArgs returns the ARG instructions before the first FROM, the only ones a FROM can use
+func globalArgs(ast *parser.Node) []*parser.Node {
+	var args []*parser.Node
+	for _, node := range ast.Children {
+		if strings.EqualFold(node.Value, "from") {
+			break
+		}
+		if strings.EqualFold(node.Value, "arg") {
+			args = append(args, node)
+		}
+	}
+	return args
+}
+
+// argImageName returns the build argument a FROM image consists of, if it is one
+func argImageName(image string) (string, bool) {
+	match := argReference.FindStringSubmatch(image)
+	if match == nil {
+		return "", false
+	}
+	return match[1] + match[2], true
+}
+
+// looksLikeImage reports whether a build argument value is an image reference. A tag,
+// digest or repository path is required, so version numbers are not mistaken for images.
+func looksLikeImage(value string) bool {
+	if value == "" || strings.ContainsAny(value, "$ \t") || !strings.ContainsAny(value, ":/@") {
+		return false
+	}
+	_, err := name.ParseReference(value)
+	return err == nil
+}
+
+// loadBaseArgs reads the image build arguments defined in the base files, keyed by name
+func loadBaseArgs(paths []string) (map[string]*BaseArg, error) {
+	args := make(map[string]*BaseArg)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read base file: %w", err)
+		}
+		result, err := parseDockerfile(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse base file %s: %w", path, err)
+		}
+		for _, node := range globalArgs(result.AST) {
+			for _, definition := range argDefinitions(node) {
+				if !looksLikeImage(definition.value) {
+					continue
+				}
+				if existing, ok := args[definition.name]; ok {
+					return nil, fmt.Errorf("build argument %s is defined in both %s and %s", definition.name, existing.Path, path)
+				}
+				args[definition.name] = &BaseArg{Name: definition.name, Value: definition.value, Path: path, Line: node.StartLine}
+			}
+		}
+	}
+	return args, nil
+}
+
+// isBaseFile reports whether a path is one of the configured base files
+func isBaseFile(path string, baseFiles []string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, baseFile := range baseFiles {
+		if baseAbs, err := filepath.Abs(baseFile); err == nil && baseAbs == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArgImages returns the images set as defaults of global build arguments that a
+// FROM instruction consists of. In a base file every global build argument holding an
+// image is returned, as the Containerfiles using it live elsewhere. Arguments defined in
+// a base file are skipped in other files; the base file is where they are updated.
+func (du *ContainerfileUpdater) extractArgImages(ast *parser.Node) ([]*FromCommand, error) {
+	used := make(map[string]bool)
+	for _, node := range ast.Children {
+		if strings.EqualFold(node.Value, "from") && node.Next != nil {
+			if arg, ok := argImageName(node.Next.Value); ok {
+				used[arg] = true
+			}
+		}
+	}
+	baseFile := isBaseFile(du.containerfilePath, du.config.BaseFiles)
+
+	data, err := du.readContent()
+	if err != nil {
+		return nil, err
+	}
+	lines, _ := splitLines(string(data))
+
+	var images []*FromCommand
+	for _, node := range globalArgs(ast) {
+		annotations, err := parseAnnotations(node.PrevComment)
+		if err != nil {
+			slog.Warn("Ignoring invalid annotation comment", "prefix", annotationPrefix, "line", node.StartLine, "error", err)
+			annotations = &ImageAnnotations{}
+		}
+
+		for _, definition := range argDefinitions(node) {
+			if !(baseFile || used[definition.name]) || !looksLikeImage(definition.value) {
+				continue
+			}
+			lineNumber, start := argValueOffset(lines, node, definition)
+			if start < 0 {
+				slog.Debug("Could not locate build argument value", "line", node.StartLine, "arg", definition.name)
+				continue
+			}
+			image, err := du.parseImageReference(definition.value)
+			if err != nil {
+				slog.Warn("Failed to parse build argument image", "arg", definition.name, "error", err)
+				continue
+			}
+
+			slog.Debug("Found image in build argument", "line", lineNumber, "arg", definition.name, "image", definition.value)
+			cmd := &FromCommand{
+				Node:        node,
+				Image:       image,
+				LineStart:   lineNumber,
+				LineEnd:     lineNumber,
+				Arg:         definition.name,
+				Annotations: annotations,
+				editor:      spanEditor(start),
+			}
+			if base, ok := du.baseArgs[definition.name]; ok && !baseFile {
+				cmd.Base = base
+				cmd.SkipReason = fmt.Sprintf("set by base file %s", base.Path)
+			}
+			du.applySkipRules(cmd)
+			images = append(images, cmd)
+		}
+	}
+	return images, nil
+}
+
+// argValueOffset finds the line and byte offset of a build argument's value within the
+// lines of its ARG instruction, returning -1 if it cannot be found
+func argValueOffset(lines []string, node *parser.Node, definition argDefinition) (int, int) {
+	for lineNumber := node.StartLine; lineNumber <= node.EndLine && lineNumber <= len(lines); lineNumber++ {
+		line := lines[lineNumber-1]
+		for _, span := range fieldSpans(line) {
+			field := line[span[0]:span[1]]
+			if !strings.HasPrefix(field, definition.name+"=") {
+				continue
+			}
+			start := span[0] + len(definition.name) + 1
+			if start < len(line) && (line[start] == '"' || line[start] == '\'') {
+				start++
+			}
+			if strings.HasPrefix(line[start:], definition.value) {
+				return lineNumber, start
+			}
+		}
+	}
+	return 0, -1
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArgImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/app:1.0")
+
+	content := strings.Join([]string{
+		`ARG BASE_IMAGE="` + host + `/app:1.0"`,
+		"ARG VERSION=1.2 UNUSED=" + host + "/app:1.0",
+		"FROM ${BASE_IMAGE} AS build",
+		"FROM $BASE_IMAGE",
+		"",
+	}, "\n")
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(updater.fromCommands) != 1 {
+		t.Fatalf("Expected only the build argument used by FROM, got %d images", len(updater.fromCommands))
+	}
+
+	data, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	want := strings.Replace(content, `"`+host+`/app:1.0"`, `"`+host+`/app@`+digest.String()+`"`, 1)
+	if string(data) != want {
+		t.Errorf("Unexpected content:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestBaseFiles(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/golang:1.24")
+
+	dir := t.TempDir()
+	basePath := filepath.Join(dir, "base.Containerfile")
+	if err := os.WriteFile(basePath, []byte("ARG GO_IMAGE="+host+"/golang:1.24\nARG GO_VERSION=1.24\n"), 0644); err != nil {
+		t.Fatalf("Failed to write base file: %v", err)
+	}
+	consumer := "ARG GO_IMAGE=" + host + "/golang:1.24\nFROM ${GO_IMAGE}\n"
+	consumerPath := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(consumerPath, []byte(consumer), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.BaseFiles = []string{basePath}
+
+	// The base file is updated although nothing in it uses the argument
+	base := NewContainerfileUpdaterWithConfig(basePath, cfg)
+	if err := base.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	pinned := host + "/golang@" + digest.String()
+	data, err := os.ReadFile(basePath)
+	if err != nil {
+		t.Fatalf("Failed to read base file: %v", err)
+	}
+	if want := "ARG GO_IMAGE=" + pinned + "\nARG GO_VERSION=1.24\n"; string(data) != want {
+		t.Errorf("Unexpected base file:\n%s\nwant:\n%s", data, want)
+	}
+
+	// Consumers leave the argument to the base file
+	updater := NewContainerfileUpdaterWithConfig(consumerPath, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if reason := updater.fromCommands[0].SkipReason; !strings.Contains(reason, "base file") {
+		t.Errorf("Expected the consumer's argument to be skipped, got %q", reason)
+	}
+	if data, _ := os.ReadFile(consumerPath); string(data) != consumer {
+		t.Errorf("Consumer was rewritten:\n%s", data)
+	}
+
+	// Verifying consumers reports defaults that drifted from the base file
+	verifier := NewContainerfileUpdaterWithConfig(consumerPath, cfg)
+	verifier.checkConsumers = true
+	results, err := verifier.VerifyPinnedDigests()
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != verifyDrift {
+		t.Fatalf("Expected drift, got %+v", results)
+	}
+	if code := verifyExitCode(results); code != exitUpdatesNeeded {
+		t.Errorf("Exit code: got %d, want %d", code, exitUpdatesNeeded)
+	}
+
+	if err := os.WriteFile(consumerPath, []byte("ARG GO_IMAGE="+pinned+"\nFROM ${GO_IMAGE}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	results, err = verifier.VerifyPinnedDigests()
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != verifyOK {
+		t.Errorf("Expected the consumer to match, got %+v", results)
+	}
+}
+
+func TestLoadBaseArgsDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, file := range []string{"a.Containerfile", "b.Containerfile"} {
+		path := filepath.Join(dir, file)
+		if err := os.WriteFile(path, []byte("ARG BASE=alpine:3.20\n"), 0644); err != nil {
+			t.Fatalf("Failed to write base file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	if _, err := loadBaseArgs(paths); err == nil {
+		t.Error("Expected an error for an argument defined in two base files")
+	}
+	if _, err := loadBaseArgs([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("Expected an error for a missing base file")
+	}
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Attestation kinds that can be required before an update is applied
+const (
+	attestationSBOM       = "sbom"
+	attestationProvenance = "provenance"
+)
+
+// Annotations carrying the in-toto predicate type of an attestation layer or artifact
+var predicateTypeAnnotations = []string{
+	"in-toto.io/predicate-type",         // BuildKit attestation manifests
+	"predicateType",                     // cosign attest (.att tags)
+	"dev.sigstore.bundle.predicateType", // Sigstore bundles attached as referrers
+}
+
+// AttestationConfig holds the attestation requirements for candidate digests
+type AttestationConfig struct {
+	Require []string `yaml:"require"` // Attestation kinds a new digest must carry (sbom, provenance)
+}
+
+// validateAttestationKinds rejects attestation kinds that can't be checked
+func validateAttestationKinds(kinds []string) error {
+	for _, kind := range kinds {
+		switch kind {
+		case attestationSBOM, attestationProvenance:
+		default:
+			return fmt.Errorf("unknown attestation kind %q (expected %s or %s)", kind, attestationSBOM, attestationProvenance)
+		}
+	}
+	return nil
+}
+
+// classifyAttestation maps an artifact, media or predicate type to an attestation kind
+func classifyAttestation(value string) string {
+	value = strings.ToLower(value)
+	switch {
+	case strings.Contains(value, "spdx"), strings.Contains(value, "cyclonedx"), strings.Contains(value, "syft"):
+		return attestationSBOM
+	case strings.Contains(value, "slsa.dev/provenance"), strings.Contains(value, "provenance"):
+		return attestationProvenance
+	}
+	return ""
+}
+
+// checkAttestations holds back an update whose candidate digest lacks a required
+// attestation. It returns the reason the update was held, or an empty string.
+func (du *ContainerfileUpdater) checkAttestations(ctx context.Context, cmd *FromCommand, digest string) string {
+	required := du.config.Attestations.Require
+	if len(required) == 0 {
+		return ""
+	}
+
+	found, err := du.discoverAttestations(ctx, cmd.Image, digest)
+	if err != nil {
+		return fmt.Sprintf("could not check attestations: %v", err)
+	}
+	cmd.Attestations = found
+
+	cmd.MissingAttestations = nil
+	for _, kind := range required {
+		if !slices.Contains(found, kind) {
+			cmd.MissingAttestations = append(cmd.MissingAttestations, kind)
+		}
+	}
+	if len(cmd.MissingAttestations) > 0 {
+		return "missing attestations: " + strings.Join(cmd.MissingAttestations, ", ")
+	}
+	return ""
+}
+
+// discoverAttestations returns the attestation kinds attached to a digest, looking at
+// OCI referrers, cosign's .sbom/.att tags and BuildKit attestation manifests
+func (du *ContainerfileUpdater) discoverAttestations(ctx context.Context, image *ImageReference, digest string) ([]string, error) {
+	options, err := du.remoteOptions(ctx, image.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := name.NewDigest(image.Name()+"@"+digest, referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reference %s@%s: %w", image.Name(), digest, err)
+	}
+
+	kinds := make(map[string]bool)
+
+	// OCI referrers API, falling back to the sha256-<hex> tag schema
+	referrers, err := remote.Referrers(ref, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list referrers: %w", err)
+	}
+	manifest, err := referrers.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read referrers: %w", err)
+	}
+	for _, desc := range manifest.Manifests {
+		if kind := classifyDescriptor(desc); kind != "" {
+			kinds[kind] = true
+		}
+	}
+
+	// cosign attach sbom and cosign attest conventions
+	cosignTag := strings.Replace(digest, ":", "-", 1)
+	if _, err := remote.Head(ref.Context().Tag(cosignTag+".sbom"), options...); err == nil {
+		kinds[attestationSBOM] = true
+	} else if !isNotFound(err) {
+		return nil, fmt.Errorf("failed to check cosign SBOM: %w", err)
+	}
+	if err := collectLayerAttestations(ref.Context().Tag(cosignTag+".att"), kinds, options); err != nil {
+		return nil, fmt.Errorf("failed to check cosign attestations: %w", err)
+	}
+
+	// BuildKit stores attestation manifests alongside the platform images in the index
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", ref, err)
+		}
+		indexManifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", ref, err)
+		}
+		for _, child := range indexManifest.Manifests {
+			if child.Annotations["vnd.docker.reference.type"] != "attestation-manifest" {
+				continue
+			}
+			if err := collectLayerAttestations(ref.Context().Digest(child.Digest.String()), kinds, options); err != nil {
+				return nil, fmt.Errorf("failed to check attestation manifest: %w", err)
+			}
+		}
+	}
+
+	var result []string
+	for kind := range kinds {
+		result = append(result, kind)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// classifyDescriptor determines the attestation kind of a referrer descriptor
+func classifyDescriptor(desc v1.Descriptor) string {
+	for _, key := range predicateTypeAnnotations {
+		if kind := classifyAttestation(desc.Annotations[key]); kind != "" {
+			return kind
+		}
+	}
+	if kind := classifyAttestation(desc.ArtifactType); kind != "" {
+		return kind
+	}
+	return classifyAttestation(string(desc.MediaType))
+}
+
+// collectLayerAttestations records the attestation kinds of an attestation image's
+// layers. A missing image simply means there is nothing attached.
+func collectLayerAttestations(ref name.Reference, kinds map[string]bool, options []remote.Option) error {
+	img, err := remote.Image(ref, options...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	for _, layer := range manifest.Layers {
+		if kind := classifyDescriptor(layer); kind != "" {
+			kinds[kind] = true
+		}
+	}
+	return nil
+}
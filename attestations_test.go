@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestClassifyAttestation(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"application/spdx+json", attestationSBOM},
+		{"application/vnd.cyclonedx+json", attestationSBOM},
+		{"https://spdx.dev/Document", attestationSBOM},
+		{"https://slsa.dev/provenance/v1", attestationProvenance},
+		{"application/vnd.dev.sigstore.bundle.v0.3+json", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := classifyAttestation(tt.value); got != tt.want {
+			t.Errorf("classifyAttestation(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAttestationKinds(t *testing.T) {
+	if err := validateAttestationKinds([]string{"sbom", "provenance"}); err != nil {
+		t.Errorf("Expected valid kinds, got %v", err)
+	}
+	if err := validateAttestationKinds([]string{"signature"}); err == nil {
+		t.Error("Expected error for unknown attestation kind")
+	}
+}
+
+// pushAttestation pushes an attestation image with one annotated layer
+func pushAttestation(t *testing.T, server *httptest.Server, ref name.Reference, annotations map[string]string, subject *v1.Descriptor, configType types.MediaType) {
+	t.Helper()
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer([]byte(`{}`), "application/vnd.in-toto+json"),
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build attestation: %v", err)
+	}
+	if configType != "" {
+		img = mutate.ConfigMediaType(img, configType)
+	}
+	if subject != nil {
+		img = mutate.Subject(img, *subject).(v1.Image)
+	}
+
+	if err := remote.Write(ref, img, remote.WithTransport(server.Client().Transport)); err != nil {
+		t.Fatalf("Failed to push attestation: %v", err)
+	}
+}
+
+// subjectDescriptor returns the descriptor of an image already in the test registry
+func subjectDescriptor(t *testing.T, server *httptest.Server, reference string) *v1.Descriptor {
+	t.Helper()
+
+	ref, err := name.ParseReference(reference, name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	desc, err := remote.Get(ref, remote.WithTransport(server.Client().Transport))
+	if err != nil {
+		t.Fatalf("Failed to fetch subject: %v", err)
+	}
+	return &desc.Descriptor
+}
+
+func TestDiscoverAttestations(t *testing.T) {
+	server, host := newTestRegistry(t, false)
+	bare := pushRandomImage(t, server, host+"/app:bare")
+	cosign := pushRandomImage(t, server, host+"/app:cosign")
+	referred := pushRandomImage(t, server, host+"/app:referred")
+
+	repo, err := name.NewRepository(host+"/app", name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse repository: %v", err)
+	}
+	cosignTag := strings.Replace(cosign.String(), ":", "-", 1)
+	pushAttestation(t, server, repo.Tag(cosignTag+".sbom"), nil, nil, "")
+	pushAttestation(t, server, repo.Tag(cosignTag+".att"), map[string]string{"predicateType": "https://slsa.dev/provenance/v0.2"}, nil, "")
+	pushAttestation(t, server, repo.Tag("spdx"), nil, subjectDescriptor(t, server, host+"/app:referred"), "application/spdx+json")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig("", cfg)
+	image := &ImageReference{Registry: host, Repository: "app", Tag: "bare"}
+
+	tests := []struct {
+		name   string
+		digest v1.Hash
+		want   []string
+	}{
+		{"none", bare, nil},
+		{"cosign", cosign, []string{attestationProvenance, attestationSBOM}},
+		{"referrers", referred, []string{attestationSBOM}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := du.discoverAttestations(t.Context(), image, tt.digest.String())
+			if err != nil {
+				t.Fatalf("discoverAttestations failed: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected attestations %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRequiredAttestationsHoldUpdates(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/plain:v1")
+	attested := pushRandomImage(t, server, host+"/attested:v1")
+
+	repo, err := name.NewRepository(host+"/attested", name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse repository: %v", err)
+	}
+	cosignTag := strings.Replace(attested.String(), ":", "-", 1)
+	pushAttestation(t, server, repo.Tag(cosignTag+".att"), map[string]string{"predicateType": "https://slsa.dev/provenance/v1"}, nil, "")
+
+	content := "FROM " + host + "/plain:v1\nFROM " + host + "/attested:v1\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Attestations.Require = []string{attestationProvenance}
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if lines[0] != "FROM "+host+"/plain:v1" {
+		t.Errorf("Expected unattested image to be left alone, got %q", lines[0])
+	}
+	if lines[1] != "FROM "+host+"/attested@"+attested.String() {
+		t.Errorf("Expected attested image to be pinned, got %q", lines[1])
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, du.Report()); err != nil {
+		t.Fatalf("writeJSONReport failed: %v", err)
+	}
+	var report RunReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if len(report.Images) != 2 {
+		t.Fatalf("Expected 2 images in report, got %d", len(report.Images))
+	}
+	if got := report.Images[0].MissingAttestations; len(got) != 1 || got[0] != attestationProvenance {
+		t.Errorf("Expected missing provenance in report, got %v", got)
+	}
+	if report.Images[0].Held == "" || report.Images[0].Changed {
+		t.Errorf("Expected held, unchanged image in report, got %+v", report.Images[0])
+	}
+	if !report.Images[1].Changed || len(report.Images[1].MissingAttestations) != 0 {
+		t.Errorf("Expected attested image to change, got %+v", report.Images[1])
+	}
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Credential sources recorded in the audit log besides the config and environment ones
+const (
+	credentialsAnonymous    = "anonymous"
+	credentialsCloud        = "cloud"
+	credentialsDockerConfig = "docker-config"
+	credentialsPlugin       = "plugin"
+)
+
+// AuditRecord is one registry interaction in the audit log. Credentials are described by
+// where they came from, never by their value.
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Reference   string    `json:"reference,omitempty"`
+	Registry    string    `json:"registry"`
+	Method      string    `json:"method"`
+	Endpoint    string    `json:"endpoint"`
+	Status      int       `json:"status,omitempty"`
+	Digest      string    `json:"digest,omitempty"`
+	DurationMS  int64     `json:"durationMs"`
+	Credentials string    `json:"credentials"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// AuditLog appends a JSON line per registry interaction to a file. A nil *AuditLog
+// records nothing.
+type AuditLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	sources map[string]string // Credential sources already looked up, keyed by registry
+}
+
+// OpenAuditLog opens an audit log for appending, creating it if needed
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{file: file, sources: make(map[string]string)}, nil
+}
+
+// Close closes the audit log file
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// record appends a record, logging rather than failing the run when it can't be written
+func (a *AuditLog) record(record AuditRecord) {
+	if a == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		slog.Warn("Failed to write audit log", "path", a.file.Name(), "error", err)
+	}
+}
+
+// credentials returns where the credentials for a registry come from, looking them up once
+func (a *AuditLog) credentials(registry string, lookup func() string) string {
+	if a == nil {
+		return ""
+	}
+	a.mu.Lock()
+	source, ok := a.sources[registry]
+	a.mu.Unlock()
+	if ok {
+		return source
+	}
+	source = lookup()
+	a.mu.Lock()
+	a.sources[registry] = source
+	a.mu.Unlock()
+	return source
+}
+
+// auditCredentials returns where the credentials sent to a registry come from, looked up
+// only when an audit log is written
+func (du *ContainerfileUpdater) auditCredentials(registry string) string {
+	return du.audit.credentials(registry, func() string {
+		target, err := name.NewRegistry(registry, referenceOptions(du.config, registry)...)
+		if err != nil {
+			return credentialsAnonymous
+		}
+		return credentialSource(du.config, target)
+	})
+}
+
+// wrapTransport records every request sent through a registry's transport
+func (a *AuditLog) wrapTransport(registry, credentials string, next http.RoundTripper) http.RoundTripper {
+	if a == nil {
+		return next
+	}
+	return &auditTransport{log: a, registry: registry, credentials: credentials, next: next}
+}
+
+// auditTransport records requests in the audit log
+type auditTransport struct {
+	log         *AuditLog
+	registry    string
+	credentials string
+	next        http.RoundTripper
+}
+
+// RoundTrip forwards the request and records its outcome and duration
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	record := AuditRecord{
+		Time:        start.UTC(),
+		Reference:   auditReference(req),
+		Registry:    t.registry,
+		Method:      req.Method,
+		Endpoint:    req.URL.Redacted(),
+		DurationMS:  time.Since(start).Milliseconds(),
+		Credentials: t.credentials,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Status = resp.StatusCode
+		record.Digest = resp.Header.Get("Docker-Content-Digest")
+	}
+	t.log.record(record)
+	return resp, err
+}
+
+// auditReferenceKey is the context key of the image reference requests are made for
+type auditReferenceKey struct{}
+
+// withAuditReference attributes the registry requests made with a context to an image
+// reference as written in a file
+func withAuditReference(ctx context.Context, reference string) context.Context {
+	return context.WithValue(ctx, auditReferenceKey{}, reference)
+}
+
+// auditReference returns the image reference a request was made for, falling back to the
+// repository and tag or digest in its distribution API path
+func auditReference(req *http.Request) string {
+	if reference, ok := req.Context().Value(auditReferenceKey{}).(string); ok {
+		return reference
+	}
+	path, ok := strings.CutPrefix(req.URL.Path, "/v2/")
+	if !ok {
+		return ""
+	}
+	for _, endpoint := range []string{"/manifests/", "/blobs/", "/referrers/", "/tags/"} {
+		repository, rest, found := strings.Cut(path, endpoint)
+		if !found {
+			continue
+		}
+		switch {
+		case endpoint == "/tags/":
+			return req.URL.Host + "/" + repository
+		case strings.HasPrefix(rest, "sha256:"), endpoint != "/manifests/":
+			return req.URL.Host + "/" + repository + "@" + rest
+		default:
+			return req.URL.Host + "/" + repository + ":" + rest
+		}
+	}
+	return ""
+}
+
+// recordCommand records a lookup made by running a command rather than an HTTP request
+func (a *AuditLog) recordCommand(ctx context.Context, registry, method, endpoint, credentials string, start time.Time, digest string, err error) {
+	if a == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:        start.UTC(),
+		Registry:    registry,
+		Method:      method,
+		Endpoint:    endpoint,
+		Digest:      digest,
+		DurationMS:  time.Since(start).Milliseconds(),
+		Credentials: credentials,
+	}
+	if reference, ok := ctx.Value(auditReferenceKey{}).(string); ok {
+		record.Reference = reference
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	a.record(record)
+}
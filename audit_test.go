@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	server, host := newTestRegistry(t, false)
+	defer server.Close()
+	digest := pushRandomImage(t, server, host+"/app:1.0")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	content := "FROM " + host + "/app:1.0\nFROM " + host + "/app:missing\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "audit.jsonl")
+	// Runs append to an existing log
+	if err := os.WriteFile(logPath, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	audit, err := OpenAuditLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, checkOnly: true, audit: audit, out: io.Discard}
+	run.run()
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) < 3 || records[0] != (AuditRecord{}) {
+		t.Fatalf("Expected the existing line followed by the run's records, got %+v", records)
+	}
+
+	var found, missing bool
+	for _, record := range records[1:] {
+		if record.Registry != host || record.Credentials != credentialsAnonymous || record.Endpoint == "" || record.Time.IsZero() {
+			t.Errorf("Incomplete audit record: %+v", record)
+		}
+		switch record.Reference {
+		case host + "/app:1.0":
+			found = found || record.Status == http.StatusOK && record.Digest == digest.String()
+		case host + "/app:missing":
+			missing = missing || record.Status == http.StatusNotFound
+		}
+	}
+	if !found || !missing {
+		t.Errorf("Expected the lookup of app:1.0 and the 404 of app:missing, got %+v", records[1:])
+	}
+}
+
+func TestAuditReference(t *testing.T) {
+	tests := map[string]string{
+		"https://ghcr.io/v2/org/app/manifests/1.0":              "ghcr.io/org/app:1.0",
+		"https://ghcr.io/v2/org/app/manifests/sha256:abc":       "ghcr.io/org/app@sha256:abc",
+		"https://ghcr.io/v2/org/app/blobs/sha256:abc":           "ghcr.io/org/app@sha256:abc",
+		"https://ghcr.io/v2/org/app/tags/list?n=1000":           "ghcr.io/org/app",
+		"https://ghcr.io/token?scope=repository:org/app:pull":   "",
+		"https://quay.io/api/v1/repository/org/app/tag/?page=1": "",
+	}
+	for rawURL, want := range tests {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &http.Request{URL: u}
+		if got := auditReference(req); got != want {
+			t.Errorf("auditReference(%s) = %q, want %q", rawURL, got, want)
+		}
+	}
+
+	req, _ := http.NewRequestWithContext(withAuditReference(t.Context(), "app:1.0"), http.MethodGet, "https://ghcr.io/v2/", nil)
+	if got := auditReference(req); got != "app:1.0" {
+		t.Errorf("Expected the reference from the context, got %q", got)
+	}
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// authEnvPrefix prefixes the per-registry credential environment variables
+const authEnvPrefix = "CONTAINERFILE_UPDATER_AUTH_"
+
+// RegistryAuth holds explicit credentials for a registry. Values may reference
+// environment variables (e.g. "${HARBOR_PASSWORD}").
+type RegistryAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`  // Bearer token sent directly to the registry
+	Helper   string `yaml:"helper"` // Credential helper suffix, e.g. "ecr-login" for docker-credential-ecr-login
+}
+
+// NewKeychain builds the keychain used for registry requests. Credentials are
+// resolved from the environment first, then the config file, then any enabled
+// cloud keychains, and finally the Docker config and its credential helpers.
+func NewKeychain(cfg *Config) authn.Keychain {
+	keychains := []authn.Keychain{&configKeychain{config: cfg}}
+	if len(cfg.CloudKeychains) > 0 {
+		keychains = append(keychains, newCloudKeychain(cfg.CloudKeychains))
+	}
+	keychains = append(keychains, authn.DefaultKeychain)
+	return authn.NewMultiKeychain(keychains...)
+}
+
+// configKeychain resolves credentials from environment variables and the config file
+type configKeychain struct {
+	config *Config
+}
+
+// Resolve implements authn.Keychain
+func (k *configKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+
+	if value := os.Getenv(authEnvVar(registry)); value != "" {
+		return authn.FromConfig(parseAuthEnv(value)), nil
+	}
+
+	rc := k.config.Registry(registry)
+	if rc == nil || rc.Auth == nil {
+		return authn.Anonymous, nil
+	}
+
+	auth := rc.Auth
+	switch {
+	case auth.Helper != "":
+		return authn.NewKeychainFromHelper(credentialHelper{name: auth.Helper}).Resolve(target)
+	case auth.Token != "":
+		return authn.FromConfig(authn.AuthConfig{RegistryToken: expandEnvRefs(auth.Token)}), nil
+	case auth.Username != "":
+		return authn.FromConfig(authn.AuthConfig{
+			Username: expandEnvRefs(auth.Username),
+			Password: expandEnvRefs(auth.Password),
+		}), nil
+	}
+
+	return authn.Anonymous, nil
+}
+
+// credentialSource describes where the credentials for a registry come from, the same
+// way the keychain looks them up, without revealing them
+func credentialSource(cfg *Config, target authn.Resource) string {
+	registry := target.RegistryStr()
+	if env := authEnvVar(registry); os.Getenv(env) != "" {
+		return "env:" + env
+	}
+	if rc := cfg.Registry(registry); rc != nil && rc.Auth != nil {
+		switch {
+		case rc.Auth.Helper != "":
+			return "helper:" + rc.Auth.Helper
+		case rc.Auth.Token != "":
+			return "config:token"
+		case rc.Auth.Username != "":
+			return "config:password"
+		}
+	}
+	if len(cfg.CloudKeychains) > 0 {
+		if auth, err := newCloudKeychain(cfg.CloudKeychains).Resolve(target); err == nil && auth != authn.Anonymous {
+			return credentialsCloud
+		}
+	}
+	if auth, err := authn.DefaultKeychain.Resolve(target); err == nil && auth != authn.Anonymous {
+		return credentialsDockerConfig
+	}
+	return credentialsAnonymous
+}
+
+// envRefPattern matches ${VAR} references in credential values
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvRefs replaces ${VAR} references with environment values. Unlike
+// os.ExpandEnv, bare "$" is left alone since it is common in robot account names.
+func expandEnvRefs(value string) string {
+	return envRefPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		return os.Getenv(envRefPattern.FindStringSubmatch(ref)[1])
+	})
+}
+
+// envNameSanitizer matches characters not allowed in environment variable names
+var envNameSanitizer = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// authEnvVar returns the environment variable holding credentials for a registry,
+// e.g. harbor.corp.com:8443 -> CONTAINERFILE_UPDATER_AUTH_HARBOR_CORP_COM_8443
+func authEnvVar(registry string) string {
+	key := envNameSanitizer.ReplaceAllString(strings.ToUpper(normalizeRegistry(registry)), "_")
+	return authEnvPrefix + strings.Trim(key, "_")
+}
+
+// parseAuthEnv parses "username:password" credentials, treating any other value as a token
+func parseAuthEnv(value string) authn.AuthConfig {
+	if username, password, ok := strings.Cut(value, ":"); ok {
+		return authn.AuthConfig{Username: username, Password: password}
+	}
+	return authn.AuthConfig{RegistryToken: value}
+}
+
+// credentialHelper runs a docker-credential-<name> binary following the Docker
+// credential helper protocol
+type credentialHelper struct {
+	name string
+}
+
+// Get implements authn.Helper
+func (h credentialHelper) Get(serverURL string) (string, string, error) {
+	// Docker Hub credentials are stored under the legacy index URL
+	if serverURL == name.DefaultRegistry {
+		serverURL = "https://" + name.DefaultRegistry + "/v1/"
+	}
+
+	binary := "docker-credential-" + h.name
+	cmd := exec.Command(binary, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf("%s get: %w: %s", binary, err, strings.TrimSpace(stdout.String()+stderr.String()))
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("failed to parse %s output: %w", binary, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// dockerDesktopBinDirs returns where Docker Desktop installs its credential helpers
+// (docker-credential-desktop, -osxkeychain, -wincred) on an operating system
+func dockerDesktopBinDirs(goos, home string) []string {
+	switch goos {
+	case "darwin":
+		return []string{filepath.Join(home, ".docker", "bin"), "/Applications/Docker.app/Contents/Resources/bin"}
+	case "windows":
+		programFiles := cmp.Or(os.Getenv("ProgramFiles"), `C:\Program Files`)
+		return []string{filepath.Join(programFiles, "Docker", "Docker", "resources", "bin")}
+	}
+	return nil
+}
+
+// withHelperDirs appends the directories that exist to a PATH value unless already listed
+func withHelperDirs(path string, dirs []string) string {
+	entries := filepath.SplitList(path)
+	for _, dir := range dirs {
+		if slices.Contains(entries, dir) {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		entries = append(entries, dir)
+	}
+	return strings.Join(entries, string(os.PathListSeparator))
+}
+
+// findDockerDesktopHelpers puts Docker Desktop's credential helpers on PATH. Sessions not
+// started from a login shell (IDEs, launchd jobs, Windows services and CI agents) often
+// lack them, and the credsStore of the Docker config then fails to resolve.
+func findDockerDesktopHelpers() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	os.Setenv("PATH", withHelperDirs(os.Getenv("PATH"), dockerDesktopBinDirs(runtime.GOOS, home)))
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestAuthEnvVar(t *testing.T) {
+	tests := map[string]string{
+		"harbor.corp.com":      "CONTAINERFILE_UPDATER_AUTH_HARBOR_CORP_COM",
+		"localhost:5000":       "CONTAINERFILE_UPDATER_AUTH_LOCALHOST_5000",
+		"index.docker.io":      "CONTAINERFILE_UPDATER_AUTH_DOCKER_IO",
+		"registry-1.docker.io": "CONTAINERFILE_UPDATER_AUTH_DOCKER_IO",
+	}
+
+	for registry, expected := range tests {
+		if got := authEnvVar(registry); got != expected {
+			t.Errorf("authEnvVar(%q): got %s, want %s", registry, got, expected)
+		}
+	}
+}
+
+func TestConfigKeychain(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	config := `registries:
+  harbor.corp.com:
+    auth:
+      username: robot$ci
+      password: ${TEST_HARBOR_PASSWORD}
+  quay.io:
+    auth:
+      token: quay-token
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("TEST_HARBOR_PASSWORD", "s3cret")
+	t.Setenv("CONTAINERFILE_UPDATER_AUTH_GHCR_IO", "octo:ghp_token")
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	keychain := &configKeychain{config: cfg}
+
+	tests := []struct {
+		registry string
+		expected authn.AuthConfig
+	}{
+		{registry: "harbor.corp.com", expected: authn.AuthConfig{Username: "robot$ci", Password: "s3cret"}},
+		{registry: "quay.io", expected: authn.AuthConfig{RegistryToken: "quay-token"}},
+		{registry: "ghcr.io", expected: authn.AuthConfig{Username: "octo", Password: "ghp_token"}},
+		{registry: "gcr.io", expected: authn.AuthConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.registry, func(t *testing.T) {
+			reg, err := name.NewRegistry(tt.registry)
+			if err != nil {
+				t.Fatalf("Failed to parse registry: %v", err)
+			}
+
+			auth, err := keychain.Resolve(reg)
+			if err != nil {
+				t.Fatalf("Failed to resolve credentials: %v", err)
+			}
+
+			got, err := auth.Authorization()
+			if err != nil {
+				t.Fatalf("Failed to get authorization: %v", err)
+			}
+			if *got != tt.expected {
+				t.Errorf("Credentials: got %+v, want %+v", *got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("Missing default config is empty", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		cfg, err := LoadConfig("")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(cfg.Registries) != 0 {
+			t.Errorf("Expected no registries, got %d", len(cfg.Registries))
+		}
+	})
+
+	t.Run("Missing explicit config is an error", func(t *testing.T) {
+		if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Error("Expected error for missing config file")
+		}
+	})
+
+	t.Run("Unknown fields are rejected", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(configPath, []byte("registires: {}\n"), 0644)
+		if _, err := LoadConfig(configPath); err == nil {
+			t.Error("Expected error for unknown field")
+		}
+	})
+
+	t.Run("Docker Hub aliases are normalized", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(configPath, []byte("registries:\n  index.docker.io:\n    auth:\n      token: hub\n"), 0644)
+		cfg, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if rc := cfg.Registry("docker.io"); rc == nil || rc.Auth.Token != "hub" {
+			t.Errorf("Expected docker.io settings, got %+v", rc)
+		}
+	})
+}
+
+func TestWithHelperDirs(t *testing.T) {
+	existing, other := t.TempDir(), t.TempDir()
+	missing := filepath.Join(existing, "missing")
+	sep := string(os.PathListSeparator)
+
+	got := withHelperDirs(other+sep+existing, []string{existing, missing})
+	if want := other + sep + existing; got != want {
+		t.Errorf("withHelperDirs() = %q, want %q", got, want)
+	}
+	got = withHelperDirs(other, []string{missing, existing})
+	if want := other + sep + existing; got != want {
+		t.Errorf("withHelperDirs() = %q, want %q", got, want)
+	}
+
+	if dirs := dockerDesktopBinDirs("darwin", "/Users/dev"); len(dirs) != 2 || dirs[0] != filepath.Join("/Users/dev", ".docker", "bin") {
+		t.Errorf("Unexpected macOS helper directories %v", dirs)
+	}
+	if dirs := dockerDesktopBinDirs("linux", "/home/dev"); dirs != nil {
+		t.Errorf("Expected no helper directories on Linux, got %v", dirs)
+	}
+}
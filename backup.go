@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat names timestamped backups so they sort chronologically
+const backupTimeFormat = "20060102T150405Z"
+
+// BackupPolicy controls the copy of a file kept before it is rewritten
+type BackupPolicy struct {
+	Disabled bool   // Don't keep a copy at all
+	Dir      string // Directory holding backups, mirroring the files' paths (next to the file if empty)
+	Keep     int    // When positive, backups are timestamped and only the newest Keep are retained
+}
+
+// Validate checks that the options can be combined
+func (p BackupPolicy) Validate() error {
+	if p.Keep < 0 {
+		return fmt.Errorf("number of backups to keep must not be negative: %d", p.Keep)
+	}
+	if p.Disabled && (p.Dir != "" || p.Keep > 0) {
+		return fmt.Errorf("--no-backup can't be combined with --backup-dir or --backup-keep")
+	}
+	return nil
+}
+
+// create copies path to its backup location and prunes old timestamped backups, returning
+// the backup's path (empty when backups are disabled). The backup is held to the path
+// policy of the file.
+func (p BackupPolicy) create(path string, now time.Time, confine PathPolicy) (string, error) {
+	if p.Disabled {
+		return "", nil
+	}
+
+	dir := filepath.Dir(path)
+	if p.Dir != "" {
+		// Mirror the file's path so files with the same name don't overwrite each other.
+		// Files outside the working directory are mirrored by their absolute path, so a
+		// path like ../other/Containerfile can't escape the backup directory.
+		rel := filepath.FromSlash(displayPath(path))
+		if !filepath.IsLocal(rel) {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return "", err
+			}
+			rel = strings.TrimLeft(strings.TrimPrefix(abs, filepath.VolumeName(abs)), string(filepath.Separator))
+		}
+		dir = filepath.Join(p.Dir, filepath.Dir(rel))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create backup directory: %w", err)
+		}
+	}
+
+	base := filepath.Base(path)
+	name := base + ".backup"
+	if p.Keep > 0 {
+		name = base + "." + now.UTC().Format(backupTimeFormat) + ".backup"
+	}
+	backupPath := filepath.Join(dir, name)
+	if err := confine.checkOutput(backupPath); err != nil {
+		return "", fmt.Errorf("refusing to write backup: %w", err)
+	}
+	if err := copyFile(path, backupPath); err != nil {
+		return "", err
+	}
+
+	if p.Keep > 0 {
+		if err := pruneBackups(dir, base, p.Keep); err != nil {
+			return backupPath, fmt.Errorf("failed to prune old backups: %w", err)
+		}
+	}
+	return backupPath, nil
+}
+
+// pruneBackups removes all but the newest keep timestamped backups of a file
+func pruneBackups(dir, base string, keep int) error {
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `\.\d{8}T\d{6}Z\.backup$`)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() && pattern.MatchString(entry.Name()) {
+			backups = append(backups, entry.Name())
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Timestamps sort lexically, oldest first
+	slices.Sort(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile creates a copy of the source file. An existing destination must be a regular
+// file, so a planted symbolic link can't redirect the copy elsewhere.
+func copyFile(src, dst string) error {
+	if info, err := os.Lstat(dst); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s exists and is not a regular file", dst)
+	}
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, sourceFile)
+	return err
+}
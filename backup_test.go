@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	if backupPath, err := (BackupPolicy{Disabled: true}).create(path, time.Now(), PathPolicy{}); err != nil || backupPath != "" {
+		t.Errorf("Expected no backup when disabled, got %q, %v", backupPath, err)
+	}
+
+	backupPath, err := BackupPolicy{}.create(path, time.Now(), PathPolicy{})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if backupPath != path+".backup" {
+		t.Errorf("Expected sibling backup, got %s", backupPath)
+	}
+
+	// Backups in a separate directory mirror the file's path
+	t.Chdir(dir)
+	backupDir := filepath.Join(dir, "backups")
+	backupPath, err = BackupPolicy{Dir: backupDir}.create("Containerfile", time.Now(), PathPolicy{})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if backupPath != filepath.Join(backupDir, "Containerfile.backup") {
+		t.Errorf("Expected backup in %s, got %s", backupDir, backupPath)
+	}
+	if data, err := os.ReadFile(backupPath); err != nil || string(data) != "FROM alpine\n" {
+		t.Errorf("Unexpected backup content %q: %v", string(data), err)
+	}
+
+	// Files outside the working directory stay inside the backup directory
+	work := filepath.Join(dir, "work")
+	other := filepath.Join(dir, "other")
+	for _, d := range []string{work, other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(other, "Containerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(work)
+	backupPath, err = BackupPolicy{Dir: backupDir}.create(filepath.Join("..", "other", "Containerfile"), time.Now(), PathPolicy{})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if rel, err := filepath.Rel(backupDir, backupPath); err != nil || !filepath.IsLocal(rel) {
+		t.Errorf("Expected the backup inside %s, got %s", backupDir, backupPath)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other", "Containerfile.backup")); err == nil {
+		t.Error("Expected no backup next to the file outside the working directory")
+	}
+}
+
+func TestBackupPolicyPrunesTimestampedBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	// Backups of another file are left alone
+	other := filepath.Join(dir, "Dockerfile.20260101T000000Z.backup")
+	if err := os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+
+	policy := BackupPolicy{Keep: 2}
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		if _, err := policy.create(path, start.Add(time.Duration(i)*time.Minute), PathPolicy{}); err != nil {
+			t.Fatalf("create failed: %v", err)
+		}
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.backup"))
+	if err != nil {
+		t.Fatalf("Glob failed: %v", err)
+	}
+	for i := range matches {
+		matches[i] = filepath.Base(matches[i])
+	}
+	want := []string{
+		"Containerfile.20261016T120200Z.backup",
+		"Containerfile.20261016T120300Z.backup",
+		"Dockerfile.20260101T000000Z.backup",
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("Expected backups %v, got %v", want, matches)
+	}
+}
+
+func TestBackupPolicyValidate(t *testing.T) {
+	for _, policy := range []BackupPolicy{{Keep: -1}, {Disabled: true, Dir: "backups"}, {Disabled: true, Keep: 3}} {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", policy)
+		}
+	}
+	if err := (BackupPolicy{Dir: "backups", Keep: 3}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// bazelPullPattern finds the rules_oci pull rules: oci_pull( in WORKSPACE files and the
+// oci.pull( module extension tag in MODULE.bazel
+var bazelPullPattern = regexp.MustCompile(`\boci[._]pull\s*\(`)
+
+// bazelAttributePattern matches a string attribute of a rule call: name = "value"
+var bazelAttributePattern = regexp.MustCompile(`\b([a-z_]+)\s*=\s*"([^"]*)"`)
+
+// isBazelPath reports whether a file is a Bazel module or workspace file
+func isBazelPath(base string) bool {
+	return base == "module.bazel" || base == "workspace" || base == "workspace.bazel"
+}
+
+// bazelAttribute is a string attribute of a rule call and where its value sits
+type bazelAttribute struct {
+	line  int // 1-based line of the attribute
+	start int // Byte offset of the value within the line
+	value string
+}
+
+// bazelPull is one oci_pull call with the attributes the updater reads and writes
+type bazelPull struct {
+	line       int // Line of the call
+	endLine    int // Line of the closing parenthesis
+	attributes map[string]bazelAttribute
+}
+
+// findBazelPulls returns the oci_pull calls of a file. Calls are delimited by matching
+// parentheses, skipping those inside strings and comments.
+func findBazelPulls(lines []string) []*bazelPull {
+	var pulls []*bazelPull
+	for index := 0; index < len(lines); index++ {
+		loc := bazelPullPattern.FindStringIndex(lines[index])
+		if loc == nil || strings.HasPrefix(strings.TrimSpace(lines[index]), "#") {
+			continue
+		}
+
+		pull := &bazelPull{line: index + 1, attributes: make(map[string]bazelAttribute)}
+		depth, inString := 0, false
+		column := loc[1] - 1
+	scan:
+		for ; index < len(lines); index, column = index+1, 0 {
+			line := lines[index]
+			for ; column < len(line); column++ {
+				switch c := line[column]; {
+				case inString:
+					if c == '\\' {
+						column++
+					} else if c == '"' {
+						inString = false
+					}
+				case c == '"':
+					inString = true
+				case c == '#':
+					column = len(line)
+				case c == '(' || c == '[' || c == '{':
+					depth++
+				case c == ')' || c == ']' || c == '}':
+					depth--
+					if depth == 0 {
+						break scan
+					}
+				}
+			}
+		}
+		pull.endLine = min(index+1, len(lines))
+
+		for lineNumber := pull.line; lineNumber <= pull.endLine; lineNumber++ {
+			line := lines[lineNumber-1]
+			for _, match := range bazelAttributePattern.FindAllStringSubmatchIndex(line, -1) {
+				name := line[match[2]:match[3]]
+				if _, ok := pull.attributes[name]; !ok {
+					pull.attributes[name] = bazelAttribute{line: lineNumber, start: match[4], value: line[match[4]:match[5]]}
+				}
+			}
+		}
+		pulls = append(pulls, pull)
+	}
+	return pulls
+}
+
+// extractBazelImages returns the images of the oci_pull rules in MODULE.bazel or WORKSPACE.
+// The image and tag attributes are resolved and the digest attribute is written.
+func (du *ContainerfileUpdater) extractBazelImages(lines []string) ([]*FromCommand, error) {
+	var images []*FromCommand
+	for _, pull := range findBazelPulls(lines) {
+		image, ok := pull.attributes["image"]
+		if !ok {
+			slog.Debug("Skipping oci_pull without an image", "line", pull.line)
+			continue
+		}
+
+		reference := image.value
+		tag := pull.attributes["tag"].value
+		if tag != "" {
+			reference += ":" + tag
+		}
+		if digest := pull.attributes["digest"].value; digest != "" {
+			reference += "@" + digest
+		}
+		imageRef, err := du.parseImageReference(reference)
+		if err != nil {
+			slog.Warn("Failed to parse image", "line", image.line, "error", err)
+			continue
+		}
+
+		cmd := &FromCommand{
+			Image:       imageRef,
+			LineStart:   pull.line,
+			LineEnd:     pull.endLine,
+			Annotations: commentAnnotations(lines, pull.line, "#"),
+			editor:      bazelDigestEditor(pull),
+		}
+		switch {
+		case tag == "":
+			cmd.SkipReason = "no tag to resolve"
+		case strings.ContainsAny(reference, "{}$"):
+			cmd.SkipReason = "uses format expressions"
+			cmd.Unpinnable = true
+		}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images, nil
+}
+
+// bazelDigestEditor writes the digest attribute of an oci_pull call, adding it below the
+// tag when missing and removing it for tag-only pins. Attributes sharing a line with
+// others are only rewritten in place.
+func bazelDigestEditor(pull *bazelPull) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		digest := cmd.Image.Digest
+		if cmd.Annotations != nil && cmd.Annotations.Pin == pinTagOnly {
+			digest = ""
+		}
+
+		if current, ok := pull.attributes["digest"]; ok {
+			index := current.line - 1
+			end := current.start + len(current.value)
+			if index >= len(lines) || end > len(lines[index]) || lines[index][current.start:end] != current.value {
+				return lines, false
+			}
+			if digest == "" {
+				if !ownLine(lines[index], "digest") {
+					return lines, false
+				}
+				return append(lines[:index:index], lines[index+1:]...), true
+			}
+			if current.value == digest {
+				return lines, false
+			}
+			lines[index] = lines[index][:current.start] + digest + lines[index][end:]
+			return lines, true
+		}
+
+		anchor, ok := pull.attributes["tag"]
+		if digest == "" || !ok || anchor.line > len(lines) || !ownLine(lines[anchor.line-1], "tag") {
+			return lines, false
+		}
+		line := lines[anchor.line-1]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		inserted := indent + `digest = "` + digest + `",`
+		return slices.Insert(lines, anchor.line, inserted), true
+	}
+}
+
+// ownLine reports whether a line holds nothing but the named attribute, so a line can be
+// added after it or it can be removed without touching its neighbours
+func ownLine(line, name string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, name) && strings.HasSuffix(trimmed, ",") && strings.Count(trimmed, "=") == 1
+}
+
+// commentAnnotations parses containerfile-updater directives from the comment lines
+// directly above a line
+func commentAnnotations(lines []string, line int, prefixes ...string) *ImageAnnotations {
+	var comments []string
+	for index := line - 2; index >= 0; index-- {
+		trimmed := strings.TrimSpace(lines[index])
+		comment, ok := "", false
+		for _, prefix := range prefixes {
+			if comment, ok = strings.CutPrefix(trimmed, prefix); ok {
+				break
+			}
+		}
+		if !ok {
+			break
+		}
+		comments = append([]string{comment}, comments...)
+	}
+
+	annotations, err := parseAnnotations(comments)
+	if err != nil {
+		slog.Warn("Ignoring invalid annotation comment", "prefix", annotationPrefix, "line", line, "error", err)
+		return &ImageAnnotations{}
+	}
+	return annotations
+}
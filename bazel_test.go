@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBazelOciPull(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	baseDigest := pushRandomImage(t, server, host+"/distroless/base:latest")
+	goDigest := pushRandomImage(t, server, host+"/golang:1.24")
+
+	content := strings.Join([]string{
+		`oci = use_extension("@rules_oci//oci:extensions.bzl", "oci")`,
+		`oci.pull(`,
+		`    name = "distroless_base",`,
+		`    image = "` + host + `/distroless/base",`,
+		`    tag = "latest",`,
+		`    digest = "sha256:` + strings.Repeat("0", 64) + `",`,
+		`    platforms = ["linux/amd64", "linux/arm64"],`,
+		`)`,
+		`# Tag only, gets a digest`,
+		`oci.pull(`,
+		`    name = "golang",`,
+		`    image = "` + host + `/golang",`,
+		`    tag = "1.24",`,
+		`)`,
+		`oci.pull(name = "pinned", image = "` + host + `/other", digest = "sha256:` + strings.Repeat("1", 64) + `")`,
+		`use_repo(oci, "distroless_base", "golang", "pinned")`,
+		"",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "MODULE.bazel")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write MODULE.bazel: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	if updater.format != formatBazel {
+		t.Fatalf("Expected the bazel format, got %q", updater.format)
+	}
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(updater.fromCommands) != 3 {
+		t.Fatalf("Expected 3 oci_pull rules, got %d", len(updater.fromCommands))
+	}
+	if reason := updater.fromCommands[2].SkipReason; reason != "no tag to resolve" {
+		t.Errorf("Expected the rule without a tag to be skipped, got %q", reason)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read MODULE.bazel: %v", err)
+	}
+	want := strings.Replace(content, "sha256:"+strings.Repeat("0", 64), baseDigest.String(), 1)
+	want = strings.Replace(want, `    tag = "1.24",`, `    tag = "1.24",`+"\n"+`    digest = "`+goDigest.String()+`",`, 1)
+	if string(data) != want {
+		t.Errorf("Unexpected content:\n%s\nwant:\n%s", data, want)
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/moby/buildkit/client/llb/sourceresolver"
+	"github.com/moby/buildkit/frontend/dockerfile/dockerfile2llb"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/opencontainers/go-digest"
+)
+
+// offlineImageConfig is the image config every base image is given during a conversion
+var offlineImageConfig = []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]},"config":{}}`)
+
+// offlineMetaResolver answers BuildKit's image config lookups without contacting registries,
+// giving every image an empty Linux config
+type offlineMetaResolver struct{}
+
+// ResolveImageConfig returns the offline config for any reference
+func (offlineMetaResolver) ResolveImageConfig(ctx context.Context, ref string, opt sourceresolver.Opt) (string, digest.Digest, []byte, error) {
+	return ref, digest.FromBytes(offlineImageConfig), offlineImageConfig, nil
+}
+
+// convertContainerfile runs BuildKit's dockerfile2llb conversion, which a build starts with,
+// with images resolved offline: the instructions, their flags, platforms, build argument
+// expansion and stage references are checked as a build would, but nothing is pulled, so
+// images of COPY --from that name no stage are taken to exist.
+func convertContainerfile(content []byte) error {
+	_, _, _, _, err := dockerfile2llb.Dockerfile2LLB(context.Background(), content, dockerfile2llb.ConvertOpt{MetaResolver: offlineMetaResolver{}})
+	var located *parser.LocationError
+	if errors.As(err, &located) && len(located.Locations) > 0 && len(located.Locations[0]) > 0 {
+		return fmt.Errorf("line %d: %w", located.Locations[0][0].Start.Line, err)
+	}
+	return err
+}
+
+// validateRewrite checks that a rewritten Containerfile still converts for a build, so
+// damage done by the rewrite is caught before the file is saved. Content that didn't
+// convert before the run isn't held against it.
+func (du *ContainerfileUpdater) validateRewrite(original []byte, lines []string, style lineStyle) error {
+	if !du.validate || du.format != formatContainerfile {
+		return nil
+	}
+	if err := convertContainerfile(original); err != nil {
+		slog.Warn("Not validating the rewrite of a file that didn't convert before", "path", du.containerfilePath, "error", err)
+		return nil
+	}
+	if err := convertContainerfile([]byte(style.join(lines))); err != nil {
+		return fmt.Errorf("rewritten %s no longer converts for a build, leaving it unchanged: %w", du.containerfilePath, err)
+	}
+	slog.Debug("Validated rewrite", "path", du.containerfilePath)
+	return nil
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertContainerfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "pinned", content: "FROM alpine:3.20@sha256:" + strings.Repeat("a", 64) + "\nRUN true\n"},
+		{name: "stage and scratch", content: "FROM golang:1.24 AS Build\nRUN go build\nFROM build\nFROM scratch\nCOPY --from=build /app /app\n"},
+		{name: "build argument", content: "ARG BASE=alpine:3.20\nFROM ${BASE}\n"},
+		{name: "unknown flag", content: "FROM alpine\nCOPY --bogus a b\n", wantErr: "unknown flag: --bogus"},
+		{name: "broken digest", content: "FROM alpine\nFROM alpine@sha256:abc\n", wantErr: `line 2: failed to parse stage name "alpine@sha256:abc"`},
+		{name: "invalid platform", content: "FROM --platform=linux/amd64/v9/x alpine\n", wantErr: "line 1: failed to parse platform"},
+		{name: "expanded stage name", content: "ARG V=Bad:Ref!\nFROM alpine:${V}\n", wantErr: `line 2: failed to parse stage name "alpine:Bad:Ref!"`},
+		{name: "unset build argument", content: "ARG BASE\nFROM ${BASE}\n", wantErr: "should not be blank"},
+		{name: "invalid copy source", content: "FROM alpine\nCOPY --from=Bad!Stage /a /b\n", wantErr: "line 2: failed to parse stage name"},
+		{name: "invalid mount source", content: "FROM alpine\nRUN --mount=from=UP:x!,target=/x true\n", wantErr: `failed to parse stage name "UP:x!"`},
+		{name: "unterminated heredoc", content: "FROM alpine\nCOPY <<EOF /a\nhi\n", wantErr: "line 2: unterminated heredoc"},
+		{name: "invalid chmod", content: "FROM alpine\nCOPY --chmod=999 a /a\n", wantErr: "invalid chmod parameter"},
+		{name: "missing argument", content: "FROM\n", wantErr: "FROM requires"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := convertContainerfile([]byte(tt.content))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateRewrite(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	damaged, style := splitLines("FROM alpine@sha256:abc\n")
+	tests := []struct {
+		name     string
+		original string
+		validate bool
+		format   string
+		wantErr  bool
+	}{
+		{name: "damage caught", original: "FROM alpine:3.20\n", validate: true, format: formatContainerfile, wantErr: true},
+		{name: "validation disabled", original: "FROM alpine:3.20\n", format: formatContainerfile},
+		{name: "other formats", original: "FROM alpine:3.20\n", validate: true, format: formatCompose},
+		{name: "invalid before the run", original: "FROM alpine\nCOPY --bogus a b\n", validate: true, format: formatContainerfile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			du := NewContainerfileUpdater("Containerfile")
+			du.validate = tt.validate
+			du.format = tt.format
+			if err := du.validateRewrite([]byte(tt.original), damaged, style); (err != nil) != tt.wantErr {
+				t.Errorf("validateRewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateWithValidation(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/base:1.0")
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM "+host+"/base:1.0 AS base\nCOPY --chmod=644 a /a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	updater.validate = true
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "@"+digest.String()) {
+		t.Errorf("Expected the validated rewrite to be saved, got:\n%s", data)
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// catalogViolation is the reason given for base images outside the catalog
+const catalogViolation = "not in the base image catalog"
+
+// CatalogConfig lists the approved base images. Once it names any image, every FROM image
+// (directly or through a build argument) must be in the catalog and is pinned to the
+// digest of the catalog's tag; other base images are flagged and left untouched.
+type CatalogConfig struct {
+	Images []CatalogImage `yaml:"images"`
+}
+
+// CatalogImage is an approved base image, or a namespace of them
+type CatalogImage struct {
+	Image string `yaml:"image"` // Repository pattern without a tag, e.g. golang or ghcr.io/org/base/*
+	Tag   string `yaml:"tag"`   // Tag every use of the image is pinned to (empty keeps the written tag)
+}
+
+// baseImageCatalog matches base images against the catalog entries
+type baseImageCatalog struct {
+	patterns []*regexp.Regexp
+	tags     []string
+}
+
+// newBaseImageCatalog compiles the catalog entries, returning nil for an empty catalog
+func newBaseImageCatalog(cfg CatalogConfig) (*baseImageCatalog, error) {
+	if len(cfg.Images) == 0 {
+		return nil, nil
+	}
+	catalog := &baseImageCatalog{}
+	for _, entry := range cfg.Images {
+		if entry.Image == "" {
+			return nil, fmt.Errorf("catalog entry without an image")
+		}
+		if entry.Tag != "" && !tagPattern.MatchString(entry.Tag) {
+			return nil, fmt.Errorf("invalid catalog tag %q for %s", entry.Tag, entry.Image)
+		}
+		patterns, err := compilePatterns([]string{entry.Image})
+		if err != nil {
+			return nil, fmt.Errorf("invalid catalog image: %w", err)
+		}
+		catalog.patterns = append(catalog.patterns, patterns[0])
+		catalog.tags = append(catalog.tags, entry.Tag)
+	}
+	return catalog, nil
+}
+
+// lookup returns the tag of the first entry an image matches, and whether one does
+func (c *baseImageCatalog) lookup(image *ImageReference) (string, bool) {
+	candidates := repositoryCandidates(image)
+	for i, pattern := range c.patterns {
+		if matchAny([]*regexp.Regexp{pattern}, candidates) != "" {
+			return c.tags[i], true
+		}
+	}
+	return "", false
+}
+
+// repositoryCandidates returns the spellings of an image's repository catalog entries are
+// matched against: as written, the short forms and the fully-qualified form
+func repositoryCandidates(image *ImageReference) []string {
+	written, _, _ := strings.Cut(image.Original, "@")
+	if i := strings.LastIndex(written, ":"); i > strings.LastIndex(written, "/") {
+		written = written[:i]
+	}
+	candidates := []string{written, image.Name(), image.Registry + "/" + image.Repository}
+	if official, ok := strings.CutPrefix(image.Name(), "library/"); ok && image.Registry == "docker.io" {
+		candidates = append(candidates, official)
+	}
+	return candidates
+}
+
+// isBaseImage reports whether an image is the base of a build stage, written in its FROM
+// instruction or set by a build argument the FROM uses
+func isBaseImage(cmd *FromCommand) bool {
+	return cmd.Arg != "" || (cmd.Node != nil && strings.EqualFold(cmd.Node.Value, "from"))
+}
+
+// applyCatalog switches a base image to its catalog tag, or flags it when the catalog
+// doesn't list it. The catalog is policy, so its tag wins over tracking rules and annotations.
+func (du *ContainerfileUpdater) applyCatalog(cmd *FromCommand) {
+	if du.catalog == nil || !isBaseImage(cmd) {
+		return
+	}
+	tag, ok := du.catalog.lookup(cmd.Image)
+	if !ok {
+		cmd.Violation = catalogViolation
+		return
+	}
+	if tag == "" || tag == cmd.Image.Tag {
+		return
+	}
+	slog.Debug("Using catalog tag", "image", cmd.Image.Original, "tag", tag)
+	cmd.TrackedTag = tag
+	cmd.Image.Tag = tag
+}
+
+// logViolations warns about the base images that break the catalog policy
+func (du *ContainerfileUpdater) logViolations() {
+	for _, cmd := range du.fromCommands {
+		if cmd.Violation != "" {
+			slog.Warn("Image violates policy", "line", cmd.LineStart, "image", cmd.Image.Original, "reason", cmd.Violation)
+		}
+	}
+}
+
+// violationCount returns the number of images that break the catalog policy
+func (du *ContainerfileUpdater) violationCount() int {
+	count := 0
+	for _, cmd := range du.fromCommands {
+		if cmd.Violation != "" {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBaseImageCatalog(t *testing.T) {
+	catalog, err := newBaseImageCatalog(CatalogConfig{Images: []CatalogImage{
+		{Image: "golang", Tag: "1.24"},
+		{Image: "ghcr.io/example/base/*"},
+	}})
+	if err != nil {
+		t.Fatalf("newBaseImageCatalog failed: %v", err)
+	}
+
+	du := NewContainerfileUpdater("Containerfile")
+	tests := []struct {
+		reference string
+		tag       string
+		ok        bool
+	}{
+		{reference: "golang:1.22", tag: "1.24", ok: true},
+		{reference: "docker.io/library/golang@sha256:9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e", tag: "1.24", ok: true},
+		{reference: "ghcr.io/example/base/core:2", ok: true},
+		{reference: "ghcr.io/example/tool:2", ok: false},
+		{reference: "golang-extra:1.24", ok: false},
+	}
+	for _, tt := range tests {
+		image, err := du.parseImageReference(tt.reference)
+		if err != nil {
+			t.Fatalf("parseImageReference(%q) failed: %v", tt.reference, err)
+		}
+		if tag, ok := catalog.lookup(image); tag != tt.tag || ok != tt.ok {
+			t.Errorf("lookup(%q) = %q, %v, want %q, %v", tt.reference, tag, ok, tt.tag, tt.ok)
+		}
+	}
+
+	if catalog, err := newBaseImageCatalog(CatalogConfig{}); catalog != nil || err != nil {
+		t.Errorf("Expected no catalog for an empty config, got %v, %v", catalog, err)
+	}
+	if _, err := newBaseImageCatalog(CatalogConfig{Images: []CatalogImage{{Image: "golang", Tag: "bad tag"}}}); err == nil {
+		t.Error("Expected error for an invalid tag")
+	}
+	if _, err := newBaseImageCatalog(CatalogConfig{Images: []CatalogImage{{Tag: "1.24"}}}); err == nil {
+		t.Error("Expected error for an entry without an image")
+	}
+}
+
+func TestCatalogUpdate(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	approved := pushRandomImage(t, server, host+"/base:2.0")
+	pushRandomImage(t, server, host+"/base:1.0")
+	pushRandomImage(t, server, host+"/rogue:1.0")
+	pushRandomImage(t, server, host+"/tool:1.0")
+
+	originalContent := "FROM " + host + "/base:1.0 AS build\n" +
+		"RUN crane pull " + host + "/tool:1.0 tool.tar\n" +
+		"FROM " + host + "/rogue:1.0\n"
+	expectedContent := "FROM " + host + "/base@" + approved.String() + " AS build\n" +
+		"RUN crane pull " + host + "/tool:1.0 tool.tar\n" +
+		"FROM " + host + "/rogue:1.0\n"
+
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Catalog = CatalogConfig{Images: []CatalogImage{{Image: host + "/base", Tag: "2.0"}}}
+	updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	updater.backup = BackupPolicy{Disabled: true}
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	content, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	if string(content) != expectedContent {
+		t.Errorf("Containerfile content mismatch.\nExpected:\n%s\nGot:\n%s", expectedContent, content)
+	}
+	if updater.violationCount() != 1 || updater.ExitCode() != exitError {
+		t.Errorf("Expected one violation failing the run, got %d and exit code %d", updater.violationCount(), updater.ExitCode())
+	}
+	summary := summarizeReports([]*RunReport{updater.Report()})
+	if summary.Violations != 1 || summary.Skipped != 1 || summary.Updated != 1 {
+		t.Errorf("Summary = %+v", summary)
+	}
+}
@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultUpdateBranch is the branch pushed when no --git-branch is given in PR mode
+const defaultUpdateBranch = "containerfile-updater/digests"
+
+// ChangeRequest describes a pull/merge request to open or update on a forge
+type ChangeRequest struct {
+	Title string
+	Body  string
+	Head  string // Branch containing the updates
+	Base  string // Branch the updates should be merged into (empty for the repository default)
+}
+
+// ChangeRequestResult reports the pull/merge request that was created or updated
+type ChangeRequestResult struct {
+	Number  int
+	URL     string
+	Created bool
+}
+
+// ChangeRequestProvider opens or refreshes pull/merge requests on a code forge
+type ChangeRequestProvider interface {
+	CreateOrUpdateChangeRequest(cr *ChangeRequest) (*ChangeRequestResult, error)
+}
+
+// Supported forges for --forge
+const (
+	forgeGitHub  = "github"
+	forgeGitLab  = "gitlab"
+	forgeGitea   = "gitea"
+	forgeForgejo = "forgejo" // Speaks the Gitea API
+)
+
+// forgeTokenEnv names the environment variable holding each forge's API token
+var forgeTokenEnv = map[string]string{
+	forgeGitHub:  "GITHUB_TOKEN",
+	forgeGitLab:  "GITLAB_TOKEN",
+	forgeGitea:   "GITEA_TOKEN",
+	forgeForgejo: "GITEA_TOKEN",
+}
+
+// NewChangeRequestProvider creates the provider for the named forge
+func NewChangeRequestProvider(forge, apiURL, repository, token string) (ChangeRequestProvider, error) {
+	switch strings.ToLower(forge) {
+	case forgeGitHub:
+		return NewGitHubClient(apiURL, repository, token)
+	case forgeGitLab:
+		return NewGitLabClient(apiURL, repository, token)
+	case forgeGitea, forgeForgejo:
+		return NewGiteaClient(apiURL, repository, token)
+	default:
+		return nil, fmt.Errorf("unsupported forge %q (expected github, gitlab, gitea or forgejo)", forge)
+	}
+}
+
+// apiClient performs JSON requests against a forge REST API
+type apiClient struct {
+	name    string            // Forge name used in error messages
+	baseURL string            // API root without a trailing slash
+	headers map[string]string // Authentication and content negotiation headers
+	client  *http.Client
+}
+
+// newAPIClient creates an apiClient with the default request timeout
+func newAPIClient(name, baseURL string, headers map[string]string) *apiClient {
+	return &apiClient{
+		name:    name,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		headers: headers,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do performs an authenticated API request, decoding the JSON response into out
+func (c *apiClient) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s API %s %s: %w", c.name, method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s API %s %s: %s: %s", c.name, method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode %s API response: %w", c.name, err)
+		}
+	}
+	return nil
+}
+
+// buildChangeRequest renders a ChangeRequest for the updated images of every file
+func buildChangeRequest(changed []*FromCommand, head, base string) *ChangeRequest {
+	var title string
+	if len(changed) == 1 {
+		title = fmt.Sprintf("Update %s digest", changed[0].Image.TaggedName())
+	} else {
+		title = fmt.Sprintf("Update %d container image digests", len(changed))
+	}
+
+	return &ChangeRequest{
+		Title: title,
+		Body:  buildChangeRequestBody(changed),
+		Head:  head,
+		Base:  base,
+	}
+}
+
+// buildChangeRequestBody renders a Renovate-style markdown table of image changes
+func buildChangeRequestBody(changed []*FromCommand) string {
+	var b strings.Builder
+
+	b.WriteString("This change pins the following container images to their latest digests.\n\n")
+	b.WriteString("| Image | File | Update | Change | Version |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+	for _, cmd := range changed {
+		version := ""
+		if description := cmd.Release.describe(); description != "" {
+			version = "`" + description + "`"
+		}
+		fmt.Fprintf(&b, "| `%s` | `%s:%d` | digest | `%s` → `%s` | %s |\n",
+			cmd.Image.TaggedName(),
+			displayPath(cmd.Path),
+			cmd.LineStart,
+			shortDigest(cmd.PreviousDigest),
+			shortDigest(cmd.Image.Digest),
+			version,
+		)
+	}
+
+	b.WriteString("\n<details>\n<summary>Full digests</summary>\n\n")
+	for _, cmd := range changed {
+		fmt.Fprintf(&b, "- `%s`\n", cmd.Image.TaggedName())
+		if cmd.PreviousDigest != "" {
+			fmt.Fprintf(&b, "  - old: `%s`\n", cmd.PreviousDigest)
+		}
+		fmt.Fprintf(&b, "  - new: `%s`\n", cmd.Image.Digest)
+		if cmd.Release != nil && cmd.Release.Revision != "" {
+			fmt.Fprintf(&b, "  - revision: `%s`\n", cmd.Release.Revision)
+		}
+	}
+	b.WriteString("\n</details>\n\n")
+
+	var notes []string
+	for _, cmd := range changed {
+		if cmd.Release == nil || cmd.Release.Source == "" {
+			continue
+		}
+		note := fmt.Sprintf("- `%s`: [%s](%s)", cmd.Image.TaggedName(), firstNonEmpty(cmd.Release.Version, "source"), firstNonEmpty(cmd.Release.ReleaseNotes, cmd.Release.Source))
+		if cmd.Release.Revision != "" {
+			note += fmt.Sprintf(" (revision `%s`)", cmd.Release.Revision)
+		}
+		notes = append(notes, note)
+	}
+	if len(notes) > 0 {
+		b.WriteString("### Release notes\n\n")
+		b.WriteString(strings.Join(notes, "\n"))
+		b.WriteString("\n\n")
+	}
+
+	var supplyChain []string
+	for _, cmd := range changed {
+		if cmd.Referrers == nil {
+			continue
+		}
+		summary := summarizeReferrers(cmd.Referrers)
+		if summary == "" {
+			summary = "nothing attached"
+		}
+		supplyChain = append(supplyChain, fmt.Sprintf("- `%s`: %s", cmd.Image.TaggedName(), summary))
+	}
+	if len(supplyChain) > 0 {
+		b.WriteString("### Supply chain\n\n")
+		b.WriteString(strings.Join(supplyChain, "\n"))
+		b.WriteString("\n\n")
+	}
+	b.WriteString("---\n\nGenerated by [containerfile-updater](https://github.com/drGrove/containerfile-updater).\n")
+
+	return b.String()
+}
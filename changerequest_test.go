@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildChangeRequestBody(t *testing.T) {
+	changed := []*FromCommand{
+		{
+			Image: &ImageReference{
+				Registry:   "docker.io",
+				Repository: "stagex/core-filesystem",
+				Tag:        "latest",
+				Digest:     "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+			},
+			Path:      "Containerfile",
+			LineStart: 3,
+		},
+	}
+
+	cr := buildChangeRequest(changed, defaultUpdateBranch, "")
+	if cr.Title != "Update stagex/core-filesystem:latest digest" {
+		t.Errorf("Title: got %q", cr.Title)
+	}
+
+	row := "| `stagex/core-filesystem:latest` | `Containerfile:3` | digest | `unpinned` → `111111111111` |"
+	if !strings.Contains(cr.Body, row) {
+		t.Errorf("Body missing table row %q:\n%s", row, cr.Body)
+	}
+}
+
+func TestNewChangeRequestProvider(t *testing.T) {
+	tests := []struct {
+		forge   string
+		apiURL  string
+		repo    string
+		wantErr bool
+	}{
+		{forge: "github", repo: "octo/app"},
+		{forge: "GitLab", repo: "group/sub/project"},
+		{forge: "gitea", apiURL: "https://codeberg.org/api/v1", repo: "octo/app"},
+		{forge: "forgejo", apiURL: "https://codeberg.org/api/v1", repo: "octo/app"},
+		{forge: "gitea", repo: "octo/app", wantErr: true},
+		{forge: "bitbucket", repo: "octo/app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewChangeRequestProvider(tt.forge, tt.apiURL, tt.repo, "token")
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: expected error", tt.forge)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.forge, err)
+		}
+	}
+}
+
+func TestGitLabCreateOrUpdateChangeRequest(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	var created, updated map[string]interface{}
+	openMRs := []gitlabMergeRequest{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.EscapedPath() == "/projects/group%2Fapp":
+			json.NewEncoder(w).Encode(map[string]string{"default_branch": "trunk"})
+		case r.Method == http.MethodGet && r.URL.EscapedPath() == "/projects/group%2Fapp/merge_requests":
+			json.NewEncoder(w).Encode(openMRs)
+		case r.Method == http.MethodPost && r.URL.EscapedPath() == "/projects/group%2Fapp/merge_requests":
+			json.NewDecoder(r.Body).Decode(&created)
+			json.NewEncoder(w).Encode(gitlabMergeRequest{IID: 11, WebURL: "https://gitlab.example.com/group/app/-/merge_requests/11"})
+		case r.Method == http.MethodPut && r.URL.EscapedPath() == "/projects/group%2Fapp/merge_requests/4":
+			json.NewDecoder(r.Body).Decode(&updated)
+			json.NewEncoder(w).Encode(gitlabMergeRequest{IID: 4})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewGitLabClient(server.URL, "group/app", "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	cr := &ChangeRequest{Title: "Update digests", Body: "body", Head: defaultUpdateBranch}
+
+	result, err := client.CreateOrUpdateChangeRequest(cr)
+	if err != nil {
+		t.Fatalf("Failed to create merge request: %v", err)
+	}
+	if !result.Created || result.Number != 11 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if created["target_branch"] != "trunk" || created["description"] != "body" {
+		t.Errorf("Unexpected create payload: %v", created)
+	}
+
+	openMRs = []gitlabMergeRequest{{IID: 4}}
+	result, err = client.CreateOrUpdateChangeRequest(cr)
+	if err != nil {
+		t.Fatalf("Failed to update merge request: %v", err)
+	}
+	if result.Created || result.Number != 4 || updated["title"] != "Update digests" {
+		t.Errorf("Unexpected update: %+v %v", result, updated)
+	}
+}
+
+func TestGiteaCreateOrUpdateChangeRequest(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	var created, updated map[string]string
+	openPulls := []map[string]interface{}{
+		{"number": 1, "head": map[string]string{"ref": "feature"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/octo/app":
+			json.NewEncoder(w).Encode(map[string]string{"default_branch": "main"})
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/octo/app/pulls":
+			json.NewEncoder(w).Encode(openPulls)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/octo/app/pulls":
+			json.NewDecoder(r.Body).Decode(&created)
+			json.NewEncoder(w).Encode(map[string]interface{}{"number": 2})
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/octo/app/pulls/5":
+			json.NewDecoder(r.Body).Decode(&updated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"number": 5})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewGiteaClient(server.URL, "octo/app", "test-token")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	cr := &ChangeRequest{Title: "Update digests", Body: "body", Head: defaultUpdateBranch}
+
+	// The open pull request is for a different branch, so a new one is created
+	result, err := client.CreateOrUpdateChangeRequest(cr)
+	if err != nil {
+		t.Fatalf("Failed to create pull request: %v", err)
+	}
+	if !result.Created || created["base"] != "main" || created["head"] != defaultUpdateBranch {
+		t.Errorf("Unexpected create: %+v %v", result, created)
+	}
+
+	openPulls = append(openPulls, map[string]interface{}{"number": 5, "head": map[string]string{"ref": defaultUpdateBranch}})
+	result, err = client.CreateOrUpdateChangeRequest(cr)
+	if err != nil {
+		t.Fatalf("Failed to update pull request: %v", err)
+	}
+	if result.Created || result.Number != 5 || updated["body"] != "body" {
+		t.Errorf("Unexpected update: %+v %v", result, updated)
+	}
+}
+
+func TestForgeTokenFromEnvironment(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	// Nothing to update, so the run only needs the forge to be configured
+	dir := t.TempDir()
+	initGroupRepository(t, dir, t.TempDir(), map[string]string{"Containerfile": "FROM scratch\n"})
+	path := filepath.Join(dir, "Containerfile")
+	t.Chdir(dir)
+
+	for _, forge := range []string{forgeGitea, forgeForgejo} {
+		args := []string{"--log-level", "error", "--forge", forge, "--forge-api-url", "https://codeberg.org/api/v1", "--forge-repo", "octo/app", "--no-backup", path}
+		t.Setenv("GITEA_TOKEN", "")
+		if exitCode := runUpdate(args); exitCode != exitError {
+			t.Errorf("%s: expected a missing $GITEA_TOKEN to fail with %d, got %d", forge, exitError, exitCode)
+		}
+		t.Setenv("GITEA_TOKEN", "test-token")
+		if exitCode := runUpdate(args); exitCode != exitOK {
+			t.Errorf("%s: expected $GITEA_TOKEN to configure the forge, got exit code %d", forge, exitCode)
+		}
+	}
+}
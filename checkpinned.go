@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// UnpinnedReference is an image reference that names a tag rather than a digest
+type UnpinnedReference struct {
+	Line  int    `json:"line"`
+	Image string `json:"image"`
+	Kind  string `json:"kind"` // image, or copy and mount for COPY --from and RUN --mount=from
+}
+
+// describe names the instruction of a reference in messages
+func (r UnpinnedReference) describe() string {
+	switch r.Kind {
+	case edgeCopy:
+		return "COPY --from image"
+	case edgeMount:
+		return "RUN --mount image"
+	}
+	return "image"
+}
+
+// FilePins are the unpinned references of one file
+type FilePins struct {
+	File     string              `json:"file"`
+	Unpinned []UnpinnedReference `json:"unpinned"`
+}
+
+// UnpinnedReferences extracts the images of the updater's file without contacting
+// registries and returns those without a digest, whatever the update filters and catalog
+// say. Only images exempt from pinning are left out, see requiresPin, as are the images of
+// COPY --from and RUN --mount=from that use variables.
+func (du *ContainerfileUpdater) UnpinnedReferences() ([]UnpinnedReference, error) {
+	commands, err := du.extractImages()
+	if err != nil {
+		return nil, err
+	}
+
+	unpinned := []UnpinnedReference{}
+	for _, cmd := range commands {
+		if requiresPin(cmd) && cmd.PreviousDigest == "" {
+			unpinned = append(unpinned, UnpinnedReference{Line: cmd.LineStart, Image: cmd.Image.Original, Kind: "image"})
+		}
+	}
+	// The updater leaves the images of other instructions alone, so only the graph has them
+	if du.format == formatContainerfile && du.graph != nil {
+		for _, edge := range du.graph.Edges {
+			if edge.Kind == edgeFrom || edge.FromImage == "" || strings.Contains(edge.FromImage, "$") {
+				continue
+			}
+			ref, err := name.ParseReference(edge.FromImage)
+			if err != nil {
+				slog.Warn("Failed to parse image", "line", edge.Line, "image", edge.FromImage, "error", err)
+				continue
+			}
+			if _, pinned := ref.(name.Digest); !pinned {
+				unpinned = append(unpinned, UnpinnedReference{Line: edge.Line, Image: edge.FromImage, Kind: edge.Kind})
+			}
+		}
+	}
+	slices.SortStableFunc(unpinned, func(a, b UnpinnedReference) int { return cmp.Compare(a.Line, b.Line) })
+	return unpinned, nil
+}
+
+// requiresPin reports whether an image must be pinned to a digest. References that can't
+// be pinned as written, such as ones using variables or naming the result of a compose
+// build, are exempt, as are images opted out with an ignore or pin=tag-only annotation.
+// The latter also pass --frozen lock verification without a digest.
+func requiresPin(cmd *FromCommand) bool {
+	if cmd.Unpinnable {
+		return false
+	}
+	return cmd.Annotations == nil || !cmd.Annotations.Ignore && cmd.Annotations.Pin != pinTagOnly
+}
+
+// writeUnpinned prints unpinned references one per line in the file:line: message form,
+// or as error annotations for GitHub Actions
+func writeUnpinned(w io.Writer, files []FilePins, github bool) {
+	for _, file := range files {
+		for _, ref := range file.Unpinned {
+			message := fmt.Sprintf("%s %s is not pinned to a digest", ref.describe(), ref.Image)
+			if github {
+				writeAnnotation(w, "error", file.File, ref.Line, "Unpinned image", message)
+				continue
+			}
+			fmt.Fprintf(w, "%s:%d: %s\n", file.File, ref.Line, message)
+		}
+	}
+}
+
+// runCheckPinned implements the check-pinned subcommand
+func runCheckPinned(args []string) int {
+	fs := flag.NewFlagSet("check-pinned", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	output := fs.String("output", outputText, "Output format (text, json)")
+	github := fs.Bool("github-output", false, "Print unpinned images as error annotations for GitHub Actions")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also check the frontend image of # syntax= directives")
+	scanRun := fs.Bool("scan-run", false, "Also check images pulled inside RUN instructions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s check-pinned [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Report every image, including those of COPY --from and RUN --mount=from, that isn't")
+		fmt.Fprintln(fs.Output(), "pinned to a digest, without contacting any registry.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = everything is pinned, 1 = unpinned images, 2 = files could not be read")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("warn"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if err := validateOutputFormat(*output); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to check", "error", err)
+		return exitError
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+
+	exitCode := exitOK
+	files := []FilePins{}
+	for _, path := range paths {
+		fileFormat, err := resolveFormat(*format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		checker := NewContainerfileUpdaterWithConfig(path, cfg)
+		checker.format = fileFormat
+		checker.pinSyntax = *pinSyntax
+		unpinned, err := checker.UnpinnedReferences()
+		if err != nil {
+			slog.Error("Failed to extract images", "path", path, "error", err)
+			exitCode = exitError
+			continue
+		}
+		if len(unpinned) > 0 {
+			exitCode = max(exitCode, exitUpdatesNeeded)
+		}
+		files = append(files, FilePins{File: displayPath(path), Unpinned: unpinned})
+	}
+
+	if *output == outputJSON {
+		if err := writeJSONReport(os.Stdout, files); err != nil {
+			slog.Error("Failed to write unpinned images", "error", err)
+			return exitError
+		}
+		return exitCode
+	}
+	writeUnpinned(os.Stdout, files, *github)
+	return exitCode
+}
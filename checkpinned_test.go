@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUnpinnedReferences(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	digest := "sha256:9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e"
+	content := "ARG BASE=debian:12\n" +
+		"FROM golang:1.24 AS build\n" +
+		"COPY --from=ghcr.io/astral-sh/uv:0.8 /uv /bin/\n" +
+		"COPY --from=ghcr.io/astral-sh/uv:0.8@" + digest + " /uvx /bin/\n" +
+		"RUN --mount=type=bind,from=busybox,target=/busybox true\n" +
+		"FROM alpine:3.20@" + digest + "\n" +
+		"COPY --from=build /out /out\n" +
+		"COPY --from=0 /out /out\n" +
+		"COPY --from=$TOOLS /tool /bin/\n" +
+		"FROM ${BASE}\n" +
+		"# containerfile-updater: ignore\n" +
+		"FROM node:20\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewContainerfileUpdaterWithConfig(path, NewConfig())
+	unpinned, err := checker.UnpinnedReferences()
+	if err != nil {
+		t.Fatalf("UnpinnedReferences() failed: %v", err)
+	}
+	want := []UnpinnedReference{
+		{Line: 1, Image: "debian:12", Kind: "image"},
+		{Line: 2, Image: "golang:1.24", Kind: "image"},
+		{Line: 3, Image: "ghcr.io/astral-sh/uv:0.8", Kind: edgeCopy},
+		{Line: 5, Image: "busybox", Kind: edgeMount},
+	}
+	if len(unpinned) != len(want) {
+		t.Fatalf("Expected %d unpinned references, got %+v", len(want), unpinned)
+	}
+	for i := range want {
+		if unpinned[i] != want[i] {
+			t.Errorf("Reference %d: expected %+v, got %+v", i, want[i], unpinned[i])
+		}
+	}
+
+	var out bytes.Buffer
+	writeUnpinned(&out, []FilePins{{File: "Containerfile", Unpinned: unpinned}}, false)
+	if line := "Containerfile:3: COPY --from image ghcr.io/astral-sh/uv:0.8 is not pinned to a digest\n"; !strings.Contains(out.String(), line) {
+		t.Errorf("Expected %q in the output:\n%s", line, out.String())
+	}
+	out.Reset()
+	writeUnpinned(&out, []FilePins{{File: "Containerfile", Unpinned: unpinned[1:2]}}, true)
+	if want := "::error file=Containerfile,line=2,title=Unpinned image::image golang:1.24 is not pinned to a digest\n"; out.String() != want {
+		t.Errorf("Expected annotation %q, got %q", want, out.String())
+	}
+}
+
+func TestUnpinnedReferencesExemptions(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	// The update filters don't exempt images from pinning, annotations do
+	content := "FROM redis:7 AS cache\n" +
+		"# containerfile-updater: pin=tag-only\n" +
+		"FROM postgres:16 AS db\n" +
+		"FROM alpine:3.20\n"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.Images.Deny = []string{"redis*"}
+	cfg.Images.Allow = []string{"postgres*"}
+
+	unpinned, err := NewContainerfileUpdaterWithConfig(path, cfg).UnpinnedReferences()
+	if err != nil {
+		t.Fatalf("UnpinnedReferences() failed: %v", err)
+	}
+	var images []string
+	for _, ref := range unpinned {
+		images = append(images, ref.Image)
+	}
+	if want := []string{"redis:7", "alpine:3.20"}; !slices.Equal(images, want) {
+		t.Errorf("Expected %v unpinned, got %v", want, images)
+	}
+
+	// References using variables can't be pinned as written
+	compose := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(compose, []byte("services:\n  app:\n    image: ghcr.io/org/app:${TAG}\n  web:\n    image: nginx:1.27\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checker := NewContainerfileUpdaterWithConfig(compose, NewConfig())
+	checker.format = formatCompose
+	unpinned, err = checker.UnpinnedReferences()
+	if err != nil {
+		t.Fatalf("UnpinnedReferences() failed: %v", err)
+	}
+	if len(unpinned) != 1 || unpinned[0].Image != "nginx:1.27" {
+		t.Errorf("Expected only nginx:1.27 unpinned, got %+v", unpinned)
+	}
+}
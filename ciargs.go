@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ciImageVariablePattern matches the names of CI variables, matrix entries and build
+// arguments whose values are pinned, such as BASE_IMAGE or image. Other values are left
+// alone even when they look like a reference.
+var ciImageVariablePattern = regexp.MustCompile(`(?i)image`)
+
+// buildArgPattern matches a KEY=value line of a build-args input
+var buildArgPattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)=(\S+)\s*$`)
+
+// extractCIVariableImages returns the images of a mapping of CI variables or matrix entries.
+// Each value is a scalar, a list of scalars (matrix axes) or a GitLab variable mapping with
+// a value key.
+func (du *ContainerfileUpdater) extractCIVariableImages(mapping *yaml.Node) []*FromCommand {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	var images []*FromCommand
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if !ciImageVariablePattern.MatchString(key.Value) {
+			continue
+		}
+		if _, nested := yamlMappingValue(value, "value"); nested != nil {
+			value = nested
+		}
+		values := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			// Right to left, so rewriting one value of a flow sequence doesn't move the others
+			values = slices.Clone(value.Content)
+			slices.Reverse(values)
+		}
+		for _, value := range values {
+			// Expressions and plain settings are no concern of the updater
+			if value.Kind != yaml.ScalarNode || !looksLikeImage(value.Value) {
+				continue
+			}
+			if cmd := du.yamlImageCommand(key, value); cmd != nil {
+				images = append(images, cmd)
+			}
+		}
+	}
+	return images
+}
+
+// extractMatrixImages returns the images of a GitHub Actions strategy.matrix, including its
+// include and exclude entries so they keep matching the pinned axes
+func (du *ContainerfileUpdater) extractMatrixImages(matrix *yaml.Node) []*FromCommand {
+	images := du.extractCIVariableImages(matrix)
+	for _, field := range []string{"include", "exclude"} {
+		_, entries := yamlMappingValue(matrix, field)
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range entries.Content {
+			images = append(images, du.extractCIVariableImages(entry)...)
+		}
+	}
+	return images
+}
+
+// extractBuildArgImages returns the images of a build-args input given as KEY=value lines,
+// as docker/build-push-action takes them. Folded scalars are skipped, as their lines don't
+// map onto the file's.
+func (du *ContainerfileUpdater) extractBuildArgImages(key, value *yaml.Node) []*FromCommand {
+	if value == nil || value.Kind != yaml.ScalarNode || value.Style&yaml.FoldedStyle != 0 {
+		return nil
+	}
+	lines := strings.Split(value.Value, "\n")
+	literal := value.Style&yaml.LiteralStyle != 0
+	if !literal && len(lines) > 1 {
+		slog.Warn("Skipping multi-line build-args value", "line", value.Line)
+		return nil
+	}
+
+	var images []*FromCommand
+	for i, line := range lines {
+		match := buildArgPattern.FindStringSubmatch(line)
+		if match == nil || !ciImageVariablePattern.MatchString(match[1]) || !looksLikeImage(match[2]) {
+			continue
+		}
+		image, err := du.parseImageReference(match[2])
+		if err != nil {
+			slog.Warn("Failed to parse image", "line", value.Line, "error", err)
+			continue
+		}
+		// A literal block starts on the line after its indicator
+		lineNumber := value.Line
+		if literal {
+			lineNumber += 1 + i
+		}
+		cmd := &FromCommand{
+			Image:       image,
+			LineStart:   lineNumber,
+			LineEnd:     lineNumber,
+			Annotations: du.yamlAnnotations(lineNumber, key),
+			editor:      buildArgEditor(match[1]),
+		}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images
+}
+
+// buildArgEditor rewrites the value of a NAME=value build argument on the command's line
+func buildArgEditor(name string) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		index := cmd.LineStart - 1
+		if index < 0 || index >= len(lines) {
+			return lines, false
+		}
+		start := strings.Index(lines[index], name+"=")
+		if start < 0 {
+			return lines, false
+		}
+		return spanEditor(start+len(name)+1)(lines, cmd)
+	}
+}
@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// Cloud keychains that can be enabled with cloudKeychains in the config file.
+// None of them link a cloud SDK: tokens come from the provider's APIs and
+// instance metadata services, or its CLI, so ambient credentials (IAM roles,
+// workload identity, managed identity) work without a docker login step.
+const (
+	cloudKeychainECR    = "ecr"
+	cloudKeychainGoogle = "google"
+	cloudKeychainAzure  = "azure"
+)
+
+// Endpoints used to obtain ambient cloud credentials, overridable in tests
+var (
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	azureIMDSTokenURL   = "http://169.254.169.254/metadata/identity/oauth2/token"
+	acrExchangeURL      = func(registry string) string { return "https://" + registry + "/oauth2/exchange" }
+)
+
+// cloudProbeTimeout bounds requests to metadata endpoints, which outside of their cloud
+// often never answer
+const cloudProbeTimeout = 2 * time.Second
+
+// azureManagementResource is the AAD resource exchanged for an ACR refresh token
+const azureManagementResource = "https://management.azure.com/"
+
+// acrTokenUsername is the fixed username ACR expects alongside a refresh token
+const acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+var (
+	ecrRegistryPattern    = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+	googleRegistryPattern = regexp.MustCompile(`^(?:[a-z0-9-]+\.)?gcr\.io$|^[a-z0-9-]+-docker\.pkg\.dev$`)
+	azureRegistryPattern  = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(?:io|cn|us)$`)
+)
+
+// cloudKeychain resolves credentials for cloud-hosted registries
+type cloudKeychain struct {
+	enabled map[string]bool
+	client  *http.Client // Requests to cloud APIs
+	probe   *http.Client // Requests to metadata endpoints
+
+	mu    sync.Mutex
+	cache map[string]*cloudCredentials // Credentials obtained or being obtained, keyed by registry
+}
+
+// cloudCredentials is the outcome of obtaining the credentials of a registry, complete once
+// done is closed
+type cloudCredentials struct {
+	done chan struct{}
+	cfg  authn.AuthConfig
+	err  error
+}
+
+// validateCloudKeychains checks that every configured provider is known
+func validateCloudKeychains(providers []string) error {
+	for _, provider := range providers {
+		switch strings.ToLower(provider) {
+		case cloudKeychainECR, cloudKeychainGoogle, cloudKeychainAzure:
+		default:
+			return fmt.Errorf("unknown cloud keychain %q (expected ecr, google or azure)", provider)
+		}
+	}
+	return nil
+}
+
+// newCloudKeychain creates a keychain for the enabled providers
+func newCloudKeychain(providers []string) *cloudKeychain {
+	enabled := make(map[string]bool, len(providers))
+	for _, provider := range providers {
+		enabled[strings.ToLower(provider)] = true
+	}
+
+	return &cloudKeychain{
+		enabled: enabled,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		probe:   &http.Client{Timeout: cloudProbeTimeout},
+		cache:   make(map[string]*cloudCredentials),
+	}
+}
+
+// Resolve implements authn.Keychain
+func (k *cloudKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	registry := target.RegistryStr()
+
+	var fetch func(string) (authn.AuthConfig, error)
+	var match []string
+	switch {
+	case k.enabled[cloudKeychainECR] && ecrRegistryPattern.MatchString(registry):
+		match = ecrRegistryPattern.FindStringSubmatch(registry)
+		fetch = func(registry string) (authn.AuthConfig, error) { return k.ecrCredentials(registry, match[1]) }
+	case k.enabled[cloudKeychainGoogle] && googleRegistryPattern.MatchString(registry):
+		fetch = func(string) (authn.AuthConfig, error) { return k.googleCredentials() }
+	case k.enabled[cloudKeychainAzure] && azureRegistryPattern.MatchString(registry):
+		fetch = k.azureCredentials
+	default:
+		return authn.Anonymous, nil
+	}
+
+	// Credentials are obtained once per registry without holding the lock, so a slow
+	// endpoint only delays the lookups of its own registry. Failures are remembered too,
+	// rather than probing unreachable endpoints again for every lookup.
+	k.mu.Lock()
+	creds, ok := k.cache[registry]
+	if !ok {
+		creds = &cloudCredentials{done: make(chan struct{})}
+		k.cache[registry] = creds
+	}
+	k.mu.Unlock()
+
+	if ok {
+		<-creds.done
+	} else {
+		creds.cfg, creds.err = fetch(registry)
+		if creds.err != nil {
+			slog.Warn("Failed to obtain cloud credentials", "registry", registry, "error", creds.err)
+		}
+		close(creds.done)
+	}
+	if creds.err != nil {
+		// Fall through to the Docker config rather than failing outright
+		return authn.Anonymous, nil
+	}
+	return authn.FromConfig(creds.cfg), nil
+}
+
+// googleCredentials obtains an access token from the GCE/GKE metadata server,
+// falling back to the gcloud CLI outside of Google Cloud
+func (k *cloudKeychain) googleCredentials() (authn.AuthConfig, error) {
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return authn.AuthConfig{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	token, err := k.fetchAccessToken(req)
+	if err != nil {
+		if token, err = runCredentialCommand("gcloud", "auth", "print-access-token"); err != nil {
+			return authn.AuthConfig{}, err
+		}
+	}
+	return authn.AuthConfig{Username: "oauth2accesstoken", Password: token}, nil
+}
+
+// azureCredentials obtains an AAD token from the managed identity endpoint (or
+// the az CLI) and exchanges it for an ACR refresh token
+func (k *cloudKeychain) azureCredentials(registry string) (authn.AuthConfig, error) {
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", azureManagementResource)
+	if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+		query.Set("client_id", clientID)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, azureIMDSTokenURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return authn.AuthConfig{}, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	aadToken, err := k.fetchAccessToken(req)
+	if err != nil {
+		aadToken, err = runCredentialCommand("az", "account", "get-access-token",
+			"--resource", azureManagementResource, "--query", "accessToken", "--output", "tsv")
+		if err != nil {
+			return authn.AuthConfig{}, err
+		}
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "access_token")
+	form.Set("service", registry)
+	form.Set("access_token", aadToken)
+	if tenant := os.Getenv("AZURE_TENANT_ID"); tenant != "" {
+		form.Set("tenant", tenant)
+	}
+
+	resp, err := k.client.PostForm(acrExchangeURL(registry), form)
+	if err != nil {
+		return authn.AuthConfig{}, fmt.Errorf("ACR token exchange failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return authn.AuthConfig{}, fmt.Errorf("ACR token exchange failed: %s", resp.Status)
+	}
+
+	var exchange struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&exchange); err != nil {
+		return authn.AuthConfig{}, fmt.Errorf("failed to decode ACR token exchange response: %w", err)
+	}
+	return authn.AuthConfig{Username: acrTokenUsername, Password: exchange.RefreshToken}, nil
+}
+
+// fetchAccessToken performs a metadata token request and returns the access_token field
+func (k *cloudKeychain) fetchAccessToken(req *http.Request) (string, error) {
+	resp, err := k.probe.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request to %s failed: %s", req.URL.Host, resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token response from %s did not include an access token", req.URL.Host)
+	}
+	return token.AccessToken, nil
+}
+
+// runCredentialCommand runs a cloud CLI and returns its trimmed output
+func runCredentialCommand(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestCloudRegistryPatterns(t *testing.T) {
+	tests := []struct {
+		registry string
+		ecr      bool
+		google   bool
+		azure    bool
+	}{
+		{registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com", ecr: true},
+		{registry: "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com", ecr: true},
+		{registry: "gcr.io", google: true},
+		{registry: "eu.gcr.io", google: true},
+		{registry: "us-central1-docker.pkg.dev", google: true},
+		{registry: "myregistry.azurecr.io", azure: true},
+		{registry: "index.docker.io"},
+		{registry: "ghcr.io"},
+	}
+
+	for _, tt := range tests {
+		if got := ecrRegistryPattern.MatchString(tt.registry); got != tt.ecr {
+			t.Errorf("%s: ECR match got %v, want %v", tt.registry, got, tt.ecr)
+		}
+		if got := googleRegistryPattern.MatchString(tt.registry); got != tt.google {
+			t.Errorf("%s: Google match got %v, want %v", tt.registry, got, tt.google)
+		}
+		if got := azureRegistryPattern.MatchString(tt.registry); got != tt.azure {
+			t.Errorf("%s: Azure match got %v, want %v", tt.registry, got, tt.azure)
+		}
+	}
+}
+
+func TestCloudKeychainGoogleMetadata(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing metadata header", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "ya29.test"})
+	}))
+	defer server.Close()
+
+	original := gcpMetadataTokenURL
+	gcpMetadataTokenURL = server.URL
+	defer func() { gcpMetadataTokenURL = original }()
+
+	keychain := newCloudKeychain([]string{"google"})
+	reg, _ := name.NewRegistry("us-docker.pkg.dev")
+
+	for i := 0; i < 2; i++ {
+		auth, err := keychain.Resolve(reg)
+		if err != nil {
+			t.Fatalf("Failed to resolve credentials: %v", err)
+		}
+		cfg, err := auth.Authorization()
+		if err != nil {
+			t.Fatalf("Failed to get authorization: %v", err)
+		}
+		if cfg.Username != "oauth2accesstoken" || cfg.Password != "ya29.test" {
+			t.Errorf("Unexpected credentials: %+v", cfg)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected credentials to be cached, got %d metadata requests", requests)
+	}
+}
+
+func TestCloudKeychainDisabledProvider(t *testing.T) {
+	keychain := newCloudKeychain([]string{"ecr"})
+	reg, _ := name.NewRegistry("gcr.io")
+
+	auth, err := keychain.Resolve(reg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if auth != authn.Anonymous {
+		t.Error("Expected anonymous credentials for a provider that isn't enabled")
+	}
+}
+
+func TestValidateCloudKeychains(t *testing.T) {
+	if err := validateCloudKeychains([]string{"ecr", "Google", "azure"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := validateCloudKeychains([]string{"digitalocean"}); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+}
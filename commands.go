@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// flagEnvPrefix prefixes the environment variables flags can be set with
+const flagEnvPrefix = "CONTAINERFILE_UPDATER_"
+
+// command is a subcommand of the CLI
+type command struct {
+	name     string
+	synopsis string // Arguments after the command name
+	summary  string
+	aliases  []string
+	hidden   bool // Left out of help and completion, for maintainers
+	run      func(args []string) int
+}
+
+// subcommands lists the subcommands in the order help shows them. It is filled in by init
+// because help and completion refer back to it.
+var subcommands []*command
+
+func init() {
+	subcommands = []*command{
+		{name: "update", synopsis: "[flags] <path>...", summary: "Pin images to their current digests and rewrite the files (the default command)", run: runUpdate},
+		{name: "check", synopsis: "[flags] <path>...", summary: "Report whether updates are available without rewriting files", run: runCheck},
+		{name: "verify", synopsis: "[flags] <containerfile-path>", summary: "Check that pinned digests still match their tags", run: runVerify},
+		{name: "deps", synopsis: "[flags] <path>...", summary: "Print the detected images as Renovate-compatible JSON", run: runDeps},
+		{name: "export-digests", synopsis: "[flags] <path>...", summary: "Write the digests of the detected images for --offline runs", run: runExportDigests},
+		{name: "export-images", synopsis: "[flags] <path>...", summary: "List the resolved images or copy them into an OCI layout for air-gapped registries", run: runExportImages},
+		{name: "import-check", synopsis: "[flags] <path>...", summary: "Check that an internal registry already serves every resolved digest", run: runImportCheck},
+		{name: "inspect", synopsis: "[flags] <path>...", summary: "Show the annotations, labels and platforms of the detected images", run: runInspect},
+		{name: "diff", synopsis: "[flags] <old> <new>", summary: "Report the images changed between two revisions of a file", run: runDiff},
+		{name: "lint", synopsis: "[flags] <path>...", summary: "Check images against the policy rules without contacting registries", run: runLint},
+		{name: "check-pinned", synopsis: "[flags] <path>...", summary: "Report images that aren't pinned to a digest without contacting registries", run: runCheckPinned},
+		{name: "stale", synopsis: "[flags] <path>...", summary: "Report how far pinned digests are behind their tags", run: runStale},
+		{name: "explain", synopsis: "[flags] <digest> [<repository>...]", summary: "Find the tags currently pointing to a digest", run: runExplain},
+		{name: "completion", synopsis: "<bash|zsh|fish>", summary: "Print a shell completion script", run: runCompletion},
+		{name: "help", synopsis: "[<command>]", summary: "Show the usage of a command", run: runHelp},
+		{name: "version", synopsis: "[--json]", summary: "Print the build information", aliases: []string{"--version"}, run: runVersion},
+		{name: "selftest", synopsis: "[--update] [<corpus>]", summary: "Run the golden-file corpus against the rewriting code", hidden: true, run: runSelftest},
+	}
+}
+
+// lookupCommand returns the command with a name or alias, or nil
+func lookupCommand(name string) *command {
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			return cmd
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// commandNames returns the names of every command help lists
+func commandNames() []string {
+	var names []string
+	for _, cmd := range subcommands {
+		if !cmd.hidden {
+			names = append(names, cmd.name)
+		}
+	}
+	return names
+}
+
+// writeCommands prints the command list shown by help
+func writeCommands(w io.Writer) {
+	program := filepath.Base(os.Args[0])
+	fmt.Fprintf(w, "Usage: %s [<command>] [flags] <args>\n", program)
+	fmt.Fprintln(w, "Without a command, the arguments are passed to update.")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range subcommands {
+		if !cmd.hidden {
+			fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.synopsis, cmd.summary)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun '%s help <command>' for the flags of a command. Commands that read files or\n", program)
+	fmt.Fprintln(w, "contact registries all accept the logging flags and --config.")
+	fmt.Fprintf(w, "Every flag can also be set with %s<FLAG>, e.g. %s for --log-level.\n", flagEnvPrefix, flagEnvVar("log-level"))
+}
+
+// flagEnvVar returns the environment variable a flag can be set with,
+// e.g. --rate-limit -> CONTAINERFILE_UPDATER_RATE_LIMIT
+func flagEnvVar(name string) string {
+	return flagEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// parseFlags parses the flags of a command after applying their environment variables,
+// so the precedence is config file < environment < flags. Repeatable flags take a
+// comma-separated list from the environment, extended by the flags given. Like
+// flag.ExitOnError, an invalid environment value exits with status 2.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := applyFlagEnv(fs, os.LookupEnv); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	fs.Parse(args)
+}
+
+// applyFlagEnv sets every flag whose environment variable is set
+func applyFlagEnv(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := lookupEnv(flagEnvVar(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		values := []string{value}
+		if _, repeatable := f.Value.(*stringSliceFlag); repeatable {
+			values = strings.Split(value, ",")
+		}
+		for _, value := range values {
+			if setErr := fs.Set(f.Name, strings.TrimSpace(value)); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", value, flagEnvVar(f.Name), setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// runCheck implements the check subcommand, an update that only reports
+func runCheck(args []string) int {
+	return runUpdate(append([]string{"--check"}, args...))
+}
+
+// runHelp implements the help subcommand
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		writeCommands(os.Stdout)
+		return exitOK
+	}
+	cmd := lookupCommand(args[0])
+	if cmd == nil || cmd.name == "help" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		writeCommands(os.Stderr)
+		return exitError
+	}
+	// Every command prints its usage and exits for -h
+	return cmd.run([]string{"-h"})
+}
+
+// runCompletion implements the completion subcommand
+func runCompletion(args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s completion <bash|zsh|fish>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Print a completion script for the shell. Flags are completed from each command's -h")
+		fmt.Fprintln(fs.Output(), "output, so the script keeps up with upgrades of the binary.")
+		fmt.Fprintln(fs.Output(), "\nExamples:")
+		fmt.Fprintf(fs.Output(), "  source <(%s completion bash)\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "  %s completion zsh > \"${fpath[1]}/_%s\"\n", filepath.Base(os.Args[0]), filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "  %s completion fish > ~/.config/fish/completions/%s.fish\n", filepath.Base(os.Args[0]), filepath.Base(os.Args[0]))
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	if err := writeCompletion(os.Stdout, fs.Arg(0), filepath.Base(os.Args[0])); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeCompletion writes the completion script of a shell for the program
+func writeCompletion(w io.Writer, shell, program string) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
+	}
+
+	var descriptions []string
+	for _, cmd := range subcommands {
+		if cmd.hidden {
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("'%s:%s'", cmd.name, strings.ReplaceAll(cmd.summary, "'", "")))
+	}
+	// Shell function names can't contain every character a binary name can
+	function := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, program)
+	_, err := strings.NewReplacer(
+		"{{program}}", program,
+		"{{function}}", function,
+		"{{commands}}", strings.Join(commandNames(), " "),
+		"{{descriptions}}", strings.Join(descriptions, "\n\t\t"),
+	).WriteString(w, script)
+	return err
+}
+
+// bashCompletion completes commands, flags parsed from -h and paths
+const bashCompletion = `# bash completion for {{program}}
+_{{function}}_flags() {
+	"$1" "$2" -h 2>&1 | sed -n 's/^  -\([^ 	]*\).*/--\1/p'
+}
+
+_{{function}}() {
+	local cur=${COMP_WORDS[COMP_CWORD]} command=update
+	if ((COMP_CWORD > 1)) && [[ " {{commands}} " == *" ${COMP_WORDS[1]} "* ]]; then
+		command=${COMP_WORDS[1]}
+	fi
+
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "$(_{{function}}_flags "${COMP_WORDS[0]}" "$command")" -- "$cur"))
+		return
+	fi
+	case $command in
+	completion)
+		((COMP_CWORD == 2)) && COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+		return
+		;;
+	help)
+		((COMP_CWORD == 2)) && COMPREPLY=($(compgen -W "{{commands}}" -- "$cur"))
+		return
+		;;
+	esac
+	COMPREPLY=($(compgen -f -- "$cur"))
+	if ((COMP_CWORD == 1)); then
+		COMPREPLY+=($(compgen -W "{{commands}}" -- "$cur"))
+	fi
+}
+
+complete -o filenames -F _{{function}} {{program}}
+`
+
+// zshCompletion completes commands with their summaries, flags parsed from -h and paths
+const zshCompletion = `#compdef {{program}}
+
+_{{function}}() {
+	local -a commands flags
+	commands=(
+		{{descriptions}}
+	)
+	local command=update
+	if ((CURRENT > 2)) && [[ " {{commands}} " == *" ${words[2]} "* ]]; then
+		command=${words[2]}
+	fi
+
+	if [[ $PREFIX == -* ]]; then
+		flags=(${(f)"$(${words[1]} $command -h 2>&1 | sed -n 's/^  -\([^ 	]*\).*/--\1/p')"})
+		compadd -a flags
+		return
+	fi
+	case $command in
+	completion)
+		((CURRENT == 3)) && compadd bash zsh fish
+		return
+		;;
+	help)
+		((CURRENT == 3)) && _describe command commands
+		return
+		;;
+	esac
+	((CURRENT == 2)) && _describe command commands
+	_files
+}
+
+if [[ $zsh_eval_context[-1] == loadautoload ]]; then
+	_{{function}} "$@"
+else
+	compdef _{{function}} {{program}}
+fi
+`
+
+// fishCompletion completes commands, flags parsed from -h and paths
+const fishCompletion = `# fish completion for {{program}}
+function __{{function}}_command
+	set -l tokens (commandline -opc)
+	if test (count $tokens) -gt 1; and contains -- $tokens[2] {{commands}}
+		echo $tokens[2]
+	else
+		echo update
+	end
+end
+
+function __{{function}}_flags
+	{{program}} (__{{function}}_command) -h 2>&1 | string replace -rf '^  -(\S+).*' -- '--$1'
+end
+
+complete -c {{program}} -n 'string match -q -- "-*" (commandline -ct)' -f -a '(__{{function}}_flags)'
+complete -c {{program}} -n '__fish_use_subcommand' -a '{{commands}}'
+complete -c {{program}} -n '__fish_seen_subcommand_from completion' -f -a 'bash zsh fish'
+complete -c {{program}} -n '__fish_seen_subcommand_from help' -f -a '{{commands}}'
+`
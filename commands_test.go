@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupCommand(t *testing.T) {
+	for name, want := range map[string]string{
+		"update":    "update",
+		"check":     "check",
+		"explain":   "explain",
+		"--version": "version",
+	} {
+		cmd := lookupCommand(name)
+		if cmd == nil || cmd.name != want {
+			t.Errorf("lookupCommand(%q) = %v, want %s", name, cmd, want)
+		}
+	}
+	// Paths fall through to the update command
+	for _, name := range []string{"Containerfile", "./verify", "-check"} {
+		if cmd := lookupCommand(name); cmd != nil {
+			t.Errorf("lookupCommand(%q) = %s, want none", name, cmd.name)
+		}
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var out bytes.Buffer
+		if err := writeCompletion(&out, shell, "containerfile-updater"); err != nil {
+			t.Fatalf("writeCompletion(%s) failed: %v", shell, err)
+		}
+		script := out.String()
+		if strings.Contains(script, "{{") {
+			t.Errorf("%s script has unreplaced placeholders:\n%s", shell, script)
+		}
+		for _, name := range commandNames() {
+			if !strings.Contains(script, name) {
+				t.Errorf("%s script doesn't complete %s", shell, name)
+			}
+		}
+		if !strings.Contains(script, "_containerfile_updater") {
+			t.Errorf("%s script doesn't define a valid function name:\n%s", shell, script)
+		}
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, "powershell", "containerfile-updater"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
+
+func TestBashCompletionSyntax(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+
+	var out bytes.Buffer
+	if err := writeCompletion(&out, "bash", "containerfile-updater"); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "completion.bash")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if output, err := exec.Command(bash, "-n", path).CombinedOutput(); err != nil {
+		t.Errorf("bash -n failed: %v\n%s", err, output)
+	}
+}
+
+func TestApplyFlagEnv(t *testing.T) {
+	env := map[string]string{
+		"CONTAINERFILE_UPDATER_CHECK":             "true",
+		"CONTAINERFILE_UPDATER_TIMEOUT":           "45s",
+		"CONTAINERFILE_UPDATER_OUTPUT":            "json",
+		"CONTAINERFILE_UPDATER_INSECURE_REGISTRY": "a.example.com, b.example.com",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	registry := addRegistryFlags(fs)
+	check := fs.Bool("check", false, "")
+	output := fs.String("output", outputText, "")
+	if err := applyFlagEnv(fs, lookupEnv); err != nil {
+		t.Fatalf("applyFlagEnv() failed: %v", err)
+	}
+	// Flags on the command line win over the environment
+	if err := fs.Parse([]string{"--output", "text", "--insecure-registry", "c.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !*check || *registry.timeout != 45*time.Second {
+		t.Errorf("Environment not applied: check=%v timeout=%v", *check, *registry.timeout)
+	}
+	if *output != outputText {
+		t.Errorf("--output = %s, want the flag's value text", *output)
+	}
+	if got := strings.Join(registry.insecureRegistries, ","); got != "a.example.com,b.example.com,c.example.com" {
+		t.Errorf("--insecure-registry = %s", got)
+	}
+
+	env = map[string]string{"CONTAINERFILE_UPDATER_TIMEOUT": "soon"}
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	addRegistryFlags(fs)
+	if err := applyFlagEnv(fs, lookupEnv); err == nil || !strings.Contains(err.Error(), "CONTAINERFILE_UPDATER_TIMEOUT") {
+		t.Errorf("Expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	t.Setenv("CONTAINERFILE_UPDATER_OUTPUT", "json")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	output := fs.String("output", outputText, "")
+	check := fs.Bool("check", false, "")
+	parseFlags(fs, []string{"--check", "Containerfile"})
+
+	if *output != outputJSON || !*check {
+		t.Errorf("parseFlags() set output=%s check=%v, want json and true", *output, *check)
+	}
+	if fs.NArg() != 1 || fs.Arg(0) != "Containerfile" {
+		t.Errorf("parseFlags() left arguments %q", fs.Args())
+	}
+}
+
+func TestSubcommandFlagEnv(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+	t.Setenv("CONTAINERFILE_UPDATER_OUTPUT", "json")
+
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine:3.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	exitCode := runCheckPinned([]string{"--log-level", "error", path})
+	os.Stdout = stdout
+	writer.Close()
+	var out bytes.Buffer
+	out.ReadFrom(reader)
+
+	if exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	var files []FilePins
+	if err := json.Unmarshal(out.Bytes(), &files); err != nil || len(files) != 1 {
+		t.Errorf("Expected --output json from the environment, got %q (%v)", out.String(), err)
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"log/slog"
+
+	"gopkg.in/yaml.v3"
+)
+
+// extractComposeImages finds the image of every service in a compose file
+func (du *ContainerfileUpdater) extractComposeImages(docs []*yaml.Node) ([]*FromCommand, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	_, services := yamlMappingValue(docs[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var images []*FromCommand
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		service := services.Content[i+1]
+		key, value := yamlMappingValue(service, "image")
+		if value == nil {
+			continue
+		}
+
+		cmd := du.yamlImageCommand(key, value)
+		if cmd == nil {
+			continue
+		}
+		if buildKey, _ := yamlMappingValue(service, "build"); buildKey != nil && cmd.SkipReason == "" {
+			// The image names the result of the build rather than something to pull
+			cmd.SkipReason = "built by compose"
+			cmd.Unpinnable = true
+			slog.Info("Skipping image", "image", cmd.Image.Original, "reason", cmd.SkipReason)
+		}
+		images = append(images, cmd)
+	}
+	return images, nil
+}
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractComposeImages(t *testing.T) {
+	disableLogging()
+
+	content := `services:
+  web:
+    image: nginx:1.25
+  app:
+    build: .
+    image: example/app:dev
+  db:
+    image: "postgres:${PG_VERSION}"
+  cache:
+    # containerfile-updater: ignore
+    image: redis:7
+  worker:
+    command: ["run"]
+`
+	path := filepath.Join(t.TempDir(), "compose.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+
+	du := NewContainerfileUpdater(path)
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+
+	want := []struct {
+		original string
+		line     int
+		skip     string
+	}{
+		{"nginx:1.25", 3, ""},
+		{"example/app:dev", 6, "built by compose"},
+		{"postgres:${PG_VERSION}", 8, "uses variable interpolation"},
+		{"redis:7", 11, "ignored by annotation"},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Expected %d images, got %d", len(want), len(images))
+	}
+	for i, w := range want {
+		if images[i].Image.Original != w.original || images[i].LineStart != w.line || images[i].SkipReason != w.skip {
+			t.Errorf("Image %d: expected %s at line %d (skip %q), got %s at line %d (skip %q)",
+				i, w.original, w.line, w.skip, images[i].Image.Original, images[i].LineStart, images[i].SkipReason)
+		}
+	}
+}
+
+func TestUpdateComposeFile(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	web := pushRandomImage(t, server, host+"/web:1.0")
+	api := pushRandomImage(t, server, host+"/api:2.0")
+
+	content := `# Local development stack
+services:
+  web:
+    image: ` + host + `/web:1.0   # frontend
+    ports:
+      - "8080:80"
+
+  api:
+    # containerfile-updater: pin=tag-digest
+    image: "` + host + `/api:2.0"
+`
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read compose file: %v", err)
+	}
+
+	expected := strings.NewReplacer(
+		host+"/web:1.0", host+"/web@"+web.String(),
+		host+"/api:2.0", host+"/api:2.0@"+api.String(),
+	).Replace(content)
+	if string(data) != expected {
+		t.Errorf("Unexpected compose file:\n%s\nexpected:\n%s", string(data), expected)
+	}
+}
+
+func TestComposeExactSpans(t *testing.T) {
+	disableLogging()
+
+	// The reference also appears in keys and comments of its line, after non-ASCII text
+	content := `services:
+  image:
+    image: image # image
+  wéb: {image: "nginx", labels: {app: nginx}}
+  proxy:
+    image: 'docker.io/library/nginx'  # was nginx
+`
+	expected := `services:
+  image:
+    image: library/image@sha256:abc # image
+  wéb: {image: "library/nginx@sha256:abc", labels: {app: nginx}}
+  proxy:
+    image: 'library/nginx@sha256:abc'  # was nginx
+`
+	path := filepath.Join(t.TempDir(), "compose.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+
+	du := NewContainerfileUpdater(path)
+	du.backup.Disabled = true
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+	for _, cmd := range images {
+		cmd.Image.Digest = "sha256:abc"
+	}
+	if err := du.reconstructAndWriteContainerfile(images); err != nil {
+		t.Fatalf("Failed to rewrite compose file: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read compose file: %v", err)
+	}
+	if string(got) != expected {
+		t.Errorf("Compose file mismatch.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
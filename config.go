@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is loaded from the working directory when --config isn't given
+const defaultConfigFile = ".containerfile-updater.yaml"
+
+// Config holds settings loaded from the configuration file
+type Config struct {
+	Registries      map[string]*RegistryConfig `yaml:"registries"`      // Per-registry settings keyed by host
+	CloudKeychains  []string                   `yaml:"cloudKeychains"`  // Cloud credential providers to enable (ecr, google, azure)
+	Proxy           string                     `yaml:"proxy"`           // Proxy URL for registry traffic (overrides HTTP(S)_PROXY)
+	NoProxy         string                     `yaml:"noProxy"`         // Comma-separated hosts, domains and CIDRs that bypass the proxy
+	Images          ImageFilterConfig          `yaml:"images"`          // Allow/deny patterns for image references
+	Attestations    AttestationConfig          `yaml:"attestations"`    // Attestations required before a new digest is pinned
+	Vulnerabilities VulnerabilityConfig        `yaml:"vulnerabilities"` // Vulnerability scan gate for new digests
+	ContentTrust    ContentTrustConfig         `yaml:"contentTrust"`    // Signature verification of new digests
+	Helm            HelmConfig                 `yaml:"helm"`            // Image coordinate paths in Helm values files
+	Tracking        []TrackingRule             `yaml:"tracking"`        // Channel tags followed instead of the written tags
+	Rewrites        []RewriteRule              `yaml:"rewrites"`        // Registries written references are moved to
+	RunImages       RunImagesConfig            `yaml:"runImages"`       // Images pulled by commands inside RUN instructions
+	Cooldown        []CooldownRule             `yaml:"cooldown"`        // Minimum release age and update schedule per image
+	Platforms       PlatformConfig             `yaml:"platforms"`       // Platforms every new digest must provide
+	Catalog         CatalogConfig              `yaml:"catalog"`         // Approved base images and the tags they are pinned to
+	Lint            LintConfig                 `yaml:"lint"`            // Levels of the policy rules
+	Signing         SigningConfig              `yaml:"signing"`         // Signatures of the lock file and JSON report
+	ReferenceFormat string                     `yaml:"referenceFormat"` // Template or shorthand pinned references are written with
+	Qualification   string                     `yaml:"qualification"`   // How Docker Hub names are written: short, library (default) or fully-qualified
+	Timeout         time.Duration              `yaml:"timeout"`         // Time allowed per image lookup (default 30s, --timeout overrides)
+	RateLimit       float64                    `yaml:"rateLimit"`       // Requests per second to each registry (0 for no limit)
+	RateBurst       int                        `yaml:"rateBurst"`       // Requests sent at once before rateLimit applies (default 1)
+	Templates       TemplateConfig             `yaml:"templates"`       // Templates for commit messages and change requests
+	BaseFiles       []string                   `yaml:"baseFiles"`       // Files whose build arguments are the source of truth for other Containerfiles
+	EnvFiles        []string                   `yaml:"envFiles"`        // Patterns of KEY=value files whose image values are pinned
+	Hooks           HooksConfig                `yaml:"hooks"`           // Commands run before and after each file is rewritten
+	ChangeRequests  ChangeRequestConfig        `yaml:"changeRequests"`  // How changes are split into pull/merge requests
+	Profiles        map[string]yaml.Node       `yaml:"profiles"`        // Named sets of settings merged over the others with --profile
+
+	limiters *rateLimiters    // Request budgets per registry, shared by every updater using this config
+	tagLists *tagLists        // Tag lists per repository, shared like the request budgets
+	pullers  *registryPullers // Authenticated pullers per registry, shared like the request budgets
+}
+
+// RegistryConfig holds settings for a single registry host
+type RegistryConfig struct {
+	Auth            *RegistryAuth `yaml:"auth"`
+	Insecure        bool          `yaml:"insecure"`        // Allow plain HTTP and skip TLS verification
+	CAFile          string        `yaml:"caFile"`          // PEM bundle of additional CAs trusted for this registry
+	CertFile        string        `yaml:"certFile"`        // PEM client certificate for mTLS
+	KeyFile         string        `yaml:"keyFile"`         // PEM private key for the client certificate
+	Proxy           string        `yaml:"proxy"`           // Proxy URL for this registry, or "direct" to bypass any proxy
+	Mirror          string        `yaml:"mirror"`          // Pull-through cache (host with optional path prefix) queried for digests
+	WriteMirror     bool          `yaml:"writeMirror"`     // Write references pointing at the mirror instead of this registry
+	CopyMirror      bool          `yaml:"copyMirror"`      // Copy digests missing from the mirror there before pinning them
+	Timeout         time.Duration `yaml:"timeout"`         // Time allowed per image lookup on this registry (overrides the global timeout)
+	RateLimit       float64       `yaml:"rateLimit"`       // Requests per second to this registry (overrides the global rate limit)
+	RateBurst       int           `yaml:"rateBurst"`       // Requests sent at once before rateLimit applies (default 1)
+	TagList         string        `yaml:"tagList"`         // API tags are listed with: registry, or quay (default for quay.io)
+	Resolver        string        `yaml:"resolver"`        // Backend digests are resolved with: registry (default), or skopeo
+	ReferenceFormat string        `yaml:"referenceFormat"` // Template or shorthand references to this registry are written with
+}
+
+// NewConfig returns an empty configuration
+func NewConfig() *Config {
+	return &Config{Registries: make(map[string]*RegistryConfig), limiters: &rateLimiters{}, tagLists: &tagLists{}, pullers: &registryPullers{}}
+}
+
+// LoadConfig reads a YAML configuration file. An empty path loads the default
+// file from the working directory if present, otherwise an empty configuration.
+func LoadConfig(path string) (*Config, error) {
+	return LoadConfigProfile(path, "")
+}
+
+// LoadConfigProfile reads a YAML configuration file like LoadConfig, with the settings of
+// the named profile merged over the others. An empty name uses the settings as they are.
+func LoadConfigProfile(path, profile string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			if profile != "" {
+				return nil, fmt.Errorf("profile %q needs a config file, but %s doesn't exist", profile, path)
+			}
+			return NewConfig(), nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := NewConfig()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := validateProfiles(cfg.Profiles); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if profile != "" {
+		if cfg, err = cfg.withProfile(data, profile); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	// Normalize registry keys so lookups match go-containerregistry's names
+	registries := make(map[string]*RegistryConfig, len(cfg.Registries))
+	for host, registry := range cfg.Registries {
+		if registry == nil {
+			registry = &RegistryConfig{}
+		}
+		registries[normalizeRegistry(host)] = registry
+	}
+	cfg.Registries = registries
+
+	if err := validateCloudKeychains(cfg.CloudKeychains); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := NewImageFilter(cfg.Images); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateAttestationKinds(cfg.Attestations.Require); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateContentTrustConfig(cfg.ContentTrust); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateVulnerabilityConfig(cfg.Vulnerabilities); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateTimeouts(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateRateLimits(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := loadMessageTemplates(cfg.Templates); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := loadBaseArgs(cfg.BaseFiles); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := compileEnvFilePatterns(cfg.EnvFiles); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateLintConfig(cfg.Lint); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateSigningConfig(cfg.Signing); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := newReferenceFormats(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := newBaseImageCatalog(cfg.Catalog); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validatePlatformConfig(cfg.Platforms); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateHelmConfig(cfg.Helm); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	for host, registry := range cfg.Registries {
+		if err := validateTagList(registry.TagList); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: registry %s: %w", path, host, err)
+		}
+		if err := validateResolver(registry.Resolver); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: registry %s: %w", path, host, err)
+		}
+		if registry.Mirror != "" {
+			if err := validateMirror(registry.Mirror); err != nil {
+				return nil, fmt.Errorf("invalid config file %s: registry %s: %w", path, host, err)
+			}
+		} else if registry.WriteMirror || registry.CopyMirror {
+			return nil, fmt.Errorf("invalid config file %s: registry %s: writeMirror and copyMirror need a mirror", path, host)
+		}
+	}
+	if _, err := newTagTracker(cfg.Tracking); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := newRegistryRewriter(cfg.Rewrites); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := newRunImageScanner(cfg.RunImages); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, err := newCooldownPolicy(cfg.Cooldown); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateHooksConfig(cfg.Hooks); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if err := validateGroupBy(cfg.ChangeRequests.GroupBy); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Registry returns the settings for a registry host, or nil if none are configured
+func (c *Config) Registry(host string) *RegistryConfig {
+	if c == nil {
+		return nil
+	}
+	return c.Registries[normalizeRegistry(host)]
+}
+
+// RegistryOrCreate returns the settings for a registry host, adding an empty entry if needed
+func (c *Config) RegistryOrCreate(host string) *RegistryConfig {
+	key := normalizeRegistry(host)
+	if c.Registries == nil {
+		c.Registries = make(map[string]*RegistryConfig)
+	}
+	if c.Registries[key] == nil {
+		c.Registries[key] = &RegistryConfig{}
+	}
+	return c.Registries[key]
+}
+
+// normalizeRegistry maps the different spellings of a registry host to one key
+func normalizeRegistry(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimSuffix(host, "/")
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "docker.io":
+		return "docker.io"
+	}
+	return host
+}
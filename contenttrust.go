@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Supported content trust verifiers
+const (
+	trustDocker   = "docker"   // Docker Content Trust (Notary v1/TUF) through `docker trust inspect`
+	trustNotation = "notation" // Notary Project signatures (Notary v2) through `notation verify`
+)
+
+// defaultTrustTimeout bounds a single signature verification
+const defaultTrustTimeout = 2 * time.Minute
+
+// errUnsigned reports that a verifier found no signature for an image
+var errUnsigned = errors.New("no signature found")
+
+// ContentTrustConfig configures the signature check of candidate digests
+type ContentTrustConfig struct {
+	Verifier string        `yaml:"verifier"` // docker or notation; empty disables verification unless required
+	Require  bool          `yaml:"require"`  // Hold back updates to digests without a signature (fail closed)
+	Server   string        `yaml:"server"`   // Notary server for docker trust (defaults to Docker's for each registry)
+	Timeout  time.Duration `yaml:"timeout"`  // Time allowed per verification (default 2m)
+}
+
+// validateContentTrustConfig rejects unknown verifiers and options they don't support
+func validateContentTrustConfig(tc ContentTrustConfig) error {
+	switch tc.Verifier {
+	case "", trustDocker, trustNotation:
+	default:
+		return fmt.Errorf("unknown content trust verifier %q (expected %s or %s)", tc.Verifier, trustDocker, trustNotation)
+	}
+	if tc.Server != "" && tc.verifier() != trustDocker {
+		return fmt.Errorf("content trust server is only supported with %s", trustDocker)
+	}
+	if tc.Timeout < 0 {
+		return fmt.Errorf("content trust timeout must not be negative")
+	}
+	return nil
+}
+
+// verifier returns the configured verifier, Docker Content Trust if only required
+func (tc ContentTrustConfig) verifier() string {
+	if tc.Verifier == "" && tc.Require {
+		return trustDocker
+	}
+	return tc.Verifier
+}
+
+// checkContentTrust holds back an update whose candidate digest isn't the one signed for
+// its tag. Unsigned images are only held when signatures are required, and are otherwise
+// updated with a warning.
+func (du *ContainerfileUpdater) checkContentTrust(ctx context.Context, cmd *FromCommand, digest string) string {
+	tc := du.config.ContentTrust
+	verifier := tc.verifier()
+	if verifier == "" {
+		return ""
+	}
+
+	timeout := tc.Timeout
+	if timeout == 0 {
+		timeout = defaultTrustTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var err error
+	switch {
+	case verifier == trustNotation:
+		err = du.verifyNotation(ctx, cmd.Image, digest)
+	case cmd.Image.Tag == "":
+		// Docker Content Trust signs tags, a digest-only reference has nothing to check
+		err = errUnsigned
+	default:
+		err = du.verifyDockerTrust(ctx, cmd.Image, digest)
+	}
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errUnsigned):
+		if tc.Require {
+			return "content trust: " + err.Error()
+		}
+		slog.Warn("Image isn't signed", "image", cmd.Image.Original, "verifier", verifier)
+		return ""
+	default:
+		return fmt.Sprintf("could not verify content trust: %v", err)
+	}
+}
+
+// dockerTrustReport is the output of `docker trust inspect`
+type dockerTrustReport []struct {
+	Name       string `json:"Name"`
+	SignedTags []struct {
+		SignedTag string `json:"SignedTag"`
+		Digest    string `json:"Digest"` // Hex without the algorithm
+	} `json:"SignedTags"`
+}
+
+// signedDigest returns the digest signed for a tag, or errUnsigned
+func (r dockerTrustReport) signedDigest(tag string) (string, error) {
+	for _, repository := range r {
+		for _, signed := range repository.SignedTags {
+			if signed.SignedTag == tag {
+				return "sha256:" + signed.Digest, nil
+			}
+		}
+	}
+	return "", errUnsigned
+}
+
+// verifyDockerTrust checks a digest against the one Docker Content Trust signed for the tag
+func (du *ContainerfileUpdater) verifyDockerTrust(ctx context.Context, image *ImageReference, digest string) error {
+	ref := image.Name() + ":" + image.Tag
+	cmd := exec.CommandContext(ctx, trustDocker, "trust", "inspect", ref)
+	cmd.Env = os.Environ()
+	if server := du.config.ContentTrust.Server; server != "" {
+		cmd.Env = append(cmd.Env, "DOCKER_CONTENT_TRUST_SERVER="+server)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+	var report dockerTrustReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil || runErr != nil && len(report) == 0 {
+		message := strings.TrimSpace(stderr.String())
+		if strings.Contains(strings.ToLower(message), "no signatures") {
+			return errUnsigned
+		}
+		if runErr == nil {
+			runErr = err
+		}
+		return fmt.Errorf("docker trust inspect %s: %w: %s", ref, runErr, message)
+	}
+
+	signed, err := report.signedDigest(image.Tag)
+	if err != nil {
+		return err
+	}
+	if signed != digest {
+		return fmt.Errorf("%s is signed as %s, not %s", ref, signed, digest)
+	}
+	return nil
+}
+
+// verifyNotation verifies the signatures of a digest against notation's trust policy
+func (du *ContainerfileUpdater) verifyNotation(ctx context.Context, image *ImageReference, digest string) error {
+	ref := image.Name() + "@" + digest
+	args := []string{"verify"}
+	if registry := du.config.Registry(image.Registry); registry != nil && registry.Insecure {
+		args = append(args, "--insecure-registry")
+	}
+	cmd := exec.CommandContext(ctx, trustNotation, append(args, ref)...)
+	cmd.Env = os.Environ()
+	if username, password := du.scannerCredentials(image.Registry); username != "" {
+		cmd.Env = append(cmd.Env, "NOTATION_USERNAME="+username, "NOTATION_PASSWORD="+password)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if strings.Contains(strings.ToLower(message), "no signature is associated") {
+			return errUnsigned
+		}
+		return fmt.Errorf("notation verify %s: %w: %s", ref, err, message)
+	}
+	return nil
+}
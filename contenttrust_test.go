@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestValidateContentTrustConfig(t *testing.T) {
+	valid := []ContentTrustConfig{
+		{},
+		{Verifier: trustDocker, Server: "https://notary.example.com"},
+		{Require: true, Server: "https://notary.example.com"},
+		{Verifier: trustNotation, Require: true},
+	}
+	for _, tc := range valid {
+		if err := validateContentTrustConfig(tc); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", tc, err)
+		}
+	}
+
+	invalid := []ContentTrustConfig{
+		{Verifier: "cosign"},
+		{Verifier: trustNotation, Server: "https://notary.example.com"},
+		{Verifier: trustDocker, Timeout: -1},
+	}
+	for _, tc := range invalid {
+		if err := validateContentTrustConfig(tc); err == nil {
+			t.Errorf("Expected %+v to be invalid", tc)
+		}
+	}
+}
+
+// installFakeDockerTrust puts a docker script on PATH whose trust inspect reports the
+// given digest as signed for every tag, or no signatures if it is empty
+func installFakeDockerTrust(t *testing.T, signedDigest string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake docker is a shell script")
+	}
+
+	output := `echo '[]'; echo "No signatures or cannot access $3" >&2; exit 1`
+	if signedDigest != "" {
+		output = fmt.Sprintf(`echo "[{\"Name\":\"$3\",\"SignedTags\":[{\"SignedTag\":\"${3##*:}\",\"Digest\":\"%s\"}]}]"`,
+			strings.TrimPrefix(signedDigest, "sha256:"))
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+output+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake docker: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestContentTrustGate(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	old := pushRandomImage(t, server, host+"/app:v1")
+	latest := pushRandomImage(t, server, host+"/app:v1")
+	content := "FROM " + host + "/app:v1@" + old.String() + "\n"
+
+	tests := []struct {
+		name    string
+		signed  string
+		trust   ContentTrustConfig
+		updated bool
+		reason  string
+	}{
+		{name: "signed", signed: latest.String(), trust: ContentTrustConfig{Require: true}, updated: true},
+		{name: "signed for another digest", signed: old.String(), trust: ContentTrustConfig{Verifier: trustDocker}, reason: "is signed as " + old.String()},
+		{name: "unsigned and required", trust: ContentTrustConfig{Require: true}, reason: "content trust: no signature found"},
+		{name: "unsigned and optional", trust: ContentTrustConfig{Verifier: trustDocker}, updated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeDockerTrust(t, tt.signed)
+			path := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			cfg.ContentTrust = tt.trust
+			du := NewContainerfileUpdaterWithConfig(path, cfg)
+			if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+				t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+			}
+
+			cmd := du.fromCommands[0]
+			if tt.updated != (cmd.Image.Digest == latest.String()) {
+				t.Errorf("Updated = %v, want %v (digest %s)", !tt.updated, tt.updated, cmd.Image.Digest)
+			}
+			if !strings.Contains(cmd.HeldReason, tt.reason) || (tt.reason == "") != (cmd.HeldReason == "") {
+				t.Errorf("HeldReason = %q, want %q", cmd.HeldReason, tt.reason)
+			}
+		})
+	}
+}
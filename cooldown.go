@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Named update schedules and the minimum age of the pinned image they stand for
+var schedules = map[string]time.Duration{
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+}
+
+// CooldownRule slows down updates of images matching a pattern
+type CooldownRule struct {
+	Image             string `yaml:"image"`             // Image pattern, as in the allow/deny lists
+	MinimumReleaseAge string `yaml:"minimumReleaseAge"` // How old a new digest must be before it is pinned, e.g. 3d
+	Schedule          string `yaml:"schedule"`          // How old the pinned digest must be before it is replaced (daily, weekly, monthly or a duration)
+	MaxPinAge         string `yaml:"maxPinAge"`         // How old the pinned digest may get before a newer tag is proposed, e.g. 90d
+}
+
+// cooldownPolicy picks the cooldown rule of an image from the configured rules
+type cooldownPolicy struct {
+	patterns    []*regexp.Regexp
+	rules       []CooldownRule
+	minimumAges []time.Duration
+	intervals   []time.Duration
+	maxPinAges  []time.Duration
+}
+
+// parseAge parses a Go duration, also accepting whole days ("3d") and weeks ("2w")
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return age, nil
+}
+
+// formatAge renders an age in days, or hours when shorter than two days
+func formatAge(age time.Duration) string {
+	if age >= 48*time.Hour {
+		return fmt.Sprintf("%dd", age/(24*time.Hour))
+	}
+	return fmt.Sprintf("%dh", age/time.Hour)
+}
+
+// newCooldownPolicy compiles cooldown rules; the first matching rule wins
+func newCooldownPolicy(rules []CooldownRule) (*cooldownPolicy, error) {
+	policy := &cooldownPolicy{}
+	for _, rule := range rules {
+		var minimumAge, interval, maxPinAge time.Duration
+		var err error
+		if rule.MinimumReleaseAge != "" {
+			if minimumAge, err = parseAge(rule.MinimumReleaseAge); err != nil {
+				return nil, fmt.Errorf("invalid minimumReleaseAge for %s: %w", rule.Image, err)
+			}
+		}
+		if rule.Schedule != "" {
+			var ok bool
+			if interval, ok = schedules[rule.Schedule]; !ok {
+				if interval, err = parseAge(rule.Schedule); err != nil {
+					return nil, fmt.Errorf("invalid schedule for %s (expected daily, weekly, monthly or a duration): %w", rule.Image, err)
+				}
+			}
+		}
+		if rule.MaxPinAge != "" {
+			if maxPinAge, err = parseAge(rule.MaxPinAge); err != nil {
+				return nil, fmt.Errorf("invalid maxPinAge for %s: %w", rule.Image, err)
+			}
+		}
+		patterns, err := compilePatterns([]string{rule.Image})
+		if err != nil {
+			return nil, fmt.Errorf("invalid cooldown pattern: %w", err)
+		}
+		policy.patterns = append(policy.patterns, patterns[0])
+		policy.rules = append(policy.rules, rule)
+		policy.minimumAges = append(policy.minimumAges, minimumAge)
+		policy.intervals = append(policy.intervals, interval)
+		policy.maxPinAges = append(policy.maxPinAges, maxPinAge)
+	}
+	return policy, nil
+}
+
+// ruleFor returns the index of the rule applying to an image, or -1
+func (p *cooldownPolicy) ruleFor(image *ImageReference) int {
+	if p == nil {
+		return -1
+	}
+	candidates := referenceCandidates(image)
+	for i, pattern := range p.patterns {
+		if matchAny([]*regexp.Regexp{pattern}, candidates) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// expired reports whether a pin of some age is past the maximum pin age of a rule
+func (p *cooldownPolicy) expired(i int, age time.Duration) bool {
+	return p.maxPinAges[i] > 0 && age > p.maxPinAges[i]
+}
+
+// checkCooldown holds back an update whose candidate digest is younger than the minimum
+// release age, or that would replace a pin younger than the schedule allows unless that pin
+// is past its maximum age. It returns the reason the update was held, or an empty string.
+func (du *ContainerfileUpdater) checkCooldown(ctx context.Context, cmd *FromCommand, digest string) string {
+	i := du.cooldown.ruleFor(cmd.Image)
+	if i < 0 {
+		return ""
+	}
+	rule, now := du.cooldown.rules[i], time.Now()
+
+	if minimumAge := du.cooldown.minimumAges[i]; minimumAge > 0 {
+		created, err := du.imageCreated(ctx, cmd, digest)
+		if err != nil {
+			return fmt.Sprintf("could not check release age: %v", err)
+		}
+		if age := now.Sub(created); age < minimumAge {
+			return fmt.Sprintf("released %s ago, minimum release age is %s", formatAge(age), rule.MinimumReleaseAge)
+		}
+	}
+
+	if interval := du.cooldown.intervals[i]; interval > 0 && cmd.PreviousDigest != "" {
+		created, err := du.imageCreated(ctx, cmd, cmd.PreviousDigest)
+		if err != nil {
+			return fmt.Sprintf("could not check schedule: %v", err)
+		}
+		if age := now.Sub(created); age < interval && !du.cooldown.expired(i, age) {
+			return fmt.Sprintf("current pin released %s ago, schedule is %s", formatAge(age), rule.Schedule)
+		}
+	}
+	return ""
+}
+
+// imageCreated returns the creation time recorded in an image's config, picking the
+// FROM instruction's platform (or linux/amd64) from multi-platform indexes
+func (du *ContainerfileUpdater) imageCreated(ctx context.Context, cmd *FromCommand, digest string) (time.Time, error) {
+	image := cmd.Image
+	options, err := du.remoteOptions(ctx, image.Registry)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if cmd.Platform != "" && !strings.Contains(cmd.Platform, "$") {
+		if platform, err := v1.ParsePlatform(cmd.Platform); err == nil {
+			options = append(options, remote.WithPlatform(*platform))
+		}
+	}
+
+	ref, err := name.NewDigest(image.Name()+"@"+digest, referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse reference %s@%s: %w", image.Name(), digest, err)
+	}
+	img, err := remote.Image(ref, options...)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	config, err := img.ConfigFile()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read config of %s: %w", ref, err)
+	}
+
+	// Reproducible builds often record the epoch, which says nothing about the release
+	if config.Created.Unix() <= 0 {
+		return time.Time{}, fmt.Errorf("%s records no creation time", ref)
+	}
+	return config.Created.Time, nil
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// pushImageCreatedAt pushes a random image whose config records the given creation time
+func pushImageCreatedAt(t *testing.T, server *httptest.Server, reference string, created time.Time) v1.Hash {
+	t.Helper()
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("Failed to create random image: %v", err)
+	}
+	if img, err = mutate.CreatedAt(img, v1.Time{Time: created}); err != nil {
+		t.Fatalf("Failed to set creation time: %v", err)
+	}
+
+	ref, err := name.ParseReference(reference, name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	transport := server.Client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if err := remote.Write(ref, img, remote.WithTransport(transport)); err != nil {
+		t.Fatalf("Failed to push image: %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Failed to compute digest: %v", err)
+	}
+	return digest
+}
+
+func TestCooldown(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	now := time.Now()
+	old := pushImageCreatedAt(t, server, host+"/base:old", now.Add(-10*24*time.Hour))
+	recent := pushImageCreatedAt(t, server, host+"/base:recent", now.Add(-2*24*time.Hour))
+	pushImageCreatedAt(t, server, host+"/base:fresh", now.Add(-time.Hour))
+	pushImageCreatedAt(t, server, host+"/base:epoch", time.Unix(0, 0))
+
+	tests := []struct {
+		name     string
+		rule     CooldownRule
+		pinned   v1.Hash // Digest pinned before the run (none if empty)
+		tag      string
+		wantHeld string // Substring of the held reason, or empty if the update applies
+	}{
+		{name: "no matching rule", rule: CooldownRule{Image: "other/*", MinimumReleaseAge: "3d"}, tag: "fresh"},
+		{name: "too young", rule: CooldownRule{Image: host + "/*", MinimumReleaseAge: "3d"}, tag: "fresh", wantHeld: "minimum release age is 3d"},
+		{name: "old enough", rule: CooldownRule{Image: host + "/*", MinimumReleaseAge: "1d"}, tag: "recent"},
+		{name: "no creation time", rule: CooldownRule{Image: host + "/*", MinimumReleaseAge: "1d"}, tag: "epoch", wantHeld: "no creation time"},
+		{name: "pin too recent for schedule", rule: CooldownRule{Image: host + "/*", Schedule: "weekly"}, pinned: recent, tag: "fresh", wantHeld: "schedule is weekly"},
+		{name: "pin due for schedule", rule: CooldownRule{Image: host + "/*", Schedule: "weekly"}, pinned: old, tag: "fresh"},
+		{name: "first pin ignores schedule", rule: CooldownRule{Image: host + "/*", Schedule: "weekly"}, tag: "fresh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			cfg.Cooldown = []CooldownRule{tt.rule}
+
+			reference := host + "/base:" + tt.tag
+			if tt.pinned.Hex != "" {
+				reference += "@" + tt.pinned.String()
+			}
+			containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(containerfilePath, []byte("FROM "+reference+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+
+			updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+			if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			cmd := updater.fromCommands[0]
+			if tt.wantHeld == "" {
+				if cmd.HeldReason != "" {
+					t.Errorf("Update held: %s", cmd.HeldReason)
+				}
+				return
+			}
+			if !strings.Contains(cmd.HeldReason, tt.wantHeld) {
+				t.Errorf("Held reason = %q, want it to contain %q", cmd.HeldReason, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func TestCooldownValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    CooldownRule
+		wantErr bool
+	}{
+		{name: "days", rule: CooldownRule{Image: "*", MinimumReleaseAge: "3d"}},
+		{name: "go duration", rule: CooldownRule{Image: "*", MinimumReleaseAge: "36h"}},
+		{name: "named schedule", rule: CooldownRule{Image: "*", Schedule: "monthly"}},
+		{name: "schedule duration", rule: CooldownRule{Image: "*", Schedule: "2w"}},
+		{name: "invalid age", rule: CooldownRule{Image: "*", MinimumReleaseAge: "soon"}, wantErr: true},
+		{name: "negative age", rule: CooldownRule{Image: "*", MinimumReleaseAge: "-1d"}, wantErr: true},
+		{name: "invalid schedule", rule: CooldownRule{Image: "*", Schedule: "fortnightly"}, wantErr: true},
+		{name: "max pin age", rule: CooldownRule{Image: "*", MaxPinAge: "90d"}},
+		{name: "invalid max pin age", rule: CooldownRule{Image: "*", MaxPinAge: "quarterly"}, wantErr: true},
+		{name: "invalid pattern", rule: CooldownRule{Image: "re:(", MinimumReleaseAge: "1d"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCooldownPolicy([]CooldownRule{tt.rule})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newCooldownPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxPinAge(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	now := time.Now()
+	expired := pushImageCreatedAt(t, server, host+"/base:1.2", now.Add(-100*24*time.Hour))
+	pushImageCreatedAt(t, server, host+"/base:1.3", now.Add(-5*24*time.Hour))
+	aging := pushImageCreatedAt(t, server, host+"/app:2.0", now.Add(-20*24*time.Hour))
+	// The tag moves on to a fresh build, which the schedule holds back
+	pushImageCreatedAt(t, server, host+"/app:2.0", now.Add(-time.Hour))
+
+	tests := []struct {
+		name        string
+		rule        CooldownRule
+		reference   string
+		wantExpired string
+		wantTag     string
+		wantHeld    bool
+	}{
+		{name: "expired pin proposes newer tag", rule: CooldownRule{Image: host + "/*", MaxPinAge: "90d"}, reference: host + "/base:1.2@" + expired.String(), wantExpired: "100d", wantTag: "1.3"},
+		{name: "recent pin", rule: CooldownRule{Image: host + "/*", MaxPinAge: "90d"}, reference: host + "/base:1.3"},
+		{name: "no maximum", rule: CooldownRule{Image: host + "/*", Schedule: "weekly"}, reference: host + "/base:1.2@" + expired.String()},
+		{name: "schedule holds pin within age", rule: CooldownRule{Image: host + "/*", Schedule: "monthly", MaxPinAge: "90d"}, reference: host + "/app:2.0@" + aging.String(), wantHeld: true},
+		{name: "expired pin overrides schedule", rule: CooldownRule{Image: host + "/*", Schedule: "monthly", MaxPinAge: "2w"}, reference: host + "/app:2.0@" + aging.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			cfg.Cooldown = []CooldownRule{tt.rule}
+
+			containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(containerfilePath, []byte("FROM "+tt.reference+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+			updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+			if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			cmd := updater.fromCommands[0]
+			if cmd.ExpiredPin != tt.wantExpired || cmd.ProposedTag != tt.wantTag {
+				t.Errorf("Expected expired pin %q proposing %q, got %q proposing %q", tt.wantExpired, tt.wantTag, cmd.ExpiredPin, cmd.ProposedTag)
+			}
+			if held := cmd.HeldReason != ""; held != tt.wantHeld {
+				t.Errorf("Expected held %v, got reason %q", tt.wantHeld, cmd.HeldReason)
+			}
+
+			var findings []Finding
+			for _, finding := range updater.Findings() {
+				if finding.Rule == ruleExpiredPin {
+					findings = append(findings, finding)
+				}
+			}
+			if want := tt.wantExpired != ""; (len(findings) == 1) != want {
+				t.Fatalf("Expected an expired-pin finding: %v, got %v", want, findings)
+			}
+			if tt.wantTag != "" && !strings.Contains(findings[0].Message, "consider moving to tag "+tt.wantTag) {
+				t.Errorf("Finding doesn't propose %s: %s", tt.wantTag, findings[0].Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// renovateDatasource is the Renovate datasource for every image the updater detects
+const renovateDatasource = "docker"
+
+// renovateManagers maps file formats to the Renovate manager handling the same files
+var renovateManagers = map[string]string{
+	formatContainerfile: "dockerfile",
+	formatCompose:       "docker-compose",
+	formatKubernetes:    "kubernetes",
+	formatWorkflow:      "github-actions",
+	formatGitLabCI:      "gitlabci",
+	formatHelm:          "helm-values",
+	formatEnv:           "regex",
+	formatBazel:         "bazel-module",
+	formatQuadlet:       "quadlet",
+}
+
+// RenovateDependency is a detected image in Renovate's extract format
+type RenovateDependency struct {
+	DepName       string         `json:"depName"`
+	CurrentValue  string         `json:"currentValue,omitempty"`
+	CurrentDigest string         `json:"currentDigest,omitempty"`
+	Datasource    string         `json:"datasource"`
+	ReplaceString string         `json:"replaceString,omitempty"`
+	DepType       string         `json:"depType,omitempty"`
+	SkipReason    string         `json:"skipReason,omitempty"`
+	ManagerData   map[string]int `json:"managerData,omitempty"`
+}
+
+// RenovatePackageFile groups the dependencies detected in one file
+type RenovatePackageFile struct {
+	PackageFile string               `json:"packageFile"`
+	Deps        []RenovateDependency `json:"deps"`
+}
+
+// renovateManager returns the Renovate manager name for the updater's file
+func (du *ContainerfileUpdater) renovateManager() string {
+	stem := strings.TrimSuffix(strings.ToLower(filepath.Base(du.containerfilePath)), filepath.Ext(du.containerfilePath))
+	if du.format == formatKubernetes && stem == "kustomization" {
+		return "kustomize"
+	}
+	return renovateManagers[du.format]
+}
+
+// renovateDepName returns the image name as Renovate writes it, without the implicit
+// library/ namespace of official Docker Hub images
+func renovateDepName(image *ImageReference) string {
+	if image.Registry == "docker.io" {
+		return strings.TrimPrefix(image.Repository, "library/")
+	}
+	return image.Name()
+}
+
+// renovateSkipReason maps a skip reason onto Renovate's skipReason values
+func renovateSkipReason(reason string) string {
+	switch {
+	case reason == "":
+		return ""
+	case strings.Contains(reason, "variable"), strings.Contains(reason, "template"):
+		return "contains-variable"
+	}
+	return "ignored"
+}
+
+// RenovatePackageFile extracts the images of the updater's file in Renovate's format
+func (du *ContainerfileUpdater) RenovatePackageFile() (*RenovatePackageFile, error) {
+	fromCommands, err := du.extractImages()
+	if err != nil {
+		return nil, err
+	}
+	du.fromCommands = fromCommands
+
+	packageFile := &RenovatePackageFile{
+		PackageFile: filepath.ToSlash(du.containerfilePath),
+		Deps:        []RenovateDependency{},
+	}
+	for i, cmd := range fromCommands {
+		dep := RenovateDependency{
+			DepName:       renovateDepName(cmd.Image),
+			CurrentDigest: cmd.Image.Digest,
+			Datasource:    renovateDatasource,
+			ReplaceString: cmd.Image.Original,
+			SkipReason:    renovateSkipReason(cmd.SkipReason),
+			ManagerData:   map[string]int{"lineNumber": cmd.LineStart - 1}, // Renovate counts lines from zero
+		}
+		if cmd.Image.ExplicitTag() {
+			dep.CurrentValue = cmd.Image.Tag
+		}
+		if du.format == formatContainerfile {
+			// Renovate's dockerfile manager marks the last FROM as the final image
+			dep.DepType = "stage"
+			if i == len(fromCommands)-1 {
+				dep.DepType = "final"
+			}
+		}
+		packageFile.Deps = append(packageFile.Deps, dep)
+	}
+	return packageFile, nil
+}
+
+// writeRenovateDeps writes package files grouped by Renovate manager as indented JSON
+func writeRenovateDeps(w io.Writer, deps map[string][]*RenovatePackageFile) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(deps)
+}
+
+// runDeps implements the deps subcommand
+func runDeps(args []string) int {
+	fs := flag.NewFlagSet("deps", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s deps [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Print the detected images as Renovate-compatible JSON without contacting any registry.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("info"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+
+	deps := make(map[string][]*RenovatePackageFile)
+	for _, path := range fs.Args() {
+		fileFormat, err := resolveFormat(*format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		extractor := NewContainerfileUpdaterWithConfig(path, cfg)
+		extractor.format = fileFormat
+		packageFile, err := extractor.RenovatePackageFile()
+		if err != nil {
+			slog.Error("Failed to extract images", "path", path, "error", err)
+			return exitError
+		}
+
+		manager := extractor.renovateManager()
+		deps[manager] = append(deps[manager], packageFile)
+	}
+
+	if err := writeRenovateDeps(os.Stdout, deps); err != nil {
+		slog.Error("Failed to write dependencies", "error", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenovatePackageFile(t *testing.T) {
+	disableLogging()
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	content := `FROM golang:1.24@` + digest + ` AS build
+FROM build AS test
+# containerfile-updater: ignore
+FROM ghcr.io/example/tools AS tools
+FROM alpine
+`
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	du := NewContainerfileUpdater(path)
+	packageFile, err := du.RenovatePackageFile()
+	if err != nil {
+		t.Fatalf("RenovatePackageFile failed: %v", err)
+	}
+	if du.renovateManager() != "dockerfile" {
+		t.Errorf("Expected dockerfile manager, got %s", du.renovateManager())
+	}
+
+	want := []RenovateDependency{
+		{DepName: "golang", CurrentValue: "1.24", CurrentDigest: digest, ReplaceString: "golang:1.24@" + digest, DepType: "stage"},
+		{DepName: "ghcr.io/example/tools", ReplaceString: "ghcr.io/example/tools", DepType: "stage", SkipReason: "ignored"},
+		{DepName: "alpine", ReplaceString: "alpine", DepType: "final"},
+	}
+	lines := []int{0, 3, 4}
+	if len(packageFile.Deps) != len(want) {
+		t.Fatalf("Expected %d deps, got %d: %+v", len(want), len(packageFile.Deps), packageFile.Deps)
+	}
+	for i, w := range want {
+		w.Datasource = renovateDatasource
+		w.ManagerData = map[string]int{"lineNumber": lines[i]}
+		got, _ := json.Marshal(packageFile.Deps[i])
+		expected, _ := json.Marshal(w)
+		if string(got) != string(expected) {
+			t.Errorf("Dep %d:\n got %s\nwant %s", i, got, expected)
+		}
+	}
+}
+
+func TestWriteRenovateDeps(t *testing.T) {
+	disableLogging()
+
+	dir := t.TempDir()
+	compose := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(compose, []byte("services:\n  web:\n    image: nginx:1.25\n"), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+	kustomization := filepath.Join(dir, "kustomization.yaml")
+	if err := os.WriteFile(kustomization, []byte("images:\n  - name: api\n    newTag: v1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization: %v", err)
+	}
+
+	deps := make(map[string][]*RenovatePackageFile)
+	for _, path := range []string{compose, kustomization} {
+		du := NewContainerfileUpdater(path)
+		packageFile, err := du.RenovatePackageFile()
+		if err != nil {
+			t.Fatalf("RenovatePackageFile(%s) failed: %v", path, err)
+		}
+		deps[du.renovateManager()] = append(deps[du.renovateManager()], packageFile)
+	}
+
+	var buf bytes.Buffer
+	if err := writeRenovateDeps(&buf, deps); err != nil {
+		t.Fatalf("writeRenovateDeps failed: %v", err)
+	}
+
+	var decoded map[string][]RenovatePackageFile
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if got := decoded["docker-compose"]; len(got) != 1 || got[0].Deps[0].DepName != "nginx" || got[0].Deps[0].CurrentValue != "1.25" {
+		t.Errorf("Unexpected docker-compose deps: %+v", got)
+	}
+	if got := decoded["kustomize"]; len(got) != 1 || got[0].Deps[0].DepName != "api" || got[0].Deps[0].CurrentValue != "v1" {
+		t.Errorf("Unexpected kustomize deps: %+v", got)
+	}
+}
@@ -0,0 +1,300 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Kinds of image differences between two revisions of a file
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+)
+
+// ImageDiff is an image whose reference differs between two revisions of a file
+type ImageDiff struct {
+	Change string     `json:"change"` // added, removed or changed
+	Image  string     `json:"image"`  // Repository with its registry
+	Old    *DiffImage `json:"old,omitempty"`
+	New    *DiffImage `json:"new,omitempty"`
+}
+
+// DiffImage is one side of an image difference, explained by what its digest is
+type DiffImage struct {
+	Line      int        `json:"line"`
+	Reference string     `json:"reference"` // As written
+	Tag       string     `json:"tag,omitempty"`
+	Digest    string     `json:"digest,omitempty"`
+	Version   string     `json:"version,omitempty"`   // Version annotation or label of the digest
+	Created   *time.Time `json:"created,omitempty"`   // Creation time of the digest's image config
+	TagDigest string     `json:"tagDigest,omitempty"` // Digest the tag resolves to now
+	Error     string     `json:"error,omitempty"`     // Why the digest could not be explained
+
+	cmd *FromCommand // Image the side was found as
+}
+
+// diffImages pairs the images of two revisions by repository, in file order, and returns
+// those that were added, removed or changed tag or digest
+func diffImages(old, new []*FromCommand) []*ImageDiff {
+	remaining := make(map[string][]*FromCommand)
+	for _, cmd := range old {
+		remaining[cmd.Image.Name()] = append(remaining[cmd.Image.Name()], cmd)
+	}
+
+	var diffs []*ImageDiff
+	for _, cmd := range new {
+		key := cmd.Image.Name()
+		candidates := remaining[key]
+		if len(candidates) == 0 {
+			diffs = append(diffs, &ImageDiff{Change: diffAdded, Image: key, New: newDiffImage(cmd)})
+			continue
+		}
+		previous := candidates[0]
+		remaining[key] = candidates[1:]
+		if previous.Image.Tag != cmd.Image.Tag || previous.Image.Digest != cmd.Image.Digest {
+			diffs = append(diffs, &ImageDiff{Change: diffChanged, Image: key, Old: newDiffImage(previous), New: newDiffImage(cmd)})
+		}
+	}
+	for _, cmd := range old {
+		if candidates := remaining[cmd.Image.Name()]; len(candidates) > 0 && candidates[0] == cmd {
+			remaining[cmd.Image.Name()] = candidates[1:]
+			diffs = append(diffs, &ImageDiff{Change: diffRemoved, Image: cmd.Image.Name(), Old: newDiffImage(cmd)})
+		}
+	}
+	return diffs
+}
+
+// newDiffImage describes the side of a difference an image is on
+func newDiffImage(cmd *FromCommand) *DiffImage {
+	return &DiffImage{Line: cmd.LineStart, Reference: cmd.Image.Original, Tag: cmd.Image.Tag, Digest: cmd.Image.Digest, cmd: cmd}
+}
+
+// explainDiffs looks up the version and creation time of every digest in the differences
+// and the digest each tag resolves to now. Lookups are best effort.
+func (du *ContainerfileUpdater) explainDiffs(diffs []*ImageDiff) {
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	for _, diff := range diffs {
+		for _, side := range []*DiffImage{diff.Old, diff.New} {
+			if side == nil || side.cmd.SkipReason != "" {
+				continue
+			}
+			if err := du.explainDiffImage(runCtx, side); err != nil {
+				slog.Warn("Failed to explain image", "image", side.Reference, "error", err)
+				side.Error = err.Error()
+			}
+		}
+	}
+}
+
+// explainDiffImage looks up one side of a difference within its registry's timeout
+func (du *ContainerfileUpdater) explainDiffImage(runCtx context.Context, side *DiffImage) error {
+	cmd := side.cmd
+	ctx, cancel, err := du.lookupContext(runCtx, cmd.Image.Registry)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	// A removed tag doesn't keep the digest from being explained
+	var tagErr error
+	if cmd.Image.Tag != "" {
+		side.TagDigest, tagErr = du.resolveImageDigest(ctx, cmd.Image)
+	}
+	if cmd.Image.Digest != "" {
+		var inspection ImageInspection
+		if err := du.inspectImage(ctx, cmd, &inspection); err != nil {
+			return err
+		}
+		side.Version = firstNonEmpty(inspection.Annotations[annotationVersion], inspection.Labels[annotationVersion])
+		side.Created = inspection.Created
+	}
+	return tagErr
+}
+
+// diffRevision is a file as it is on disk or at a git revision
+type diffRevision struct {
+	label   string // How the revision was named on the command line
+	path    string // Path of the file, used to detect its format
+	content []byte
+}
+
+// loadDiffRevision reads a file, or with the git syntax <ref>:<path> the file as it was
+// committed at a revision
+func loadDiffRevision(arg string) (*diffRevision, error) {
+	if _, err := os.Stat(arg); err == nil {
+		content, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &diffRevision{label: arg, path: arg, content: content}, nil
+	}
+
+	ref, path, ok := strings.Cut(arg, ":")
+	if !ok || ref == "" || path == "" {
+		return nil, fmt.Errorf("%s is neither a file nor <git-ref>:<path>", arg)
+	}
+	// A ./ prefix makes git resolve the path from the working directory
+	content, err := (&GitRepository{dir: "."}).run("show", ref+":./"+filepath.ToSlash(displayPath(path)))
+	if err != nil {
+		return nil, err
+	}
+	return &diffRevision{label: arg, path: path, content: []byte(content + "\n")}, nil
+}
+
+// writeDiffs prints image differences with one line per side
+func writeDiffs(w io.Writer, old, new *diffRevision, diffs []*ImageDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintf(w, "No image changes between %s and %s\n", old.label, new.label)
+		return
+	}
+
+	marks := map[string]string{diffAdded: "+", diffRemoved: "-", diffChanged: "~"}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, diff := range diffs {
+		fmt.Fprintf(tw, "%s %s\n", marks[diff.Change], diff.Image)
+		for _, side := range []struct {
+			name     string
+			revision *diffRevision
+			image    *DiffImage
+		}{{"old", old, diff.Old}, {"new", new, diff.New}} {
+			if side.image == nil {
+				continue
+			}
+			line := fmt.Sprintf("    %s\t%s:%d\t%s", side.name, side.revision.label, side.image.Line, side.image.Reference)
+			if description := describeDiffImage(side.image); description != "" {
+				line += "\t" + description
+			}
+			fmt.Fprintln(tw, line)
+		}
+	}
+	tw.Flush()
+}
+
+// describeDiffImage summarizes what the digest of one side is
+func describeDiffImage(image *DiffImage) string {
+	var notes []string
+	if image.Version != "" {
+		notes = append(notes, "version "+image.Version)
+	}
+	if image.Created != nil {
+		notes = append(notes, "created "+image.Created.Format(time.DateOnly))
+	}
+	switch {
+	case image.Error != "":
+		notes = append(notes, "error: "+image.Error)
+	case image.TagDigest == "":
+	case image.Digest == "":
+		notes = append(notes, "tag is at "+shortDigest(image.TagDigest))
+	case image.TagDigest == image.Digest:
+		notes = append(notes, "tag still points here")
+	default:
+		notes = append(notes, "tag moved to "+shortDigest(image.TagDigest))
+	}
+	return strings.Join(notes, ", ")
+}
+
+// runDiff implements the diff subcommand
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	output := fs.String("output", outputText, "Output format (text, json)")
+	noResolve := fs.Bool("no-resolve", false, "Don't look up the version of each digest and the digest of each tag")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [flags] <old> <new>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "       %s diff [flags] <path>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Report the images added, removed or repinned between two revisions of a file.")
+		fmt.Fprintln(fs.Output(), "Either side may be <git-ref>:<path>; a single path is compared with HEAD:<path>.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = no image changes, 1 = images changed, 2 = errors")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("warn"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if err := validateOutputFormat(*output); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+
+	sides := fs.Args()
+	switch len(sides) {
+	case 1:
+		sides = []string{"HEAD:" + sides[0], sides[0]}
+	case 2:
+	default:
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+
+	var revisions []*diffRevision
+	var images [][]*FromCommand
+	var updater *ContainerfileUpdater
+	for _, side := range sides {
+		revision, err := loadDiffRevision(side)
+		if err != nil {
+			slog.Error("Failed to read file", "file", side, "error", err)
+			return exitError
+		}
+		fileFormat, err := resolveFormat(*format, revision.path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		updater = NewContainerfileUpdaterWithConfig(revision.path, cfg)
+		updater.format = fileFormat
+		updater.input = revision.content
+		commands, err := updater.extractImages()
+		if err != nil {
+			slog.Error("Failed to extract images", "file", side, "error", err)
+			return exitError
+		}
+		revisions = append(revisions, revision)
+		images = append(images, commands)
+	}
+
+	diffs := diffImages(images[0], images[1])
+	if !*noResolve {
+		updater.explainDiffs(diffs)
+	}
+
+	if *output == outputJSON {
+		if diffs == nil {
+			diffs = []*ImageDiff{}
+		}
+		if err := writeJSONReport(os.Stdout, diffs); err != nil {
+			slog.Error("Failed to write diff", "error", err)
+			return exitError
+		}
+	} else {
+		writeDiffs(os.Stdout, revisions[0], revisions[1], diffs)
+	}
+	if len(diffs) > 0 {
+		return exitUpdatesNeeded
+	}
+	return exitOK
+}
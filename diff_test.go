@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// diffCommands extracts the images of Containerfile content
+func diffCommands(t *testing.T, cfg *Config, content string) []*FromCommand {
+	t.Helper()
+	du := NewContainerfileUpdaterWithConfig("Containerfile", cfg)
+	du.input = []byte(content)
+	commands, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("Failed to extract images: %v", err)
+	}
+	return commands
+}
+
+func TestDiffImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	digestA := "sha256:" + strings.Repeat("a", 64)
+	digestB := "sha256:" + strings.Repeat("b", 64)
+	old := diffCommands(t, NewConfig(), "FROM golang:1.21@"+digestA+" AS build\n"+
+		"FROM alpine:3.19\n"+
+		"FROM busybox:1.36 AS tools\n")
+	new := diffCommands(t, NewConfig(), "FROM golang:1.22@"+digestB+" AS build\n"+
+		"FROM alpine:3.19\n"+
+		"FROM ghcr.io/org/tool:1.0\n")
+
+	diffs := diffImages(old, new)
+	var got []string
+	for _, diff := range diffs {
+		got = append(got, diff.Change+" "+diff.Image)
+	}
+	want := []string{
+		"changed library/golang",
+		"added ghcr.io/org/tool",
+		"removed library/busybox",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("diffImages() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if changed := diffs[0]; changed.Old.Tag != "1.21" || changed.New.Digest != digestB || changed.Old.Line != 1 {
+		t.Errorf("Unexpected sides %+v -> %+v", changed.Old, changed.New)
+	}
+}
+
+func TestExplainDiffs(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	old := pushRandomImage(t, server, host+"/app:v1")
+	latest := pushRandomImage(t, server, host+"/app:v1")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	diffs := diffImages(
+		diffCommands(t, cfg, "FROM "+host+"/app:v1@"+old.String()+"\n"),
+		diffCommands(t, cfg, "FROM "+host+"/app:v1@"+latest.String()+"\n"),
+	)
+	if len(diffs) != 1 {
+		t.Fatalf("Expected one difference, got %d", len(diffs))
+	}
+	NewContainerfileUpdaterWithConfig("Containerfile", cfg).explainDiffs(diffs)
+
+	if got := describeDiffImage(diffs[0].Old); !strings.Contains(got, "tag moved to "+shortDigest(latest.String())) {
+		t.Errorf("Old side described as %q", got)
+	}
+	if got := describeDiffImage(diffs[0].New); !strings.Contains(got, "tag still points here") {
+		t.Errorf("New side described as %q (%+v)", got, diffs[0].New)
+	}
+}
+
+func TestLoadDiffRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile("Containerfile", []byte("FROM alpine:3.19\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	repo := &GitRepository{dir: dir}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test"},
+		{"config", "commit.gpgsign", "false"},
+		{"add", "Containerfile"},
+		{"commit", "--quiet", "--message", "initial"},
+	} {
+		if _, err := repo.run(args...); err != nil {
+			t.Fatalf("Failed to set up repository: %v", err)
+		}
+	}
+	if err := os.WriteFile("Containerfile", []byte("FROM alpine:3.20\n"), 0644); err != nil {
+		t.Fatalf("Failed to update Containerfile: %v", err)
+	}
+
+	committed, err := loadDiffRevision("HEAD:Containerfile")
+	if err != nil {
+		t.Fatalf("loadDiffRevision failed: %v", err)
+	}
+	if string(committed.content) != "FROM alpine:3.19\n" || committed.path != "Containerfile" {
+		t.Errorf("Committed revision = %+v", committed)
+	}
+	working, err := loadDiffRevision("Containerfile")
+	if err != nil || string(working.content) != "FROM alpine:3.20\n" {
+		t.Errorf("Working revision = %+v (%v)", working, err)
+	}
+	if _, err := loadDiffRevision("missing"); err == nil {
+		t.Error("Expected an error for a path that doesn't exist")
+	}
+}
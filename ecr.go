@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// ecrGetAuthorizationToken is the X-Amz-Target of the ECR GetAuthorizationToken API
+const ecrGetAuthorizationToken = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+
+// awsSessionName names the role sessions assumed with a web identity token
+const awsSessionName = "containerfile-updater"
+
+// Endpoints of the AWS credential sources and APIs, overridable in tests
+var (
+	ec2MetadataURL    = "http://169.254.169.254"
+	ecsCredentialsURL = "http://169.254.170.2"
+	ecrAPIURL         = func(registry string) string { return "https://" + ecrAPIHost(registry) + "/" }
+	stsURL            = func(region string) string { return "https://sts." + region + "." + awsDomain(region) + "/" }
+)
+
+// awsCredentials are the keys AWS requests are signed with
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsDomain returns the domain of a region's endpoints
+func awsDomain(region string) string {
+	if strings.HasPrefix(region, "cn-") {
+		return "amazonaws.com.cn"
+	}
+	return "amazonaws.com"
+}
+
+// ecrAPIHost returns the host of the ECR API serving a registry, e.g.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com -> api.ecr.us-east-1.amazonaws.com
+func ecrAPIHost(registry string) string {
+	_, host, _ := strings.Cut(registry, ".dkr.")
+	if strings.HasPrefix(host, "ecr-fips.") {
+		return host
+	}
+	return "api." + host
+}
+
+// ecrCredentials obtains a registry password from the ECR GetAuthorizationToken API, signed
+// with the first credentials of the AWS default chain
+func (k *cloudKeychain) ecrCredentials(registry, region string) (authn.AuthConfig, error) {
+	creds, err := k.awsCredentials(region)
+	if err != nil {
+		return authn.AuthConfig{}, err
+	}
+
+	body := []byte("{}")
+	req, err := http.NewRequest(http.MethodPost, ecrAPIURL(registry), bytes.NewReader(body))
+	if err != nil {
+		return authn.AuthConfig{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrGetAuthorizationToken)
+	signAWSRequest(req, body, creds, region, "ecr", time.Now())
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return authn.AuthConfig{}, fmt.Errorf("ECR GetAuthorizationToken failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return authn.AuthConfig{}, fmt.Errorf("ECR GetAuthorizationToken failed: %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return authn.AuthConfig{}, fmt.Errorf("failed to decode ECR authorization token: %w", err)
+	}
+	if len(result.AuthorizationData) == 0 {
+		return authn.AuthConfig{}, fmt.Errorf("ECR returned no authorization token")
+	}
+	token, err := base64.StdEncoding.DecodeString(result.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return authn.AuthConfig{}, fmt.Errorf("failed to decode ECR authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(token), ":")
+	if !ok {
+		return authn.AuthConfig{}, fmt.Errorf("ECR authorization token is not username:password")
+	}
+	return authn.AuthConfig{Username: username, Password: password}, nil
+}
+
+// awsCredentials looks up credentials like the AWS SDKs do: environment variables, the
+// shared credentials file, a web identity token (EKS, GitHub Actions OIDC), the ECS
+// container endpoint and finally the EC2 instance metadata service
+func (k *cloudKeychain) awsCredentials(region string) (awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if creds, ok := sharedAWSCredentials(); ok {
+		return creds, nil
+	}
+	if tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		return k.webIdentityCredentials(region, tokenFile, role)
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return k.containerCredentials()
+	}
+	return k.instanceCredentials()
+}
+
+// sharedAWSCredentials reads the static keys of the current profile from the shared
+// credentials file. Profiles assuming roles or using SSO aren't supported.
+func sharedAWSCredentials() (awsCredentials, bool) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, false
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return awsCredentials{}, false
+	}
+	defer file.Close()
+
+	profile := cmp.Or(os.Getenv("AWS_PROFILE"), "default")
+	var creds awsCredentials
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	return creds, creds.AccessKeyID != "" && creds.SecretAccessKey != ""
+}
+
+// webIdentityCredentials exchanges a web identity token for the credentials of a role with
+// STS AssumeRoleWithWebIdentity, which needs no signature
+func (k *cloudKeychain) webIdentityCredentials(region, tokenFile, role string) (awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+	form := url.Values{}
+	form.Set("Action", "AssumeRoleWithWebIdentity")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", role)
+	form.Set("RoleSessionName", cmp.Or(os.Getenv("AWS_ROLE_SESSION_NAME"), awsSessionName))
+	form.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	resp, err := k.client.PostForm(stsURL(region), form)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("STS AssumeRoleWithWebIdentity failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("STS AssumeRoleWithWebIdentity failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode STS response: %w", err)
+	}
+	return awsCredentials(result.Credentials), nil
+}
+
+// containerCredentials fetches the credentials of an ECS task or EKS pod identity from the
+// container credentials endpoint
+func (k *cloudKeychain) containerCredentials() (awsCredentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		endpoint = ecsCredentialsURL + uri
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	authorization := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("failed to read container authorization token: %w", err)
+		}
+		authorization = strings.TrimSpace(string(token))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return k.fetchAWSCredentials(req)
+}
+
+// instanceCredentials fetches the credentials of the EC2 instance role with IMDSv2
+func (k *cloudKeychain) instanceCredentials() (awsCredentials, error) {
+	req, err := http.NewRequest(http.MethodPut, ec2MetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	resp, err := k.probe.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials found and the instance metadata service is unreachable: %w", err)
+	}
+	token, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("instance metadata token request failed: %s", resp.Status)
+	}
+
+	rolesURL := ec2MetadataURL + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest(http.MethodGet, rolesURL, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	resp, err = k.probe.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	roles, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("instance has no IAM role: %s", resp.Status)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+
+	req, err = http.NewRequest(http.MethodGet, rolesURL+role, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	return k.fetchAWSCredentials(req)
+}
+
+// fetchAWSCredentials performs a credentials request to a metadata endpoint, which answers
+// in the same JSON form for containers and instances
+func (k *cloudKeychain) fetchAWSCredentials(req *http.Request) (awsCredentials, error) {
+	resp, err := k.probe.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("credentials request to %s failed: %s", req.URL.Host, resp.Status)
+	}
+
+	var result struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode credentials response: %w", err)
+	}
+	if result.AccessKeyID == "" || result.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("credentials response from %s did not include keys", req.URL.Host)
+	}
+	return awsCredentials{AccessKeyID: result.AccessKeyID, SecretAccessKey: result.SecretAccessKey, SessionToken: result.Token}, nil
+}
+
+// signAWSRequest signs a request without query parameters with AWS Signature Version 4,
+// covering the host and every header already set
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with a key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
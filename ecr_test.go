@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// The post-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodPost, "https://example.amazonaws.com/", nil)
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Unexpected signature:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestECRAPIHost(t *testing.T) {
+	tests := map[string]string{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com":          "api.ecr.us-east-1.amazonaws.com",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn":      "api.ecr.cn-north-1.amazonaws.com.cn",
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com": "ecr-fips.us-gov-west-1.amazonaws.com",
+	}
+	for registry, want := range tests {
+		if got := ecrAPIHost(registry); got != want {
+			t.Errorf("ecrAPIHost(%s) = %s, want %s", registry, got, want)
+		}
+	}
+}
+
+// newECRServer serves GetAuthorizationToken for requests signed with an access key
+func newECRServer(t *testing.T, accessKeyID string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != ecrGetAuthorizationToken {
+			http.Error(w, "unknown operation", http.StatusBadRequest)
+			return
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "Credential="+accessKeyID+"/") || !strings.Contains(r.Header.Get("Authorization"), "/us-east-1/ecr/aws4_request") {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password"))
+		json.NewEncoder(w).Encode(map[string]any{"authorizationData": []map[string]string{{"authorizationToken": token}}})
+	}))
+	original := ecrAPIURL
+	ecrAPIURL = func(string) string { return server.URL + "/" }
+	t.Cleanup(func() {
+		ecrAPIURL = original
+		server.Close()
+	})
+	return server
+}
+
+// clearAWSEnvironment keeps the developer's AWS configuration out of a test
+func clearAWSEnvironment(t *testing.T) {
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+}
+
+func TestCloudKeychainECR(t *testing.T) {
+	clearAWSEnvironment(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	newECRServer(t, "AKIDENV")
+
+	keychain := newCloudKeychain([]string{"ecr"})
+	reg, _ := name.NewRegistry("123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	auth, err := keychain.Resolve(reg)
+	if err != nil {
+		t.Fatalf("Failed to resolve credentials: %v", err)
+	}
+	cfg, err := auth.Authorization()
+	if err != nil {
+		t.Fatalf("Failed to get authorization: %v", err)
+	}
+	if cfg.Username != "AWS" || cfg.Password != "ecr-password" {
+		t.Errorf("Unexpected credentials: %+v", cfg)
+	}
+}
+
+func TestCloudKeychainECRInstanceRole(t *testing.T) {
+	clearAWSEnvironment(t)
+	newECRServer(t, "AKIDINSTANCE")
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("imds-token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "imds-token":
+			http.Error(w, "missing token", http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("builder\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/builder":
+			json.NewEncoder(w).Encode(map[string]string{"AccessKeyId": "AKIDINSTANCE", "SecretAccessKey": "secret", "Token": "session"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer metadata.Close()
+	original := ec2MetadataURL
+	ec2MetadataURL = metadata.URL
+	defer func() { ec2MetadataURL = original }()
+
+	keychain := newCloudKeychain([]string{"ecr"})
+	reg, _ := name.NewRegistry("123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	auth, _ := keychain.Resolve(reg)
+	if cfg, err := auth.Authorization(); err != nil || cfg.Password != "ecr-password" {
+		t.Errorf("Expected the instance role's ECR password, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestCloudKeychainConcurrentResolve(t *testing.T) {
+	clearAWSEnvironment(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	newECRServer(t, "AKIDENV")
+
+	// The metadata server answers only once released, like an unreachable endpoint
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "ya29.test"})
+	}))
+	defer server.Close()
+	original := gcpMetadataTokenURL
+	gcpMetadataTokenURL = server.URL
+	defer func() { gcpMetadataTokenURL = original }()
+
+	keychain := newCloudKeychain([]string{"google", "ecr"})
+	google, _ := name.NewRegistry("gcr.io")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			auth, _ := keychain.Resolve(google)
+			if cfg, err := auth.Authorization(); err != nil || cfg.Password != "ya29.test" {
+				t.Errorf("Unexpected credentials: %+v (%v)", cfg, err)
+			}
+		}()
+	}
+
+	// Another registry resolves while the metadata request is outstanding
+	ecr, _ := name.NewRegistry("123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	auth, _ := keychain.Resolve(ecr)
+	if cfg, err := auth.Authorization(); err != nil || cfg.Password != "ecr-password" {
+		t.Errorf("Expected ECR credentials while gcr.io is pending, got %+v (%v)", cfg, err)
+	}
+
+	close(release)
+	wg.Wait()
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected concurrent lookups to share one metadata request, got %d", n)
+	}
+}
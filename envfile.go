@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// envAssignmentPattern matches a KEY=value line of an env or versions file, with an optional
+// "export" and the Makefile assignment operators, capturing the unquoted value
+var envAssignmentPattern = regexp.MustCompile(`^\s*(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*[?:]?=\s*["']?([^\s"'#]+)`)
+
+// compileEnvFilePatterns compiles the envFiles patterns of the config, which use the same
+// syntax as path patterns of an ignore file
+func compileEnvFilePatterns(patterns []string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, pattern := range patterns {
+		rule, err := compileIgnorePattern(pattern)
+		if err != nil || rule.negate || rule.dirOnly {
+			return nil, fmt.Errorf("invalid env file pattern %q", pattern)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// isEnvFile reports whether a path matches one of the config's env file patterns, relative
+// to the working directory
+func isEnvFile(path string, patterns []string) bool {
+	if path == stdinPath {
+		return false
+	}
+	rules, err := compileEnvFilePatterns(patterns)
+	if err != nil {
+		return false
+	}
+	display := displayPath(path)
+	for _, rule := range rules {
+		if rule.re.MatchString(display) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectFileFormat detects a file's format, recognizing the env files named in the config
+func detectFileFormat(path string, cfg *Config) string {
+	if cfg != nil && isEnvFile(path, cfg.EnvFiles) {
+		return formatEnv
+	}
+	return detectFormat(path)
+}
+
+// extractEnvImages returns the values of an env file that are image references. Values
+// without a tag, digest or repository path, such as plain versions, are left alone.
+func (du *ContainerfileUpdater) extractEnvImages(lines []string) ([]*FromCommand, error) {
+	var images []*FromCommand
+	var comments []string
+	for index, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if comment, ok := strings.CutPrefix(trimmed, "#"); ok {
+			comments = append(comments, comment)
+			continue
+		}
+		above := comments
+		comments = nil
+
+		match := envAssignmentPattern.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		key, value := line[match[2]:match[3]], line[match[4]:match[5]]
+		if !looksLikeImage(value) {
+			continue
+		}
+		image, err := du.parseImageReference(value)
+		if err != nil {
+			continue
+		}
+
+		annotations, err := parseAnnotations(above)
+		if err != nil {
+			slog.Warn("Ignoring invalid annotation comment", "prefix", annotationPrefix, "line", index+1, "error", err)
+			annotations = &ImageAnnotations{}
+		}
+		slog.Debug("Found image in env file", "line", index+1, "key", key, "image", value)
+		cmd := &FromCommand{
+			Image:       image,
+			LineStart:   index + 1,
+			LineEnd:     index + 1,
+			Annotations: annotations,
+			editor:      spanEditor(match[4]),
+		}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images, nil
+}
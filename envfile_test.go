@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvFile(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	goDigest := pushRandomImage(t, server, host+"/golang:1.24")
+	alpineDigest := pushRandomImage(t, server, host+"/alpine:3.20")
+
+	dir := t.TempDir()
+	content := strings.Join([]string{
+		"# Images used by the Makefile",
+		"GOLANG_IMAGE=" + host + "/golang:1.24@sha256:" + strings.Repeat("0", 64),
+		`export ALPINE_IMAGE="` + host + `/alpine:3.20"`,
+		"GO_VERSION=1.24",
+		"# containerfile-updater: ignore",
+		"LEGACY_IMAGE ?= " + host + "/legacy:1",
+		"",
+	}, "\n")
+	path := filepath.Join(dir, "IMAGES.env")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.EnvFiles = []string{"IMAGES.env"}
+
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	if updater.format != formatEnv {
+		t.Fatalf("Expected the env format, got %q", updater.format)
+	}
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(updater.fromCommands) != 3 {
+		t.Fatalf("Expected 3 images, got %d", len(updater.fromCommands))
+	}
+	if reason := updater.fromCommands[2].SkipReason; reason != "ignored by annotation" {
+		t.Errorf("Expected the annotated image to be skipped, got %q", reason)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read env file: %v", err)
+	}
+	want := strings.Join([]string{
+		"# Images used by the Makefile",
+		"GOLANG_IMAGE=" + host + "/golang@" + goDigest.String(),
+		`export ALPINE_IMAGE="` + host + `/alpine@` + alpineDigest.String() + `"`,
+		"GO_VERSION=1.24",
+		"# containerfile-updater: ignore",
+		"LEGACY_IMAGE ?= " + host + "/legacy:1",
+		"",
+	}, "\n")
+	if string(data) != want {
+		t.Errorf("Unexpected content:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestDiscoverEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Containerfile", "build/IMAGES.env", "build/other.env"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	cfg := NewConfig()
+	cfg.EnvFiles = []string{"IMAGES.env"}
+	paths, err := discoverFiles([]string{dir}, cfg)
+	if err != nil {
+		t.Fatalf("discoverFiles failed: %v", err)
+	}
+	if len(paths) != 2 || filepath.Base(paths[1]) != "IMAGES.env" {
+		t.Errorf("Expected the Containerfile and IMAGES.env, got %v", paths)
+	}
+
+	if _, err := compileEnvFilePatterns([]string{"!IMAGES.env"}); err == nil {
+		t.Error("Expected an error for a negated env file pattern")
+	}
+}
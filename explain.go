@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// digestPattern matches a sha256 manifest digest
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// defaultExplainMaxTags bounds the tags resolved per repository, one request each
+const defaultExplainMaxTags = 1000
+
+// DigestExplanation describes what a digest is in one repository
+type DigestExplanation struct {
+	Repository string     `json:"repository"`
+	Digest     string     `json:"digest"`
+	Tags       []string   `json:"tags"`                // Tags pointing to the digest now
+	Truncated  bool       `json:"truncated,omitempty"` // Whether only some of the repository's tags were checked
+	MediaType  string     `json:"mediaType,omitempty"`
+	Platforms  []string   `json:"platforms,omitempty"`
+	Created    *time.Time `json:"created,omitempty"`
+	Version    string     `json:"version,omitempty"` // Version annotation or label
+	Error      string     `json:"error,omitempty"`
+}
+
+// explainDigest finds the tags of a repository that currently point to a digest and
+// looks up when the digest was created. At most maxTags tags are resolved.
+func (du *ContainerfileUpdater) explainDigest(runCtx context.Context, image *ImageReference, maxTags int) *DigestExplanation {
+	explanation := &DigestExplanation{Repository: image.Name(), Digest: image.Digest, Tags: []string{}}
+	if err := du.explainImage(runCtx, image, explanation, maxTags); err != nil {
+		slog.Warn("Failed to explain digest", "repository", image.Name(), "digest", image.Digest, "error", err)
+		explanation.Error = err.Error()
+	}
+	return explanation
+}
+
+// explainImage fills in an explanation within the registry's timeout for each lookup
+func (du *ContainerfileUpdater) explainImage(runCtx context.Context, image *ImageReference, explanation *DigestExplanation, maxTags int) error {
+	ctx, cancel, err := du.lookupContext(runCtx, image.Registry)
+	if err != nil {
+		return err
+	}
+	var inspection ImageInspection
+	err = du.inspectImage(ctx, &FromCommand{Image: image}, &inspection)
+	cancel()
+	if err != nil {
+		return err
+	}
+	explanation.MediaType = inspection.MediaType
+	explanation.Platforms = inspection.Platforms
+	explanation.Created = inspection.Created
+	explanation.Version = firstNonEmpty(inspection.Annotations[annotationVersion], inspection.Labels[annotationVersion])
+
+	ctx, cancel, err = du.lookupContext(runCtx, image.Registry)
+	if err != nil {
+		return err
+	}
+	tags, err := du.listTags(ctx, image)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if len(tags) > maxTags {
+		slog.Warn("Only checking some tags", "repository", image.Name(), "tags", len(tags), "checked", maxTags)
+		tags = tags[:maxTags]
+		explanation.Truncated = true
+	}
+
+	for _, tag := range tags {
+		tagged := *image
+		tagged.Tag = tag
+		ctx, cancel, err := du.lookupContext(runCtx, image.Registry)
+		if err != nil {
+			return err
+		}
+		digest, err := du.resolveDigest(ctx, image.Registry, tagged.TaggedName())
+		cancel()
+		if err != nil {
+			// Tags can be deleted while the list is walked
+			slog.Debug("Failed to resolve tag", "image", tagged.TaggedName(), "error", err)
+			continue
+		}
+		if digest == image.Digest {
+			explanation.Tags = append(explanation.Tags, tag)
+		}
+	}
+	return nil
+}
+
+// pinnedRepositories returns the repositories pinned to a digest in the files found under
+// the given paths
+func pinnedRepositories(paths []string, digest string, cfg *Config) ([]string, error) {
+	files, err := discoverFiles(paths, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories []string
+	for _, path := range files {
+		du := NewContainerfileUpdaterWithConfig(path, cfg)
+		du.format = detectFileFormat(path, cfg)
+		commands, err := du.extractImages()
+		if err != nil {
+			slog.Warn("Failed to extract images", "path", path, "error", err)
+			continue
+		}
+		for _, cmd := range commands {
+			if cmd.Image.Digest == digest && !slices.Contains(repositories, cmd.Image.Name()) {
+				repositories = append(repositories, cmd.Image.Name())
+			}
+		}
+	}
+	return repositories, nil
+}
+
+// writeExplanations prints digest explanations as indented text blocks
+func writeExplanations(w io.Writer, explanations []*DigestExplanation) {
+	for i, explanation := range explanations {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s@%s\n", explanation.Repository, explanation.Digest)
+		if explanation.Error != "" {
+			fmt.Fprintf(w, "  Error:       %s\n", explanation.Error)
+			continue
+		}
+
+		tags := strings.Join(explanation.Tags, ", ")
+		if tags == "" {
+			tags = "none (no tag points to this digest anymore)"
+		}
+		if explanation.Truncated {
+			tags += " (only some tags checked)"
+		}
+		fmt.Fprintf(w, "  Tags:        %s\n", tags)
+		if explanation.Created != nil {
+			fmt.Fprintf(w, "  Created:     %s\n", explanation.Created.Format(time.RFC3339))
+		}
+		if explanation.Version != "" {
+			fmt.Fprintf(w, "  Version:     %s\n", explanation.Version)
+		}
+		if len(explanation.Platforms) > 0 {
+			fmt.Fprintf(w, "  Platforms:   %s\n", strings.Join(explanation.Platforms, ", "))
+		}
+	}
+}
+
+// runExplain implements the explain subcommand
+func runExplain(args []string) int {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	output := fs.String("output", outputText, "Output format (text, json)")
+	var searchPaths stringSliceFlag
+	fs.Var(&searchPaths, "path", "Without a repository, look for images pinned to the digest in these files or directories (repeatable, default .)")
+	maxTags := fs.Int("max-tags", defaultExplainMaxTags, "Resolve at most this many tags per repository")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s explain [flags] <digest> [<repository>...]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(fs.Output(), "       %s explain [flags] <repository>@<digest>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Find the tags currently pointing to a digest and when it was created.")
+		fmt.Fprintln(fs.Output(), "Without a repository, the repositories pinned to the digest in --path are searched.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = tags found, 1 = no tag points to the digest, 2 = errors")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("warn"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if err := validateOutputFormat(*output); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+	if *maxTags < 1 {
+		slog.Error("Invalid --max-tags", "error", "must be positive")
+		return exitError
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	digest, repositories := fs.Arg(0), fs.Args()[1:]
+	if repository, pinned, ok := strings.Cut(digest, "@"); ok {
+		digest, repositories = pinned, append([]string{repository}, repositories...)
+	}
+	if !digestPattern.MatchString(digest) {
+		slog.Error("Invalid digest", "digest", digest, "error", "expected sha256:<64 hex digits>")
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	if len(repositories) == 0 {
+		if len(searchPaths) == 0 {
+			searchPaths = stringSliceFlag{"."}
+		}
+		if repositories, err = pinnedRepositories(searchPaths, digest, cfg); err != nil {
+			slog.Error("Failed to find files", "error", err)
+			return exitError
+		}
+		if len(repositories) == 0 {
+			slog.Error("No image is pinned to the digest; name its repository", "digest", digest, "paths", []string(searchPaths))
+			return exitError
+		}
+	}
+
+	explainer := NewContainerfileUpdaterWithConfig("", cfg)
+	runCtx, cancelRun := explainer.runContext()
+	defer cancelRun()
+
+	exitCode := exitOK
+	explanations := []*DigestExplanation{}
+	for _, repository := range repositories {
+		image, err := explainer.parseImageReference(repository + "@" + digest)
+		if err != nil {
+			slog.Error("Invalid repository", "repository", repository, "error", err)
+			return exitError
+		}
+		image.Tag = ""
+		explanation := explainer.explainDigest(runCtx, image, *maxTags)
+		switch {
+		case explanation.Error != "":
+			exitCode = exitError
+		case len(explanation.Tags) == 0 && exitCode == exitOK:
+			exitCode = exitUpdatesNeeded
+		}
+		explanations = append(explanations, explanation)
+	}
+
+	if *output == outputJSON {
+		if err := writeJSONReport(os.Stdout, explanations); err != nil {
+			slog.Error("Failed to write explanations", "error", err)
+			return exitError
+		}
+		return exitCode
+	}
+	writeExplanations(os.Stdout, explanations)
+	return exitCode
+}
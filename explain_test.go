@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// tagTestImage adds a tag to an image in the test registry
+func tagTestImage(t *testing.T, server *httptest.Server, reference, tag string) {
+	t.Helper()
+
+	ref, err := name.ParseReference(reference, name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	transport := remote.WithTransport(server.Client().Transport)
+	desc, err := remote.Get(ref, transport)
+	if err != nil {
+		t.Fatalf("Failed to get image: %v", err)
+	}
+	if err := remote.Tag(ref.Context().Tag(tag), desc, transport); err != nil {
+		t.Fatalf("Failed to tag image: %v", err)
+	}
+}
+
+func TestExplainDigest(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/app:1.0")
+	current := pushRandomImage(t, server, host+"/app:1.1")
+	tagTestImage(t, server, host+"/app:1.1", "1")
+	tagTestImage(t, server, host+"/app:1.1", "latest")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig("", cfg)
+	image, err := du.parseImageReference(host + "/app@" + current.String())
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	runCtx, cancel := du.runContext()
+	defer cancel()
+
+	explanation := du.explainDigest(runCtx, image, defaultExplainMaxTags)
+	if explanation.Error != "" {
+		t.Fatalf("explainDigest() failed: %s", explanation.Error)
+	}
+	slices.Sort(explanation.Tags)
+	if got := strings.Join(explanation.Tags, ","); got != "1,1.1,latest" {
+		t.Errorf("Tags = %s, want 1,1.1,latest", got)
+	}
+
+	// A truncated search reports what it could check
+	truncated := du.explainDigest(runCtx, image, 1)
+	if !truncated.Truncated || len(truncated.Tags) > 1 {
+		t.Errorf("Expected a truncated search, got %+v", truncated)
+	}
+
+	var out bytes.Buffer
+	writeExplanations(&out, []*DigestExplanation{explanation})
+	if !strings.Contains(out.String(), "Tags:        1, 1.1, latest") {
+		t.Errorf("Unexpected text output:\n%s", out.String())
+	}
+}
+
+func TestExplainUntaggedDigest(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	old := pushRandomImage(t, server, host+"/app:1.0")
+	pushRandomImage(t, server, host+"/app:1.0")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig("", cfg)
+	image, err := du.parseImageReference(host + "/app@" + old.String())
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	runCtx, cancel := du.runContext()
+	defer cancel()
+
+	explanation := du.explainDigest(runCtx, image, defaultExplainMaxTags)
+	if explanation.Error != "" || len(explanation.Tags) != 0 {
+		t.Errorf("Expected no tags and no error, got %+v", explanation)
+	}
+}
+
+func TestPinnedRepositories(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	dir := t.TempDir()
+	content := "FROM golang:1.22@" + digest + " AS build\n" +
+		"FROM alpine:3.19@sha256:" + strings.Repeat("b", 64) + "\n" +
+		"FROM golang:1.22@" + digest + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "Containerfile"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repositories, err := pinnedRepositories([]string{dir}, digest, NewConfig())
+	if err != nil {
+		t.Fatalf("pinnedRepositories() failed: %v", err)
+	}
+	if got := strings.Join(repositories, ","); got != "library/golang" {
+		t.Errorf("pinnedRepositories() = %s, want library/golang", got)
+	}
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// skippedDirs are never descended into when a directory is given on the command line. Names
+// are matched case-insensitively, as the file systems of macOS and Windows do.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// stdinPath is the path argument that reads content from stdin and writes it to stdout
+const stdinPath = "-"
+
+// discoverFiles expands the command line paths into the files to update. Files are kept
+// as given; directories are walked recursively for files the updater recognizes or the
+// config names as env files, skipping paths excluded by .containerfileupdaterignore files
+// in the walked directories.
+func discoverFiles(args []string, cfg *Config) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if arg == stdinPath {
+			files = append(files, arg)
+			continue
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+
+		// Ignore files that apply to the path being visited, outermost first. Those above
+		// the directory apply too, as nested .gitignore files do.
+		root, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, err
+		}
+		ignores, err := loadIgnoreFiles(filepath.Dir(root))
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(arg, path)
+			if err != nil {
+				return err
+			}
+			abs := filepath.Join(root, rel)
+			for len(ignores) > 0 && !isWithin(ignores[len(ignores)-1].dir, abs) {
+				ignores = ignores[:len(ignores)-1]
+			}
+			if entry.IsDir() {
+				name := strings.ToLower(entry.Name())
+				if path != arg && (skippedDirs[name] || (strings.HasPrefix(name, ".") && name != ".github" && name != ".gitlab")) {
+					return filepath.SkipDir
+				}
+				if path != arg && pathIgnored(ignores, abs, true) {
+					return filepath.SkipDir
+				}
+				ignore, err := loadIgnoreFile(abs)
+				if err != nil {
+					return err
+				}
+				if ignore != nil {
+					ignores = append(ignores, ignore)
+				}
+				return nil
+			}
+			updatable := isUpdatableFile(path) || (cfg != nil && isEnvFile(path, cfg.EnvFiles))
+			if entry.Type().IsRegular() && updatable && !pathIgnored(ignores, abs, false) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", arg, err)
+		}
+	}
+	return files, nil
+}
+
+// isWithin reports whether path is dir or below it
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isUpdatableFile reports whether a file found in a directory walk should be updated:
+// Containerfiles and Dockerfiles, compose files, workflows, GitLab CI files, Bazel module and workspace
+// files, quadlet units, kustomizations and values files of a chart. Plain Kubernetes manifests are only updated when passed explicitly.
+func isUpdatableFile(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	// Backups written next to updated files and per-Dockerfile ignore files
+	if strings.HasSuffix(base, ".backup") || strings.HasSuffix(base, ".dockerignore") {
+		return false
+	}
+	for _, name := range []string{"containerfile", "dockerfile"} {
+		if base == name || strings.HasPrefix(base, name+".") || strings.HasSuffix(base, "."+name) {
+			return true
+		}
+	}
+
+	switch detectFormat(path) {
+	case formatCompose, formatWorkflow, formatGitLabCI, formatBazel, formatQuadlet:
+		return true
+	case formatKubernetes:
+		stem := strings.TrimSuffix(base, filepath.Ext(base))
+		return stem == "kustomization"
+	case formatHelm:
+		_, err := os.Stat(filepath.Join(filepath.Dir(path), "Chart.yaml"))
+		return err == nil
+	}
+	return false
+}
+
+// displayPath returns a path for commit messages and change requests, relative to the
+// working directory when it lies below it
+func displayPath(path string) string {
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Containerfile":                 "FROM alpine\n",
+		"Containerfile.backup":          "FROM alpine\n",
+		"build/api.Dockerfile":          "FROM golang\n",
+		"build/Dockerfile.dockerignore": "*.md\n",
+		"compose.yaml":                  "services: {}\n",
+		".github/workflows/ci.yml":      "jobs: {}\n",
+		".gitlab-ci.yml":                "stages: []\n",
+		".gitlab/ci/build.yml":          "build: {}\n",
+		"deploy/kustomization.yaml":     "images: []\n",
+		"deploy/deployment.yaml":        "apiVersion: apps/v1\n",
+		"chart/Chart.yaml":              "name: app\n",
+		"chart/values.yaml":             "image: {}\n",
+		"other/values.yaml":             "image: {}\n",
+		"node_modules/pkg/Dockerfile":   "FROM node\n",
+		"Vendor/pkg/Dockerfile":         "FROM golang\n",
+		".GIT/Containerfile":            "FROM alpine\n",
+		".cache/Containerfile":          "FROM alpine\n",
+		"README.md":                     "# app\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// An explicitly named file is kept even if a walk would skip it
+	explicit := filepath.Join(dir, "deploy", "deployment.yaml")
+	got, err := discoverFiles([]string{dir, explicit}, nil)
+	if err != nil {
+		t.Fatalf("discoverFiles failed: %v", err)
+	}
+	for i, path := range got {
+		got[i], _ = filepath.Rel(dir, path)
+	}
+	sort.Strings(got)
+
+	want := []string{
+		".github/workflows/ci.yml",
+		".gitlab-ci.yml",
+		".gitlab/ci/build.yml",
+		"Containerfile",
+		"build/api.Dockerfile",
+		"chart/values.yaml",
+		"compose.yaml",
+		"deploy/deployment.yaml",
+		"deploy/kustomization.yaml",
+	}
+	for i := range want {
+		want[i] = filepath.FromSlash(want[i])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if _, err := discoverFiles([]string{filepath.Join(dir, "missing")}, nil); err == nil {
+		t.Error("Expected error for a missing path")
+	}
+}
+
+func TestUpdateRunMultipleFiles(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/app:1.0")
+	db := pushRandomImage(t, server, host+"/db:2.0")
+
+	dir := t.TempDir()
+	containerfile := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(containerfile, []byte("FROM "+host+"/app:1.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	compose := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(compose, []byte("services:\n  db:\n    image: "+host+"/db:2.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+
+	paths, err := discoverFiles([]string{dir}, nil)
+	if err != nil {
+		t.Fatalf("discoverFiles failed: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	var out bytes.Buffer
+	run := &updateRun{paths: paths, cfg: cfg, format: formatAuto, output: outputText, checkOnly: true, out: &out}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d in check mode, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	run.checkOnly = false
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	if !regexp.MustCompile(`Updates available:\s+2`).MatchString(out.String()) || !regexp.MustCompile(`Updated:\s+2`).MatchString(out.String()) {
+		t.Errorf("Expected summaries of both runs, got:\n%s", out.String())
+	}
+
+	for path, expected := range map[string]string{
+		containerfile: "FROM " + host + "/app@" + app.String() + "\n",
+		compose:       "services:\n  db:\n    image: " + host + "/db@" + db.String() + "\n",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if string(data) != expected {
+			t.Errorf("Unexpected %s:\n%s\nexpected:\n%s", filepath.Base(path), string(data), expected)
+		}
+	}
+}
+
+func TestDisplayPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	tests := map[string]string{
+		"./Containerfile": "Containerfile",
+		filepath.Join(wd, "build", "Containerfile"):   "build/Containerfile",
+		filepath.Join(filepath.Dir(wd), "Dockerfile"): filepath.ToSlash(filepath.Join(filepath.Dir(wd), "Dockerfile")),
+	}
+	for input, expected := range tests {
+		if got := displayPath(input); got != expected {
+			t.Errorf("displayPath(%q): got %s, want %s", input, got, expected)
+		}
+	}
+}
+
+func TestUpdateRunStdout(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/app:1.0")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	original := "FROM " + host + "/app:1.0\r\nRUN true\r\n"
+	expected := "FROM " + host + "/app@" + app.String() + "\r\nRUN true\r\n"
+
+	// Stdin is updated to stdout
+	var content, report bytes.Buffer
+	run := &updateRun{paths: []string{stdinPath}, cfg: cfg, format: formatAuto, output: outputText, stdout: true,
+		in: strings.NewReader(original), content: &content, out: &report}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	if content.String() != expected {
+		t.Errorf("Expected %q on stdout, got %q", expected, content.String())
+	}
+	if !regexp.MustCompile(`Updated:\s+1`).MatchString(report.String()) {
+		t.Errorf("Expected the summary in the report, got:\n%s", report.String())
+	}
+
+	// A file is left untouched, without a backup, and unchanged content passes through
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	content.Reset()
+	run = &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, stdout: true, checkOnly: true,
+		content: &content, out: &report}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	if content.String() != original {
+		t.Errorf("Expected unchanged content in check mode, got %q", content.String())
+	}
+
+	run.checkOnly = false
+	content.Reset()
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	if content.String() != expected {
+		t.Errorf("Expected %q on stdout, got %q", expected, content.String())
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("Expected the file to be left alone, got %q", string(data))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected no backup to be created, got %v", entries)
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexPatternPrefix marks an allow/deny pattern as a regular expression rather than a glob
+const regexPatternPrefix = "re:"
+
+// ImageFilterConfig lists the image patterns that may or may not be updated
+type ImageFilterConfig struct {
+	Allow []string `yaml:"allow"` // When set, only matching images are updated
+	Deny  []string `yaml:"deny"`  // Matching images are never updated (takes precedence over allow)
+}
+
+// ImageFilter decides whether an image may be updated based on allow/deny patterns
+type ImageFilter struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// NewImageFilter compiles allow and deny patterns. Patterns are globs where "*"
+// matches any sequence of characters (including "/") and "?" a single character,
+// unless prefixed with "re:" to use a regular expression.
+func NewImageFilter(cfg ImageFilterConfig) (*ImageFilter, error) {
+	allow, err := compilePatterns(cfg.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow pattern: %w", err)
+	}
+	deny, err := compilePatterns(cfg.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny pattern: %w", err)
+	}
+	return &ImageFilter{allow: allow, deny: deny}, nil
+}
+
+// compilePatterns compiles glob or regex patterns into anchored regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		expr, isRegex := strings.CutPrefix(pattern, regexPatternPrefix)
+		if !isRegex {
+			expr = globToRegex(pattern)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// globToRegex converts a glob pattern into an anchored regular expression
+func globToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// SkipReason returns why an image must not be updated, or an empty string if it may be
+func (f *ImageFilter) SkipReason(image *ImageReference) string {
+	if f == nil {
+		return ""
+	}
+
+	candidates := referenceCandidates(image)
+	if pattern := matchAny(f.deny, candidates); pattern != "" {
+		return fmt.Sprintf("denied by pattern %s", pattern)
+	}
+	if len(f.allow) > 0 && matchAny(f.allow, candidates) == "" {
+		return "not in allowlist"
+	}
+	return ""
+}
+
+// referenceCandidates returns the spellings of a reference patterns are matched
+// against: as written, the registry/repository:tag form, and fully qualified
+func referenceCandidates(image *ImageReference) []string {
+	written, _, _ := strings.Cut(image.Original, "@")
+	return []string{
+		written,
+		image.TaggedName(),
+		fmt.Sprintf("%s/%s:%s", image.Registry, image.Repository, image.Tag),
+	}
+}
+
+// matchAny returns the first pattern matching any candidate
+func matchAny(patterns []*regexp.Regexp, candidates []string) string {
+	for _, re := range patterns {
+		for _, candidate := range candidates {
+			if re.MatchString(candidate) {
+				return re.String()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageFilter(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	filter, err := NewImageFilter(ImageFilterConfig{
+		Allow: []string{"stagex/*", "docker.io/library/*", `re:^gcr\.io/distroless/.*:nonroot$`},
+		Deny:  []string{"internal-registry.corp/*", "stagex/core-internal*"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+
+	updater := NewContainerfileUpdater("test")
+	tests := []struct {
+		image   string
+		allowed bool
+		reason  string
+	}{
+		{image: "stagex/core-filesystem:latest", allowed: true},
+		{image: "ubuntu:20.04", allowed: true},
+		{image: "gcr.io/distroless/static:nonroot", allowed: true},
+		{image: "gcr.io/distroless/static:debug", reason: "not in allowlist"},
+		{image: "internal-registry.corp/base:stable", reason: "denied by pattern"},
+		{image: "stagex/core-internal-tools:1", reason: "denied by pattern"},
+		{image: "quay.io/prometheus/prometheus:v2", reason: "not in allowlist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			imageRef, err := updater.parseImageReference(tt.image)
+			if err != nil {
+				t.Fatalf("Failed to parse image: %v", err)
+			}
+
+			reason := filter.SkipReason(imageRef)
+			if tt.allowed && reason != "" {
+				t.Errorf("Expected image to be allowed, got %q", reason)
+			}
+			if !tt.allowed && !strings.Contains(reason, tt.reason) {
+				t.Errorf("Skip reason: got %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestImageFilterInvalidPattern(t *testing.T) {
+	if _, err := NewImageFilter(ImageFilterConfig{Deny: []string{"re:("}}); err == nil {
+		t.Error("Expected error for invalid regular expression")
+	}
+}
+
+func TestNilImageFilterAllowsEverything(t *testing.T) {
+	var filter *ImageFilter
+	if reason := filter.SkipReason(&ImageReference{Original: "ubuntu"}); reason != "" {
+		t.Errorf("Expected no skip reason, got %q", reason)
+	}
+}
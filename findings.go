@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Policy rules findings are reported under
+const (
+	ruleUnpinnedImage   = "unpinned-image"
+	ruleDisallowedImage = "disallowed-image"
+	ruleLatestTag       = "latest-tag"
+	ruleMissingPlatform = "missing-platform"
+	ruleExpiredPin      = "expired-pin"
+
+	ruleStageShadowsImage = "stage-shadows-image"
+	ruleArgWithoutDefault = "arg-without-default"
+)
+
+// Finding levels, named as in SARIF
+const (
+	levelError   = "error"
+	levelWarning = "warning"
+	levelNote    = "note"
+)
+
+// findingRule describes a policy rule
+type findingRule struct {
+	id          string
+	description string
+	level       string // Default level of its findings
+}
+
+// findingRules lists the rules in the order they are documented
+var findingRules = []findingRule{
+	{id: ruleUnpinnedImage, description: "Image is not pinned to a digest", level: levelWarning},
+	{id: ruleDisallowedImage, description: "Image is denied by the allow/deny lists or outside the base image catalog", level: levelError},
+	{id: ruleLatestTag, description: "Image uses the latest tag", level: levelWarning},
+	{id: ruleMissingPlatform, description: "New digest lacks a required platform", level: levelError},
+	{id: ruleExpiredPin, description: "Pinned image is older than its maximum pin age", level: levelWarning},
+	{id: ruleStageShadowsImage, description: "Stage alias is also the name of an image", level: levelWarning},
+	{id: ruleArgWithoutDefault, description: "FROM uses a build argument without a default", level: levelError},
+}
+
+// lookupRule returns the rule with an id
+func lookupRule(id string) (findingRule, bool) {
+	for _, rule := range findingRules {
+		if rule.id == id {
+			return rule, true
+		}
+	}
+	return findingRule{}, false
+}
+
+// Finding is a policy violation found in an image reference as written
+type Finding struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"` // error, warning or note
+	Message string `json:"message"`
+	Line    int    `json:"line"`
+	Image   string `json:"image"`
+}
+
+// newFinding creates a finding about an image at the default level of its rule
+func newFinding(id string, cmd *FromCommand, format string, args ...any) Finding {
+	return newLineFinding(id, cmd.LineStart, cmd.Image.Original, format, args...)
+}
+
+// newLineFinding creates a finding about an instruction at the default level of its rule
+func newLineFinding(id string, line int, image string, format string, args ...any) Finding {
+	rule, _ := lookupRule(id)
+	return Finding{Rule: id, Level: rule.level, Message: fmt.Sprintf(format, args...), Line: line, Image: image}
+}
+
+// Findings checks the images of the last run, and the Containerfile they came from, against
+// the policy rules, at the levels set in the lint config. They describe the references as
+// written, before the run pinned them.
+func (du *ContainerfileUpdater) Findings() []Finding {
+	all := slices.Clone(du.fileFindings)
+	for _, cmd := range du.fromCommands {
+		all = append(all, du.imageFindings(cmd)...)
+	}
+	slices.SortStableFunc(all, func(a, b Finding) int { return cmp.Compare(a.Line, b.Line) })
+
+	findings := []Finding{}
+	for _, finding := range all {
+		if level, ok := du.config.Lint.Rules[finding.Rule]; ok {
+			finding.Level = level
+		}
+		if finding.Level != levelOff {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// imageFindings checks one image against the policy rules
+func (du *ContainerfileUpdater) imageFindings(cmd *FromCommand) []Finding {
+	var findings []Finding
+	if reason := firstNonEmpty(cmd.Violation, du.imageFilter.SkipReason(cmd.Image)); reason != "" {
+		findings = append(findings, newFinding(ruleDisallowedImage, cmd, "%s is %s", cmd.Image.Original, reason))
+	}
+
+	digest := cmd.PreviousDigest
+	if digest == "" && !strings.Contains(cmd.Image.Original, "$") {
+		findings = append(findings, newFinding(ruleUnpinnedImage, cmd, "%s is not pinned to a digest", cmd.Image.Original))
+	}
+	if cmd.Image.Tag == "latest" && cmd.TrackedTag == "" && digest == "" {
+		findings = append(findings, newFinding(ruleLatestTag, cmd, "%s uses the latest tag, which can change at any time", cmd.Image.Original))
+	}
+	if len(cmd.MissingPlatforms) > 0 {
+		findings = append(findings, newFinding(ruleMissingPlatform, cmd, "The new digest of %s lacks %s", cmd.Image.Original, strings.Join(cmd.MissingPlatforms, ", ")))
+	}
+	if cmd.ExpiredPin != "" {
+		finding := newFinding(ruleExpiredPin, cmd, "%s was built %s ago, past its maximum pin age", cmd.Image.Original, cmd.ExpiredPin)
+		if cmd.ProposedTag != "" {
+			finding.Message += fmt.Sprintf("; consider moving to tag %s", cmd.ProposedTag)
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
@@ -0,0 +1,246 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// File formats the updater can rewrite
+const (
+	formatAuto          = "auto"
+	formatContainerfile = "containerfile"
+	formatCompose       = "compose"
+	formatKubernetes    = "kubernetes"
+	formatWorkflow      = "github-actions"
+	formatGitLabCI      = "gitlab-ci"
+	formatHelm          = "helm"
+	formatEnv           = "env"
+	formatBazel         = "bazel"
+	formatQuadlet       = "quadlet"
+)
+
+// formatFlagUsage is the help text of every command's --format flag
+const formatFlagUsage = "File format: auto (detect from the file name and content), containerfile, compose, kubernetes, github-actions, gitlab-ci, helm, env, bazel or quadlet"
+
+// kubernetesObjectPattern matches the top-level apiVersion of a Kubernetes object
+var kubernetesObjectPattern = regexp.MustCompile(`(?m)^apiVersion:\s*\S+`)
+
+// FileUpdater is a file format images can be pinned in. Formats share the digest
+// resolution core: they only find the images of a file and write updated ones back.
+type FileUpdater interface {
+	// Name is the format's --format value
+	Name() string
+	// Detect reports whether a file is in this format, from its name and, if needed, content
+	Detect(path string) bool
+	// Parse reads the content of a file into the format's own representation
+	Parse(path string, content []byte) (any, error)
+	// ListImages returns the images of a parsed file, with skip rules applied
+	ListImages(du *ContainerfileUpdater, parsed any) ([]*FromCommand, error)
+	// Rewrite writes the updated reference of an image into the file's lines, reporting
+	// whether anything changed
+	Rewrite(lines []string, cmd *FromCommand) ([]string, bool)
+}
+
+// builtinFormat implements FileUpdater for the formats shipped with the updater, whose
+// images carry an editor for the position they were found at
+type builtinFormat[D any] struct {
+	name   string
+	detect func(path string) bool
+	parse  func(path string, content []byte) (D, error)
+	list   func(du *ContainerfileUpdater, doc D) ([]*FromCommand, error)
+}
+
+func (f *builtinFormat[D]) Name() string {
+	return f.name
+}
+
+func (f *builtinFormat[D]) Detect(path string) bool {
+	return f.detect(path)
+}
+
+func (f *builtinFormat[D]) Parse(path string, content []byte) (any, error) {
+	return f.parse(path, content)
+}
+
+func (f *builtinFormat[D]) ListImages(du *ContainerfileUpdater, parsed any) ([]*FromCommand, error) {
+	doc, ok := parsed.(D)
+	if !ok {
+		return nil, fmt.Errorf("%s format can't list images of a %T", f.name, parsed)
+	}
+	return f.list(du, doc)
+}
+
+func (f *builtinFormat[D]) Rewrite(lines []string, cmd *FromCommand) ([]string, bool) {
+	if cmd.editor == nil {
+		slog.Warn("Don't know where to write the image", "line", cmd.LineStart, "image", cmd.Image.Original)
+		return lines, false
+	}
+	return cmd.editor(lines, cmd)
+}
+
+// fileUpdaters are the known formats in the order they are detected. Files no format
+// detects are treated as Containerfiles.
+var fileUpdaters = []FileUpdater{
+	&builtinFormat[[]string]{
+		name:   formatBazel,
+		detect: func(path string) bool { return isBazelPath(strings.ToLower(filepath.Base(path))) },
+		parse:  parseLines,
+		list:   (*ContainerfileUpdater).extractBazelImages,
+	},
+	&builtinFormat[[]string]{
+		name:   formatQuadlet,
+		detect: func(path string) bool { return isQuadletPath(strings.ToLower(filepath.Ext(path))) },
+		parse:  parseLines,
+		list:   (*ContainerfileUpdater).extractQuadletImages,
+	},
+	&builtinFormat[[]*yaml.Node]{
+		name:   formatWorkflow,
+		detect: func(path string) bool { return isYAMLPath(path) && isGitHubWorkflowPath(path) },
+		parse:  parseYAMLDocuments,
+		list:   (*ContainerfileUpdater).extractWorkflowImages,
+	},
+	&builtinFormat[[]*yaml.Node]{
+		name:   formatGitLabCI,
+		detect: func(path string) bool { return isYAMLPath(path) && isGitLabCIPath(path) },
+		parse:  parseYAMLDocuments,
+		list:   (*ContainerfileUpdater).extractGitLabCIImages,
+	},
+	&builtinFormat[[]*yaml.Node]{
+		name:   formatCompose,
+		detect: isComposePath,
+		parse:  parseYAMLDocuments,
+		list:   (*ContainerfileUpdater).extractComposeImages,
+	},
+	&builtinFormat[[]*yaml.Node]{
+		name:   formatHelm,
+		detect: func(path string) bool { return isYAMLPath(path) && isHelmValuesPath(path) },
+		parse:  parseYAMLDocuments,
+		list:   (*ContainerfileUpdater).extractHelmImages,
+	},
+	&builtinFormat[[]*yaml.Node]{
+		name:   formatKubernetes,
+		detect: isKubernetesPath,
+		parse:  parseYAMLDocuments,
+		list:   (*ContainerfileUpdater).extractKubernetesImages,
+	},
+	&builtinFormat[[]string]{
+		name:   formatEnv,
+		detect: func(string) bool { return false }, // Named in the config, see detectFileFormat
+		parse:  parseLines,
+		list:   (*ContainerfileUpdater).extractEnvImages,
+	},
+	&builtinFormat[*parser.Result]{
+		name:   formatContainerfile,
+		detect: func(string) bool { return false }, // The fallback for every other file
+		parse:  parseContainerfileContent,
+		list:   (*ContainerfileUpdater).extractContainerfileImages,
+	},
+}
+
+// RegisterFileUpdater adds a file format, detected before the built-in ones
+func RegisterFileUpdater(fu FileUpdater) {
+	if _, ok := lookupFileUpdater(fu.Name()); ok || fu.Name() == formatAuto {
+		panic(fmt.Sprintf("file format %q registered twice", fu.Name()))
+	}
+	fileUpdaters = append([]FileUpdater{fu}, fileUpdaters...)
+}
+
+// lookupFileUpdater returns the format with the given --format name
+func lookupFileUpdater(name string) (FileUpdater, bool) {
+	index := slices.IndexFunc(fileUpdaters, func(fu FileUpdater) bool { return fu.Name() == name })
+	if index < 0 {
+		return nil, false
+	}
+	return fileUpdaters[index], true
+}
+
+// parseLines splits the content of a line-based format into lines
+func parseLines(_ string, content []byte) ([]string, error) {
+	lines, _ := splitLines(string(content))
+	return lines, nil
+}
+
+// parseContainerfileContent parses a Containerfile with the BuildKit parser, following the
+// frontend its syntax directive selects
+func parseContainerfileContent(path string, content []byte) (*parser.Result, error) {
+	logFrontend(path, selectedFrontend(content))
+	result, err := parseDockerfile(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Containerfile with BuildKit parser: %w", err)
+	}
+
+	// Print any parser warnings
+	for _, warning := range result.Warnings {
+		slog.Warn("Parser warning", "warning", warning.Short)
+	}
+	return result, nil
+}
+
+// isYAMLPath reports whether a file has a YAML extension
+func isYAMLPath(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// isComposePath reports whether a file is named like a compose file: compose.yaml,
+// docker-compose.yml and overrides such as docker-compose.prod.yml
+func isComposePath(path string) bool {
+	if !isYAMLPath(path) {
+		return false
+	}
+	base := strings.ToLower(filepath.Base(path))
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	return stem == "compose" || stem == "docker-compose" ||
+		strings.HasPrefix(stem, "compose.") || strings.HasPrefix(stem, "docker-compose.")
+}
+
+// isKubernetesPath reports whether a file is a kustomization or a YAML file holding
+// Kubernetes objects
+func isKubernetesPath(path string) bool {
+	if !isYAMLPath(path) {
+		return false
+	}
+	base := strings.ToLower(filepath.Base(path))
+	if strings.TrimSuffix(base, filepath.Ext(base)) == "kustomization" {
+		return true
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && kubernetesObjectPattern.Match(data)
+}
+
+// detectFormat guesses a file's format from its name, and for YAML files that aren't
+// named like any format from their content, defaulting to a Containerfile
+func detectFormat(path string) string {
+	for _, fu := range fileUpdaters {
+		if fu.Detect(path) {
+			return fu.Name()
+		}
+	}
+	return formatContainerfile
+}
+
+// resolveFormat validates a --format value, detecting the format from the path and the
+// config's env file patterns for "auto"
+func resolveFormat(format, path string, cfg *Config) (string, error) {
+	if format == "" || format == formatAuto {
+		return detectFileFormat(path, cfg), nil
+	}
+	if _, ok := lookupFileUpdater(format); ok {
+		return format, nil
+	}
+
+	names := []string{formatAuto}
+	for _, fu := range fileUpdaters {
+		names = append(names, fu.Name())
+	}
+	return "", fmt.Errorf("unknown format %q (expected one of %s)", format, strings.Join(names, ", "))
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "deployment.yaml")
+	if err := os.WriteFile(manifest, []byte("apiVersion: apps/v1\nkind: Deployment\n"), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	values := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(values, []byte("image:\n  repository: nginx\n"), 0644); err != nil {
+		t.Fatalf("Failed to write values: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"Containerfile", formatContainerfile},
+		{"build/Dockerfile.prod", formatContainerfile},
+		{"compose.yaml", formatCompose},
+		{"compose.yml", formatCompose},
+		{"deploy/docker-compose.yml", formatCompose},
+		{"docker-compose.override.yaml", formatCompose},
+		{"overlays/prod/kustomization.yaml", formatKubernetes},
+		{manifest, formatKubernetes},
+		{values, formatHelm},
+		{"charts/app/values-prod.yaml", formatHelm},
+		{".github/workflows/build.yml", formatWorkflow},
+		{"actions/scan/action.yaml", formatWorkflow},
+		{".gitlab-ci.yml", formatGitLabCI},
+		{".gitlab/ci/build.yml", formatGitLabCI},
+		{"MODULE.bazel", formatBazel},
+		{"third_party/WORKSPACE", formatBazel},
+		{"deploy/app.container", formatQuadlet},
+		{"deploy/base.image", formatQuadlet},
+		{"app.containerfile", formatContainerfile},
+	}
+
+	for _, tt := range tests {
+		if got := detectFormat(tt.path); got != tt.want {
+			t.Errorf("detectFormat(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := resolveFormat("terraform", "main.tf", nil); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+	if got, _ := resolveFormat(formatCompose, "stack.yml", nil); got != formatCompose {
+		t.Errorf("Expected explicit format to win, got %q", got)
+	}
+}
+
+// imageListFormat is a minimal FileUpdater: one image reference per line of a .images file
+type imageListFormat struct{}
+
+func (imageListFormat) Name() string { return "image-list" }
+
+func (imageListFormat) Detect(path string) bool { return filepath.Ext(path) == ".images" }
+
+func (imageListFormat) Parse(_ string, content []byte) (any, error) {
+	lines, _ := splitLines(string(content))
+	return lines, nil
+}
+
+func (imageListFormat) ListImages(du *ContainerfileUpdater, parsed any) ([]*FromCommand, error) {
+	var images []*FromCommand
+	for index, line := range parsed.([]string) {
+		if line == "" {
+			continue
+		}
+		image, err := du.parseImageReference(line)
+		if err != nil {
+			return nil, err
+		}
+		cmd := &FromCommand{Image: image, LineStart: index + 1, LineEnd: index + 1}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images, nil
+}
+
+func (imageListFormat) Rewrite(lines []string, cmd *FromCommand) ([]string, bool) {
+	lines[cmd.LineStart-1] = formatReference(cmd)
+	return lines, true
+}
+
+func TestRegisterFileUpdater(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+	builtin := fileUpdaters
+	defer func() { fileUpdaters = builtin }()
+
+	RegisterFileUpdater(imageListFormat{})
+	if got := detectFormat("deploy/prod.images"); got != "image-list" {
+		t.Fatalf("detectFormat() = %q, want the registered format", got)
+	}
+	if _, err := resolveFormat("image-list", "other.txt", nil); err != nil {
+		t.Errorf("Registered format rejected: %v", err)
+	}
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/app:1.0")
+	path := filepath.Join(t.TempDir(), "prod.images")
+	if err := os.WriteFile(path, []byte(host+"/app:1.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write image list: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read image list: %v", err)
+	}
+	if want := host + "/app@" + digest.String() + "\n"; string(data) != want {
+		t.Errorf("Got %q, want %q", data, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic when registering a format twice")
+		}
+	}()
+	RegisterFileUpdater(imageListFormat{})
+}
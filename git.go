@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitRepository runs git commands against the working tree containing a Containerfile
+type GitRepository struct {
+	dir string
+}
+
+// NewGitRepository creates a GitRepository rooted at the directory of the given path
+func NewGitRepository(path string) *GitRepository {
+	return &GitRepository{dir: filepath.Dir(path)}
+}
+
+// run executes a git subcommand and returns its trimmed stdout
+func (g *GitRepository) run(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// SwitchBranch checks out the named branch, creating it from HEAD if it does not exist
+func (g *GitRepository) SwitchBranch(branch string) error {
+	if _, err := g.run("rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		slog.Info("Switching to existing branch", "branch", branch)
+		_, err := g.run("checkout", branch)
+		return err
+	}
+
+	slog.Info("Creating branch", "branch", branch)
+	_, err := g.run("checkout", "-b", branch)
+	return err
+}
+
+// Commit stages the given paths and creates a commit with the provided message
+func (g *GitRepository) Commit(message string, paths ...string) error {
+	addArgs := append([]string{"add", "--"}, paths...)
+	if _, err := g.run(addArgs...); err != nil {
+		return err
+	}
+
+	commitArgs := append([]string{"commit", "--message", message, "--"}, paths...)
+	if _, err := g.run(commitArgs...); err != nil {
+		return err
+	}
+
+	rev, err := g.run("rev-parse", "--short", "HEAD")
+	if err != nil {
+		return err
+	}
+	slog.Info("Created commit", "commit", rev)
+	return nil
+}
+
+// Head returns the commit checked out
+func (g *GitRepository) Head() (string, error) {
+	return g.run("rev-parse", "HEAD")
+}
+
+// CurrentBranch returns the name of the branch checked out, or HEAD when detached
+func (g *GitRepository) CurrentBranch() (string, error) {
+	return g.run("rev-parse", "--abbrev-ref", "HEAD")
+}
+
+// ResetBranch checks out the named branch pointing at a commit, creating it or discarding
+// its previous commits. Like the pushed branches, these are owned by the tool.
+func (g *GitRepository) ResetBranch(branch, commit string) error {
+	slog.Info("Resetting branch", "branch", branch)
+	_, err := g.run("checkout", "-B", branch, commit)
+	return err
+}
+
+// Checkout checks out a branch or commit
+func (g *GitRepository) Checkout(ref string) error {
+	_, err := g.run("checkout", ref)
+	return err
+}
+
+// Push force-pushes the current HEAD to the named branch on the remote.
+// Update branches are owned by the tool, so their history is always replaced.
+func (g *GitRepository) Push(remote, branch string) error {
+	if _, err := g.run("push", "--force", remote, "HEAD:refs/heads/"+branch); err != nil {
+		return err
+	}
+	slog.Info("Pushed branch", "branch", branch, "remote", remote)
+	return nil
+}
+
+// shortDigest returns the first 12 hex characters of a digest for display
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "unpinned"
+	}
+	hex := digest
+	if i := strings.Index(hex, ":"); i != -1 {
+		hex = hex[i+1:]
+	}
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return hex
+}
+
+// buildCommitMessage renders a commit message listing old→new digests per image
+func buildCommitMessage(containerfilePath string, changed []*FromCommand) string {
+	var b strings.Builder
+
+	if len(changed) == 1 {
+		fmt.Fprintf(&b, "Update %s digest in %s\n", changed[0].Image.TaggedName(), filepath.Base(containerfilePath))
+	} else {
+		fmt.Fprintf(&b, "Update %d image digests in %s\n", len(changed), filepath.Base(containerfilePath))
+	}
+	b.WriteString("\n")
+
+	for _, cmd := range changed {
+		fmt.Fprintf(&b, "- %s (line %d): %s → %s\n", cmd.Image.TaggedName(), cmd.LineStart, shortDigest(cmd.PreviousDigest), shortDigest(cmd.Image.Digest))
+		if cmd.PreviousDigest != "" {
+			fmt.Fprintf(&b, "  old: %s\n", cmd.PreviousDigest)
+		}
+		fmt.Fprintf(&b, "  new: %s\n", cmd.Image.Digest)
+		if release := cmd.Release; release != nil {
+			if release.Version != "" {
+				fmt.Fprintf(&b, "  version: %s\n", release.Version)
+			}
+			if release.Revision != "" {
+				fmt.Fprintf(&b, "  revision: %s\n", release.Revision)
+			}
+		}
+	}
+
+	return b.String()
+}
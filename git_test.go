@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShortDigest(t *testing.T) {
+	tests := map[string]string{
+		"": "unpinned",
+		"sha256:86ac87f73641c920fb42cc9612d4fb57b5626b56bd8368b316b5d4f2df5e49c5": "86ac87f73641",
+		"sha256:abc": "abc",
+	}
+
+	for input, expected := range tests {
+		if got := shortDigest(input); got != expected {
+			t.Errorf("shortDigest(%q): got %s, want %s", input, got, expected)
+		}
+	}
+}
+
+func TestBuildCommitMessage(t *testing.T) {
+	changed := []*FromCommand{
+		{
+			Image: &ImageReference{
+				Registry:   "docker.io",
+				Repository: "library/ubuntu",
+				Tag:        "20.04",
+				Digest:     "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+			},
+			LineStart:      2,
+			PreviousDigest: "sha256:2222222222222222222222222222222222222222222222222222222222222222",
+		},
+		{
+			Image: &ImageReference{
+				Registry:   "gcr.io",
+				Repository: "distroless/static",
+				Tag:        "nonroot",
+				Digest:     "sha256:3333333333333333333333333333333333333333333333333333333333333333",
+			},
+			LineStart: 5,
+		},
+	}
+
+	message := buildCommitMessage("/src/Containerfile", changed)
+
+	expectedLines := []string{
+		"Update 2 image digests in Containerfile",
+		"- library/ubuntu:20.04 (line 2): 222222222222 → 111111111111",
+		"  old: sha256:2222222222222222222222222222222222222222222222222222222222222222",
+		"- gcr.io/distroless/static:nonroot (line 5): unpinned → 333333333333",
+		"  new: sha256:3333333333333333333333333333333333333333333333333333333333333333",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(message, line) {
+			t.Errorf("Commit message missing %q:\n%s", line, message)
+		}
+	}
+}
+
+func TestGitRepositoryCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	restore := disableLogging()
+	defer restore()
+
+	tmpDir := t.TempDir()
+	containerfilePath := filepath.Join(tmpDir, "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte("FROM ubuntu:20.04\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test containerfile: %v", err)
+	}
+
+	repo := NewGitRepository(containerfilePath)
+	setup := [][]string{
+		{"init", "--quiet"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test"},
+		{"config", "commit.gpgsign", "false"},
+		{"add", "Containerfile"},
+		{"commit", "--quiet", "--message", "initial"},
+	}
+	for _, args := range setup {
+		if _, err := repo.run(args...); err != nil {
+			t.Fatalf("Failed to set up repository: %v", err)
+		}
+	}
+
+	if err := repo.SwitchBranch("digest-updates"); err != nil {
+		t.Fatalf("Failed to switch branch: %v", err)
+	}
+
+	if err := os.WriteFile(containerfilePath, []byte("FROM library/ubuntu@sha256:abc\n"), 0644); err != nil {
+		t.Fatalf("Failed to update test containerfile: %v", err)
+	}
+	// Untracked files such as backups must not be committed
+	if err := os.WriteFile(containerfilePath+".backup", []byte("FROM ubuntu:20.04\n"), 0644); err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	if err := repo.Commit("Update digests", "Containerfile"); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	branch, err := repo.run("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read branch: %v", err)
+	}
+	if branch != "digest-updates" {
+		t.Errorf("Branch: got %s, want digest-updates", branch)
+	}
+
+	files, err := repo.run("show", "--name-only", "--format=", "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to read commit: %v", err)
+	}
+	if files != "Containerfile" {
+		t.Errorf("Committed files: got %q, want Containerfile", files)
+	}
+
+	// Switching to an existing branch must not fail
+	if err := repo.SwitchBranch("digest-updates"); err != nil {
+		t.Errorf("Failed to switch to existing branch: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// giteaPageSize is the number of pull requests requested per page
+const giteaPageSize = 50
+
+// GiteaClient opens and updates pull requests through the Gitea/Forgejo REST API
+type GiteaClient struct {
+	api   *apiClient
+	owner string
+	repo  string
+}
+
+// NewGiteaClient creates a client for the "owner/name" repository. Gitea is
+// always self-hosted, so the API URL (e.g. https://codeberg.org/api/v1) is required.
+func NewGiteaClient(apiURL, repository, token string) (*GiteaClient, error) {
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return nil, fmt.Errorf("invalid Gitea repository %q, expected owner/name", repository)
+	}
+	if apiURL == "" {
+		return nil, fmt.Errorf("a Gitea API URL (e.g. https://gitea.example.com/api/v1) is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a Gitea token is required to open pull requests")
+	}
+
+	return &GiteaClient{
+		api: newAPIClient("Gitea", apiURL, map[string]string{
+			"Accept":        "application/json",
+			"Authorization": "token " + token,
+		}),
+		owner: owner,
+		repo:  repo,
+	}, nil
+}
+
+// giteaPullRequest is the subset of the pull request resource we use
+type giteaPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// defaultBranch looks up the repository's default branch
+func (gt *GiteaClient) defaultBranch() (string, error) {
+	var repository struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := gt.api.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s", gt.owner, gt.repo), nil, &repository); err != nil {
+		return "", err
+	}
+	return repository.DefaultBranch, nil
+}
+
+// findOpenPullRequest returns the open pull request for the head branch, if any.
+// The list endpoint can't filter by head branch, so pages are scanned client-side.
+func (gt *GiteaClient) findOpenPullRequest(head string) (*giteaPullRequest, error) {
+	for page := 1; ; page++ {
+		var pulls []giteaPullRequest
+		path := fmt.Sprintf("/repos/%s/%s/pulls?state=open&limit=%d&page=%d", gt.owner, gt.repo, giteaPageSize, page)
+		if err := gt.api.do(http.MethodGet, path, nil, &pulls); err != nil {
+			return nil, err
+		}
+
+		for i := range pulls {
+			if pulls[i].Head.Ref == head {
+				return &pulls[i], nil
+			}
+		}
+
+		if len(pulls) < giteaPageSize {
+			return nil, nil
+		}
+	}
+}
+
+// CreateOrUpdateChangeRequest opens a pull request for the change, or refreshes
+// the title and body of the one already open for the same head branch
+func (gt *GiteaClient) CreateOrUpdateChangeRequest(cr *ChangeRequest) (*ChangeRequestResult, error) {
+	existing, err := gt.findOpenPullRequest(cr.Head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up existing pull request: %w", err)
+	}
+
+	if existing != nil {
+		update := map[string]string{"title": cr.Title, "body": cr.Body}
+		var pr giteaPullRequest
+		path := fmt.Sprintf("/repos/%s/%s/pulls/%d", gt.owner, gt.repo, existing.Number)
+		if err := gt.api.do(http.MethodPatch, path, update, &pr); err != nil {
+			return nil, fmt.Errorf("failed to update pull request #%d: %w", existing.Number, err)
+		}
+		slog.Info("Updated pull request", "number", pr.Number, "url", pr.HTMLURL)
+		return &ChangeRequestResult{Number: pr.Number, URL: pr.HTMLURL}, nil
+	}
+
+	base := cr.Base
+	if base == "" {
+		if base, err = gt.defaultBranch(); err != nil {
+			return nil, fmt.Errorf("failed to determine default branch: %w", err)
+		}
+	}
+
+	create := map[string]string{"title": cr.Title, "body": cr.Body, "head": cr.Head, "base": base}
+	var pr giteaPullRequest
+	if err := gt.api.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls", gt.owner, gt.repo), create, &pr); err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %w", err)
+	}
+	slog.Info("Created pull request", "number", pr.Number, "url", pr.HTMLURL)
+	return &ChangeRequestResult{Number: pr.Number, URL: pr.HTMLURL, Created: true}, nil
+}
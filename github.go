@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultGitHubAPI is the public GitHub REST API endpoint
+const defaultGitHubAPI = "https://api.github.com"
+
+// GitHubClient opens and updates pull requests through the GitHub REST API
+type GitHubClient struct {
+	api   *apiClient
+	owner string
+	repo  string
+}
+
+// NewGitHubClient creates a client for the "owner/name" repository
+func NewGitHubClient(apiURL, repository, token string) (*GitHubClient, error) {
+	owner, repo, ok := strings.Cut(repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return nil, fmt.Errorf("invalid GitHub repository %q, expected owner/name", repository)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a GitHub token is required to open pull requests")
+	}
+	if apiURL == "" {
+		apiURL = defaultGitHubAPI
+	}
+
+	return &GitHubClient{
+		api: newAPIClient("GitHub", apiURL, map[string]string{
+			"Accept":               "application/vnd.github+json",
+			"Authorization":        "Bearer " + token,
+			"X-GitHub-Api-Version": "2022-11-28",
+		}),
+		owner: owner,
+		repo:  repo,
+	}, nil
+}
+
+// githubPullRequest is the subset of the pull request resource we use
+type githubPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// defaultBranch looks up the repository's default branch
+func (gh *GitHubClient) defaultBranch() (string, error) {
+	var repository struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := gh.api.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s", gh.owner, gh.repo), nil, &repository); err != nil {
+		return "", err
+	}
+	return repository.DefaultBranch, nil
+}
+
+// findOpenPullRequest returns the open pull request for the head branch, if any
+func (gh *GitHubClient) findOpenPullRequest(head string) (*githubPullRequest, error) {
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("head", gh.owner+":"+head)
+
+	var pulls []githubPullRequest
+	path := fmt.Sprintf("/repos/%s/%s/pulls?%s", gh.owner, gh.repo, query.Encode())
+	if err := gh.api.do(http.MethodGet, path, nil, &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return &pulls[0], nil
+}
+
+// CreateOrUpdateChangeRequest opens a pull request for the change, or refreshes
+// the title and body of the one already open for the same head branch
+func (gh *GitHubClient) CreateOrUpdateChangeRequest(cr *ChangeRequest) (*ChangeRequestResult, error) {
+	existing, err := gh.findOpenPullRequest(cr.Head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up existing pull request: %w", err)
+	}
+
+	if existing != nil {
+		update := map[string]string{"title": cr.Title, "body": cr.Body}
+		var pr githubPullRequest
+		path := fmt.Sprintf("/repos/%s/%s/pulls/%d", gh.owner, gh.repo, existing.Number)
+		if err := gh.api.do(http.MethodPatch, path, update, &pr); err != nil {
+			return nil, fmt.Errorf("failed to update pull request #%d: %w", existing.Number, err)
+		}
+		slog.Info("Updated pull request", "number", pr.Number, "url", pr.HTMLURL)
+		return &ChangeRequestResult{Number: pr.Number, URL: pr.HTMLURL}, nil
+	}
+
+	base := cr.Base
+	if base == "" {
+		if base, err = gh.defaultBranch(); err != nil {
+			return nil, fmt.Errorf("failed to determine default branch: %w", err)
+		}
+	}
+
+	create := map[string]string{"title": cr.Title, "body": cr.Body, "head": cr.Head, "base": base}
+	var pr githubPullRequest
+	if err := gh.api.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls", gh.owner, gh.repo), create, &pr); err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %w", err)
+	}
+	slog.Info("Created pull request", "number", pr.Number, "url", pr.HTMLURL)
+	return &ChangeRequestResult{Number: pr.Number, URL: pr.HTMLURL, Created: true}, nil
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeGitHub serves the subset of the GitHub API used by GitHubClient
+type fakeGitHub struct {
+	openPulls []githubPullRequest
+	created   map[string]string
+	updated   map[string]string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/octo/app":
+		json.NewEncoder(w).Encode(map[string]string{"default_branch": "main"})
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/octo/app/pulls":
+		if r.URL.Query().Get("head") != "octo:containerfile-updater/digests" {
+			http.Error(w, "unexpected head", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(f.openPulls)
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/octo/app/pulls":
+		json.NewDecoder(r.Body).Decode(&f.created)
+		json.NewEncoder(w).Encode(githubPullRequest{Number: 7, HTMLURL: "https://github.com/octo/app/pull/7"})
+	case r.Method == http.MethodPatch && r.URL.Path == "/repos/octo/app/pulls/3":
+		json.NewDecoder(r.Body).Decode(&f.updated)
+		json.NewEncoder(w).Encode(githubPullRequest{Number: 3, HTMLURL: "https://github.com/octo/app/pull/3"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestGitHubCreateOrUpdateChangeRequest(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	cr := &ChangeRequest{Title: "Update digests", Body: "body", Head: defaultUpdateBranch}
+
+	t.Run("Creates a pull request against the default branch", func(t *testing.T) {
+		fake := &fakeGitHub{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client, err := NewGitHubClient(server.URL, "octo/app", "test-token")
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		result, err := client.CreateOrUpdateChangeRequest(cr)
+		if err != nil {
+			t.Fatalf("Failed to create pull request: %v", err)
+		}
+		if !result.Created || result.Number != 7 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if fake.created["base"] != "main" || fake.created["head"] != defaultUpdateBranch {
+			t.Errorf("Unexpected create payload: %v", fake.created)
+		}
+	})
+
+	t.Run("Updates an existing pull request", func(t *testing.T) {
+		fake := &fakeGitHub{openPulls: []githubPullRequest{{Number: 3}}}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client, err := NewGitHubClient(server.URL, "octo/app", "test-token")
+		if err != nil {
+			t.Fatalf("Failed to create client: %v", err)
+		}
+
+		result, err := client.CreateOrUpdateChangeRequest(cr)
+		if err != nil {
+			t.Fatalf("Failed to update pull request: %v", err)
+		}
+		if result.Created || result.Number != 3 {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+		if fake.created != nil {
+			t.Error("Should not create a new pull request when one is open")
+		}
+		if fake.updated["title"] != "Update digests" {
+			t.Errorf("Unexpected update payload: %v", fake.updated)
+		}
+	})
+}
+
+func TestNewGitHubClientValidation(t *testing.T) {
+	if _, err := NewGitHubClient("", "not-a-repo", "token"); err == nil {
+		t.Error("Expected error for invalid repository")
+	}
+	if _, err := NewGitHubClient("", "octo/app", ""); err == nil {
+		t.Error("Expected error for missing token")
+	}
+}
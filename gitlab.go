@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// defaultGitLabAPI is the gitlab.com REST API endpoint
+const defaultGitLabAPI = "https://gitlab.com/api/v4"
+
+// GitLabClient opens and updates merge requests through the GitLab REST API
+type GitLabClient struct {
+	api     *apiClient
+	project string // URL-escaped project path used as the :id parameter
+}
+
+// NewGitLabClient creates a client for the "group/project" path
+func NewGitLabClient(apiURL, project, token string) (*GitLabClient, error) {
+	if project == "" {
+		return nil, fmt.Errorf("a GitLab project path (group/project) is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("a GitLab token is required to open merge requests")
+	}
+	if apiURL == "" {
+		apiURL = defaultGitLabAPI
+	}
+
+	return &GitLabClient{
+		api:     newAPIClient("GitLab", apiURL, map[string]string{"PRIVATE-TOKEN": token}),
+		project: url.PathEscape(project),
+	}, nil
+}
+
+// gitlabMergeRequest is the subset of the merge request resource we use
+type gitlabMergeRequest struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+// defaultBranch looks up the project's default branch
+func (gl *GitLabClient) defaultBranch() (string, error) {
+	var project struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := gl.api.do(http.MethodGet, "/projects/"+gl.project, nil, &project); err != nil {
+		return "", err
+	}
+	return project.DefaultBranch, nil
+}
+
+// findOpenMergeRequest returns the open merge request for the source branch, if any
+func (gl *GitLabClient) findOpenMergeRequest(source string) (*gitlabMergeRequest, error) {
+	query := url.Values{}
+	query.Set("state", "opened")
+	query.Set("source_branch", source)
+
+	var mrs []gitlabMergeRequest
+	path := fmt.Sprintf("/projects/%s/merge_requests?%s", gl.project, query.Encode())
+	if err := gl.api.do(http.MethodGet, path, nil, &mrs); err != nil {
+		return nil, err
+	}
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+	return &mrs[0], nil
+}
+
+// CreateOrUpdateChangeRequest opens a merge request for the change, or refreshes
+// the title and description of the one already open for the same source branch
+func (gl *GitLabClient) CreateOrUpdateChangeRequest(cr *ChangeRequest) (*ChangeRequestResult, error) {
+	existing, err := gl.findOpenMergeRequest(cr.Head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up existing merge request: %w", err)
+	}
+
+	if existing != nil {
+		update := map[string]string{"title": cr.Title, "description": cr.Body}
+		var mr gitlabMergeRequest
+		path := fmt.Sprintf("/projects/%s/merge_requests/%d", gl.project, existing.IID)
+		if err := gl.api.do(http.MethodPut, path, update, &mr); err != nil {
+			return nil, fmt.Errorf("failed to update merge request !%d: %w", existing.IID, err)
+		}
+		slog.Info("Updated merge request", "iid", mr.IID, "url", mr.WebURL)
+		return &ChangeRequestResult{Number: mr.IID, URL: mr.WebURL}, nil
+	}
+
+	base := cr.Base
+	if base == "" {
+		if base, err = gl.defaultBranch(); err != nil {
+			return nil, fmt.Errorf("failed to determine default branch: %w", err)
+		}
+	}
+
+	create := map[string]interface{}{
+		"title":                cr.Title,
+		"description":          cr.Body,
+		"source_branch":        cr.Head,
+		"target_branch":        base,
+		"remove_source_branch": true,
+	}
+	var mr gitlabMergeRequest
+	if err := gl.api.do(http.MethodPost, fmt.Sprintf("/projects/%s/merge_requests", gl.project), create, &mr); err != nil {
+		return nil, fmt.Errorf("failed to create merge request: %w", err)
+	}
+	slog.Info("Created merge request", "iid", mr.IID, "url", mr.WebURL)
+	return &ChangeRequestResult{Number: mr.IID, URL: mr.WebURL, Created: true}, nil
+}
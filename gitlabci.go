@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gitlabCIKeywords are the top-level keys of a GitLab CI file that aren't jobs
+var gitlabCIKeywords = map[string]bool{
+	"default":       true,
+	"include":       true,
+	"stages":        true,
+	"variables":     true,
+	"workflow":      true,
+	"image":         true,
+	"services":      true,
+	"cache":         true,
+	"before_script": true,
+	"after_script":  true,
+}
+
+// isGitLabCIPath reports whether a path is a GitLab CI file: .gitlab-ci.yml, or a file
+// included from .gitlab/ci/
+func isGitLabCIPath(path string) bool {
+	slashed := strings.ToLower(filepath.ToSlash(path))
+	if strings.Contains(slashed, ".gitlab/ci/") {
+		return true
+	}
+	base := slashed[strings.LastIndex(slashed, "/")+1:]
+	return base == ".gitlab-ci.yml" || base == ".gitlab-ci.yaml"
+}
+
+// extractGitLabCIImages finds the images and services of the jobs of a GitLab CI file and
+// of its defaults, and the images passed to builds through variables and parallel:matrix
+func (du *ContainerfileUpdater) extractGitLabCIImages(docs []*yaml.Node) ([]*FromCommand, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	root := docs[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	_, variables := yamlMappingValue(root, "variables")
+	images := du.extractCIVariableImages(variables)
+	images = append(images, du.gitlabJobImages(root)...)
+	_, defaults := yamlMappingValue(root, "default")
+	images = append(images, du.gitlabJobImages(defaults)...)
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name, job := root.Content[i].Value, root.Content[i+1]
+		if gitlabCIKeywords[name] || job.Kind != yaml.MappingNode {
+			continue
+		}
+		images = append(images, du.gitlabJobImages(job)...)
+
+		_, variables := yamlMappingValue(job, "variables")
+		images = append(images, du.extractCIVariableImages(variables)...)
+		_, parallel := yamlMappingValue(job, "parallel")
+		_, matrix := yamlMappingValue(parallel, "matrix")
+		if matrix != nil && matrix.Kind == yaml.SequenceNode {
+			for _, entry := range matrix.Content {
+				images = append(images, du.extractCIVariableImages(entry)...)
+			}
+		}
+	}
+	return images, nil
+}
+
+// gitlabJobImages returns the image and services of a job or the defaults, each given as
+// the image or as a mapping with a name key
+func (du *ContainerfileUpdater) gitlabJobImages(job *yaml.Node) []*FromCommand {
+	var images []*FromCommand
+	add := func(key, value *yaml.Node) {
+		if value.Kind != yaml.ScalarNode {
+			key, value = yamlMappingValue(value, "name")
+			if value == nil {
+				return
+			}
+		}
+		if cmd := du.yamlImageCommand(key, value); cmd != nil {
+			images = append(images, cmd)
+		}
+	}
+
+	if key, image := yamlMappingValue(job, "image"); image != nil {
+		add(key, image)
+	}
+	servicesKey, services := yamlMappingValue(job, "services")
+	if services != nil && services.Kind == yaml.SequenceNode {
+		for _, service := range services.Content {
+			add(servicesKey, service)
+		}
+	}
+	return images
+}
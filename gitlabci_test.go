@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateGitLabCI(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	base := pushRandomImage(t, server, host+"/base:1.0")
+	next := pushRandomImage(t, server, host+"/base:2.0")
+	docker := pushRandomImage(t, server, host+"/docker:27")
+	dind := pushRandomImage(t, server, host+"/docker:27-dind")
+
+	content := `variables:
+  BASE_IMAGE:
+    value: ` + host + `/base:1.0
+    description: Base image of the build
+  DOCKER_TLS_CERTDIR: /certs
+default:
+  image: ` + host + `/docker:27
+build:
+  image:
+    name: $CI_REGISTRY_IMAGE/builder:latest
+  services:
+    - name: ` + host + `/docker:27-dind
+      alias: docker
+  variables:
+    KUBE_CONTEXT: group/project:agent
+  parallel:
+    matrix:
+      - BASE_IMAGE: [` + host + `/base:1.0, ` + host + `/base:2.0]
+        ARCH: amd64
+  script:
+    - docker build --build-arg BASE_IMAGE="$BASE_IMAGE" .
+`
+	path := filepath.Join(t.TempDir(), ".gitlab-ci.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write GitLab CI file: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+
+	want := []struct {
+		original string
+		line     int
+		skip     string
+	}{
+		{host + "/base:1.0", 3, ""},
+		{host + "/docker:27", 7, ""},
+		{"$CI_REGISTRY_IMAGE/builder:latest", 10, "uses variable interpolation"},
+		{host + "/docker:27-dind", 12, ""},
+		{host + "/base:2.0", 18, ""},
+		{host + "/base:1.0", 18, ""},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Expected %d images, got %d", len(want), len(images))
+	}
+	for i, w := range want {
+		if images[i].Image.Original != w.original || images[i].LineStart != w.line || images[i].SkipReason != w.skip {
+			t.Errorf("Image %d: expected %s at line %d (skip %q), got %s at line %d (skip %q)",
+				i, w.original, w.line, w.skip, images[i].Image.Original, images[i].LineStart, images[i].SkipReason)
+		}
+	}
+
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read GitLab CI file: %v", err)
+	}
+	expected := strings.NewReplacer(
+		host+"/base:1.0", host+"/base@"+base.String(),
+		host+"/base:2.0", host+"/base@"+next.String(),
+		host+"/docker:27-dind", host+"/docker@"+dind.String(),
+		host+"/docker:27", host+"/docker@"+docker.String(),
+	).Replace(content)
+	if string(data) != expected {
+		t.Errorf("Unexpected GitLab CI file:\n%s\nexpected:\n%s", string(data), expected)
+	}
+}
@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// goldenSuffix names the expected output of a corpus file, e.g. Containerfile.golden
+const goldenSuffix = ".golden"
+
+// goldenCorpus holds real-world files and the output expected from updating them, built
+// into the binary so selftest can run anywhere
+//
+//go:embed testdata/golden
+var goldenCorpus embed.FS
+
+// goldenCorpusDir is the corpus directory within the module and the embedded files
+const goldenCorpusDir = "testdata/golden"
+
+// syntheticDigests resolves every tag to a digest derived from its fully qualified
+// reference, so the corpus updates the same way everywhere without a registry
+type syntheticDigests struct{}
+
+// Lookup returns the synthetic digest of an image
+func (syntheticDigests) Lookup(image *ImageReference) (string, error) {
+	sum := sha256.Sum256([]byte(digestKey(image)))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// goldenCase is one corpus directory: a file to update and the output expected from it
+type goldenCase struct {
+	name  string // Directory of the case
+	input string // Path of the file within the corpus, named so its format is detected
+}
+
+// golden returns the path of the expected output
+func (c goldenCase) golden() string {
+	return c.input + goldenSuffix
+}
+
+// goldenCases lists the cases of a corpus, one per directory holding a file and its
+// .golden counterpart
+func goldenCases(corpus fs.FS) ([]goldenCase, error) {
+	dirs, err := fs.ReadDir(corpus, ".")
+	if err != nil {
+		return nil, err
+	}
+	var cases []goldenCase
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entries, err := fs.ReadDir(corpus, dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		var inputs []string
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasSuffix(entry.Name(), goldenSuffix) {
+				inputs = append(inputs, path.Join(dir.Name(), entry.Name()))
+			}
+		}
+		if len(inputs) != 1 {
+			return nil, fmt.Errorf("corpus case %s must hold exactly one file besides its %s file, found %d", dir.Name(), goldenSuffix, len(inputs))
+		}
+		cases = append(cases, goldenCase{name: dir.Name(), input: inputs[0]})
+	}
+	return cases, nil
+}
+
+// update runs the updater over the case's file in filter mode with synthetic digests and
+// returns the content it would write
+func (c goldenCase) update(corpus fs.FS) ([]byte, error) {
+	input, err := fs.ReadFile(corpus, c.input)
+	if err != nil {
+		return nil, err
+	}
+	cfg := NewConfig()
+	format, err := resolveFormat(formatAuto, c.input, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	updater := NewContainerfileUpdaterWithConfig(c.input, cfg)
+	updater.format = format
+	updater.digests = syntheticDigests{}
+	updater.input = input
+	var updated bytes.Buffer
+	updater.output = &updated
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		return nil, err
+	}
+	// Without changes nothing was written
+	if updated.Len() == 0 {
+		return input, nil
+	}
+	return updated.Bytes(), nil
+}
+
+// check compares the case's output with its golden file, describing the first difference
+func (c goldenCase) check(corpus fs.FS) error {
+	got, err := c.update(corpus)
+	if err != nil {
+		return err
+	}
+	want, err := fs.ReadFile(corpus, c.golden())
+	if err != nil {
+		return err
+	}
+	return compareGolden(got, want)
+}
+
+// compareGolden describes the first line where output differs from the golden file
+func compareGolden(got, want []byte) error {
+	if bytes.Equal(got, want) {
+		return nil
+	}
+	gotLines := strings.SplitAfter(string(got), "\n")
+	wantLines := strings.SplitAfter(string(want), "\n")
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Errorf("line %d: got %q, want %q", i+1, g, w)
+		}
+	}
+	return fmt.Errorf("output differs from the golden file")
+}
+
+// runSelftest implements the hidden selftest subcommand
+func runSelftest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	update := fs.Bool("update", false, "Rewrite the golden files of a corpus directory with the current output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s selftest [flags] [<corpus>]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Update every file of the golden-file corpus with synthetic digests and compare the")
+		fmt.Fprintln(fs.Output(), "output with the expected files. Without a corpus directory the built-in one is used.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if err := logging.configure("error"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if fs.NArg() > 1 || (*update && fs.NArg() == 0) {
+		fs.Usage()
+		return exitError
+	}
+
+	corpus, err := openCorpus(fs.Arg(0))
+	if err != nil {
+		slog.Error("Failed to open the corpus", "error", err)
+		return exitError
+	}
+	return selftest(os.Stdout, corpus, fs.Arg(0), *update)
+}
+
+// openCorpus returns the corpus in a directory, or the built-in one without a directory
+func openCorpus(dir string) (fs.FS, error) {
+	if dir != "" {
+		return os.DirFS(dir), nil
+	}
+	return fs.Sub(goldenCorpus, goldenCorpusDir)
+}
+
+// selftest checks every case of a corpus, or rewrites their golden files in dir with
+// update, printing one line per case
+func selftest(w io.Writer, corpus fs.FS, dir string, update bool) int {
+	cases, err := goldenCases(corpus)
+	if err != nil {
+		slog.Error("Failed to read the corpus", "error", err)
+		return exitError
+	}
+
+	exitCode := exitOK
+	for _, c := range cases {
+		if update {
+			got, err := c.update(corpus)
+			if err == nil {
+				err = writeFileAtomic(filepath.Join(dir, filepath.FromSlash(c.golden())), got)
+			}
+			if err != nil {
+				fmt.Fprintf(w, "FAIL %s: %v\n", c.name, err)
+				exitCode = exitError
+				continue
+			}
+			fmt.Fprintf(w, "updated %s\n", c.name)
+			continue
+		}
+		if err := c.check(corpus); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.name, err)
+			exitCode = exitError
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s\n", c.name)
+	}
+	return exitCode
+}
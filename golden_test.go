@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "Rewrite the golden files of the corpus with the current output")
+
+func TestGoldenCorpus(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	corpus := os.DirFS(goldenCorpusDir)
+	cases, err := goldenCases(corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("Expected corpus cases")
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if *updateGolden {
+				got, err := c.update(corpus)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(goldenCorpusDir, c.golden()), got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err := c.check(corpus); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSelftest(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	corpus, err := openCorpus("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if code := selftest(&out, corpus, "", false); code != exitOK {
+		t.Fatalf("Built-in corpus failed:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "ok   continuation\n") {
+		t.Errorf("Expected a line per case, got:\n%s", out.String())
+	}
+
+	// A regression names the case and the first line that changed
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "broken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken", "Containerfile"), []byte("FROM alpine:3.20 AS base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken", "Containerfile.golden"), []byte("FROM alpine:3.20 AS base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if code := selftest(&out, os.DirFS(dir), dir, false); code != exitError {
+		t.Errorf("Expected exit code %d, got %d", exitError, code)
+	}
+	if !strings.Contains(out.String(), `FAIL broken: line 1: got "FROM library/alpine@sha256:`) {
+		t.Errorf("Expected the first differing line, got:\n%s", out.String())
+	}
+
+	// --update rewrites the golden file, after which the case passes
+	if code := selftest(&out, os.DirFS(dir), dir, true); code != exitOK {
+		t.Fatalf("Update failed:\n%s", out.String())
+	}
+	out.Reset()
+	if code := selftest(&out, os.DirFS(dir), dir, false); code != exitOK {
+		t.Errorf("Expected the updated case to pass:\n%s", out.String())
+	}
+}
+
+func TestSelftestHidden(t *testing.T) {
+	var help bytes.Buffer
+	writeCommands(&help)
+	if strings.Contains(help.String(), "selftest") {
+		t.Errorf("selftest is listed in help:\n%s", help.String())
+	}
+	if lookupCommand("selftest") == nil {
+		t.Error("selftest is not runnable")
+	}
+}
+
+func TestGoldenCorpusRerun(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	corpus := os.DirFS(goldenCorpusDir)
+	cases, err := goldenCases(corpus)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default digest mode drops the tag, so only these forms can be updated again.
+	// Resolution comments keep the tag of FROM instructions, not of ARG defaults or
+	// other formats.
+	modes := []struct {
+		name            string
+		referenceFormat string
+		annotate        bool
+		cases           []string // Corpus cases the mode applies to (all if empty)
+	}{
+		{name: "tag-digest", referenceFormat: pinTagDigest},
+		{name: "annotate-resolved", annotate: true, cases: []string{"existing-pins", "legacy-frontend", "platform-flags"}},
+	}
+	for _, mode := range modes {
+		for _, c := range cases {
+			if len(mode.cases) > 0 && !slices.Contains(mode.cases, c.name) {
+				continue
+			}
+			t.Run(mode.name+"/"+c.name, func(t *testing.T) {
+				input, err := fs.ReadFile(corpus, c.input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join(t.TempDir(), filepath.Base(c.input))
+				if err := os.WriteFile(path, input, 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				var updated []byte
+				for run := 1; run <= 2; run++ {
+					cfg := NewConfig()
+					cfg.ReferenceFormat = mode.referenceFormat
+					format, err := resolveFormat(formatAuto, c.input, cfg)
+					if err != nil {
+						t.Fatal(err)
+					}
+					updater := NewContainerfileUpdaterWithConfig(path, cfg)
+					updater.format = format
+					updater.digests = syntheticDigests{}
+					updater.annotate = mode.annotate
+					if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+						t.Fatalf("Run %d failed: %v", run, err)
+					}
+					if run == 1 {
+						updated, _ = os.ReadFile(path)
+						os.Remove(path + ".backup")
+						continue
+					}
+					if n := updater.changedCount(); n != 0 {
+						t.Errorf("Expected the rerun to change nothing, got %d changes", n)
+					}
+					if _, err := os.Stat(path + ".backup"); err == nil {
+						t.Error("Expected the rerun not to write the file")
+					}
+					if data, _ := os.ReadFile(path); !bytes.Equal(data, updated) {
+						t.Errorf("Expected the rerun to leave the file as the first run wrote it: %v", compareGolden(data, updated))
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// graphDOT is the --graph format rendering stage graphs for Graphviz
+const graphDOT = "dot"
+
+// Kinds of dependency between build stages
+const (
+	edgeFrom  = "from"  // FROM <stage or image>
+	edgeCopy  = "copy"  // COPY/ADD --from=<stage or image>
+	edgeMount = "mount" // RUN --mount=from=<stage or image>
+)
+
+// StageGraph models which build stages depend on which stages and images, so the blast
+// radius of a base image change can be followed through a multi-stage build
+type StageGraph struct {
+	Stages []*Stage     `json:"stages"`
+	Edges  []*StageEdge `json:"edges"`
+}
+
+// Stage is one FROM instruction of a multi-stage build
+type Stage struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name,omitempty"` // Alias given with AS
+	Line     int    `json:"line"`
+	Affected bool   `json:"affected"` // Whether an image updated in this run reaches the stage
+
+	endLine int // Last line belonging to the stage
+}
+
+// ID returns how the stage is referred to: its alias, or its index
+func (s *Stage) ID() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return strconv.Itoa(s.Index)
+}
+
+// StageEdge is a dependency of a stage on another stage or on an external image
+type StageEdge struct {
+	FromStage string `json:"fromStage,omitempty"` // Stage depended on
+	FromImage string `json:"fromImage,omitempty"` // Image depended on, as written
+	To        string `json:"to"`                  // Depending stage
+	Kind      string `json:"kind"`                // from, copy or mount
+	Line      int    `json:"line"`
+}
+
+// buildStageGraph collects the stages of a parsed Containerfile and the FROM, COPY --from
+// and RUN --mount=from dependencies between them
+func buildStageGraph(ast *parser.Node) *StageGraph {
+	graph := &StageGraph{Stages: []*Stage{}, Edges: []*StageEdge{}}
+	byName := make(map[string]*Stage)
+
+	// addEdge records a dependency on a stage if the source names one, or on an image
+	addEdge := func(stage *Stage, source, kind string, line int) {
+		edge := &StageEdge{To: stage.ID(), Kind: kind, Line: line}
+		if from, ok := byName[strings.ToLower(source)]; ok {
+			edge.FromStage = from.ID()
+		} else if index, err := strconv.Atoi(source); err == nil && index >= 0 && index < len(graph.Stages) {
+			edge.FromStage = graph.Stages[index].ID()
+		} else {
+			edge.FromImage = source
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+
+	var current *Stage
+	for _, node := range ast.Children {
+		switch strings.ToLower(node.Value) {
+		case "from":
+			if node.Next == nil {
+				continue
+			}
+			if current != nil {
+				current.endLine = node.StartLine - 1
+			}
+			current = &Stage{Index: len(graph.Stages), Line: node.StartLine}
+			if as := node.Next.Next; as != nil && strings.EqualFold(as.Value, "as") && as.Next != nil {
+				current.Name = as.Next.Value
+			}
+			// The base is resolved before the stage's own alias exists
+			addEdge(current, node.Next.Value, edgeFrom, node.StartLine)
+			graph.Stages = append(graph.Stages, current)
+			if current.Name != "" {
+				byName[strings.ToLower(current.Name)] = current
+			}
+		case "copy", "add":
+			if current == nil {
+				continue
+			}
+			for _, flag := range node.Flags {
+				if source, ok := strings.CutPrefix(flag, "--from="); ok {
+					addEdge(current, source, edgeCopy, node.StartLine)
+				}
+			}
+		case "run":
+			if current == nil {
+				continue
+			}
+			for _, flag := range node.Flags {
+				mount, ok := strings.CutPrefix(flag, "--mount=")
+				if !ok {
+					continue
+				}
+				fields, err := csv.NewReader(strings.NewReader(mount)).Read()
+				if err != nil {
+					continue
+				}
+				for _, field := range fields {
+					if source, ok := strings.CutPrefix(field, "from="); ok {
+						addEdge(current, source, edgeMount, node.StartLine)
+					}
+				}
+			}
+		}
+	}
+	if current != nil {
+		current.endLine = math.MaxInt
+	}
+	return graph
+}
+
+// withAffected returns a copy of the graph marking the stages that contain a changed image
+// or depend, directly or through other stages, on one that does
+func (g *StageGraph) withAffected(commands []*FromCommand) *StageGraph {
+	if g == nil {
+		return nil
+	}
+
+	graph := &StageGraph{Edges: g.Edges}
+	affected := make(map[string]bool)
+	for _, stage := range g.Stages {
+		copied := *stage
+		copied.Affected = false
+		for _, cmd := range commands {
+			if cmd.Changed && cmd.LineStart >= stage.Line && cmd.LineStart <= stage.endLine {
+				copied.Affected = true
+			}
+		}
+		affected[copied.ID()] = copied.Affected
+		graph.Stages = append(graph.Stages, &copied)
+	}
+
+	// Stages only depend on earlier ones, so one pass in order propagates the changes
+	for _, stage := range graph.Stages {
+		for _, edge := range g.Edges {
+			if edge.To == stage.ID() && edge.FromStage != "" && affected[edge.FromStage] {
+				stage.Affected = true
+			}
+		}
+		affected[stage.ID()] = stage.Affected
+	}
+	return graph
+}
+
+// writeDOT renders the graph in Graphviz DOT format, highlighting affected stages
+func (g *StageGraph) writeDOT(w io.Writer, title string) {
+	fmt.Fprintf(w, "digraph %s {\n", strconv.Quote(title))
+	fmt.Fprintln(w, "  rankdir=LR;")
+	for _, stage := range g.Stages {
+		attributes := ""
+		if stage.Affected {
+			attributes = ", color=red, fontcolor=red"
+		}
+		fmt.Fprintf(w, "  %s [label=%s%s];\n", strconv.Quote("stage:"+stage.ID()), strconv.Quote(stage.ID()), attributes)
+	}
+
+	images := make(map[string]bool)
+	for _, edge := range g.Edges {
+		if edge.FromImage != "" && !images[edge.FromImage] {
+			images[edge.FromImage] = true
+			fmt.Fprintf(w, "  %s [label=%s, shape=box];\n", strconv.Quote("image:"+edge.FromImage), strconv.Quote(edge.FromImage))
+		}
+	}
+	for _, edge := range g.Edges {
+		from := "stage:" + edge.FromStage
+		if edge.FromImage != "" {
+			from = "image:" + edge.FromImage
+		}
+		fmt.Fprintf(w, "  %s -> %s [label=%s];\n", strconv.Quote(from), strconv.Quote("stage:"+edge.To), strconv.Quote(edge.Kind))
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func TestStageGraph(t *testing.T) {
+	content := `FROM golang:1.24 AS build
+COPY --from=ghcr.io/example/assets:1 /assets /assets
+RUN --mount=type=cache,target=/root/.cache go build ./...
+
+FROM alpine:3.20 AS Certs
+RUN apk add ca-certificates
+
+FROM build AS test
+RUN --mount=type=bind,from=certs,source=/etc/ssl,target=/etc/ssl go test ./...
+
+FROM scratch
+COPY --from=0 /app /app
+COPY --from=certs /etc/ssl /etc/ssl
+`
+	result, err := parser.Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Failed to parse Containerfile: %v", err)
+	}
+	graph := buildStageGraph(result.AST)
+
+	var ids []string
+	for _, stage := range graph.Stages {
+		ids = append(ids, stage.ID())
+	}
+	if got := strings.Join(ids, ","); got != "build,Certs,test,3" {
+		t.Errorf("Stages = %s, want build,Certs,test,3", got)
+	}
+
+	var edges []string
+	for _, edge := range graph.Edges {
+		edges = append(edges, edge.FromStage+edge.FromImage+" -"+edge.Kind+"-> "+edge.To)
+	}
+	want := []string{
+		"golang:1.24 -from-> build",
+		"ghcr.io/example/assets:1 -copy-> build",
+		"alpine:3.20 -from-> Certs",
+		"build -from-> test",
+		"Certs -mount-> test",
+		"scratch -from-> 3",
+		"build -copy-> 3",
+		"Certs -copy-> 3",
+	}
+	if strings.Join(edges, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Edges:\n%s\nwant:\n%s", strings.Join(edges, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Updating alpine reaches Certs, and through it test and the final stage, but not build
+	commands := []*FromCommand{
+		{LineStart: 1, Changed: false},
+		{LineStart: 5, Changed: true},
+	}
+	affected := graph.withAffected(commands)
+	for _, stage := range affected.Stages {
+		if wantAffected := stage.ID() != "build"; stage.Affected != wantAffected {
+			t.Errorf("Stage %s affected = %v, want %v", stage.ID(), stage.Affected, wantAffected)
+		}
+	}
+	for _, stage := range graph.Stages {
+		if stage.Affected {
+			t.Errorf("withAffected modified the original graph")
+		}
+	}
+
+	var dot bytes.Buffer
+	affected.writeDOT(&dot, "Containerfile")
+	for _, line := range []string{
+		`digraph "Containerfile" {`,
+		`  "stage:Certs" [label="Certs", color=red, fontcolor=red];`,
+		`  "stage:build" [label="build"];`,
+		`  "image:alpine:3.20" [label="alpine:3.20", shape=box];`,
+		`  "stage:Certs" -> "stage:test" [label="mount"];`,
+	} {
+		if !strings.Contains(dot.String(), line+"\n") {
+			t.Errorf("DOT output missing %q:\n%s", line, dot.String())
+		}
+	}
+}
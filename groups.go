@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Strategies splitting the changes of a run into change requests
+const (
+	groupByAll   = "all"   // One change request for every change (default)
+	groupByFile  = "file"  // One change request per file
+	groupByImage = "image" // One change request per image family, e.g. every golang update
+)
+
+// ChangeRequestConfig controls how the changes of a run are split into change requests
+type ChangeRequestConfig struct {
+	GroupBy string `yaml:"groupBy"` // all (default), file or image
+}
+
+// validateGroupBy rejects unknown grouping strategies
+func validateGroupBy(groupBy string) error {
+	switch groupBy {
+	case "", groupByAll, groupByFile, groupByImage:
+		return nil
+	}
+	return fmt.Errorf("unknown change request grouping %q (expected %s, %s or %s)", groupBy, groupByAll, groupByFile, groupByImage)
+}
+
+// changeGroup is the changes that go into one change request
+type changeGroup struct {
+	key     string         // File path or image name the changes share
+	changed []*FromCommand // Changed images, in the order they were found
+}
+
+// groupChanges splits changed images by file or image family, keeping the order in which
+// each group was first seen
+func groupChanges(changed []*FromCommand, groupBy string) []*changeGroup {
+	var groups []*changeGroup
+	byKey := map[string]*changeGroup{}
+	for _, cmd := range changed {
+		key := ""
+		switch groupBy {
+		case groupByFile:
+			key = displayPath(cmd.Path)
+		case groupByImage:
+			key = cmd.Image.Name()
+		}
+		group, ok := byKey[key]
+		if !ok {
+			group = &changeGroup{key: key}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.changed = append(group.changed, cmd)
+	}
+	return groups
+}
+
+// branchUnsafe matches runs of characters not kept in group branch names
+var branchUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// branch returns the branch a group's changes are pushed to, below the update branch
+// name. A separate suffix rather than a path keeps it from clashing with that branch.
+func (g *changeGroup) branch(prefix string) string {
+	if g.key == "" {
+		return prefix
+	}
+	slug := strings.Trim(branchUnsafe.ReplaceAllString(strings.ToLower(g.key), "-"), "-.")
+	return prefix + "-" + slug
+}
+
+// files returns the paths of a group's changes, in the order they were found
+func (g *changeGroup) files() []string {
+	var paths []string
+	for _, cmd := range g.changed {
+		if !slices.Contains(paths, cmd.Path) {
+			paths = append(paths, cmd.Path)
+		}
+	}
+	return paths
+}
+
+// grouped reports whether the run's changes are split over several change requests
+func (r *updateRun) grouped() bool {
+	return r.provider != nil && r.groupBy != "" && r.groupBy != groupByAll
+}
+
+// rewriteGroupFile applies only a group's changes to the original content of a file
+func (r *updateRun) rewriteGroupFile(path string, original []byte, changed []*FromCommand) ([]byte, error) {
+	format, err := resolveFormat(r.format, path, r.cfg)
+	if err != nil {
+		return nil, err
+	}
+	updater, ok := lookupFileUpdater(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	// Bottom-up, as in the full rewrite
+	ordered := slices.Clone(changed)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].LineStart > ordered[j].LineStart
+	})
+	lines, style := splitLines(string(original))
+	for _, cmd := range ordered {
+		lines, _ = updater.Rewrite(lines, cmd)
+	}
+	return []byte(style.join(lines)), nil
+}
+
+// openGroupedChangeRequests opens a change request per group of changes. The files are put
+// back as they were, then every group gets a branch off the current commit holding only
+// its own changes, committed per file, and the lock file updated with only those. The
+// original branch is checked out at the end, so the changes only live on the group branches.
+func (r *updateRun) openGroupedChangeRequests(repo *GitRepository, lock *LockFile, changed []*FromCommand, originals map[string][]byte) error {
+	base, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	// Every group's branch starts from a clean tree
+	for path, data := range originals {
+		if err := writeFileAtomic(path, data); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
+	defer func() {
+		if current == "HEAD" {
+			// Detached, as CI checkouts often are
+			current = base
+		}
+		if err := repo.Checkout(current); err != nil {
+			slog.Error("Failed to check out the original branch", "branch", current, "error", err)
+		}
+	}()
+
+	for _, group := range groupChanges(changed, r.groupBy) {
+		branch := group.branch(r.gitBranch)
+		if err := repo.ResetBranch(branch, base); err != nil {
+			return err
+		}
+		for _, path := range group.files() {
+			var fileChanged []*FromCommand
+			for _, cmd := range group.changed {
+				if cmd.Path == path {
+					fileChanged = append(fileChanged, cmd)
+				}
+			}
+			original, ok := originals[path]
+			if !ok {
+				return fmt.Errorf("no original content of %s", path)
+			}
+			content, err := r.rewriteGroupFile(path, original, fileChanged)
+			if err != nil {
+				return err
+			}
+			if err := r.confine.check(path); err != nil {
+				return fmt.Errorf("refusing to write: %w", err)
+			}
+			if err := writeFileAtomic(path, content); err != nil {
+				return err
+			}
+			message, err := r.templates.commitMessage(path, fileChanged)
+			if err != nil {
+				return err
+			}
+			commitPath, err := filepath.Abs(path)
+			if err != nil {
+				commitPath = path
+			}
+			if err := repo.Commit(message, commitPath); err != nil {
+				return err
+			}
+		}
+		if lock != nil {
+			if err := r.commitGroupLock(repo, group.changed); err != nil {
+				return err
+			}
+		}
+		if err := repo.Push(r.gitRemote, branch); err != nil {
+			return fmt.Errorf("failed to push branch %s: %w", branch, err)
+		}
+
+		cr, err := r.templates.changeRequest(group.changed, branch, r.forgeBase)
+		if err != nil {
+			return fmt.Errorf("failed to render change request: %w", err)
+		}
+		if _, err := r.provider.CreateOrUpdateChangeRequest(cr); err != nil {
+			return fmt.Errorf("failed to open change request for %s: %w", group.key, err)
+		}
+	}
+	return nil
+}
+
+// commitGroupLock records a group's changes in the lock file as the group's branch has it
+// and commits it
+func (r *updateRun) commitGroupLock(repo *GitRepository, changed []*FromCommand) error {
+	lock, err := LoadLockFile(r.lockFile)
+	if err != nil {
+		return err
+	}
+	lock.recordChanges(changed, time.Now())
+	paths, lockChanged, err := r.saveLock(lock)
+	if err != nil {
+		return fmt.Errorf("failed to save lock file: %w", err)
+	}
+	if !lockChanged {
+		return nil
+	}
+	return repo.Commit("Update "+filepath.Base(r.lockFile), paths...)
+}
+
+// readOriginals keeps the content of files before they are updated, for splitting their
+// changes into groups afterwards
+func readOriginals(paths []string) map[string][]byte {
+	originals := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		// Unreadable files fail to update, so they have no changes to split
+		if data, err := os.ReadFile(path); err == nil {
+			originals[path] = data
+		}
+	}
+	return originals
+}
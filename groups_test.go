@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// recordingProvider collects the change requests it is asked to open
+type recordingProvider struct {
+	requests []*ChangeRequest
+}
+
+func (p *recordingProvider) CreateOrUpdateChangeRequest(cr *ChangeRequest) (*ChangeRequestResult, error) {
+	p.requests = append(p.requests, cr)
+	return &ChangeRequestResult{Number: len(p.requests), Created: true}, nil
+}
+
+// initGroupRepository commits files to a new repository on main, with a bare remote
+func initGroupRepository(t *testing.T, dir, remote string, files map[string]string) *GitRepository {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := NewGitRepository(filepath.Join(dir, "Containerfile"))
+	setup := [][]string{
+		{"init", "--quiet", "--initial-branch", "main"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test"},
+		{"config", "commit.gpgsign", "false"},
+		{"add", "."},
+		{"commit", "--quiet", "--message", "initial"},
+		{"init", "--quiet", "--bare", remote},
+	}
+	for _, args := range setup {
+		if _, err := repo.run(args...); err != nil {
+			t.Fatalf("Failed to set up repository: %v", err)
+		}
+	}
+	return repo
+}
+
+func TestGroupChanges(t *testing.T) {
+	changed := []*FromCommand{
+		{Path: "Containerfile", Image: &ImageReference{Registry: "docker.io", Repository: "library/golang", Tag: "1.24"}},
+		{Path: "Containerfile", Image: &ImageReference{Registry: "ghcr.io", Repository: "org/tool", Tag: "2"}},
+		{Path: "tools/Containerfile", Image: &ImageReference{Registry: "docker.io", Repository: "library/golang", Tag: "1.23"}},
+	}
+
+	tests := []struct {
+		groupBy  string
+		branches []string
+		sizes    []int
+	}{
+		{groupByAll, []string{"updates"}, []int{3}},
+		{groupByFile, []string{"updates-containerfile", "updates-tools-containerfile"}, []int{2, 1}},
+		{groupByImage, []string{"updates-library-golang", "updates-ghcr.io-org-tool"}, []int{2, 1}},
+	}
+	for _, tt := range tests {
+		groups := groupChanges(changed, tt.groupBy)
+		if len(groups) != len(tt.branches) {
+			t.Fatalf("%s: expected %d groups, got %d", tt.groupBy, len(tt.branches), len(groups))
+		}
+		for i, group := range groups {
+			if branch := group.branch("updates"); branch != tt.branches[i] || len(group.changed) != tt.sizes[i] {
+				t.Errorf("%s: group %d: expected branch %s with %d changes, got %s with %d", tt.groupBy, i, tt.branches[i], tt.sizes[i], branch, len(group.changed))
+			}
+		}
+	}
+
+	if err := validateGroupBy("registry"); err == nil {
+		t.Error("Expected an unknown grouping to be rejected")
+	}
+}
+
+func TestGroupedChangeRequests(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	defer server.Close()
+	golang := pushRandomImage(t, server, host+"/golang:1.24")
+	alpine := pushRandomImage(t, server, host+"/alpine:3.20")
+
+	dir := t.TempDir()
+	remote := t.TempDir()
+	files := map[string]string{
+		"Containerfile":       "FROM " + host + "/golang:1.24 AS build\nFROM " + host + "/alpine:3.20\n",
+		"tools/Containerfile": "FROM " + host + "/golang:1.24\n",
+	}
+	repo := initGroupRepository(t, dir, remote, files)
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	provider := &recordingProvider{}
+	run := &updateRun{
+		paths:     []string{filepath.Join(dir, "Containerfile"), filepath.Join(dir, "tools", "Containerfile")},
+		cfg:       cfg,
+		format:    formatAuto,
+		output:    outputText,
+		gitCommit: true,
+		gitBranch: "updates",
+		gitRemote: remote,
+		provider:  provider,
+		groupBy:   groupByImage,
+		backup:    BackupPolicy{Disabled: true},
+		out:       io.Discard,
+	}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected a change request per image, got %d", len(provider.requests))
+	}
+	golangBranch := provider.requests[0].Head
+	if !strings.HasSuffix(golangBranch, "-golang") || !strings.Contains(provider.requests[0].Title, "2 container image digests") {
+		t.Errorf("Expected the golang updates of both files first, got %s: %s", golangBranch, provider.requests[0].Title)
+	}
+	if !strings.HasSuffix(provider.requests[1].Head, "-alpine") {
+		t.Errorf("Expected the alpine update second, got %s", provider.requests[1].Head)
+	}
+
+	// Each pushed branch only holds its own image's changes
+	show := func(branch, file string) string {
+		content, err := repo.run("--git-dir", remote, "show", branch+":"+file)
+		if err != nil {
+			t.Fatalf("Failed to read %s on %s: %v", file, branch, err)
+		}
+		return content
+	}
+	if content := show(golangBranch, "Containerfile"); !strings.Contains(content, golang.String()) || strings.Contains(content, alpine.String()) {
+		t.Errorf("Expected only golang pinned on %s:\n%s", golangBranch, content)
+	}
+	if content := show(golangBranch, "tools/Containerfile"); !strings.Contains(content, golang.String()) {
+		t.Errorf("Expected tools/Containerfile pinned on %s:\n%s", golangBranch, content)
+	}
+	if content := show(provider.requests[1].Head, "Containerfile"); !strings.Contains(content, alpine.String()) || strings.Contains(content, golang.String()) {
+		t.Errorf("Expected only alpine pinned on %s:\n%s", provider.requests[1].Head, content)
+	}
+
+	// The working tree is back on its branch as it was
+	if branch, _ := repo.CurrentBranch(); branch != "main" {
+		t.Errorf("Expected main to be checked out again, got %s", branch)
+	}
+	for name, content := range files {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+			t.Errorf("Expected %s to be unchanged, got %q", name, data)
+		}
+	}
+}
+
+func TestGroupedChangeRequestsLockFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	defer server.Close()
+	golang := pushRandomImage(t, server, host+"/golang:1.24")
+	alpine := pushRandomImage(t, server, host+"/alpine:3.20")
+
+	// The lock file is picked up from the working directory, as runUpdate does
+	dir := t.TempDir()
+	remote := t.TempDir()
+	lockContent := `{"version": 1, "files": {}}` + "\n"
+	repo := initGroupRepository(t, dir, remote, map[string]string{
+		"Containerfile": "FROM " + host + "/golang:1.24 AS build\nFROM " + host + "/alpine:3.20\n",
+		defaultLockFile: lockContent,
+	})
+	t.Chdir(dir)
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	provider := &recordingProvider{}
+	run := &updateRun{
+		paths:     []string{"Containerfile"},
+		cfg:       cfg,
+		format:    formatAuto,
+		output:    outputText,
+		gitCommit: true,
+		gitBranch: "updates",
+		gitRemote: remote,
+		provider:  provider,
+		groupBy:   groupByImage,
+		lockFile:  defaultLockFile,
+		backup:    BackupPolicy{Disabled: true},
+		out:       io.Discard,
+	}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	if len(provider.requests) != 2 {
+		t.Fatalf("Expected a change request per image, got %d", len(provider.requests))
+	}
+
+	// Each branch's lock file records only its own image
+	for i, want := range []struct{ has, lacks v1.Hash }{{golang, alpine}, {alpine, golang}} {
+		branch := provider.requests[i].Head
+		content, err := repo.run("--git-dir", remote, "show", branch+":"+defaultLockFile)
+		if err != nil {
+			t.Fatalf("Failed to read the lock file on %s: %v", branch, err)
+		}
+		if !strings.Contains(content, want.has.String()) || strings.Contains(content, want.lacks.String()) {
+			t.Errorf("Expected only %s locked on %s:\n%s", want.has, branch, content)
+		}
+	}
+	if data, _ := os.ReadFile(defaultLockFile); string(data) != lockContent {
+		t.Errorf("Expected the lock file on main to be unchanged, got %q", data)
+	}
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HelmConfig maps the values file paths that hold image coordinates
+type HelmConfig struct {
+	Images []HelmImagePath `yaml:"images"` // Image mappings to pin (defaults to the top-level "image")
+}
+
+// HelmImagePath locates a mapping of image coordinates in a values file
+type HelmImagePath struct {
+	Path       string `yaml:"path"`       // Dotted path to the mapping; "*" matches any key or list index
+	Registry   string `yaml:"registry"`   // Key holding the registry (default "registry")
+	Repository string `yaml:"repository"` // Key holding the repository (default "repository")
+	Tag        string `yaml:"tag"`        // Key holding the tag (default "tag")
+	Digest     string `yaml:"digest"`     // Key the digest is written to (default "digest")
+	ClearTag   bool   `yaml:"clearTag"`   // Blank the tag once a digest is pinned
+}
+
+// defaultHelmImagePaths covers the layout generated by `helm create`
+var defaultHelmImagePaths = []HelmImagePath{{Path: "image"}}
+
+// key returns the configured key name or its default
+func (p HelmImagePath) key(configured, fallback string) string {
+	if configured != "" {
+		return configured
+	}
+	return fallback
+}
+
+// validateHelmConfig rejects image paths that can't be matched
+func validateHelmConfig(hc HelmConfig) error {
+	for i, image := range hc.Images {
+		if strings.TrimSpace(image.Path) == "" {
+			return fmt.Errorf("helm image %d: path is required", i)
+		}
+	}
+	return nil
+}
+
+// isHelmValuesPath reports whether a file name looks like a chart values file
+func isHelmValuesPath(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	return stem == "values" || strings.HasPrefix(stem, "values-") || strings.HasPrefix(stem, "values.")
+}
+
+// extractHelmImages finds the configured image mappings in a Helm values file
+func (du *ContainerfileUpdater) extractHelmImages(docs []*yaml.Node) ([]*FromCommand, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	paths := du.config.Helm.Images
+	if len(paths) == 0 {
+		paths = defaultHelmImagePaths
+	}
+
+	seen := make(map[*yaml.Node]bool)
+	var images []*FromCommand
+	for _, path := range paths {
+		for _, match := range yamlPathLookup(nil, docs[0], strings.Split(path.Path, ".")) {
+			if seen[match.value] || match.value.Kind != yaml.MappingNode {
+				continue
+			}
+			seen[match.value] = true
+			if cmd := du.helmImageCommand(match.key, match.value, path); cmd != nil {
+				images = append(images, cmd)
+			}
+		}
+	}
+	return images, nil
+}
+
+// yamlPathMatch is a key/value pair found by yamlPathLookup
+type yamlPathMatch struct {
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+// yamlPathLookup resolves a dotted path below a node, expanding "*" segments
+func yamlPathLookup(key, node *yaml.Node, segments []string) []yamlPathMatch {
+	if len(segments) == 0 {
+		return []yamlPathMatch{{key: key, value: node}}
+	}
+
+	segment, rest := segments[0], segments[1:]
+	var matches []yamlPathMatch
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if segment == "*" || node.Content[i].Value == segment {
+				matches = append(matches, yamlPathLookup(node.Content[i], node.Content[i+1], rest)...)
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				matches = append(matches, yamlPathLookup(key, child, rest)...)
+			}
+		}
+	}
+	return matches
+}
+
+// helmImageCommand turns an image coordinates mapping into a FromCommand that pins by
+// setting the digest key
+func (du *ContainerfileUpdater) helmImageCommand(key, mapping *yaml.Node, path HelmImagePath) *FromCommand {
+	repositoryKey, repository := yamlMappingValue(mapping, path.key(path.Repository, "repository"))
+	if repository == nil || repository.Kind != yaml.ScalarNode || repository.Value == "" {
+		return nil
+	}
+
+	reference := repository.Value
+	if registry := yamlScalar(mapping, path.key(path.Registry, "registry")); registry != "" {
+		reference = registry + "/" + reference
+	}
+
+	tag := yamlScalar(mapping, path.key(path.Tag, "tag"))
+	if tag == "" {
+		// Charts conventionally fall back to the chart's appVersion
+		tag = du.chartAppVersion()
+	}
+	if tag != "" {
+		reference += ":" + tag
+	}
+	if digest := yamlScalar(mapping, path.key(path.Digest, "digest")); digest != "" {
+		reference += "@" + digest
+	}
+
+	imageRef, err := du.parseImageReference(reference)
+	if err != nil {
+		slog.Warn("Failed to parse image", "line", repository.Line, "error", err)
+		return nil
+	}
+
+	cmd := &FromCommand{
+		Image:       imageRef,
+		LineStart:   repository.Line,
+		LineEnd:     yamlLastLine(mapping),
+		Annotations: du.yamlAnnotations(repository.Line, key, repositoryKey),
+		editor:      helmDigestEditor(mapping, path),
+	}
+	switch {
+	case mapping.Style&yaml.FlowStyle != 0:
+		cmd.SkipReason = "flow-style image mapping"
+	case tag == "":
+		cmd.SkipReason = "no tag or chart appVersion to resolve"
+	case strings.Contains(reference, "{{"):
+		cmd.SkipReason = "uses template expressions"
+		cmd.Unpinnable = true
+	}
+	du.applySkipRules(cmd)
+	return cmd
+}
+
+// chartAppVersion returns the appVersion of the Chart.yaml next to the values file, if any
+func (du *ContainerfileUpdater) chartAppVersion() string {
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(du.containerfilePath), "Chart.yaml"))
+	if err != nil {
+		return ""
+	}
+	var chart struct {
+		AppVersion string `yaml:"appVersion"`
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return ""
+	}
+	return chart.AppVersion
+}
+
+// helmDigestEditor writes the digest key of an image mapping, blanking the tag when
+// configured and removing the digest for tag-only pins
+func helmDigestEditor(mapping *yaml.Node, path HelmImagePath) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		digest := cmd.Image.Digest
+		if cmd.Annotations != nil && cmd.Annotations.Pin == pinTagOnly {
+			digest = ""
+		}
+
+		cleared := false
+		if path.ClearTag && digest != "" {
+			// Clear before setting the digest: it may insert a line below the tag
+			lines, cleared = clearYAMLScalar(lines, mapping, path.key(path.Tag, "tag"))
+		}
+		lines, changed := setYAMLField(lines, mapping, path.key(path.Digest, "digest"), digest)
+		return lines, changed || cleared
+	}
+}
+
+// clearYAMLScalar blanks a scalar field of a mapping to an empty string, keeping the key
+func clearYAMLScalar(lines []string, mapping *yaml.Node, field string) ([]string, bool) {
+	key, value := yamlMappingValue(mapping, field)
+	if key == nil || value.Kind != yaml.ScalarNode || value.Value == "" || value.Line != key.Line {
+		return lines, false
+	}
+
+	index := value.Line - 1
+	if index < 0 || index >= len(lines) {
+		return lines, false
+	}
+	switch value.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		lines[index] = replaceYAMLScalar(lines[index], value, "")
+	default:
+		lines[index] = replaceYAMLScalar(lines[index], value, `""`)
+	}
+	return lines, true
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractHelmImages(t *testing.T) {
+	disableLogging()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: app\nappVersion: \"1.4.0\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Chart.yaml: %v", err)
+	}
+
+	content := `image:
+  repository: example/app
+  tag: ""
+sidecars:
+  - name: proxy
+    image:
+      registry: ghcr.io
+      repository: example/proxy
+      tag: v2
+  - name: logger
+    image:
+      # containerfile-updater: ignore
+      repository: example/logger
+      tag: v1
+metrics:
+  image: {repository: example/metrics, tag: v3}
+`
+	path := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write values: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.Helm.Images = []HelmImagePath{{Path: "image"}, {Path: "sidecars.*.image"}, {Path: "metrics.image"}}
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+
+	want := []struct {
+		tagged string
+		line   int
+		skip   string
+	}{
+		{"example/app:1.4.0", 2, ""},
+		{"ghcr.io/example/proxy:v2", 8, ""},
+		{"example/logger:v1", 13, "ignored by annotation"},
+		{"example/metrics:v3", 16, "flow-style image mapping"},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Expected %d images, got %d", len(want), len(images))
+	}
+	for i, w := range want {
+		if images[i].Image.TaggedName() != w.tagged || images[i].LineStart != w.line || images[i].SkipReason != w.skip {
+			t.Errorf("Image %d: expected %s at line %d (skip %q), got %s at line %d (skip %q)",
+				i, w.tagged, w.line, w.skip, images[i].Image.TaggedName(), images[i].LineStart, images[i].SkipReason)
+		}
+	}
+}
+
+func TestUpdateHelmValues(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/app:1.0")
+	worker := pushRandomImage(t, server, host+"/worker:2.0")
+
+	content := `replicaCount: 1
+image:
+  registry: ` + host + `
+  repository: app
+  tag: "1.0"
+  pullPolicy: IfNotPresent
+worker:
+  image:
+    registry: ` + host + `
+    repository: worker
+    tag: 2.0 # released
+    digest: sha256:old
+service:
+  port: 80
+`
+	path := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write values: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Helm.Images = []HelmImagePath{{Path: "image"}, {Path: "worker.image", ClearTag: true}}
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read values: %v", err)
+	}
+	expected := `replicaCount: 1
+image:
+  registry: ` + host + `
+  repository: app
+  tag: "1.0"
+  pullPolicy: IfNotPresent
+  digest: ` + app.String() + `
+worker:
+  image:
+    registry: ` + host + `
+    repository: worker
+    tag: "" # released
+    digest: ` + worker.String() + `
+service:
+  port: 80
+`
+	if string(data) != expected {
+		t.Errorf("Unexpected values:\n%s\nexpected:\n%s", string(data), expected)
+	}
+}
+
+func TestValidateHelmConfig(t *testing.T) {
+	if err := validateHelmConfig(HelmConfig{Images: []HelmImagePath{{Path: "image"}}}); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := validateHelmConfig(HelmConfig{Images: []HelmImagePath{{Repository: "repo"}}}); err == nil {
+		t.Error("Expected error for missing path")
+	}
+}
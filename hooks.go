@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Stages hooks run at
+const (
+	hookPreUpdate  = "pre-update"
+	hookPostUpdate = "post-update"
+)
+
+// defaultHookTimeout bounds each hook command, long enough for a build check
+const defaultHookTimeout = 10 * time.Minute
+
+// hookOutputLines is how much of a failed hook's output its error quotes
+const hookOutputLines = 20
+
+// HooksConfig holds shell commands run around the rewrite of each file
+type HooksConfig struct {
+	PreUpdate  []string      `yaml:"preUpdate"`  // Run before a file is rewritten; a failure leaves it untouched
+	PostUpdate []string      `yaml:"postUpdate"` // Run after a file is rewritten; a failure restores its previous content
+	Timeout    time.Duration `yaml:"timeout"`    // Time allowed per command (default 10m)
+}
+
+// validateHooksConfig rejects blank commands and negative timeouts
+func validateHooksConfig(hc HooksConfig) error {
+	for stage, commands := range map[string][]string{"preUpdate": hc.PreUpdate, "postUpdate": hc.PostUpdate} {
+		if slices.ContainsFunc(commands, func(command string) bool { return strings.TrimSpace(command) == "" }) {
+			return fmt.Errorf("hooks.%s has an empty command", stage)
+		}
+	}
+	if hc.Timeout < 0 {
+		return fmt.Errorf("hooks.timeout must not be negative")
+	}
+	return nil
+}
+
+// run runs the commands of a stage one after the other with sh -c, or cmd /C on Windows,
+// stopping at the first failure. They run in the working directory and learn about the file from the
+// environment.
+func (hc HooksConfig) run(stage, path, format string) error {
+	commands := hc.PreUpdate
+	if stage == hookPostUpdate {
+		commands = hc.PostUpdate
+	}
+	timeout := hc.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+
+	for _, command := range commands {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		cmd := hookCommand(ctx, command)
+		cmd.Env = append(os.Environ(),
+			"CONTAINERFILE_UPDATER_HOOK="+stage,
+			"CONTAINERFILE_UPDATER_FILE="+path,
+			"CONTAINERFILE_UPDATER_DIR="+filepath.Dir(path),
+			"CONTAINERFILE_UPDATER_FORMAT="+format,
+		)
+		start := time.Now()
+		output, err := cmd.CombinedOutput()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %w%s", stage, command, err, quoteOutput(output))
+		}
+		slog.Info("Ran hook", "stage", stage, "command", command, "path", path, "duration", time.Since(start).Round(time.Millisecond))
+		slog.Debug("Hook output", "command", command, "output", string(output))
+	}
+	return nil
+}
+
+// quoteOutput renders the last lines of a failed command's output for its error
+func quoteOutput(output []byte) string {
+	text := strings.TrimSpace(string(output))
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > hookOutputLines {
+		lines = lines[len(lines)-hookOutputLines:]
+	}
+	return ": " + strings.Join(lines, "\n")
+}
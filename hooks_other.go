@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+)
+
+// hookCommand runs a hook with sh -c
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
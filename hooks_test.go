@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The hooks are sh commands")
+	}
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/base:1.0")
+	content := "FROM " + host + "/base:1.0\n"
+	pinned := "FROM " + host + "/base@" + digest.String() + "\n"
+
+	tests := []struct {
+		name      string
+		hooks     HooksConfig
+		checkOnly bool
+		want      string // Content of the file after the run
+		wantErr   string
+		wantLog   string // Lines the hooks appended to their log
+	}{
+		{
+			name:    "hooks pass",
+			hooks:   HooksConfig{PreUpdate: []string{`echo "pre $CONTAINERFILE_UPDATER_HOOK" >> "$LOG"`}, PostUpdate: []string{`grep -q @sha256 "$CONTAINERFILE_UPDATER_FILE" && echo "post $CONTAINERFILE_UPDATER_FORMAT" >> "$LOG"`}},
+			want:    pinned,
+			wantLog: "pre pre-update\npost containerfile\n",
+		},
+		{
+			name:    "post-update failure restores the file",
+			hooks:   HooksConfig{PostUpdate: []string{`echo checked >> "$LOG"`, `echo "build check failed"; exit 3`}},
+			want:    content,
+			wantErr: `post-update hook "echo \"build check failed\"; exit 3" failed: exit status 3: build check failed`,
+			wantLog: "checked\n",
+		},
+		{
+			name:    "pre-update failure leaves the file alone",
+			hooks:   HooksConfig{PreUpdate: []string{"false"}, PostUpdate: []string{`echo post >> "$LOG"`}},
+			want:    content,
+			wantErr: `pre-update hook "false" failed`,
+		},
+		{
+			name:      "check mode runs no hooks",
+			hooks:     HooksConfig{PreUpdate: []string{`echo pre >> "$LOG"`}},
+			checkOnly: true,
+			want:      content,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, "hooks.log")
+			t.Setenv("LOG", logPath)
+			path := filepath.Join(dir, "Containerfile")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			cfg.Hooks = tt.hooks
+			updater := NewContainerfileUpdaterWithConfig(path, cfg)
+			updater.checkOnly = tt.checkOnly
+			err := updater.UpdateContainerfileWithLatestDigests()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Update failed: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Expected file %q, got %q", tt.want, string(data))
+			}
+			if changed := updater.changedCount() > 0; changed != (tt.want == pinned) && !tt.checkOnly {
+				t.Errorf("Expected changed %v, got %v", tt.want == pinned, changed)
+			}
+			log, _ := os.ReadFile(logPath)
+			if string(log) != tt.wantLog {
+				t.Errorf("Expected hook log %q, got %q", tt.wantLog, string(log))
+			}
+		})
+	}
+}
+
+func TestHookShell(t *testing.T) {
+	// Runs the same under sh and cmd.exe
+	hooks := HooksConfig{PreUpdate: []string{"echo hook failed&& exit 3"}}
+	err := hooks.run(hookPreUpdate, "Containerfile", formatContainerfile)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: hook failed") {
+		t.Errorf("Expected the hook's exit status and output, got %v", err)
+	}
+}
+
+func TestValidateHooksConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   HooksConfig
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "commands", hooks: HooksConfig{PreUpdate: []string{"make lint"}, PostUpdate: []string{"docker build --check ."}}},
+		{name: "blank command", hooks: HooksConfig{PostUpdate: []string{" "}}, wantErr: true},
+		{name: "negative timeout", hooks: HooksConfig{Timeout: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateHooksConfig(tt.hooks); (err != nil) != tt.wantErr {
+				t.Errorf("validateHooksConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
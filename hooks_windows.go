@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// hookCommand runs a hook with cmd /C. The command line is passed as written, as cmd.exe
+// doesn't understand the escaping of regular arguments.
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + command + `"`}
+	return cmd
+}
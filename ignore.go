@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileName is the file listing paths a directory walk skips and images never updated
+const ignoreFileName = ".containerfileupdaterignore"
+
+// ignoreImagePrefix marks a line of an ignore file as an image pattern rather than a path
+const ignoreImagePrefix = "image:"
+
+// ignoreRule is one gitignore-style path pattern
+type ignoreRule struct {
+	re      *regexp.Regexp // Matches slash-separated paths relative to the ignore file
+	negate  bool           // "!" re-includes what earlier patterns excluded
+	dirOnly bool           // A trailing "/" only matches directories
+}
+
+// ignoreFile holds the patterns of one ignore file, which apply below its directory
+type ignoreFile struct {
+	dir    string // Absolute path of the directory holding the file
+	paths  []ignoreRule
+	images []*regexp.Regexp
+}
+
+// loadIgnoreFile reads the ignore file of an absolute directory, returning nil if there is none
+func loadIgnoreFile(dir string) (*ignoreFile, error) {
+	path := filepath.Join(dir, ignoreFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := parseIgnoreFile(dir, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ignore, nil
+}
+
+// parseIgnoreFile parses gitignore-style path patterns and "image:" patterns. Image
+// patterns are globs or "re:" regular expressions, as in the image deny list.
+func parseIgnoreFile(dir string, data []byte) (*ignoreFile, error) {
+	ignore := &ignoreFile{dir: dir}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimRight(strings.TrimSuffix(scanner.Text(), "\r"), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if image, ok := strings.CutPrefix(line, ignoreImagePrefix); ok {
+			patterns, err := compilePatterns([]string{strings.TrimSpace(image)})
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid image pattern %w", number, err)
+			}
+			ignore.images = append(ignore.images, patterns...)
+			continue
+		}
+
+		rule, err := compileIgnorePattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q: %w", number, line, err)
+		}
+		ignore.paths = append(ignore.paths, rule)
+	}
+	return ignore, scanner.Err()
+}
+
+// compileIgnorePattern translates a gitignore pattern: "*" and "?" stay within a path
+// segment, "**" spans segments, and a pattern without an inner "/" matches at any depth
+func compileIgnorePattern(pattern string) (ignoreRule, error) {
+	var rule ignoreRule
+	if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+		rule.negate = true
+		pattern = negated
+	}
+	if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+		rule.dirOnly = true
+		pattern = dir
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		case pattern[i] == '[' && strings.Contains(pattern[i+1:], "]"):
+			end := i + 1 + strings.Index(pattern[i+1:], "]")
+			class := pattern[i+1 : end]
+			if negated, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + negated
+			}
+			b.WriteString("[" + class + "]")
+			i = end
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			b.WriteString(regexp.QuoteMeta(pattern[i+1 : i+2]))
+			i++
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return rule, err
+	}
+	rule.re = re
+	return rule, nil
+}
+
+// match reports whether any path pattern matches an absolute path below the ignore file's
+// directory, and if so whether the last matching one excludes it
+func (f *ignoreFile) match(path string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(f.dir, path)
+	if err != nil || rel == "." || !isWithin(f.dir, path) {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range f.paths {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			matched, ignored = true, !rule.negate
+		}
+	}
+	return matched, ignored
+}
+
+// pathIgnored reports whether the ignore files of a walk exclude a path. Files deeper in
+// the tree take precedence, like nested .gitignore files.
+func pathIgnored(ignores []*ignoreFile, path string, isDir bool) bool {
+	ignored := false
+	for _, ignore := range ignores {
+		if matched, excluded := ignore.match(path, isDir); matched {
+			ignored = excluded
+		}
+	}
+	return ignored
+}
+
+// loadIgnoreFiles reads the ignore files of an absolute directory and its parents up to
+// the root of its git repository, outermost first
+func loadIgnoreFiles(dir string) ([]*ignoreFile, error) {
+	var ignores []*ignoreFile
+	for {
+		ignore, err := loadIgnoreFile(dir)
+		if err != nil {
+			return nil, err
+		}
+		if ignore != nil {
+			ignores = append([]*ignoreFile{ignore}, ignores...)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ignores, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ignores, nil
+		}
+		dir = parent
+	}
+}
+
+// ignoredImagePatterns collects the image patterns of the ignore files that apply to a file
+func ignoredImagePatterns(path string) ([]*regexp.Regexp, error) {
+	if path == stdinPath {
+		return nil, nil
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	ignores, err := loadIgnoreFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []*regexp.Regexp
+	for _, ignore := range ignores {
+		patterns = append(patterns, ignore.images...)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		match   bool
+	}{
+		{pattern: "fixtures", path: "fixtures", isDir: true, match: true},
+		{pattern: "fixtures", path: "a/b/fixtures", isDir: true, match: true},
+		{pattern: "/fixtures", path: "a/fixtures", isDir: true, match: false},
+		{pattern: "examples/", path: "examples", isDir: true, match: true},
+		{pattern: "examples/", path: "examples", isDir: false, match: false},
+		{pattern: "*.Dockerfile", path: "build/test.Dockerfile", match: true},
+		{pattern: "build/*.Dockerfile", path: "build/sub/test.Dockerfile", match: false},
+		{pattern: "build/**/*.Dockerfile", path: "build/sub/test.Dockerfile", match: true},
+		{pattern: "build/**/*.Dockerfile", path: "build/test.Dockerfile", match: true},
+		{pattern: "**/testdata/Containerfile", path: "pkg/testdata/Containerfile", match: true},
+		{pattern: "Dockerfile.?", path: "Dockerfile.a", match: true},
+		{pattern: "Dockerfile.[!a]", path: "Dockerfile.a", match: false},
+		{pattern: `\#hash`, path: "#hash", match: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			rule, err := compileIgnorePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("compileIgnorePattern(%q) error = %v", tt.pattern, err)
+			}
+			ignore := &ignoreFile{dir: "/repo", paths: []ignoreRule{rule}}
+			matched, _ := ignore.match(filepath.Join("/repo", filepath.FromSlash(tt.path)), tt.isDir)
+			if matched != tt.match {
+				t.Errorf("Pattern %q on %q: got %v, want %v", tt.pattern, tt.path, matched, tt.match)
+			}
+		})
+	}
+}
+
+func TestDiscoverFilesIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".git/HEAD":                     "ref: refs/heads/main\n",
+		ignoreFileName:                  "# Vendored examples and fixtures\nexamples/\n**/testdata/\n*.fixture.Dockerfile\n!keep.fixture.Dockerfile\n",
+		"Containerfile":                 "FROM alpine\n",
+		"examples/Containerfile":        "FROM alpine\n",
+		"svc/testdata/Containerfile":    "FROM alpine\n",
+		"svc/broken.fixture.Dockerfile": "FROM alpine\n",
+		"svc/keep.fixture.Dockerfile":   "FROM alpine\n",
+		"svc/Containerfile":             "FROM alpine\n",
+		"svc/legacy/" + ignoreFileName:  "Containerfile.*\n",
+		"svc/legacy/Containerfile":      "FROM alpine\n",
+		"svc/legacy/Containerfile.old":  "FROM alpine\n",
+		"Containerfile.old":             "FROM alpine\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	discover := func(root string, args ...string) []string {
+		got, err := discoverFiles(args, nil)
+		if err != nil {
+			t.Fatalf("discoverFiles failed: %v", err)
+		}
+		for i, path := range got {
+			rel, _ := filepath.Rel(root, path)
+			got[i] = filepath.ToSlash(rel)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	want := []string{
+		"Containerfile",
+		"Containerfile.old",
+		"svc/Containerfile",
+		"svc/keep.fixture.Dockerfile",
+		"svc/legacy/Containerfile",
+	}
+	if got := discover(dir, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Walking a subdirectory still honors the ignore file at the repository root
+	want = []string{"Containerfile", "keep.fixture.Dockerfile", "legacy/Containerfile"}
+	if got := discover(filepath.Join(dir, "svc"), filepath.Join(dir, "svc")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Explicitly named paths are kept
+	explicit := filepath.Join(dir, "examples", "Containerfile")
+	if got := discover(dir, explicit); !reflect.DeepEqual(got, []string{"examples/Containerfile"}) {
+		t.Errorf("Expected the explicit file to be kept, got %v", got)
+	}
+}
+
+func TestIgnoreFileImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	ignore := "image: registry.example.com/vendored/*\nimage: re:^library/busybox:\n"
+	if err := os.WriteFile(filepath.Join(dir, ignoreFileName), []byte(ignore), 0644); err != nil {
+		t.Fatalf("Failed to write ignore file: %v", err)
+	}
+	path := filepath.Join(dir, "app", "Containerfile")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	content := "FROM registry.example.com/vendored/tool:1 AS tool\nFROM busybox:1.36\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	updater := NewContainerfileUpdater(path)
+	updater.checkOnly = true
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(updater.fromCommands) != 2 {
+		t.Fatalf("Expected 2 images, got %d", len(updater.fromCommands))
+	}
+	for _, cmd := range updater.fromCommands {
+		if cmd.SkipReason != "ignored by "+ignoreFileName {
+			t.Errorf("%s: skip reason %q", cmd.Image.Original, cmd.SkipReason)
+		}
+	}
+
+	if _, err := parseIgnoreFile(dir, []byte("image: re:(\n")); err == nil {
+		t.Error("Expected an error for an invalid image pattern")
+	}
+}
@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ImageInspection describes an image as published on its registry
+type ImageInspection struct {
+	File        string            `json:"file"`
+	Line        int               `json:"line"`
+	Image       string            `json:"image"`            // Reference as written
+	Reference   string            `json:"reference"`        // Tag or digest that was inspected
+	Digest      string            `json:"digest,omitempty"` // Digest the reference resolves to
+	MediaType   string            `json:"mediaType,omitempty"`
+	Platforms   []string          `json:"platforms,omitempty"` // Platforms of an index, or of the single image
+	Created     *time.Time        `json:"created,omitempty"`   // Creation time of the image config
+	Release     *ReleaseInfo      `json:"release,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"` // Annotations of the index or manifest
+	Labels      map[string]string `json:"labels,omitempty"`      // Labels of the image config
+	Tags        []string          `json:"tags,omitempty"`        // Every tag of the repository, with --tags
+	Skipped     string            `json:"skipped,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// InspectImages looks up the published metadata of every image in the updater's file
+func (du *ContainerfileUpdater) InspectImages() ([]ImageInspection, error) {
+	commands, err := du.extractImages()
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	inspections := []ImageInspection{}
+	for _, cmd := range commands {
+		inspection := ImageInspection{
+			File:    displayPath(du.containerfilePath),
+			Line:    cmd.LineStart,
+			Image:   cmd.Image.Original,
+			Skipped: cmd.SkipReason,
+		}
+		if cmd.SkipReason == "" {
+			if err := du.inspectCommand(runCtx, cmd, &inspection); err != nil {
+				slog.Warn("Failed to inspect image", "image", cmd.Image.Original, "error", err)
+				inspection.Error = err.Error()
+			}
+		}
+		inspections = append(inspections, inspection)
+	}
+	return inspections, nil
+}
+
+// inspectCommand inspects one image within the run's context
+func (du *ContainerfileUpdater) inspectCommand(runCtx context.Context, cmd *FromCommand, inspection *ImageInspection) error {
+	ctx, cancel, err := du.lookupContext(runCtx, cmd.Image.Registry)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if err := du.inspectImage(ctx, cmd, inspection); err != nil {
+		return err
+	}
+	if du.inspectTags {
+		if inspection.Tags, err = du.listTags(ctx, cmd.Image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inspectImage fills in the registry metadata of an image: the pinned digest if there is
+// one, its tag otherwise. The labels and creation time of an index come from the image of
+// the FROM instruction's platform (or linux/amd64).
+func (du *ContainerfileUpdater) inspectImage(ctx context.Context, cmd *FromCommand, inspection *ImageInspection) error {
+	image := cmd.Image
+	inspection.Reference = image.TaggedName()
+	if image.Digest != "" {
+		inspection.Reference = image.PinnedName()
+	}
+
+	ref, err := name.ParseReference(inspection.Reference, referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return fmt.Errorf("failed to parse reference %s: %w", inspection.Reference, err)
+	}
+	options, err := du.remoteOptions(ctx, image.Registry)
+	if err != nil {
+		return err
+	}
+
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	inspection.Digest = desc.Digest.String()
+	inspection.MediaType = string(desc.MediaType)
+
+	var img v1.Image
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return fmt.Errorf("failed to read index %s: %w", ref, err)
+		}
+		manifest, err := index.IndexManifest()
+		if err != nil {
+			return fmt.Errorf("failed to read index %s: %w", ref, err)
+		}
+		inspection.Annotations = manifest.Annotations
+		for _, child := range manifest.Manifests {
+			// BuildKit attestation manifests carry an unknown/unknown platform
+			if child.Platform == nil || child.Platform.OS == "unknown" {
+				continue
+			}
+			inspection.Platforms = append(inspection.Platforms, child.Platform.String())
+		}
+
+		if cmd.Platform != "" && !strings.Contains(cmd.Platform, "$") {
+			if platform, err := v1.ParsePlatform(cmd.Platform); err == nil {
+				options = append(options, remote.WithPlatform(*platform))
+			}
+		}
+		if img, err = remote.Image(ref.Context().Digest(inspection.Digest), options...); err != nil {
+			return fmt.Errorf("failed to fetch platform image of %s: %w", ref, err)
+		}
+	} else {
+		if img, err = desc.Image(); err != nil {
+			return fmt.Errorf("failed to read image %s: %w", ref, err)
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			return fmt.Errorf("failed to read manifest %s: %w", ref, err)
+		}
+		inspection.Annotations = manifest.Annotations
+	}
+
+	config, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("failed to read config of %s: %w", ref, err)
+	}
+	inspection.Labels = config.Config.Labels
+	if config.Created.Unix() > 0 {
+		created := config.Created.UTC()
+		inspection.Created = &created
+	}
+	if !desc.MediaType.IsIndex() && config.OS != "" {
+		platform := v1.Platform{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}
+		inspection.Platforms = []string{platform.String()}
+	}
+
+	// Annotations describe the published artifact and win over inherited base image labels
+	metadata := maps.Clone(inspection.Labels)
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	maps.Copy(metadata, inspection.Annotations)
+	inspection.Release = newReleaseInfo(metadata)
+	return nil
+}
+
+// writeInspections prints image inspections as indented text blocks
+func writeInspections(w io.Writer, inspections []ImageInspection) {
+	for i, inspection := range inspections {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:%d %s\n", inspection.File, inspection.Line, inspection.Image)
+		switch {
+		case inspection.Skipped != "":
+			fmt.Fprintf(w, "  Skipped:     %s\n", inspection.Skipped)
+			continue
+		case inspection.Error != "":
+			fmt.Fprintf(w, "  Error:       %s\n", inspection.Error)
+			continue
+		}
+
+		fmt.Fprintf(w, "  Digest:      %s\n", inspection.Digest)
+		if inspection.Created != nil {
+			fmt.Fprintf(w, "  Created:     %s\n", inspection.Created.Format(time.RFC3339))
+		}
+		if len(inspection.Platforms) > 0 {
+			fmt.Fprintf(w, "  Platforms:   %s\n", strings.Join(inspection.Platforms, ", "))
+		}
+		if release := inspection.Release; release != nil {
+			fmt.Fprintf(w, "  Source:      %s\n", release.Source)
+			if release.Version != "" {
+				fmt.Fprintf(w, "  Version:     %s\n", release.Version)
+			}
+			if release.Revision != "" {
+				fmt.Fprintf(w, "  Revision:    %s\n", release.Revision)
+			}
+		}
+		if len(inspection.Tags) > 0 {
+			fmt.Fprintf(w, "  Tags:        %s\n", strings.Join(inspection.Tags, ", "))
+		}
+		writeMetadata(w, "Annotations", inspection.Annotations)
+		writeMetadata(w, "Labels", inspection.Labels)
+	}
+}
+
+// writeMetadata prints annotations or labels sorted by key
+func writeMetadata(w io.Writer, title string, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  %s:\n", title)
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		fmt.Fprintf(w, "    %s=%s\n", key, metadata[key])
+	}
+}
+
+// runInspect implements the inspect subcommand
+func runInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	output := fs.String("output", outputText, "Output format (text, json)")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also inspect the frontend image of # syntax= directives")
+	scanRun := fs.Bool("scan-run", false, "Also inspect images pulled inside RUN instructions")
+	tags := fs.Bool("tags", false, "Also list every tag of each image's repository")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Print the annotations, labels, creation time and platforms of every image.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("info"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if err := validateOutputFormat(*output); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to inspect", "error", err)
+		return exitError
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+
+	exitCode := exitOK
+	inspections := []ImageInspection{}
+	for _, path := range paths {
+		fileFormat, err := resolveFormat(*format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		inspector := NewContainerfileUpdaterWithConfig(path, cfg)
+		inspector.format = fileFormat
+		inspector.pinSyntax = *pinSyntax
+		inspector.inspectTags = *tags
+		results, err := inspector.InspectImages()
+		if err != nil {
+			slog.Error("Failed to extract images", "path", path, "error", err)
+			exitCode = exitError
+			continue
+		}
+		for _, inspection := range results {
+			if inspection.Error != "" {
+				exitCode = exitError
+			}
+		}
+		inspections = append(inspections, results...)
+	}
+
+	if *output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(inspections); err != nil {
+			slog.Error("Failed to write inspections", "error", err)
+			return exitError
+		}
+		return exitCode
+	}
+	writeInspections(os.Stdout, inspections)
+	return exitCode
+}
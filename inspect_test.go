@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestInspectImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	transport := server.Client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	created := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	platformImage := func(arch string) v1.Image {
+		t.Helper()
+		img, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatalf("Failed to create random image: %v", err)
+		}
+		if img, err = mutate.CreatedAt(img, v1.Time{Time: created}); err != nil {
+			t.Fatalf("Failed to set creation time: %v", err)
+		}
+		if img, err = mutate.Config(img, v1.Config{Labels: map[string]string{"arch": arch}}); err != nil {
+			t.Fatalf("Failed to set labels: %v", err)
+		}
+		return img
+	}
+
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: platformImage("amd64"), Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: platformImage("arm64"), Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}}},
+	)
+	index = mutate.Annotations(index, map[string]string{
+		annotationSource:  "https://github.com/example/base",
+		annotationVersion: "1.0.0",
+	}).(v1.ImageIndex)
+	ref, err := name.ParseReference(host+"/base:1.0", name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	if err := remote.WriteIndex(ref, index, remote.WithTransport(transport)); err != nil {
+		t.Fatalf("Failed to push index: %v", err)
+	}
+
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	content := "FROM --platform=linux/arm64/v8 " + host + "/base:1.0\n" +
+		"FROM " + host + "/missing:1.0\n" +
+		"# containerfile-updater: ignore\n" +
+		"FROM " + host + "/base:1.0\n"
+	if err := os.WriteFile(containerfilePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	inspections, err := NewContainerfileUpdaterWithConfig(containerfilePath, cfg).InspectImages()
+	if err != nil {
+		t.Fatalf("InspectImages failed: %v", err)
+	}
+	if len(inspections) != 3 {
+		t.Fatalf("Expected 3 inspections, got %d", len(inspections))
+	}
+
+	base := inspections[0]
+	if base.Error != "" {
+		t.Fatalf("Inspection failed: %s", base.Error)
+	}
+	if !slices.Equal(base.Platforms, []string{"linux/amd64", "linux/arm64/v8"}) {
+		t.Errorf("Platforms = %v", base.Platforms)
+	}
+	if base.Labels["arch"] != "arm64" {
+		t.Errorf("Labels should come from the FROM platform, got %v", base.Labels)
+	}
+	if base.Created == nil || !base.Created.Equal(created) {
+		t.Errorf("Created = %v, want %v", base.Created, created)
+	}
+	if base.Release == nil || base.Release.ReleaseNotes != "https://github.com/example/base/releases/tag/1.0.0" {
+		t.Errorf("Release = %+v", base.Release)
+	}
+	if inspections[1].Error == "" {
+		t.Errorf("Expected an error for the missing image")
+	}
+	if inspections[2].Skipped == "" {
+		t.Errorf("Expected the ignored image to be skipped")
+	}
+
+	var out bytes.Buffer
+	writeInspections(&out, inspections)
+	for _, want := range []string{"Platforms:   linux/amd64, linux/arm64/v8", "Created:     2025-01-15T12:00:00Z", "    arch=arm64", "Source:      https://github.com/example/base"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Text output missing %q:\n%s", want, out.String())
+		}
+	}
+}
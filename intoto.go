@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// in-toto statement and SLSA provenance identifiers
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	updateBuildType     = "https://github.com/drGrove/containerfile-updater/update/v1"
+	defaultBuilderID    = "https://github.com/drGrove/containerfile-updater"
+)
+
+// InTotoStatement is an in-toto statement about the files of an update run
+type InTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     SLSAProvenance       `json:"predicate"`
+}
+
+// ResourceDescriptor identifies a file or image by name and digest
+type ResourceDescriptor struct {
+	Name        string            `json:"name,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	Annotations map[string]any    `json:"annotations,omitempty"`
+}
+
+// SLSAProvenance is a SLSA v1 provenance predicate describing an update run: the files
+// given are the external parameters, the images whose pins changed the resolved
+// dependencies, with their previous digests and why they changed
+type SLSAProvenance struct {
+	BuildDefinition struct {
+		BuildType            string               `json:"buildType"`
+		ExternalParameters   map[string]any       `json:"externalParameters"`
+		ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version,omitempty"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string    `json:"invocationId,omitempty"`
+			StartedOn    time.Time `json:"startedOn"`
+			FinishedOn   time.Time `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// builderIdentity returns who ran the update and the run's ID: the workflow and run on
+// GitHub Actions, the project and job on GitLab CI, and the updater itself elsewhere
+func builderIdentity(getenv func(string) string) (string, string) {
+	if repository := getenv("GITHUB_REPOSITORY"); repository != "" {
+		server := cmp.Or(getenv("GITHUB_SERVER_URL"), "https://github.com")
+		id := server + "/" + repository
+		if workflow := getenv("GITHUB_WORKFLOW_REF"); workflow != "" {
+			id = server + "/" + workflow
+		}
+		var invocation string
+		if run := getenv("GITHUB_RUN_ID"); run != "" {
+			invocation = fmt.Sprintf("%s/%s/actions/runs/%s/attempts/%s", server, repository, run, cmp.Or(getenv("GITHUB_RUN_ATTEMPT"), "1"))
+		}
+		return id, invocation
+	}
+	if project := getenv("CI_PROJECT_URL"); project != "" {
+		return project + "/-/blob/" + getenv("CI_COMMIT_SHA") + "/" + cmp.Or(getenv("CI_CONFIG_PATH"), ".gitlab-ci.yml"), getenv("CI_JOB_URL")
+	}
+	return defaultBuilderID, ""
+}
+
+// changeReason describes why the pin of an image changed
+func changeReason(image ImageReport) string {
+	tag := image.Image[strings.LastIndex(image.Image, ":")+1:]
+	if image.PreviousDigest == "" {
+		return fmt.Sprintf("pinned to the digest of tag %s", tag)
+	}
+	return fmt.Sprintf("tag %s moved to a new digest", tag)
+}
+
+// digestMap splits a digest into the algorithm and hex form in-toto uses
+func digestMap(digest string) map[string]string {
+	algorithm, value, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil
+	}
+	return map[string]string{algorithm: value}
+}
+
+// newRunStatement describes an update run. The subjects are the files as they are after
+// the run, so the statement can be matched against the committed files.
+func newRunStatement(reports []*RunReport, checkOnly bool, started, finished time.Time, getenv func(string) string) (*InTotoStatement, error) {
+	statement := &InTotoStatement{Type: inTotoStatementType, Subject: []ResourceDescriptor{}, PredicateType: slsaProvenanceType}
+	provenance := &statement.Predicate
+	provenance.BuildDefinition.BuildType = updateBuildType
+	provenance.BuildDefinition.ResolvedDependencies = []ResourceDescriptor{}
+
+	var files []string
+	for _, report := range reports {
+		file := displayPath(report.Containerfile)
+		files = append(files, file)
+		if report.Containerfile != stdinPath && report.Error == "" {
+			data, err := os.ReadFile(report.Containerfile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", file, err)
+			}
+			sum := sha256.Sum256(data)
+			statement.Subject = append(statement.Subject, ResourceDescriptor{Name: file, Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}})
+		}
+
+		for _, image := range report.Images {
+			if !image.Changed || image.Error != "" || image.Skipped != "" || image.Held != "" {
+				continue
+			}
+			annotations := map[string]any{
+				"file":   file,
+				"line":   image.Line,
+				"reason": changeReason(image),
+			}
+			if image.PreviousDigest != "" {
+				annotations["previousDigest"] = image.PreviousDigest
+			}
+			if image.Release != nil {
+				for key, value := range map[string]string{"version": image.Release.Version, "revision": image.Release.Revision, "source": image.Release.Source} {
+					if value != "" {
+						annotations[key] = value
+					}
+				}
+			}
+			provenance.BuildDefinition.ResolvedDependencies = append(provenance.BuildDefinition.ResolvedDependencies, ResourceDescriptor{
+				Name:        image.Image,
+				Digest:      digestMap(image.Digest),
+				Annotations: annotations,
+			})
+		}
+	}
+	provenance.BuildDefinition.ExternalParameters = map[string]any{"files": files, "checkOnly": checkOnly}
+
+	info := currentBuildInfo()
+	runDetails := &provenance.RunDetails
+	runDetails.Builder.ID, runDetails.Metadata.InvocationID = builderIdentity(getenv)
+	runDetails.Builder.Version = map[string]string{"containerfile-updater": info.Version}
+	if info.Commit != "" {
+		runDetails.Builder.Version["commit"] = info.Commit
+	}
+	runDetails.Metadata.StartedOn = started.UTC().Truncate(time.Second)
+	runDetails.Metadata.FinishedOn = finished.UTC().Truncate(time.Second)
+	return statement, nil
+}
+
+// writeAttestation writes the in-toto statement of a run to a file, signing it when a
+// signer is configured
+func (r *updateRun) writeAttestation(reports []*RunReport, started time.Time) error {
+	statement, err := newRunStatement(reports, r.checkOnly, started, time.Now(), os.Getenv)
+	if err != nil {
+		return err
+	}
+	var data strings.Builder
+	if err := writeJSONReport(&data, statement); err != nil {
+		return err
+	}
+	if err := r.writeOutput(r.intoto, []byte(data.String())); err != nil {
+		return fmt.Errorf("failed to write %s: %w", r.intoto, err)
+	}
+	if r.cfg.Signing.Signer != "" {
+		if _, err := r.signOutput(r.intoto); err != nil {
+			return fmt.Errorf("failed to sign %s: %w", r.intoto, err)
+		}
+	}
+	return nil
+}
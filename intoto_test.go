@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuilderIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		id         string
+		invocation string
+	}{
+		{"local", nil, defaultBuilderID, ""},
+		{
+			"github",
+			map[string]string{
+				"GITHUB_REPOSITORY":   "org/repo",
+				"GITHUB_WORKFLOW_REF": "org/repo/.github/workflows/pins.yml@refs/heads/main",
+				"GITHUB_RUN_ID":       "42",
+				"GITHUB_RUN_ATTEMPT":  "2",
+			},
+			"https://github.com/org/repo/.github/workflows/pins.yml@refs/heads/main",
+			"https://github.com/org/repo/actions/runs/42/attempts/2",
+		},
+		{
+			"gitlab",
+			map[string]string{
+				"CI_PROJECT_URL": "https://gitlab.example.com/group/project",
+				"CI_COMMIT_SHA":  "abc123",
+				"CI_JOB_URL":     "https://gitlab.example.com/group/project/-/jobs/7",
+			},
+			"https://gitlab.example.com/group/project/-/blob/abc123/.gitlab-ci.yml",
+			"https://gitlab.example.com/group/project/-/jobs/7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, invocation := builderIdentity(func(key string) string { return tt.env[key] })
+			if id != tt.id || invocation != tt.invocation {
+				t.Errorf("Expected (%q, %q), got (%q, %q)", tt.id, tt.invocation, id, invocation)
+			}
+		})
+	}
+}
+
+func TestRunAttestation(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/app:latest")
+	base := pushRandomImage(t, server, host+"/base:latest")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	content := "FROM " + host + "/base@" + base.String() + "\nFROM " + host + "/app:latest\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"GITHUB_REPOSITORY", "CI_PROJECT_URL"} {
+		t.Setenv(key, "")
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	statementPath := filepath.Join(dir, "run.intoto.json")
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, backup: BackupPolicy{Disabled: true}, intoto: statementPath, out: io.Discard}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	data, err := os.ReadFile(statementPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statement InTotoStatement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		t.Fatalf("Invalid statement: %v", err)
+	}
+	if statement.Type != inTotoStatementType || statement.PredicateType != slsaProvenanceType {
+		t.Errorf("Unexpected statement types %q and %q", statement.Type, statement.PredicateType)
+	}
+
+	updated, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(updated)
+	if len(statement.Subject) != 1 || statement.Subject[0].Digest["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the updated file as the subject, got %+v", statement.Subject)
+	}
+
+	// Only the changed pin is a dependency
+	dependencies := statement.Predicate.BuildDefinition.ResolvedDependencies
+	if len(dependencies) != 1 {
+		t.Fatalf("Expected 1 resolved dependency, got %+v", dependencies)
+	}
+	dependency := dependencies[0]
+	if dependency.Name != host+"/app:latest" || dependency.Digest["sha256"] != strings.TrimPrefix(digest.String(), "sha256:") {
+		t.Errorf("Unexpected dependency %+v", dependency)
+	}
+	if dependency.Annotations["reason"] != "pinned to the digest of tag latest" || dependency.Annotations["line"] != float64(2) {
+		t.Errorf("Unexpected dependency annotations %v", dependency.Annotations)
+	}
+	if details := statement.Predicate.RunDetails; details.Builder.ID != defaultBuilderID || details.Metadata.FinishedOn.Before(details.Metadata.StartedOn) {
+		t.Errorf("Unexpected run details %+v", details)
+	}
+}
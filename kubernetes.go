@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// podSpecContainerKeys name the container lists of a PodSpec, wherever it is nested
+var podSpecContainerKeys = map[string]bool{
+	"containers":          true,
+	"initContainers":      true,
+	"ephemeralContainers": true,
+}
+
+// extractKubernetesImages finds container images in every document of a Kubernetes
+// manifest, and the images transformer entries of a Kustomization
+func (du *ContainerfileUpdater) extractKubernetesImages(docs []*yaml.Node) ([]*FromCommand, error) {
+	stem := strings.TrimSuffix(strings.ToLower(filepath.Base(du.containerfilePath)), filepath.Ext(du.containerfilePath))
+	var images []*FromCommand
+	for _, doc := range docs {
+		if yamlScalar(doc, "kind") == "Kustomization" || stem == "kustomization" {
+			images = append(images, du.kustomizeImages(doc)...)
+			continue
+		}
+		images = du.collectContainerImages(doc, images)
+	}
+	return images, nil
+}
+
+// collectContainerImages walks a manifest and collects the image of every container
+// list it finds, covering Pods, workloads, CronJob templates and custom resources
+func (du *ContainerfileUpdater) collectContainerImages(node *yaml.Node, images []*FromCommand) []*FromCommand {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if podSpecContainerKeys[key.Value] && value.Kind == yaml.SequenceNode {
+				for _, container := range value.Content {
+					imageKey, image := yamlMappingValue(container, "image")
+					if image == nil {
+						continue
+					}
+					if cmd := du.yamlImageCommand(imageKey, image); cmd != nil {
+						images = append(images, cmd)
+					}
+				}
+				continue
+			}
+			images = du.collectContainerImages(value, images)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			images = du.collectContainerImages(child, images)
+		}
+	}
+	return images
+}
+
+// kustomizeImages turns the entries of a Kustomization's images transformer into
+// FromCommands that pin by setting each entry's digest field
+func (du *ContainerfileUpdater) kustomizeImages(doc *yaml.Node) []*FromCommand {
+	_, entries := yamlMappingValue(doc, "images")
+	if entries == nil || entries.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	var images []*FromCommand
+	for _, entry := range entries.Content {
+		nameKey, nameNode := yamlMappingValue(entry, "name")
+		if nameNode == nil || nameNode.Value == "" {
+			continue
+		}
+
+		// newName and newTag override the image the manifests refer to
+		reference := nameNode.Value
+		if newName := yamlScalar(entry, "newName"); newName != "" {
+			reference = newName
+		}
+		if newTag := yamlScalar(entry, "newTag"); newTag != "" {
+			reference += ":" + newTag
+		}
+		if digest := yamlScalar(entry, "digest"); digest != "" {
+			reference += "@" + digest
+		}
+
+		imageRef, err := du.parseImageReference(reference)
+		if err != nil {
+			slog.Warn("Failed to parse image", "line", nameNode.Line, "error", err)
+			continue
+		}
+
+		cmd := &FromCommand{
+			Image:       imageRef,
+			LineStart:   nameNode.Line,
+			LineEnd:     yamlLastLine(entry),
+			Annotations: du.yamlAnnotations(nameNode.Line, entry, nameKey),
+			editor:      kustomizeDigestEditor(entry),
+		}
+		if entry.Style&yaml.FlowStyle != 0 {
+			cmd.SkipReason = "flow-style images entry"
+		}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images
+}
+
+// kustomizeDigestEditor sets the digest field of a Kustomization images entry,
+// removing it for tag-only pins
+func kustomizeDigestEditor(entry *yaml.Node) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		digest := cmd.Image.Digest
+		if cmd.Annotations != nil && cmd.Annotations.Pin == pinTagOnly {
+			digest = ""
+		}
+		return setYAMLField(lines, entry, "digest", digest)
+	}
+}
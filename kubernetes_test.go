@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractKubernetesImages(t *testing.T) {
+	disableLogging()
+
+	content := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: example/migrate:1.0
+      containers:
+        - name: web
+          image: nginx:1.25
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: report
+              # containerfile-updater: ignore
+              image: example/report:nightly
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  image: not-a-container
+`
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	du := NewContainerfileUpdater(path)
+	if du.format != formatKubernetes {
+		t.Fatalf("Expected kubernetes format, got %s", du.format)
+	}
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+
+	want := []struct {
+		original string
+		line     int
+		skip     string
+	}{
+		{"example/migrate:1.0", 10, ""},
+		{"nginx:1.25", 13, ""},
+		{"example/report:nightly", 27, "ignored by annotation"},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Expected %d images, got %d", len(want), len(images))
+	}
+	for i, w := range want {
+		if images[i].Image.Original != w.original || images[i].LineStart != w.line || images[i].SkipReason != w.skip {
+			t.Errorf("Image %d: expected %s at line %d (skip %q), got %s at line %d (skip %q)",
+				i, w.original, w.line, w.skip, images[i].Image.Original, images[i].LineStart, images[i].SkipReason)
+		}
+	}
+}
+
+func TestUpdateKubernetesManifests(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	web := pushRandomImage(t, server, host+"/web:1.0")
+	api := pushRandomImage(t, server, host+"/api:2.0")
+	worker := pushRandomImage(t, server, host+"/worker:3.0")
+
+	dir := t.TempDir()
+	manifest := `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  containers:
+    - name: web
+      image: "` + host + `/web:1.0" # pinned by CI
+`
+	manifestPath := filepath.Join(dir, "pod.yaml")
+	if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	kustomization := `resources:
+  - pod.yaml
+images:
+  - name: api
+    newName: ` + host + `/api
+    newTag: "2.0"
+  - name: worker
+    newName: ` + host + `/worker
+    newTag: "3.0"
+    digest: sha256:` + strings.Repeat("0", 64) + `
+namePrefix: prod-
+`
+	kustomizationPath := filepath.Join(dir, "kustomization.yaml")
+	if err := os.WriteFile(kustomizationPath, []byte(kustomization), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+
+	for _, path := range []string{manifestPath, kustomizationPath} {
+		du := NewContainerfileUpdaterWithConfig(path, cfg)
+		if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("UpdateContainerfileWithLatestDigests(%s) failed: %v", path, err)
+		}
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	expected := strings.Replace(manifest, host+"/web:1.0", host+"/web@"+web.String(), 1)
+	if string(data) != expected {
+		t.Errorf("Unexpected manifest:\n%s\nexpected:\n%s", string(data), expected)
+	}
+
+	data, err = os.ReadFile(kustomizationPath)
+	if err != nil {
+		t.Fatalf("Failed to read kustomization: %v", err)
+	}
+	expected = `resources:
+  - pod.yaml
+images:
+  - name: api
+    newName: ` + host + `/api
+    newTag: "2.0"
+    digest: ` + api.String() + `
+  - name: worker
+    newName: ` + host + `/worker
+    newTag: "3.0"
+    digest: ` + worker.String() + `
+namePrefix: prod-
+`
+	if string(data) != expected {
+		t.Errorf("Unexpected kustomization:\n%s\nexpected:\n%s", string(data), expected)
+	}
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// levelOff disables a rule in the lint config
+const levelOff = "off"
+
+// LintConfig adjusts the policy rules checked by lint and reported in every run
+type LintConfig struct {
+	Rules map[string]string `yaml:"rules"` // Level per rule id: error, warning, note or off
+}
+
+// validateLintConfig rejects unknown rules and levels
+func validateLintConfig(cfg LintConfig) error {
+	for id, level := range cfg.Rules {
+		if _, ok := lookupRule(id); !ok {
+			return fmt.Errorf("unknown lint rule %q", id)
+		}
+		if !slices.Contains([]string{levelError, levelWarning, levelNote, levelOff}, level) {
+			return fmt.Errorf("invalid level %q for lint rule %s (expected error, warning, note or off)", level, id)
+		}
+	}
+	return nil
+}
+
+// variableReference matches $NAME, ${NAME} and ${NAME:-default} in a FROM image
+var variableReference = regexp.MustCompile(`\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)(:?[-+][^}]*)?\})`)
+
+// containerfileFindings checks the rules about a Containerfile's structure rather than a
+// single image: stage aliases shadowing images and FROM build arguments without a default
+func (du *ContainerfileUpdater) containerfileFindings(ast *parser.Node, commands []*FromCommand) []Finding {
+	var findings []Finding
+
+	for _, stage := range du.graph.Stages {
+		if stage.Name == "" {
+			continue
+		}
+		for _, cmd := range commands {
+			if isBaseImage(cmd) && cmd.Image.Registry == "docker.io" && strings.EqualFold(cmd.Image.Repository, "library/"+stage.Name) {
+				findings = append(findings, newLineFinding(ruleStageShadowsImage, stage.Line, stage.Name,
+					"Stage %s shadows the image %s: a later FROM %s builds on the stage, not the image", stage.Name, cmd.Image.Original, stage.Name))
+				break
+			}
+		}
+	}
+
+	declared := make(map[string]bool)
+	defaults := make(map[string]bool)
+	for _, node := range globalArgs(ast) {
+		for next := node.Next; next != nil; next = next.Next {
+			name, _, _ := strings.Cut(next.Value, "=")
+			declared[name] = true
+		}
+		for _, definition := range argDefinitions(node) {
+			defaults[definition.name] = definition.value != ""
+		}
+	}
+	for _, node := range ast.Children {
+		if !strings.EqualFold(node.Value, "from") || node.Next == nil {
+			continue
+		}
+		for _, match := range variableReference.FindAllStringSubmatch(node.Next.Value, -1) {
+			name, inline := match[1]+match[2], match[3]
+			if defaults[name] || strings.HasPrefix(inline, ":-") || strings.HasPrefix(inline, "-") {
+				continue
+			}
+			message := "FROM uses build argument %s, which has no default"
+			if !declared[name] {
+				message = "FROM uses build argument %s, which isn't declared before the first FROM"
+			}
+			findings = append(findings, newLineFinding(ruleArgWithoutDefault, node.StartLine, node.Next.Value, message, name))
+		}
+	}
+	return findings
+}
+
+// Lint extracts the images of the updater's file without contacting registries and checks
+// them against the policy rules
+func (du *ContainerfileUpdater) Lint() ([]Finding, error) {
+	commands, err := du.extractImages()
+	if err != nil {
+		return nil, err
+	}
+	du.fromCommands = commands
+	return du.Findings(), nil
+}
+
+// FileFindings are the findings of one file
+type FileFindings struct {
+	File     string    `json:"file"`
+	Findings []Finding `json:"findings"`
+}
+
+// writeFindings prints findings one per line, in the file:line: level: message form
+// editors and CI logs link to
+func writeFindings(w io.Writer, files []FileFindings) {
+	for _, file := range files {
+		for _, finding := range file.Findings {
+			fmt.Fprintf(w, "%s:%d: %s: %s [%s]\n", file.File, finding.Line, finding.Level, finding.Message, finding.Rule)
+		}
+	}
+}
+
+// runLint implements the lint subcommand
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	output := fs.String("output", outputText, "Output format (text, json, sarif)")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also check the frontend image of # syntax= directives")
+	scanRun := fs.Bool("scan-run", false, "Also check images pulled inside RUN instructions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s lint [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Check the images of every file against the policy rules without contacting any registry.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = no errors, 1 = findings at the error level, 2 = files could not be read")
+		fmt.Fprintln(fs.Output(), "\nRules:")
+		for _, rule := range findingRules {
+			fmt.Fprintf(fs.Output(), "  %-22s %-8s %s\n", rule.id, rule.level, rule.description)
+		}
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("warn"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if err := validateOutputFormat(*output, outputSARIF); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to lint", "error", err)
+		return exitError
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+
+	exitCode := exitOK
+	files := []FileFindings{}
+	for _, path := range paths {
+		fileFormat, err := resolveFormat(*format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		linter := NewContainerfileUpdaterWithConfig(path, cfg)
+		linter.format = fileFormat
+		linter.pinSyntax = *pinSyntax
+		findings, err := linter.Lint()
+		if err != nil {
+			slog.Error("Failed to extract images", "path", path, "error", err)
+			exitCode = exitError
+			continue
+		}
+		if slices.ContainsFunc(findings, func(f Finding) bool { return f.Level == levelError }) {
+			exitCode = max(exitCode, exitUpdatesNeeded)
+		}
+		files = append(files, FileFindings{File: displayPath(path), Findings: findings})
+	}
+
+	switch *output {
+	case outputJSON:
+		err = writeJSONReport(os.Stdout, files)
+	case outputSARIF:
+		err = writeSARIF(os.Stdout, files)
+	default:
+		writeFindings(os.Stdout, files)
+	}
+	if err != nil {
+		slog.Error("Failed to write findings", "error", err)
+		return exitError
+	}
+	return exitCode
+}
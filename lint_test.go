@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	content := "ARG BASE\n" +
+		"ARG TOOLS=ghcr.io/example/tools:1@sha256:9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e41d07f3b9c2e\n" +
+		"FROM golang:1.24 AS golang\n" +
+		"FROM alpine\n" +
+		"FROM ${BASE}\n" +
+		"FROM ${TOOLS}\n" +
+		"FROM ${RUNTIME:-debian:12}\n" +
+		"FROM $UNDECLARED\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	linter := NewContainerfileUpdaterWithConfig(path, cfg)
+	findings, err := linter.Lint()
+	if err != nil {
+		t.Fatalf("Lint() failed: %v", err)
+	}
+
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.Rule+"@"+finding.Level)
+	}
+	expected := []string{
+		"stage-shadows-image@warning",
+		"unpinned-image@warning",
+		"unpinned-image@warning",
+		"latest-tag@warning",
+		"arg-without-default@error",
+		"arg-without-default@error",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("Findings = %v, want %v", got, expected)
+	}
+	if findings[5].Line != 8 || !strings.Contains(findings[5].Message, "isn't declared") {
+		t.Errorf("Unexpected finding for an undeclared argument: %+v", findings[5])
+	}
+
+	// Levels come from the config, and rules can be turned off
+	cfg.Lint.Rules = map[string]string{ruleLatestTag: levelError, ruleUnpinnedImage: levelOff}
+	linter = NewContainerfileUpdaterWithConfig(path, cfg)
+	if findings, err = linter.Lint(); err != nil {
+		t.Fatalf("Lint() failed: %v", err)
+	}
+	var out bytes.Buffer
+	writeFindings(&out, []FileFindings{{File: "Containerfile", Findings: findings}})
+	if !strings.Contains(out.String(), "Containerfile:4: error: alpine uses the latest tag") || strings.Contains(out.String(), ruleUnpinnedImage) {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+func TestValidateLintConfig(t *testing.T) {
+	tests := []struct {
+		rules   map[string]string
+		wantErr bool
+	}{
+		{rules: map[string]string{ruleLatestTag: levelError, ruleStageShadowsImage: levelOff}},
+		{rules: map[string]string{"no-such-rule": levelError}, wantErr: true},
+		{rules: map[string]string{ruleLatestTag: "fatal"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateLintConfig(LintConfig{Rules: tt.rules}); (err != nil) != tt.wantErr {
+			t.Errorf("validateLintConfig(%v) error = %v, wantErr %v", tt.rules, err, tt.wantErr)
+		}
+	}
+}
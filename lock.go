@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFileVersion is the format version written to lock files
+const lockFileVersion = 1
+
+// defaultLockFile is the conventional lock file name
+const defaultLockFile = "containerfile-updater.lock"
+
+// LockFile records the digest pinned for every image of every file, so later runs can diff
+// against it, --frozen runs can verify files without network access, and other tools can
+// consume it for provenance
+type LockFile struct {
+	Version int                      `json:"version"`
+	Files   map[string][]LockedImage `json:"files"` // Keyed by path relative to the lock file, with forward slashes
+
+	path string
+}
+
+// LockedImage is the resolution of one image reference
+type LockedImage struct {
+	Image      string    `json:"image"` // registry/repository as written by the updater
+	Tag        string    `json:"tag"`   // Tag that was resolved (the tracking tag if any)
+	Digest     string    `json:"digest"`
+	Registry   string    `json:"registry"`
+	ResolvedAt time.Time `json:"resolvedAt"` // When the digest was first pinned
+}
+
+// LoadLockFile reads a lock file, returning an empty one if it doesn't exist yet
+func LoadLockFile(path string) (*LockFile, error) {
+	lock := &LockFile{Version: lockFileVersion, Files: make(map[string][]LockedImage), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file %s: %w", path, err)
+	}
+	if lock.Version != lockFileVersion {
+		return nil, fmt.Errorf("unsupported lock file version %d in %s", lock.Version, path)
+	}
+	if lock.Files == nil {
+		lock.Files = make(map[string][]LockedImage)
+	}
+	return lock, nil
+}
+
+// key returns the entry name of a file: its path relative to the lock file
+func (l *LockFile) key(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	base, err := filepath.Abs(filepath.Dir(l.path))
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	if rel, err := filepath.Rel(base, abs); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(abs)
+}
+
+// find returns the locked entry for an image of a file, or nil
+func (l *LockFile) find(path string, image *ImageReference) *LockedImage {
+	if l == nil {
+		return nil
+	}
+	entries := l.Files[l.key(path)]
+	for i := range entries {
+		if entries[i].Image == image.Name() && entries[i].Tag == image.Tag {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// record replaces a file's entries with the digests of the processed images, logging every
+// image whose digest moved since the lock was written. Images whose lookup failed keep
+// their previous entry, and the resolution time only changes along with the digest.
+func (l *LockFile) record(path string, commands []*FromCommand, now time.Time) {
+	if l == nil || path == stdinPath {
+		return
+	}
+
+	var entries []LockedImage
+	seen := make(map[string]bool)
+	for _, cmd := range commands {
+		if cmd.SkipReason != "" || seen[cmd.Image.TaggedName()] {
+			continue
+		}
+		seen[cmd.Image.TaggedName()] = true
+
+		locked := l.find(path, cmd.Image)
+		if cmd.Image.Digest == "" {
+			if locked != nil {
+				entries = append(entries, *locked)
+			}
+			continue
+		}
+
+		entry := LockedImage{
+			Image:      cmd.Image.Name(),
+			Tag:        cmd.Image.Tag,
+			Digest:     cmd.Image.Digest,
+			Registry:   cmd.Image.Registry,
+			ResolvedAt: now.UTC().Truncate(time.Second),
+		}
+		if locked != nil && locked.Digest == entry.Digest {
+			entry.ResolvedAt = locked.ResolvedAt
+		} else if locked != nil {
+			slog.Info("Digest changed since lock file", "path", path, "image", cmd.Image.TaggedName(), "locked", locked.Digest, "digest", entry.Digest)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		delete(l.Files, l.key(path))
+		return
+	}
+	l.Files[l.key(path)] = entries
+}
+
+// recordChanges sets the entries of updated images, leaving those of every other image as
+// they are, for change requests carrying only some of a run's changes
+func (l *LockFile) recordChanges(changed []*FromCommand, now time.Time) {
+	for _, cmd := range changed {
+		if cmd.Path == stdinPath || cmd.Image.Digest == "" {
+			continue
+		}
+		entry := LockedImage{
+			Image:      cmd.Image.Name(),
+			Tag:        cmd.Image.Tag,
+			Digest:     cmd.Image.Digest,
+			Registry:   cmd.Image.Registry,
+			ResolvedAt: now.UTC().Truncate(time.Second),
+		}
+		if locked := l.find(cmd.Path, cmd.Image); locked != nil {
+			if locked.Digest != entry.Digest {
+				*locked = entry
+			}
+			continue
+		}
+		key := l.key(cmd.Path)
+		l.Files[key] = append(l.Files[key], entry)
+	}
+}
+
+// saveLock writes a lock file and, when signing is configured, its signature. It returns
+// the absolute paths of both for committing them, and whether either changed.
+func (r *updateRun) saveLock(lock *LockFile) ([]string, bool, error) {
+	if err := r.confine.checkOutput(lock.path); err != nil {
+		return nil, false, fmt.Errorf("refusing to write: %w", err)
+	}
+	changed, err := lock.Save()
+	if err != nil {
+		return nil, false, err
+	}
+	paths := []string{lock.path}
+	if signing := r.cfg.Signing; signing.Signer != "" {
+		// A changed lock file needs a new signature, and an unsigned one its first
+		signature := signing.signaturePath(lock.path)
+		if _, err := os.Stat(signature); changed || err != nil {
+			if _, err := r.signOutput(lock.path); err != nil {
+				return nil, false, fmt.Errorf("failed to sign lock file: %w", err)
+			}
+			changed = true
+		}
+		paths = append(paths, signature)
+	}
+	for i, path := range paths {
+		if abs, err := filepath.Abs(path); err == nil {
+			paths[i] = abs
+		}
+	}
+	return paths, changed, nil
+}
+
+// Save writes the lock file, reporting whether its content changed
+func (l *LockFile) Save() (bool, error) {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	data = append(data, '\n')
+
+	if current, err := os.ReadFile(l.path); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	if err := writeFileAtomic(l.path, data); err != nil {
+		return false, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return true, nil
+}
+
+// verifyLock checks every file against the lock file without contacting any registry: each
+// processed image must be locked, and pinned images must carry the locked digest
+func (r *updateRun) verifyLock(lock *LockFile) int {
+	exitCode := exitOK
+	for _, path := range r.paths {
+		format, err := resolveFormat(r.format, path, r.cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+		updater := NewContainerfileUpdaterWithConfig(path, r.cfg)
+		updater.format = format
+		updater.pinSyntax = r.pinSyntax
+		commands, err := updater.extractImages()
+		if err != nil {
+			slog.Error("Failed to read file", "path", path, "error", err)
+			exitCode = exitError
+			continue
+		}
+
+		for _, cmd := range commands {
+			if cmd.SkipReason != "" {
+				continue
+			}
+
+			locked := lock.find(path, cmd.Image)
+			var problem string
+			switch {
+			case locked == nil:
+				problem = "not in lock file"
+			case cmd.Annotations != nil && cmd.Annotations.Pin == pinTagOnly:
+				// Tag-only references carry no digest to compare
+			case cmd.Image.Digest == "":
+				problem = "not pinned to the locked digest " + locked.Digest
+			case cmd.Image.Digest != locked.Digest:
+				problem = "pinned digest differs from the locked digest " + locked.Digest
+			}
+			if problem != "" {
+				slog.Warn("Image does not match lock file", "path", path, "line", cmd.LineStart, "image", cmd.Image.Original, "problem", problem)
+				exitCode = max(exitCode, exitUpdatesNeeded)
+			}
+		}
+	}
+
+	if exitCode == exitOK {
+		slog.Info("All images match the lock file", "lock_file", lock.path)
+	}
+	return exitCode
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/app:1.0")
+
+	dir := t.TempDir()
+	containerfile := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(containerfile, []byte("# containerfile-updater: pin=tag-digest\nFROM "+host+"/app:1.0\nFROM scratch\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	lockPath := filepath.Join(dir, defaultLockFile)
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	run := &updateRun{paths: []string{containerfile}, cfg: cfg, format: formatAuto, output: outputText,
+		lockFile: lockPath, backup: BackupPolicy{Disabled: true}, out: &bytes.Buffer{}}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	lock, err := LoadLockFile(lockPath)
+	if err != nil {
+		t.Fatalf("LoadLockFile failed: %v", err)
+	}
+	entries := lock.Files["Containerfile"]
+	if len(entries) != 1 {
+		t.Fatalf("Expected one locked image, got %+v", lock.Files)
+	}
+	entry := entries[0]
+	if entry.Image != host+"/app" || entry.Tag != "1.0" || entry.Digest != app.String() || entry.Registry != host || entry.ResolvedAt.IsZero() {
+		t.Errorf("Unexpected lock entry %+v", entry)
+	}
+
+	// A second run with the same digest leaves the lock file alone
+	before, _ := os.ReadFile(lockPath)
+	if exitCode := run.run(); exitCode != exitOK {
+		t.Fatalf("Expected exit code %d, got %d", exitOK, exitCode)
+	}
+	if after, _ := os.ReadFile(lockPath); !bytes.Equal(before, after) {
+		t.Errorf("Expected an unchanged lock file, got:\n%s", after)
+	}
+
+	// Frozen runs verify without the registry
+	server.Close()
+	run.frozen = true
+	if exitCode := run.run(); exitCode != exitOK {
+		t.Errorf("Expected frozen exit code %d, got %d", exitOK, exitCode)
+	}
+
+	drifted := "FROM " + host + "/app:1.0@" + app.String()[:len(app.String())-4] + "0000\n"
+	if err := os.WriteFile(containerfile, []byte(drifted), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected frozen exit code %d for a drifted digest, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	if err := os.WriteFile(containerfile, []byte("FROM "+host+"/other:1.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Errorf("Expected frozen exit code %d for an unlocked image, got %d", exitUpdatesNeeded, exitCode)
+	}
+}
+
+func TestLoadLockFileRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultLockFile)
+	if err := os.WriteFile(path, []byte(`{"version": 2, "files": {}}`), 0644); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+	if _, err := LoadLockFile(path); err == nil {
+		t.Error("Expected error for an unknown lock file version")
+	}
+
+	lock, err := LoadLockFile(filepath.Join(t.TempDir(), defaultLockFile))
+	if err != nil || len(lock.Files) != 0 {
+		t.Errorf("Expected an empty lock for a missing file, got %+v, %v", lock, err)
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Log output formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// loggingFlags holds the log level and format flags shared by every command
+type loggingFlags struct {
+	level   *string
+	format  *string
+	quiet   *bool
+	verbose *bool
+}
+
+// addLoggingFlags registers the logging flags on a flag set
+func addLoggingFlags(fs *flag.FlagSet) *loggingFlags {
+	return &loggingFlags{
+		level:   fs.String("log-level", "", "Minimum log level: debug, info, warn, error (default info, warn while a progress bar is shown)"),
+		format:  fs.String("log-format", logFormatText, "Log format written to stderr (text, json)"),
+		quiet:   fs.Bool("quiet", false, "Only log errors (shorthand for --log-level error)"),
+		verbose: fs.Bool("verbose", false, "Log every registry request (shorthand for --log-level debug)"),
+	}
+}
+
+// configure installs the logger selected by the flags as the default, using defaultLevel
+// when no level was requested
+func (lf *loggingFlags) configure(defaultLevel string) error {
+	level := firstNonEmpty(*lf.level, defaultLevel)
+	switch {
+	case *lf.quiet && *lf.verbose:
+		return errors.New("--quiet and --verbose are mutually exclusive")
+	case *lf.quiet:
+		level = "error"
+	case *lf.verbose:
+		level = "debug"
+	}
+
+	logger, err := newLogger(os.Stderr, level, *lf.format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// parseLogLevel parses a level name as accepted by --log-level
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", level)
+}
+
+// newLogger creates a logger writing the given format at or above the given level
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	minLevel, err := parseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: minLevel}
+	switch strings.ToLower(format) {
+	case logFormatText, "":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (expected %s or %s)", format, logFormatText, logFormatJSON)
+}
+
+// loggingTransport logs every registry request at debug level
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip forwards the request and logs its outcome and duration
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		slog.Debug("Registry request failed", "method", req.Method, "url", req.URL.Redacted(), "duration", time.Since(start), "error", err)
+		return resp, err
+	}
+	slog.Debug("Registry request", "method", req.Method, "url", req.URL.Redacted(), "status", resp.StatusCode, "duration", time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("newLogger failed: %v", err)
+	}
+
+	logger.Info("Found latest digest", "image", "alpine:3.20")
+	logger.Warn("Failed to fetch digest", "image", "ghcr.io/example/app:1.0", "error", "unauthorized")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected only the warning to be logged, got %d lines:\n%s", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Failed to decode log record: %v", err)
+	}
+	if record["level"] != "WARN" || record["msg"] != "Failed to fetch digest" || record["image"] != "ghcr.io/example/app:1.0" {
+		t.Errorf("Unexpected log record: %v", record)
+	}
+}
+
+func TestNewLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "DEBUG", "")
+	if err != nil {
+		t.Fatalf("newLogger failed: %v", err)
+	}
+
+	logger.Debug("Fetching latest digest", "registry", "docker.io")
+	if !strings.Contains(buf.String(), `level=DEBUG msg="Fetching latest digest" registry=docker.io`) {
+		t.Errorf("Unexpected text output: %s", buf.String())
+	}
+}
+
+func TestNewLoggerInvalid(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+	if _, err := newLogger(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
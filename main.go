@@ -2,16 +2,22 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	// BuildKit dockerfile parser
 	"github.com/moby/buildkit/frontend/dockerfile/parser"
@@ -22,11 +28,59 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
+// Exit codes reported to CI pipelines
+const (
+	exitOK            = 0 // No changes needed
+	exitUpdatesNeeded = 1 // Updates were applied, or are available in --check mode
+	exitError         = 2 // Digests could not be resolved or the run failed
+)
+
 // ContainerfileUpdater handles parsing and updating Containerfiles with latest digests
 type ContainerfileUpdater struct {
 	containerfilePath string
-	timeout        time.Duration
+	timeout        time.Duration   // Time allowed per image lookup on registries without their own timeout
+	deadline       time.Time       // When the whole run must be done (zero for no deadline)
 	buildStages    map[string]bool // Track build stage aliases
+	checkOnly      bool            // Report pending updates without writing the Containerfile
+	strict         bool            // Leave the file unchanged when any digest fails to resolve
+	validate       bool            // Check that a rewritten Containerfile still converts for a build before saving it
+	platform       string          // Platform whose manifests the file's images are pinned to (empty pins indexes)
+	checkConsumers bool            // Verify build argument defaults against their base files
+	fromCommands   []*FromCommand  // FROM commands processed during the last run
+	config         *Config         // Settings loaded from the config file
+	keychain       authn.Keychain  // Credentials used for registry requests
+	transports     *registryTransports // HTTP transports per registry host
+	imageFilter    *ImageFilter    // Allow/deny patterns from the config file
+	selection      *imageSelection // Images and stages selected with --only and --stage (nil for all)
+	baseArgs       map[string]*BaseArg // Image build arguments defined in base files
+	ignoredImages  []*regexp.Regexp // Image patterns from .containerfileupdaterignore files
+	tracker        *tagTracker     // Tracking tags from the config file
+	catalog        *baseImageCatalog // Approved base images from the config file (nil for no catalog)
+	rewriter       *registryRewriter // Registry rewrite rules from the config file
+	formats        *referenceFormats // Reference templates from the config file (nil for the built-in forms)
+	runScanner     *runImageScanner // Finds images in RUN instructions (nil unless enabled)
+	cooldown       *cooldownPolicy // Minimum release ages and schedules from the config file
+	graph          *StageGraph     // Build stages of the last Containerfile parsed (nil for other formats)
+	fileFindings   []Finding       // Policy findings about the last Containerfile parsed rather than one image
+	escapeToken    rune            // Escape and line continuation character of the last Containerfile parsed
+	targets        []RegistryEvent // When set, only images pushed by these events are updated
+	metrics        *Metrics        // Prometheus metrics in watch and webhook mode (nil otherwise)
+	audit          *AuditLog       // Records every registry interaction (nil for none)
+	progress       *Progress       // Progress bar advanced per image (nil when not shown)
+	format         string          // File format being updated (one of the format constants)
+	backup         BackupPolicy    // Where to keep a copy of the file before rewriting it
+	pathPolicy     PathPolicy      // Which files may be rewritten
+	input          []byte          // Content to update instead of reading the file (nil reads it)
+	output         io.Writer       // Receives the updated content instead of rewriting the file
+	digests        DigestSource    // Resolve digests from this source instead of registries (offline mode)
+	resolver       *digestResolver // Digests shared with the other files of the run (nil to resolve alone)
+	pinSyntax      bool            // Also pin the frontend image of a "# syntax=" directive
+	annotate       bool            // Maintain "# tag=… resolved=…" comments above pinned FROM instructions
+	releaseNotes   bool            // Look up release notes for every updated image, not only tag changes
+	referrers      bool            // List the SBOMs, signatures and attestations attached to every updated digest
+	inspectTags    bool            // List the repository tags of inspected images
+	headless       map[string]bool // Registries whose HEAD responses lack the digest, queried with GET instead
+	anonymous      map[string]bool // Registries that rejected the credentials but allow anonymous pulls
 }
 
 // ImageReference represents a parsed image reference from a FROM command
@@ -38,37 +92,120 @@ type ImageReference struct {
 	Original   string // Original reference string
 }
 
+// Name returns the registry/repository form, using the Docker Hub shorthand where possible
+func (ir *ImageReference) Name() string {
+	if ir.Registry == "docker.io" {
+		return ir.Repository
+	}
+	return ir.Registry + "/" + ir.Repository
+}
+
+// TaggedName returns the registry/repository:tag form used to query the registry
+func (ir *ImageReference) TaggedName() string {
+	return fmt.Sprintf("%s:%s", ir.Name(), ir.Tag)
+}
+
+// PinnedName returns the registry/repository@digest form of a pinned reference
+func (ir *ImageReference) PinnedName() string {
+	return fmt.Sprintf("%s@%s", ir.Name(), ir.Digest)
+}
+
+// ExplicitTag reports whether the original reference names a tag rather than defaulting to latest
+func (ir *ImageReference) ExplicitTag() bool {
+	base, _, _ := strings.Cut(ir.Original, "@")
+	return strings.Contains(base[strings.LastIndex(base, "/")+1:], ":")
+}
+
 // NewContainerfileUpdater creates a new ContainerfileUpdater instance
 func NewContainerfileUpdater(containerfilePath string) *ContainerfileUpdater {
+	return NewContainerfileUpdaterWithConfig(containerfilePath, NewConfig())
+}
+
+// NewContainerfileUpdaterWithConfig creates a ContainerfileUpdater using the given configuration
+func NewContainerfileUpdaterWithConfig(containerfilePath string, cfg *Config) *ContainerfileUpdater {
+	// Patterns are validated when the config file is loaded
+	imageFilter, err := NewImageFilter(cfg.Images)
+	if err != nil {
+		slog.Warn("Ignoring invalid image filter", "error", err)
+	}
+	tracker, err := newTagTracker(cfg.Tracking)
+	if err != nil {
+		slog.Warn("Ignoring invalid tracking rules", "error", err)
+	}
+	rewriter, err := newRegistryRewriter(cfg.Rewrites)
+	if err != nil {
+		slog.Warn("Ignoring invalid rewrite rules", "error", err)
+	}
+	cooldown, err := newCooldownPolicy(cfg.Cooldown)
+	if err != nil {
+		slog.Warn("Ignoring invalid cooldown rules", "error", err)
+	}
+	catalog, err := newBaseImageCatalog(cfg.Catalog)
+	if err != nil {
+		slog.Warn("Ignoring invalid catalog", "error", err)
+	}
+	baseArgs, err := loadBaseArgs(cfg.BaseFiles)
+	if err != nil {
+		slog.Warn("Ignoring unreadable base files", "error", err)
+	}
+	ignoredImages, err := ignoredImagePatterns(containerfilePath)
+	if err != nil {
+		slog.Warn("Ignoring unreadable ignore file", "error", err)
+	}
+	formats, err := newReferenceFormats(cfg)
+	if err != nil {
+		slog.Warn("Ignoring invalid reference formats", "error", err)
+	}
+	var runScanner *runImageScanner
+	if cfg.RunImages.Enabled {
+		if runScanner, err = newRunImageScanner(cfg.RunImages); err != nil {
+			slog.Warn("Ignoring invalid RUN image patterns", "error", err)
+		}
+	}
+
 	return &ContainerfileUpdater{
 		containerfilePath: containerfilePath,
-		timeout:        30 * time.Second,
+		timeout:        cmp.Or(cfg.Timeout, defaultTimeout),
 		buildStages:    make(map[string]bool),
+		headless:       make(map[string]bool),
+		anonymous:      make(map[string]bool),
+		config:         cfg,
+		keychain:       NewKeychain(cfg),
+		transports:     newRegistryTransports(cfg),
+		imageFilter:    imageFilter,
+		baseArgs:       baseArgs,
+		ignoredImages:  ignoredImages,
+		tracker:        tracker,
+		catalog:        catalog,
+		rewriter:       rewriter,
+		formats:        formats,
+		runScanner:     runScanner,
+		cooldown:       cooldown,
+		format:         detectFileFormat(containerfilePath, cfg),
+		platform:       filePlatform(containerfilePath, cfg),
 	}
 }
 
 // UpdateContainerfileWithLatestDigests is the main entry point
 func (du *ContainerfileUpdater) UpdateContainerfileWithLatestDigests() error {
-	log.Printf("Processing Containerfile: %s", du.containerfilePath)
+	slog.Info("Processing file", "path", du.containerfilePath, "format", du.format)
 
-	// Step 1: Parse Containerfile using BuildKit parser
-	result, err := du.parseContainerfile()
+	// Step 1 and 2: Parse the file and extract its image references
+	fromCommands, err := du.extractImages()
 	if err != nil {
-		return fmt.Errorf("failed to parse Containerfile: %w", err)
+		return err
 	}
 
-	// Step 2: Extract FROM commands from AST
-	fromCommands, err := du.extractFromCommands(result.AST)
-	if err != nil {
-		return fmt.Errorf("failed to extract FROM commands: %w", err)
+	for _, cmd := range fromCommands {
+		cmd.Path = du.containerfilePath
 	}
-
+	du.fromCommands = fromCommands
 	if len(fromCommands) == 0 {
-		log.Println("No FROM commands found in Containerfile")
+		slog.Info("No images found", "path", du.containerfilePath)
 		return nil
 	}
 
-	log.Printf("Found %d FROM command(s)", len(fromCommands))
+	slog.Info("Found image references", "count", len(fromCommands))
 
 	// Step 3: Update FROM commands with latest digests
 	updatedCommands, err := du.updateFromCommandsWithDigests(fromCommands)
@@ -76,44 +213,238 @@ func (du *ContainerfileUpdater) UpdateContainerfileWithLatestDigests() error {
 		return fmt.Errorf("failed to update FROM commands with digests: %w", err)
 	}
 
+	// A partially pinned file could ship unnoticed, so strict mode writes all or nothing
+	if du.strict && !du.checkOnly && du.failedCount() > 0 {
+		return fmt.Errorf("%d of %d images could not be resolved, leaving the file unchanged (--strict)", du.failedCount(), len(fromCommands))
+	}
+
 	// Step 4: Reconstruct and write updated Containerfile
-	err = du.reconstructAndWriteContainerfile(result, updatedCommands)
+	err = du.reconstructAndWriteContainerfile(updatedCommands)
 	if err != nil {
 		return fmt.Errorf("failed to write updated Containerfile: %w", err)
 	}
 
-	log.Printf("Successfully updated Containerfile: %s", du.containerfilePath)
+	du.collectReleaseInfo()
+	du.collectReferrers()
+	du.logSkipped()
+	du.logHeld()
+	du.logViolations()
+
+	if du.checkOnly {
+		slog.Info("Checked file", "path", du.containerfilePath, "updates", du.changedCount())
+		return nil
+	}
+
+	du.metrics.observeUpdates(du.changedCount())
+	if du.changedCount() > 0 {
+		slog.Info("Successfully updated file", "path", du.containerfilePath)
+	}
 	return nil
 }
 
-// parseContainerfile uses BuildKit parser to parse the Containerfile into AST
-func (du *ContainerfileUpdater) parseContainerfile() (*parser.Result, error) {
-	file, err := os.Open(du.containerfilePath)
+// changedCount returns the number of FROM commands whose reference changed
+func (du *ContainerfileUpdater) changedCount() int {
+	return len(du.ChangedCommands())
+}
+
+// ChangedCommands returns the FROM commands whose reference changed in the last run
+func (du *ContainerfileUpdater) ChangedCommands() []*FromCommand {
+	var changed []*FromCommand
+	for _, cmd := range du.fromCommands {
+		if cmd.Changed {
+			changed = append(changed, cmd)
+		}
+	}
+	return changed
+}
+
+// failedCount returns the number of FROM commands whose digest could not be resolved
+func (du *ContainerfileUpdater) failedCount() int {
+	count := 0
+	for _, cmd := range du.fromCommands {
+		if cmd.Err != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// logSkipped summarizes the images that were left untouched
+func (du *ContainerfileUpdater) logSkipped() {
+	if du.skippedCount() == 0 {
+		return
+	}
+
+	slog.Info("Skipped images", "count", du.skippedCount())
+	for _, cmd := range du.fromCommands {
+		if cmd.SkipReason != "" {
+			slog.Info("Skipped image", "line", cmd.LineStart, "image", cmd.Image.Original, "reason", cmd.SkipReason)
+		}
+	}
+}
+
+// logHeld summarizes the updates that were available but not applied
+func (du *ContainerfileUpdater) logHeld() {
+	var held []*FromCommand
+	for _, cmd := range du.fromCommands {
+		if cmd.HeldReason != "" {
+			held = append(held, cmd)
+		}
+	}
+	if len(held) == 0 {
+		return
+	}
+
+	slog.Warn("Held back updates", "count", len(held))
+	for _, cmd := range held {
+		slog.Warn("Held back update", "line", cmd.LineStart, "image", cmd.Image.Original, "reason", cmd.HeldReason)
+	}
+}
+
+// skippedCount returns the number of FROM commands that were left untouched
+func (du *ContainerfileUpdater) skippedCount() int {
+	count := 0
+	for _, cmd := range du.fromCommands {
+		if cmd.SkipReason != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// ExitCode maps the outcome of the last run onto the CI exit code contract: any
+// resolution failure or base image outside the catalog is an error, since the result
+// can't be trusted, and otherwise pending or applied updates exit 1 so CI notices them.
+func (du *ContainerfileUpdater) ExitCode() int {
+	if du.violationCount() > 0 || du.failedCount() > 0 {
+		return exitError
+	}
+	if du.changedCount() > 0 {
+		return exitUpdatesNeeded
+	}
+	return exitOK
+}
+
+// extractImages parses the file according to its format and returns the image references found
+func (du *ContainerfileUpdater) extractImages() ([]*FromCommand, error) {
+	format, err := du.fileUpdater()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open Containerfile: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	var parsed any
+	data, err := du.readContent()
+	if err == nil {
+		parsed, err = format.Parse(du.containerfilePath, data)
+	}
+	if err != nil {
+		if du.format == formatContainerfile {
+			return nil, fmt.Errorf("failed to parse Containerfile: %w", err)
+		}
+		return nil, err
+	}
+	return format.ListImages(du, parsed)
+}
 
-	// Parse using BuildKit containerfile parser
-	result, err := parser.Parse(file)
+// fileUpdater returns the format of the file being updated
+func (du *ContainerfileUpdater) fileUpdater() (FileUpdater, error) {
+	format, ok := lookupFileUpdater(du.format)
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", du.format)
+	}
+	return format, nil
+}
+
+// extractContainerfileImages returns the images of a parsed Containerfile: FROM images,
+// build arguments FROM uses and, when enabled, RUN images and the syntax directive
+func (du *ContainerfileUpdater) extractContainerfileImages(result *parser.Result) ([]*FromCommand, error) {
+	du.graph = buildStageGraph(result.AST)
+	du.escapeToken = result.EscapeToken
+
+	// Extract FROM commands from AST
+	fromCommands, err := du.extractFromCommands(result.AST)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Containerfile with BuildKit parser: %w", err)
+		return nil, fmt.Errorf("failed to extract FROM commands: %w", err)
+	}
+
+	argImages, err := du.extractArgImages(result.AST)
+	if err != nil {
+		return nil, err
+	}
+	fromCommands = append(argImages, fromCommands...)
+
+	if du.runScanner != nil {
+		runImages, err := du.extractRunImages(result.AST)
+		if err != nil {
+			return nil, err
+		}
+		fromCommands = append(fromCommands, runImages...)
+	}
+
+	if du.pinSyntax {
+		syntax, err := du.extractSyntaxImage()
+		if err != nil {
+			return nil, err
+		}
+		if syntax != nil {
+			fromCommands = append([]*FromCommand{syntax}, fromCommands...)
+		}
 	}
+	du.fileFindings = du.containerfileFindings(result.AST, fromCommands)
+	return fromCommands, nil
+}
 
-	// Print any parser warnings
-	for _, warning := range result.Warnings {
-		log.Printf("Parser warning: %s", warning.Short)
+// readContent returns the content being updated, read from the file unless it was supplied
+func (du *ContainerfileUpdater) readContent() ([]byte, error) {
+	if du.input != nil {
+		return du.input, nil
+	}
+	data, err := os.ReadFile(du.containerfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", du.containerfilePath, err)
 	}
+	return data, nil
+}
 
-	return result, nil
+// parseContainerfile uses BuildKit parser to parse the Containerfile into AST
+func (du *ContainerfileUpdater) parseContainerfile() (*parser.Result, error) {
+	data, err := du.readContent()
+	if err != nil {
+		return nil, err
+	}
+	return parseContainerfileContent(du.containerfilePath, data)
 }
 
 // FromCommand represents a FROM command found in the AST
 type FromCommand struct {
-	Node      *parser.Node
-	Image     *ImageReference
-	LineStart int
-	LineEnd   int
+	Node           *parser.Node
+	Image          *ImageReference
+	Path           string // File the image was found in
+	LineStart      int
+	LineEnd        int
+	Platform       string // Value of the --platform flag (if any)
+	TrackedTag     string // Tag resolved instead of the written one (empty if not tracking)
+	RewrittenFrom  string // Registry/repository before the written reference was moved to another registry
+	PreviousDigest string // Digest pinned before this run (if any)
+	Err            error  // Error encountered while resolving the digest
+	Changed        bool   // Whether the rewritten reference differs from the original
+	Annotations    *ImageAnnotations // Directives from comments preceding the instruction
+	SkipReason     string // Why the image was left untouched (empty if it was processed)
+	Unpinnable     bool   // Whether the reference can't be pinned as written, e.g. as it uses variables
+	HeldReason     string // Why an available update was not applied (empty if it was)
+	Violation      string // Why the image breaks the base image catalog (empty if it complies)
+	Attestations        []string // Attestation kinds found on the candidate digest
+	MissingAttestations []string // Required attestation kinds the candidate digest lacks
+	MissingPlatforms    []string // Required platforms the candidate digest lacks
+	NewVulnerabilities  []string // Vulnerabilities the candidate digest introduces over the current pin
+	ExpiredPin          string   // Age of the pinned digest when it is past its maximum pin age (empty if it isn't)
+	ProposedTag         string   // Newer tag proposed for a pin past its maximum age (empty if none)
+	PinnedPlatform      string   // Platform whose manifest is pinned instead of the index (empty for the index)
+	Release             *ReleaseInfo // Source and release notes of the new digest (nil if not looked up)
+	Referrers           []Referrer   // Artifacts attached to the new digest (nil if not looked up)
+	Base                *BaseArg   // Base file definition a build argument defers to (nil if none)
+	Arg                 string     // Build argument whose default the image is (empty for other images)
+	formats             *referenceFormats // Reference templates the pin is written with (nil for the built-in forms)
+	editor              lineEditor // Rewrites the file for this image at the position it was parsed from
 }
 
 // extractFromCommands traverses the AST to find all FROM commands
@@ -130,26 +461,50 @@ func (du *ContainerfileUpdater) extractFromCommands(ast *parser.Node) ([]*FromCo
 	// Second pass: process FROM commands, skipping stage references
 	for _, child := range ast.Children {
 		if strings.ToLower(child.Value) == "from" {
-			log.Printf("Found FROM command at line %d-%d: %s", child.StartLine, child.EndLine, child.Original)
+			slog.Debug("Found FROM command", "line", child.StartLine, "end_line", child.EndLine, "instruction", child.Original)
+
+			if child.Next != nil && strings.Contains(child.Next.Value, "$") {
+				// The default of the build argument is updated instead, see extractArgImages
+				slog.Debug("Skipping FROM command built from a build argument", "image", child.Next.Value)
+				continue
+			}
 
 			// Extract image reference from FROM command
 			imageRef, isStageRef, err := du.parseFromCommand(child)
 			if err != nil {
-				log.Printf("Warning: failed to parse FROM command: %v", err)
+				slog.Warn("Failed to parse FROM command", "error", err)
 				continue
 			}
 
 			if isStageRef {
-				log.Printf("Skipping FROM command that references build stage or special image: %s", imageRef.Original)
+				slog.Debug("Skipping FROM command that references build stage or special image", "image", imageRef.Original)
 				continue
 			}
 
-			fromCommands = append(fromCommands, &FromCommand{
-				Node:      child,
-				Image:     imageRef,
-				LineStart: child.StartLine,
-				LineEnd:   child.EndLine,
-			})
+			annotations, err := parseAnnotations(child.PrevComment)
+			if err != nil {
+				slog.Warn("Ignoring invalid annotation comment", "prefix", annotationPrefix, "line", child.StartLine, "error", err)
+				annotations = &ImageAnnotations{}
+			}
+
+			cmd := &FromCommand{
+				Node:        child,
+				Image:       imageRef,
+				LineStart:   child.StartLine,
+				LineEnd:     child.EndLine,
+				Platform:    parseFromFlags(child),
+				Annotations: annotations,
+				editor:      fromReferenceEditor(du.escapeToken),
+			}
+			if tag, ok := resolutionTag(cmd); ok {
+				slog.Debug("Using tag from resolution comment", "line", child.StartLine, "image", imageRef.Original, "tag", tag)
+				cmd.Image.Tag = tag
+			}
+			if du.annotate {
+				cmd.editor = resolutionCommentEditor(cmd.editor, time.Now().UTC().Format(resolutionDateFormat))
+			}
+			du.applySkipRules(cmd)
+			fromCommands = append(fromCommands, cmd)
 		}
 	}
 
@@ -171,13 +526,27 @@ func (du *ContainerfileUpdater) collectBuildStageAlias(node *parser.Node) {
 			if current.Next != nil {
 				alias := current.Next.Value
 				du.buildStages[strings.ToLower(alias)] = true
-				log.Printf("Collected build stage alias: %s", alias)
+				slog.Debug("Collected build stage alias", "alias", alias)
 			}
 			break
 		}
 	}
 }
 
+// parseFromFlags returns the --platform value of a FROM command, ignoring any other flags
+func parseFromFlags(node *parser.Node) string {
+	var platform string
+	for _, flag := range node.Flags {
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		if name == "platform" {
+			platform = value
+			continue
+		}
+		slog.Debug("Ignoring FROM flag", "line", node.StartLine, "flag", flag)
+	}
+	return platform
+}
+
 // parseFromCommand extracts the image reference from a FROM command node
 func (du *ContainerfileUpdater) parseFromCommand(node *parser.Node) (*ImageReference, bool, error) {
 	if node.Next == nil {
@@ -214,7 +583,7 @@ func (du *ContainerfileUpdater) parseFromCommand(node *parser.Node) (*ImageRefer
 			// Found AS clause, get the alias if present
 			if current.Next != nil {
 				asAlias = current.Next.Value
-				log.Printf("Found multi-stage build alias: %s", asAlias)
+				slog.Debug("Found multi-stage build alias", "alias", asAlias)
 			}
 			break
 		}
@@ -324,184 +693,1297 @@ func (du *ContainerfileUpdater) parseImageReference(imageRef string) (*ImageRefe
 
 // updateFromCommandsWithDigests fetches latest digests for each FROM command
 func (du *ContainerfileUpdater) updateFromCommandsWithDigests(fromCommands []*FromCommand) ([]*FromCommand, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), du.timeout)
-	defer cancel()
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
 
 	for _, cmd := range fromCommands {
-		// Always fetch latest digest, even if one already exists
-		log.Printf("Fetching latest digest for %s/%s:%s from %s", cmd.Image.Registry, cmd.Image.Repository, cmd.Image.Tag, cmd.Image.Registry)
+		du.progress.ImageDone()
+		if cmd.SkipReason != "" {
+			continue
+		}
+		du.updateImage(runCtx, cmd)
+	}
 
-		digest, err := du.fetchImageDigest(ctx, cmd.Image)
+	return fromCommands, nil
+}
+
+// updateImage resolves the latest digest of one image within its registry's timeout and
+// applies it unless a check holds it back
+func (du *ContainerfileUpdater) updateImage(runCtx context.Context, cmd *FromCommand) {
+	// Always fetch latest digest, even if one already exists
+	slog.Debug("Fetching latest digest", "registry", cmd.Image.Registry, "repository", cmd.Image.Repository, "tag", cmd.Image.Tag)
+
+	cmd.PreviousDigest = cmd.Image.Digest
+	ctx, cancel, err := du.lookupContext(runCtx, cmd.Image.Registry)
+	var digest string
+	if err == nil {
+		defer cancel()
+		digest, err = du.fetchImageDigest(ctx, cmd.Image)
 		if err != nil {
-			log.Printf("Warning: failed to fetch digest for %s: %v", cmd.Image.Original, err)
-			continue
+			err = du.withTagSuggestions(ctx, cmd.Image, err)
+		} else if err = du.verifyPlatforms(ctx, cmd, digest); err == nil {
+			if platform := du.pinnedPlatform(cmd); platform != "" {
+				cmd.PinnedPlatform = platform
+				digest, err = du.platformDigest(ctx, cmd.Image, digest, platform)
+			}
+		}
+	}
+	if err != nil {
+		if du.resolver.firstFailure(cmd.Image) {
+			slog.Warn("Failed to fetch digest", "image", cmd.Image.Original, "error", err)
+		} else {
+			slog.Debug("Digest already failed to resolve in this run", "image", cmd.Image.Original, "error", err)
 		}
+		cmd.Err = err
+		// Don't rewrite the line with a stale digest
+		cmd.Image.Digest = ""
+		return
+	}
 
-		log.Printf("Found latest digest for %s: %s", cmd.Image.Original, digest)
-		cmd.Image.Digest = digest
+	slog.Info("Found latest digest", "image", cmd.Image.Original, "digest", digest)
+	pinned := du.applyDigest(ctx, runCtx, cmd, digest)
+	du.checkPinAge(ctx, cmd, pinned)
+}
+
+// applyDigest pins an image to its latest digest unless a check holds it back, and returns
+// the digest the image is pinned to after the run
+func (du *ContainerfileUpdater) applyDigest(ctx, runCtx context.Context, cmd *FromCommand, digest string) string {
+	if digest != cmd.PreviousDigest {
+		if reason := du.gateUpdate(ctx, cmd, digest); reason != "" {
+			slog.Warn("Not updating image", "image", cmd.Image.Original, "digest", digest, "reason", reason)
+			cmd.HeldReason = reason
+			return cmd.PreviousDigest
+		}
 	}
+	if reason := du.copyToMirror(runCtx, cmd, digest); reason != "" {
+		slog.Warn("Not updating image", "image", cmd.Image.Original, "digest", digest, "reason", reason)
+		cmd.HeldReason = reason
+		return cmd.PreviousDigest
+	}
+	cmd.Image.Digest = digest
+	du.applyRewrite(cmd)
+	return digest
+}
 
-	return fromCommands, nil
+// gateUpdate runs the configured checks on a candidate digest and returns why the
+// update must be held back, or an empty string if it may be applied
+func (du *ContainerfileUpdater) gateUpdate(ctx context.Context, cmd *FromCommand, digest string) string {
+	if reason := du.checkCooldown(ctx, cmd, digest); reason != "" {
+		return reason
+	}
+	if reason := du.checkPlatforms(ctx, cmd, digest); reason != "" {
+		return reason
+	}
+	if reason := du.checkAttestations(ctx, cmd, digest); reason != "" {
+		return reason
+	}
+	if reason := du.checkContentTrust(ctx, cmd, digest); reason != "" {
+		return reason
+	}
+	return du.checkVulnerabilities(cmd, digest)
 }
 
 // fetchImageDigest fetches the manifest digest for an image reference
 func (du *ContainerfileUpdater) fetchImageDigest(ctx context.Context, imageRef *ImageReference) (string, error) {
-	// Construct full image reference
-	var fullRef string
-	if imageRef.Registry == "docker.io" {
-		// Docker Hub shorthand
-		fullRef = fmt.Sprintf("%s:%s", imageRef.Repository, imageRef.Tag)
-	} else {
-		fullRef = fmt.Sprintf("%s/%s:%s", imageRef.Registry, imageRef.Repository, imageRef.Tag)
+	if du.digests != nil {
+		return du.digests.Lookup(imageRef)
 	}
 
+	return du.resolver.resolve(imageRef, func() (string, error) {
+		ctx := withAuditReference(ctx, imageRef.Original)
+		start := time.Now()
+		digest, err := du.resolveImageDigest(ctx, imageRef)
+		du.metrics.observeFetch(imageRef.Registry, du.format, time.Since(start), err)
+		return digest, err
+	})
+}
+
+// resolveDigest fetches the manifest digest for a tag or digest reference on a registry
+func (du *ContainerfileUpdater) resolveDigest(ctx context.Context, registry, fullRef string) (_ string, err error) {
+	if plugin, ok := pluginFetchers[registry]; ok {
+		start := time.Now()
+		digest, err := plugin.resolve(ctx, fullRef)
+		du.audit.recordCommand(ctx, registry, pluginResolve, "plugin:"+plugin.name, credentialsPlugin, start, digest, err)
+		return digest, err
+	}
+	if registryResolver(du.config, registry) == resolverSkopeo {
+		return du.skopeoDigest(ctx, registry, fullRef)
+	}
+	defer func() {
+		// A missing tag was looked up with working credentials, anything else may have left
+		// the shared puller with a failed token exchange
+		if err != nil && !isNotFound(err) {
+			du.config.pullers.forget(registry)
+		}
+	}()
+
 	// Parse reference using go-containerregistry
-	ref, err := name.ParseReference(fullRef)
+	ref, err := name.ParseReference(fullRef, referenceOptions(du.config, registry)...)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse reference %s: %w", fullRef, err)
 	}
 
-	// Set up authentication (uses Docker config by default)
-	options := []remote.Option{
-		remote.WithAuthFromKeychain(authn.DefaultKeychain),
-		remote.WithContext(ctx),
+	if du.anonymous[registry] {
+		options, err := du.anonymousOptions(ctx, registry)
+		if err != nil {
+			return "", err
+		}
+		return du.manifestDigest(ctx, registry, ref, options)
+	}
+	options, err := du.remoteOptions(ctx, registry)
+	if err != nil {
+		return "", err
+	}
+	digest, err := du.manifestDigest(ctx, registry, ref, options)
+	if err != nil && isAuthFailure(err) {
+		return du.retryAnonymously(ctx, registry, ref, err)
+	}
+	return digest, err
+}
+
+// manifestDigest fetches the digest of a manifest with the given options
+func (du *ContainerfileUpdater) manifestDigest(ctx context.Context, registry string, ref name.Reference, options []remote.Option) (string, error) {
+	// Only the digest is needed, which a HEAD request returns without counting as a pull
+	if !du.headless[registry] {
+		descriptor, err := remote.Head(ref, options...)
+		if err == nil {
+			return descriptor.Digest.String(), nil
+		}
+		if !headUnsupported(ctx, err) {
+			return "", fmt.Errorf("failed to fetch manifest for %s: %w", ref, err)
+		}
+		slog.Debug("HEAD request returned no digest, falling back to GET", "registry", registry, "error", err)
+		du.headless[registry] = true
 	}
 
 	// Get manifest descriptor to obtain digest
 	descriptor, err := remote.Get(ref, options...)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch manifest for %s: %w", fullRef, err)
+		return "", fmt.Errorf("failed to fetch manifest for %s: %w", ref, err)
 	}
 
 	return descriptor.Digest.String(), nil
 }
 
+// retryAnonymously looks up a manifest without credentials after the registry rejected
+// them, so stale credentials such as an expired docker login don't break public images.
+// When that fails too, the error says whether logging in or a missing image is to blame.
+func (du *ContainerfileUpdater) retryAnonymously(ctx context.Context, registry string, ref name.Reference, authErr error) (string, error) {
+	auth, err := du.keychain.Resolve(ref.Context())
+	if err != nil || auth == authn.Anonymous {
+		return "", fmt.Errorf("registry %s requires authentication for %s, log in or configure credentials for it: %w", registry, ref, authErr)
+	}
+
+	// The shared puller may hold the rejected token exchange
+	du.config.pullers.forget(registry)
+	options, err := du.anonymousOptions(ctx, registry)
+	if err != nil {
+		return "", err
+	}
+	digest, err := du.manifestDigest(ctx, registry, ref, options)
+	switch {
+	case err == nil:
+		slog.Warn("Registry rejected the credentials, pulling anonymously; log in again if they expired", "registry", registry)
+		du.anonymous[registry] = true
+		return digest, nil
+	case isNotFound(err):
+		return "", err
+	default:
+		return "", fmt.Errorf("registry %s rejected the credentials for %s, log in again if they expired or fix them in the config: %w", registry, ref, authErr)
+	}
+}
+
+// registryTransport returns the transport for requests to a registry, logging them in
+// debug mode, counting them in the metrics and recording them with the source of the
+// credentials sent in the audit log
+func (du *ContainerfileUpdater) registryTransport(ctx context.Context, registry, credentials string) (http.RoundTripper, error) {
+	transport, err := du.transports.forRegistry(registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure transport for %s: %w", registry, err)
+	}
+
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		transport = &loggingTransport{next: transport}
+	}
+	transport = du.audit.wrapTransport(registry, credentials, transport)
+	return du.metrics.wrapTransport(registry, transport), nil
+}
+
+// anonymousOptions returns the options for requests to a registry without credentials
+func (du *ContainerfileUpdater) anonymousOptions(ctx context.Context, registry string) ([]remote.Option, error) {
+	transport, err := du.registryTransport(ctx, registry, credentialsAnonymous)
+	if err != nil {
+		return nil, err
+	}
+	return []remote.Option{
+		remote.WithAuth(authn.Anonymous),
+		remote.WithTransport(transport),
+		remote.WithContext(ctx),
+	}, nil
+}
+
+// remoteOptions returns the authentication and transport options for requests to a registry
+func (du *ContainerfileUpdater) remoteOptions(ctx context.Context, registry string) ([]remote.Option, error) {
+	transport, err := du.registryTransport(ctx, registry, du.auditCredentials(registry))
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up authentication (environment and config file, then Docker config)
+	puller, err := du.config.pullers.forRegistry(registry, du.keychain, transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure puller for %s: %w", registry, err)
+	}
+	return []remote.Option{
+		remote.Reuse(puller),
+		remote.WithAuthFromKeychain(du.keychain),
+		remote.WithTransport(transport),
+		remote.WithContext(ctx),
+	}, nil
+}
+
 // reconstructAndWriteContainerfile rebuilds the Containerfile with updated FROM commands
-func (du *ContainerfileUpdater) reconstructAndWriteContainerfile(result *parser.Result, updatedCommands []*FromCommand) error {
-	// Read original Containerfile lines
-	file, err := os.Open(du.containerfilePath)
+func (du *ContainerfileUpdater) reconstructAndWriteContainerfile(updatedCommands []*FromCommand) error {
+	// Read original Containerfile lines, remembering how they were terminated
+	data, err := du.readContent()
 	if err != nil {
-		return fmt.Errorf("failed to open original Containerfile: %w", err)
+		return err
 	}
-	defer file.Close()
+	originalLines, style := splitLines(string(data))
 
-	var originalLines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		originalLines = append(originalLines, scanner.Text())
+	// Apply edits bottom-up so lines inserted by one edit don't shift the ones above it
+	ordered := make([]*FromCommand, len(updatedCommands))
+	copy(ordered, updatedCommands)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].LineStart > ordered[j].LineStart
+	})
+
+	format, err := du.fileUpdater()
+	if err != nil {
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read original Containerfile: %w", err)
+
+	newLines := originalLines
+	for _, cmd := range ordered {
+		// Only update if we successfully fetched a digest and no check held it back
+		if cmd.SkipReason != "" || cmd.HeldReason != "" || cmd.Image.Digest == "" {
+			continue
+		}
+		// A pin already at the resolved digest stays as written, whichever form it takes
+		if du.pinCurrent(cmd) {
+			continue
+		}
+
+		newLines, cmd.Changed = format.Rewrite(newLines, cmd)
+		if !cmd.Changed {
+			continue
+		}
+		if du.checkOnly {
+			slog.Info("Update available", "line", cmd.LineStart, "from", cmd.Image.Original, "to", formatReference(cmd))
+			continue
+		}
+		slog.Info("Updated line", "line", cmd.LineStart, "from", cmd.Image.Original, "to", formatReference(cmd))
+	}
+
+	if du.checkOnly {
+		return nil
+	}
+
+	// Every pin is current: leave the file, its modification time and any backups alone
+	if !slices.ContainsFunc(updatedCommands, func(cmd *FromCommand) bool { return cmd.Changed }) {
+		slog.Info("File unchanged, not rewriting it", "path", du.containerfilePath)
+		return nil
 	}
 
-	// Create map of line numbers to updated FROM commands
-	updateMap := make(map[int]*FromCommand)
-	for _, cmd := range updatedCommands {
-		// Only update if we successfully fetched a digest
-		if cmd.Image.Digest != "" {
-			updateMap[cmd.LineStart] = cmd
+	// Write updated Containerfile
+	err = du.validateRewrite(data, newLines, style)
+	if err == nil {
+		err = du.writeContainerfile(data, newLines, style)
+	}
+	if err != nil {
+		// The file was left as it was, or restored after a failed hook
+		for _, cmd := range updatedCommands {
+			cmd.Changed = false
 		}
+		return err
 	}
+	return nil
+}
 
-	// Build new Containerfile content
-	var newLines []string
-	for i, line := range originalLines {
-		lineNum := i + 1 // Line numbers are 1-based
+// lineEditor rewrites the file's lines for an updated image, reporting whether anything changed
+type lineEditor func(lines []string, cmd *FromCommand) ([]string, bool)
+
+// spanEditor rewrites the image reference starting at a byte offset of the command's first
+// line. Only that span is replaced, so the same text elsewhere on the line (in a comment, a
+// key or another value) is never touched, and a line no longer holding the original
+// reference at the offset is left alone.
+func spanEditor(start int) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		index := cmd.LineStart - 1
+		if index < 0 || index >= len(lines) {
+			return lines, false
+		}
+		line := lines[index]
+		end := start + len(cmd.Image.Original)
+		if start < 0 || end > len(line) || line[start:end] != cmd.Image.Original {
+			return lines, false
+		}
 
-		if cmd, shouldUpdate := updateMap[lineNum]; shouldUpdate {
-			// Construct new FROM line with digest
-			var newImageRef string
-			if cmd.Image.Registry == "docker.io" {
-				// Use Docker Hub shorthand format
-				newImageRef = fmt.Sprintf("%s@%s", cmd.Image.Repository, cmd.Image.Digest)
-			} else {
-				// Use full registry format
-				newImageRef = fmt.Sprintf("%s/%s@%s", cmd.Image.Registry, cmd.Image.Repository, cmd.Image.Digest)
+		updated := line[:start] + formatReference(cmd) + line[end:]
+		if updated == line {
+			return lines, false
+		}
+		lines[index] = updated
+		return lines, true
+	}
+}
+
+// fromReferenceEditor substitutes the updated reference for the image argument of a FROM
+// instruction. It looks past flags and line continuations, which end in the escape
+// token of the file (\ unless an escape directive sets `), so the image is found wherever
+// it sits within the instruction's lines and a flag value that happens to contain the
+// reference is never touched.
+func fromReferenceEditor(escapeToken rune) lineEditor {
+	escape := string(cmp.Or(escapeToken, parser.DefaultEscapeToken))
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		seenFrom := false
+		for index := max(cmd.LineStart-1, 0); index < cmd.LineEnd && index < len(lines); index++ {
+			line := lines[index]
+			if seenFrom && strings.HasPrefix(strings.TrimSpace(line), "#") {
+				// Comments may be interleaved with continuation lines
+				continue
 			}
 
-			// Replace the FROM line, preserving any aliases or flags
-			originalLine := line
-			// Simple replacement of the image reference part
-			updatedLine := strings.Replace(originalLine, cmd.Image.Original, newImageRef, 1)
-			newLines = append(newLines, updatedLine)
+			for _, span := range fieldSpans(line) {
+				token := line[span[0]:span[1]]
+				if !seenFrom {
+					seenFrom = strings.EqualFold(token, "from")
+					continue
+				}
+				if token == escape || strings.HasPrefix(token, "--") {
+					continue
+				}
+
+				// The first remaining token is the image
+				if strings.TrimSuffix(token, escape) != cmd.Image.Original {
+					return lines, false
+				}
+				end := span[0] + len(cmd.Image.Original)
+				updated := line[:span[0]] + formatReference(cmd) + line[end:]
+				if updated == line {
+					return lines, false
+				}
+				lines[index] = updated
+				return lines, true
+			}
+		}
+		return lines, false
+	}
+}
 
-			log.Printf("Updated line %d: %s -> %s", lineNum, originalLine, updatedLine)
-		} else {
-			newLines = append(newLines, line)
+// fieldSpans returns the start and end offsets of the whitespace-separated fields of a line
+func fieldSpans(line string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range line {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
 		}
 	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(line)})
+	}
+	return spans
+}
 
-	// Write updated Containerfile
-	return du.writeContainerfile(newLines)
+// formatReference renders the updated image reference according to the pin mode
+func formatReference(cmd *FromCommand) string {
+	pin := pinDigest
+	if cmd.Annotations != nil && cmd.Annotations.Pin != "" {
+		pin = cmd.Annotations.Pin
+	}
+
+	name := cmd.formats.name(cmd.Image)
+	if pin == pinTagOnly {
+		if cmd.TrackedTag != "" || cmd.RewrittenFrom != "" {
+			return name + ":" + cmd.Image.Tag
+		}
+		// Keep the reference as written, dropping any digest
+		base, _, _ := strings.Cut(cmd.Image.Original, "@")
+		if !cmd.Image.ExplicitTag() {
+			base += ":" + cmd.Image.Tag
+		}
+		return base
+	}
+
+	if pin == pinTagDigest {
+		return fmt.Sprintf("%s:%s@%s", name, cmd.Image.Tag, cmd.Image.Digest)
+	}
+	// Pin modes set by annotation take precedence over the configured formats
+	if cmd.Annotations == nil || cmd.Annotations.Pin == "" {
+		if reference, ok := cmd.formats.render(cmd.Image); ok {
+			return reference
+		}
+	}
+	return name + "@" + cmd.Image.Digest
 }
 
-// writeContainerfile writes the updated content back to the Containerfile
-func (du *ContainerfileUpdater) writeContainerfile(lines []string) error {
+// pinCurrent reports whether a reference is already pinned to the digest just resolved, so
+// rewriting it could only change its form. Tracked tags and registry rewrites change the
+// reference itself, tag-only pins drop the digest, resolution comments may still be
+// missing and configured reference formats bring existing pins into shape, so those are
+// always edited.
+func (du *ContainerfileUpdater) pinCurrent(cmd *FromCommand) bool {
+	if du.annotate || cmd.TrackedTag != "" || cmd.RewrittenFrom != "" {
+		return false
+	}
+	if cmd.Annotations != nil && cmd.Annotations.Pin == pinTagOnly {
+		return false
+	}
+	if cmd.formats.qualifies(cmd.Image) {
+		return false
+	}
+	if (cmd.Annotations == nil || cmd.Annotations.Pin == "") && cmd.formats.forRegistry(cmd.Image.Registry) != nil {
+		return false
+	}
+	return cmd.PreviousDigest != "" && cmd.Image.Digest == cmd.PreviousDigest
+}
+
+// writeContainerfile writes the updated content back to the Containerfile, between the
+// configured pre- and post-update hooks
+func (du *ContainerfileUpdater) writeContainerfile(original []byte, lines []string, style lineStyle) error {
+	if du.output != nil {
+		// Filter mode leaves the file alone, so there's nothing to back up
+		if _, err := io.WriteString(du.output, style.join(lines)); err != nil {
+			return fmt.Errorf("failed to write updated content: %w", err)
+		}
+		return nil
+	}
+
+	// Checked again right before writing, the file may have been swapped since it was read
+	if err := du.pathPolicy.check(du.containerfilePath); err != nil {
+		return fmt.Errorf("refusing to write: %w", err)
+	}
+
+	hooks := du.config.Hooks
+	if err := hooks.run(hookPreUpdate, du.containerfilePath, du.format); err != nil {
+		return err
+	}
+
 	// Create backup of original file
-	backupPath := du.containerfilePath + ".backup"
-	if err := du.copyFile(du.containerfilePath, backupPath); err != nil {
-		log.Printf("Warning: failed to create backup: %v", err)
-	} else {
-		log.Printf("Created backup: %s", backupPath)
+	if backupPath, err := du.backup.create(du.containerfilePath, time.Now(), du.pathPolicy); err != nil {
+		slog.Warn("Failed to create backup", "error", err)
+	} else if backupPath != "" {
+		slog.Info("Created backup", "path", backupPath)
 	}
 
-	// Write updated content
-	file, err := os.Create(du.containerfilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create updated Containerfile: %w", err)
+	// Write updated content to a temporary file and swap it in so a crash can't truncate it
+	content := style.join(lines)
+	if err := writeFileAtomic(du.containerfilePath, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write updated Containerfile: %w", err)
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	for _, line := range lines {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("failed to write line to Containerfile: %w", err)
+	// A rewrite the checks reject must not be left behind to be committed
+	if err := hooks.run(hookPostUpdate, du.containerfilePath, du.format); err != nil {
+		if restoreErr := writeFileAtomic(du.containerfilePath, original); restoreErr != nil {
+			return fmt.Errorf("%w (restoring %s failed: %v)", err, du.containerfilePath, restoreErr)
 		}
+		slog.Warn("Restored file after a failed hook", "path", du.containerfilePath)
+		return err
 	}
+	return nil
+}
 
-	if err := writer.Flush(); err != nil {
-		return fmt.Errorf("failed to flush Containerfile: %w", err)
-	}
+// stringSliceFlag is a flag.Value collecting every occurrence of a repeatable flag
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
 
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
 	return nil
 }
 
-// copyFile creates a copy of the source file
-func (du *ContainerfileUpdater) copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// usage returns a help printer for the update command
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [update|check] [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Example: ./containerfile-updater ./Containerfile")
+		fmt.Fprintln(fs.Output(), "Directories are searched recursively for Containerfiles, Dockerfiles, compose files, workflows, kustomizations and chart values.")
+		fmt.Fprintln(fs.Output(), "The path - reads from stdin and writes the updated content to stdout.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = no changes needed, 1 = updates applied or available (--check), 2 = errors resolving digests")
+		fmt.Fprintf(fs.Output(), "\nRun '%s help' for the other commands. Flags can also be set with %s<FLAG>.\n", filepath.Base(os.Args[0]), flagEnvPrefix)
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
 	}
-	defer sourceFile.Close()
+}
+
+// registryFlags holds the flags shared by every command that talks to registries
+type registryFlags struct {
+	configPath         *string
+	profile            *string
+	insecureRegistries stringSliceFlag
+	proxy              *string
+	noProxy            *string
+	timeout            *time.Duration
+	rateLimit          *float64
+}
+
+// addRegistryFlags registers the config and registry connection flags on a flag set
+func addRegistryFlags(fs *flag.FlagSet) *registryFlags {
+	rf := &registryFlags{}
+	rf.configPath = fs.String("config", "", "Path to the YAML config file (defaults to "+defaultConfigFile+" if present)")
+	rf.profile = fs.String("profile", "", "Merge the settings of this profile of the config file over the others")
+	fs.Var(&rf.insecureRegistries, "insecure-registry", "Allow plain HTTP and self-signed TLS for this registry host (repeatable)")
+	rf.proxy = fs.String("proxy", "", "Proxy URL for registry requests (overrides HTTP_PROXY/HTTPS_PROXY)")
+	rf.noProxy = fs.String("no-proxy", "", "Comma-separated hosts, domains and CIDRs that bypass the proxy (added to NO_PROXY)")
+	rf.timeout = fs.Duration("timeout", 0, "Time allowed per image lookup (default 30s; overrides the config file, registries can set their own)")
+	rf.rateLimit = fs.Float64("rate-limit", 0, "Requests per second to each registry (overrides the config file, registries can set their own)")
+	return rf
+}
 
-	destFile, err := os.Create(dst)
+// loadConfig loads the config file and applies the registry flag overrides
+func (rf *registryFlags) loadConfig() (*Config, error) {
+	cfg, err := LoadConfigProfile(*rf.configPath, *rf.profile)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if *rf.profile != "" {
+		slog.Debug("Using config profile", "profile", *rf.profile)
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
-	return err
+	for _, host := range rf.insecureRegistries {
+		cfg.RegistryOrCreate(host).Insecure = true
+	}
+	if *rf.proxy != "" {
+		cfg.Proxy = *rf.proxy
+	}
+	if *rf.noProxy != "" {
+		cfg.NoProxy = joinNoProxy(cfg.NoProxy, *rf.noProxy)
+	}
+	if *rf.timeout < 0 {
+		return nil, fmt.Errorf("--timeout must not be negative")
+	}
+	if *rf.timeout > 0 {
+		cfg.Timeout = *rf.timeout
+	}
+	if *rf.rateLimit < 0 {
+		return nil, fmt.Errorf("--rate-limit must not be negative")
+	}
+	if *rf.rateLimit > 0 {
+		cfg.RateLimit = *rf.rateLimit
+	}
+	return cfg, nil
 }
 
-// main function demonstrating usage
+// main dispatches to a subcommand, defaulting to updating the Containerfile
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("Usage: %s <containerfile-path>\n", filepath.Base(os.Args[0]))
-		fmt.Println("Example: ./containerfile-updater ./Containerfile")
-		os.Exit(1)
+	findDockerDesktopHelpers()
+	if len(os.Args) > 1 {
+		if cmd := lookupCommand(os.Args[1]); cmd != nil {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+	os.Exit(runUpdate(os.Args[1:]))
+}
+
+// runUpdate resolves the latest digests and rewrites the Containerfile
+func runUpdate(args []string) int {
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	checkOnly := fs.Bool("check", false, "Report whether updates are available without modifying the Containerfile")
+	gitCommit := fs.Bool("git-commit", false, "Stage and commit the updated Containerfile with a generated message")
+	gitBranch := fs.String("git-branch", "", "Create or switch to this branch before updating")
+	gitRemote := fs.String("git-remote", "origin", "Remote to push the update branch to in PR mode")
+	forge := fs.String("forge", "", "Commit, push the update branch and open or update a pull/merge request on this forge (github, gitlab, gitea, forgejo)")
+	githubPR := fs.Bool("github-pr", false, "Shorthand for --forge=github")
+	forgeRepo := fs.String("forge-repo", "", "Repository (owner/name or group/project) for the pull/merge request (defaults to $GITHUB_REPOSITORY or $CI_PROJECT_PATH)")
+	forgeBase := fs.String("forge-base", "", "Base branch for the pull/merge request (defaults to the repository default branch)")
+	forgeURL := fs.String("forge-api-url", "", "Forge API URL (for GitHub Enterprise, self-hosted GitLab, or Gitea/Forgejo)")
+	groupBy := fs.String("group-by", "", "Split the changes into a pull/merge request per file or image instead of one for all (all, file, image)")
+	var requireAttestations stringSliceFlag
+	fs.Var(&requireAttestations, "require-attestation", "Only update to digests carrying this attestation (sbom, provenance; repeatable)")
+	var requirePlatforms stringSliceFlag
+	fs.Var(&requirePlatforms, "require-platform", "Only update to digests providing this platform, e.g. linux/arm64 (repeatable)")
+	verifyPlatforms := fs.Bool("verify-platforms", false, "Fail images whose digest lacks a required platform or the fixed --platform of their FROM")
+	filePlatform := fs.String("file-platform", "", "Pin images to the manifest of this platform, e.g. linux/arm64, instead of the index (for per-platform files)")
+	vulnScanner := fs.String("vuln-scanner", "", "Scan candidate digests with this scanner (trivy, grype) and hold back updates adding vulnerabilities")
+	requireContentTrust := fs.Bool("require-content-trust", false, "Only update to digests signed for their tag (Docker Content Trust, or notation if configured)")
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	output := fs.String("output", outputText, "Report format written to stdout after the run (text, json, sarif)")
+	githubOutput := fs.Bool("github-output", false, "Annotate files with workflow commands (with --output text) and write step outputs and a job summary for GitHub Actions")
+	watch := fs.Bool("watch", false, "Keep running and re-pin every --interval until SIGINT/SIGTERM")
+	interval := fs.Duration("interval", defaultWatchInterval, "Time between runs in --watch mode")
+	healthAddr := fs.String("health-addr", "", "Serve /healthz and /metrics on this address in --watch mode (e.g. :8080)")
+	webhookAddr := fs.String("webhook-addr", "", "Serve registry webhooks (Harbor, Docker Hub, GitHub) on this address and update only the pushed images")
+	webhookSecret := fs.String("webhook-secret", "", "Shared secret webhook requests must carry")
+	var backup BackupPolicy
+	fs.BoolVar(&backup.Disabled, "no-backup", false, "Don't keep a .backup copy of files before rewriting them")
+	fs.StringVar(&backup.Dir, "backup-dir", "", "Write backups into this directory instead of next to each file")
+	fs.IntVar(&backup.Keep, "backup-keep", 0, "Keep timestamped backups, pruning all but the newest N per file (0 overwrites a single .backup)")
+	var pathPolicy PathPolicy
+	fs.StringVar(&pathPolicy.Root, "root", "", "Refuse to read or write files resolving outside of this directory, including the lock file, reports, attestations, backups and audit log")
+	fs.BoolVar(&pathPolicy.NoSymlinks, "no-follow-symlinks", false, "Refuse to read or write through symbolic links, and below links inside --root, for the same files as --root")
+	lockFile := fs.String("lock-file", "", "Record pinned digests in this lock file (defaults to "+defaultLockFile+" if present)")
+	reportFile := fs.String("report-file", "", "Also write the JSON report to this file")
+	auditLog := fs.String("audit-log", "", "Append a JSON line for every registry request and digest lookup to this file")
+	attestation := fs.String("attestation", "", "Write an in-toto statement with SLSA provenance of the run to this file")
+	signer := fs.String("signer", "", "Sign the lock file and --report-file with this signer (cosign, key)")
+	signingKey := fs.String("signing-key", "", "Key file or KMS URI for cosign (keyless if unset), or PEM private key for the key signer")
+	frozen := fs.Bool("frozen", false, "Verify the files against the lock file without contacting registries")
+	offline := fs.Bool("offline", false, "Resolve digests only from --digest-file, without contacting registries")
+	digestFile := fs.String("digest-file", "", "Digests written by export-digests, used in --offline mode")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also pin the frontend image of a # syntax= directive to a digest")
+	annotate := fs.Bool("annotate-resolved", false, "Maintain a # tag=<tag> resolved=<date> comment above each pinned FROM instruction")
+	deadline := fs.Duration("deadline", 0, "Time allowed for the whole run; lookups still pending when it expires fail (default none)")
+	graph := fs.String("graph", "", "Print the build stage graph of each Containerfile after the summary (dot); --output json always includes it")
+	releaseNotes := fs.Bool("release-notes", false, "Link the source and release notes of every updated image in reports (always done for tracked tag changes)")
+	referrers := fs.Bool("referrers", false, "List the SBOMs, signatures and attestations attached to every updated digest in reports")
+	scanRun := fs.Bool("scan-run", false, "Also pin images pulled by docker, podman, crane or skopeo inside RUN instructions")
+	toStdout := fs.Bool("stdout", false, "Write the updated content to stdout instead of rewriting the file (implied by the path -)")
+	var only, stages stringSliceFlag
+	fs.Var(&only, "only", "Only update images matching these names or patterns, e.g. golang,ghcr.io/org/* (comma-separated, repeatable)")
+	fs.Var(&stages, "stage", "Only update images used by these build stages (comma-separated, repeatable)")
+	onlyUnpinned := fs.Bool("only-unpinned", false, "Leave existing digest pins untouched and only pin images without one")
+	strict := fs.Bool("strict", false, "Leave a file unchanged and exit 2 when any of its digests fails to resolve, and open no change request")
+	validate := fs.Bool("validate", false, "Check that rewritten Containerfiles still convert for a build before saving them")
+	jobs := fs.Int("jobs", defaultJobs, "Images resolved at once when updating several files; each image is resolved once per run")
+	fs.Usage = usage(fs)
+	parseFlags(fs, args)
+
+	// Errors are reported once logging is configured
+	cfg, configErr := registry.loadConfig()
+	paths, discoverErr := discoverFiles(fs.Args(), cfg)
+
+	// A progress bar replaces the per-image log lines unless a level was requested
+	var progress *Progress
+	defaultLevel := "info"
+	if len(paths) > 1 && *output == outputText && !*watch && *webhookAddr == "" && isTerminal(os.Stdout) {
+		progress = NewProgress(os.Stdout, len(paths))
+		defaultLevel = "warn"
+	}
+	if err := logging.configure(defaultLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		// Log lines would tear the bar apart
+		progress = nil
+	}
+	if usePlugins() > 0 && configErr == nil {
+		// Files in the formats of plugins are only found now that they are loaded
+		paths, discoverErr = discoverFiles(fs.Args(), cfg)
+		if progress != nil {
+			progress = NewProgress(os.Stdout, len(paths))
+		}
+	}
+
+	if err := validateOutputFormat(*output, outputSARIF); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+	if *jobs < 1 {
+		slog.Error("Invalid --jobs", "error", "must be at least 1")
+		return exitError
+	}
+	if *deadline < 0 {
+		slog.Error("Invalid --deadline", "error", "must not be negative")
+		return exitError
+	}
+	if *graph != "" && *graph != graphDOT {
+		slog.Error("Invalid --graph", "error", fmt.Errorf("unknown graph format %q (expected %s)", *graph, graphDOT))
+		return exitError
+	}
+	if *graph != "" && *output == outputJSON {
+		slog.Error("--graph can't be combined with --output json, which already includes the stage graph")
+		return exitError
+	}
+	if _, err := resolveFormat(*format, "", nil); err != nil {
+		slog.Error("Invalid --format", "error", err)
+		return exitError
+	}
+	if err := validateAttestationKinds(requireAttestations); err != nil {
+		slog.Error("Invalid --require-attestation", "error", err)
+		return exitError
+	}
+	if err := validatePlatformConfig(PlatformConfig{Require: requirePlatforms}); err != nil {
+		slog.Error("Invalid --require-platform", "error", err)
+		return exitError
+	}
+	if *filePlatform != "" {
+		if err := validatePlatform(*filePlatform); err != nil {
+			slog.Error("Invalid --file-platform", "error", err)
+			return exitError
+		}
+	}
+	selection, err := newImageSelection(only, stages, *onlyUnpinned)
+	if err != nil {
+		slog.Error("Invalid image selection", "error", err)
+		return exitError
+	}
+	if *lockFile == "" {
+		if _, err := os.Stat(defaultLockFile); err == nil {
+			*lockFile = defaultLockFile
+		}
+	}
+	if *frozen {
+		if _, err := os.Stat(*lockFile); *lockFile == "" || err != nil {
+			slog.Error("--frozen needs an existing lock file", "lock_file", firstNonEmpty(*lockFile, defaultLockFile))
+			return exitError
+		}
+		if *gitCommit || *gitBranch != "" || *forge != "" || *githubPR || *watch || *webhookAddr != "" || *toStdout {
+			slog.Error("--frozen can't be combined with git, forge, watch, webhook or stdout flags")
+			return exitError
+		}
+	}
+	if err := validateGroupBy(*groupBy); err != nil {
+		slog.Error("Invalid --group-by", "error", err)
+		return exitError
+	}
+	if err := backup.Validate(); err != nil {
+		slog.Error("Invalid backup flags", "error", err)
+		return exitError
+	}
+	if err := pathPolicy.Validate(); err != nil {
+		slog.Error("Invalid --root", "error", err)
+		return exitError
+	}
+	if *watch && *webhookAddr != "" {
+		slog.Error("--watch and --webhook-addr are mutually exclusive")
+		return exitError
+	}
+	if *watch && *interval <= 0 {
+		slog.Error("Invalid --interval: must be positive", "interval", *interval)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	if discoverErr != nil {
+		slog.Error("Failed to find files to update", "error", discoverErr)
+		return exitError
+	}
+	if len(paths) == 0 {
+		slog.Error("No files to update found", "paths", fs.Args())
+		return exitError
+	}
+	if slices.Contains(paths, stdinPath) {
+		*toStdout = true
+	}
+	if *toStdout {
+		if len(paths) != 1 {
+			slog.Error("--stdout and - need exactly one file")
+			return exitError
+		}
+		if *gitCommit || *gitBranch != "" || *forge != "" || *githubPR || *watch || *webhookAddr != "" {
+			slog.Error("--stdout can't be combined with git, forge, watch or webhook flags")
+			return exitError
+		}
+	}
+
+	if configErr != nil {
+		slog.Error("Failed to load config", "error", configErr)
+		return exitError
+	}
+	for _, kind := range requireAttestations {
+		if !slices.Contains(cfg.Attestations.Require, kind) {
+			cfg.Attestations.Require = append(cfg.Attestations.Require, kind)
+		}
+	}
+	for _, platform := range requirePlatforms {
+		if !slices.Contains(cfg.Platforms.Require, platform) {
+			cfg.Platforms.Require = append(cfg.Platforms.Require, platform)
+		}
+	}
+	if *verifyPlatforms {
+		cfg.Platforms.Action = platformActionError
+		cfg.Platforms.CheckFrom = true
+	}
+	if *filePlatform != "" {
+		// The flag applies to every file given, ahead of the configured patterns
+		cfg.Platforms.Files = append([]PlatformFile{{Path: "*", Platform: *filePlatform}}, cfg.Platforms.Files...)
+	}
+	if *vulnScanner != "" {
+		cfg.Vulnerabilities.Scanner = *vulnScanner
+		if err := validateVulnerabilityConfig(cfg.Vulnerabilities); err != nil {
+			slog.Error("Invalid --vuln-scanner", "error", err)
+			return exitError
+		}
+	}
+
+	if *requireContentTrust {
+		cfg.ContentTrust.Require = true
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+	if *signer != "" || *signingKey != "" {
+		cfg.Signing.Signer = cmp.Or(*signer, cfg.Signing.Signer)
+		cfg.Signing.Key = cmp.Or(*signingKey, cfg.Signing.Key)
+		if err := validateSigningConfig(cfg.Signing); err != nil {
+			slog.Error("Invalid signing flags", "error", err)
+			return exitError
+		}
+	}
+
+	if *githubPR && *forge == "" {
+		*forge = forgeGitHub
+	}
+
+	var digests DigestSource
+	if *offline != (*digestFile != "") {
+		slog.Error("--offline and --digest-file must be used together")
+		return exitError
+	}
+	if *offline {
+		if len(cfg.Attestations.Require) > 0 || cfg.Vulnerabilities.Scanner != "" || cfg.ContentTrust.verifier() != "" || len(cfg.Cooldown) > 0 || len(cfg.Platforms.Require) > 0 || cfg.Platforms.CheckFrom || *filePlatform != "" || *forge != "" || *watch || *webhookAddr != "" {
+			slog.Error("--offline can't be combined with attestation, vulnerability, content trust, cooldown or platform checks, --file-platform, forge, watch or webhook mode")
+			return exitError
+		}
+		if digests, err = LoadDigestFile(*digestFile); err != nil {
+			slog.Error("Failed to load digest file", "error", err)
+			return exitError
+		}
+	}
+
+	var provider ChangeRequestProvider
+	if *forge != "" && !*checkOnly {
+		repository := *forgeRepo
+		if repository == "" {
+			repository = firstNonEmpty(os.Getenv("GITHUB_REPOSITORY"), os.Getenv("CI_PROJECT_PATH"))
+		}
+
+		provider, err = NewChangeRequestProvider(*forge, *forgeURL, repository, os.Getenv(forgeTokenEnv[strings.ToLower(*forge)]))
+		if err != nil {
+			slog.Error("Failed to configure forge", "forge", *forge, "error", err)
+			return exitError
+		}
+		// Pull requests need a dedicated branch and a commit to push
+		*gitCommit = true
+		if *gitBranch == "" {
+			*gitBranch = defaultUpdateBranch
+		}
+	}
+
+	if *groupBy != "" {
+		cfg.ChangeRequests.GroupBy = *groupBy
+	}
+
+	templates, err := loadMessageTemplates(cfg.Templates)
+	if err != nil {
+		slog.Error("Failed to load templates", "error", err)
+		return exitError
+	}
+
+	var audit *AuditLog
+	if *auditLog != "" {
+		if err := pathPolicy.checkOutput(*auditLog); err != nil {
+			slog.Error("Refusing to use --audit-log", "error", err)
+			return exitError
+		}
+		if audit, err = OpenAuditLog(*auditLog); err != nil {
+			slog.Error("Invalid --audit-log", "error", err)
+			return exitError
+		}
+		defer audit.Close()
+	}
+
+	run := &updateRun{
+		paths:     paths,
+		cfg:       cfg,
+		format:    *format,
+		checkOnly: *checkOnly,
+		strict:    *strict,
+		validate:  *validate,
+		selection: selection,
+		gitCommit: *gitCommit,
+		gitBranch: *gitBranch,
+		gitRemote: *gitRemote,
+		forgeBase: *forgeBase,
+		output:    *output,
+		github:    *githubOutput,
+		provider:  provider,
+		progress:  progress,
+		backup:    backup,
+		confine:   pathPolicy,
+		stdout:    *toStdout,
+		lockFile:  *lockFile,
+		report:    *reportFile,
+		intoto:    *attestation,
+		frozen:    *frozen,
+		digests:   digests,
+		pinSyntax: *pinSyntax,
+		annotate:  *annotate,
+		notes:     *releaseNotes,
+		referrers: *referrers,
+		graph:     *graph,
+		deadline:  *deadline,
+		jobs:      *jobs,
+		templates: templates,
+		groupBy:   cfg.ChangeRequests.GroupBy,
+		audit:     audit,
+	}
+	if *watch {
+		return runWatch(run, *interval, *healthAddr)
+	}
+	if *webhookAddr != "" {
+		return runWebhook(run, *webhookAddr, *webhookSecret)
+	}
+	return run.run()
+}
+
+// updateRun holds everything needed to update the files once, so watch mode can repeat it
+type updateRun struct {
+	paths     []string
+	cfg       *Config
+	format    string            // --format value; "auto" detects each file's format
+	checkOnly bool
+	strict    bool              // Fail files with unresolved digests and skip the change request
+	validate  bool              // Check rewritten Containerfiles convert for a build before saving them
+	selection *imageSelection   // Images and stages to update (nil for all)
+	gitCommit bool
+	gitBranch string
+	gitRemote string
+	forgeBase string
+	output    string
+	github    bool              // Also report to GitHub Actions with annotations, step outputs and a job summary
+	provider  ChangeRequestProvider
+	targets   []RegistryEvent
+	metrics   *Metrics
+	audit     *AuditLog         // Records every registry interaction (nil for none)
+	progress  *Progress
+	backup    BackupPolicy
+	confine   PathPolicy        // Which files may be read and rewritten
+	stdout    bool              // Write updated content to content instead of rewriting the files
+	lockFile  string            // Lock file recording the pinned digests (none if empty)
+	report    string            // File the JSON report is also written to (none if empty)
+	intoto    string            // File the in-toto statement of the run is written to (none if empty)
+	frozen    bool              // Verify the files against the lock file instead of updating them
+	digests   DigestSource      // Resolve digests from this source instead of registries (offline mode)
+	pinSyntax bool              // Pin "# syntax=" directive images too
+	annotate  bool              // Maintain resolution comments above pinned FROM instructions
+	notes     bool              // Look up release notes for every updated image
+	referrers bool              // List the artifacts attached to every updated digest
+	graph     string            // Also print the stage graph of each Containerfile in this format (none if empty)
+	deadline  time.Duration     // Time allowed for the whole run, across files (none if zero)
+	jobs      int               // Images resolved at once across files (defaultJobs if zero)
+	resolver  *digestResolver   // Digests resolved during the current run, shared by its files
+	templates *messageTemplates // Commit message and change request templates (built-in if nil)
+	groupBy   string            // How changes are split into change requests (one for all if empty)
+	until     time.Time         // When the current run's deadline expires
+	in        io.Reader         // Content of the "-" path (os.Stdin if nil)
+	content   io.Writer         // Receives updated content in stdout mode (os.Stdout if nil)
+	out       io.Writer         // Receives the summary or JSON report (os.Stdout, or os.Stderr in stdout mode, if nil)
+}
+
+// run updates every file, committing each changed file and opening a single change
+// request when configured. The exit code is the most severe of the files' exit codes.
+func (r *updateRun) run() int {
+	started := time.Now()
+	var lock *LockFile
+	if r.lockFile != "" {
+		if _, err := os.Lstat(r.lockFile); err == nil {
+			if err := r.confine.check(r.lockFile); err != nil {
+				slog.Error("Refusing to use lock file", "error", err)
+				return exitError
+			}
+		}
+		var err error
+		if lock, err = LoadLockFile(r.lockFile); err != nil {
+			slog.Error("Failed to load lock file", "error", err)
+			return exitError
+		}
+	}
+	if r.frozen {
+		return r.verifyLock(lock)
+	}
+	r.until = time.Time{}
+	if r.deadline > 0 {
+		r.until = time.Now().Add(r.deadline)
+	}
+	r.resolver = nil
+	if r.digests == nil {
+		r.resolver = newDigestResolver()
+		if len(r.paths) > 1 && cmp.Or(r.jobs, defaultJobs) > 1 {
+			r.resolveShared()
+		}
+	}
+
+	repo := NewGitRepository(r.paths[0])
+	var originals map[string][]byte
+	if r.grouped() && !r.checkOnly {
+		originals = readOriginals(r.paths)
+	} else if r.gitBranch != "" && !r.checkOnly {
+		if err := repo.SwitchBranch(r.gitBranch); err != nil {
+			slog.Error("Failed to switch branch", "branch", r.gitBranch, "error", err)
+			return exitError
+		}
+	}
+
+	exitCode := exitOK
+	var changed []*FromCommand
+	var reports []*RunReport
+	for _, path := range r.paths {
+		r.progress.StartFile(path)
+		report, fileChanged, fileExitCode, err := r.updateFile(repo, lock, path)
+		r.progress.FileDone()
+		if err != nil {
+			r.progress.Finish()
+			slog.Error("Failed to commit changes", "path", path, "error", err)
+			return exitError
+		}
+		reports = append(reports, report)
+		changed = append(changed, fileChanged...)
+		exitCode = max(exitCode, fileExitCode)
+	}
+	r.progress.Finish()
+
+	out := r.out
+	if out == nil {
+		out = os.Stdout
+		if r.stdout {
+			// Stdout carries the updated content
+			out = os.Stderr
+		}
+	}
+	summary := summarizeReports(reports)
+	report := &UpdateReport{Updater: currentBuildInfo(), CheckOnly: r.checkOnly, Files: reports, Summary: summary}
+	switch r.output {
+	case outputJSON:
+		if err := writeJSONReport(out, report); err != nil {
+			slog.Error("Failed to write report", "error", err)
+			return exitError
+		}
+	case outputSARIF:
+		files := make([]FileFindings, len(reports))
+		for i, report := range reports {
+			files[i] = FileFindings{File: displayPath(report.Containerfile), Findings: report.Findings}
+		}
+		if err := writeSARIF(out, files); err != nil {
+			slog.Error("Failed to write SARIF report", "error", err)
+			return exitError
+		}
+	default:
+		writeSummary(out, summary, r.checkOnly)
+		if r.graph == graphDOT {
+			for _, report := range reports {
+				if report.Graph != nil {
+					fmt.Fprintln(out)
+					report.Graph.writeDOT(out, displayPath(report.Containerfile))
+				}
+			}
+		}
+	}
+	if r.github {
+		// Workflow commands would corrupt a JSON or SARIF document on the same stream
+		annotations := out
+		if r.output == outputJSON || r.output == outputSARIF {
+			annotations = nil
+		}
+		if err := writeGitHubActions(annotations, reports, summary, r.checkOnly); err != nil {
+			slog.Error("Failed to report to GitHub Actions", "error", err)
+			return exitError
+		}
+	}
+	if r.report != "" {
+		var data bytes.Buffer
+		if err := writeJSONReport(&data, report); err != nil {
+			slog.Error("Failed to encode report", "error", err)
+			return exitError
+		}
+		if err := r.writeOutput(r.report, data.Bytes()); err != nil {
+			slog.Error("Failed to write report file", "path", r.report, "error", err)
+			return exitError
+		}
+		if r.cfg.Signing.Signer != "" {
+			if _, err := r.signOutput(r.report); err != nil {
+				slog.Error("Failed to sign report file", "error", err)
+				return exitError
+			}
+		}
+	}
+	if r.intoto != "" && !r.stdout {
+		if err := r.writeAttestation(reports, started); err != nil {
+			slog.Error("Failed to write attestation", "error", err)
+			return exitError
+		}
 	}
 
-	containerfilePath := os.Args[1]
+	// Grouped changes update the lock file on the branch of each group instead
+	if lock != nil && !r.checkOnly && !r.stdout && !(r.grouped() && len(changed) > 0) {
+		lockPaths, lockChanged, err := r.saveLock(lock)
+		if err != nil {
+			slog.Error("Failed to save lock file", "error", err)
+			return exitError
+		}
+		if lockChanged && r.gitCommit && len(changed) > 0 {
+			if err := repo.Commit("Update "+filepath.Base(r.lockFile), lockPaths...); err != nil {
+				slog.Error("Failed to commit lock file", "error", err)
+				return exitError
+			}
+		}
+	}
+
+	if r.gitCommit && !r.checkOnly && len(changed) == 0 {
+		slog.Info("No digest changes to commit")
+	}
+	if r.provider != nil && len(changed) > 0 && r.strict && exitCode == exitError {
+		slog.Error("Not opening a change request for a partial update (--strict)")
+		return exitCode
+	}
+	if r.provider != nil && len(changed) > 0 && r.grouped() {
+		if err := r.openGroupedChangeRequests(repo, lock, changed, originals); err != nil {
+			slog.Error("Failed to open grouped change requests", "error", err)
+			return exitError
+		}
+		return exitCode
+	}
+	if r.provider != nil && len(changed) > 0 {
+		if err := repo.Push(r.gitRemote, r.gitBranch); err != nil {
+			slog.Error("Failed to push branch", "branch", r.gitBranch, "error", err)
+			return exitError
+		}
 
-	// Check if Containerfile exists
-	if _, err := os.Stat(containerfilePath); os.IsNotExist(err) {
-		log.Fatalf("Containerfile not found: %s", containerfilePath)
+		cr, err := r.templates.changeRequest(changed, r.gitBranch, r.forgeBase)
+		if err != nil {
+			slog.Error("Failed to render change request", "error", err)
+			return exitError
+		}
+		if _, err := r.provider.CreateOrUpdateChangeRequest(cr); err != nil {
+			slog.Error("Failed to open change request", "error", err)
+			return exitError
+		}
 	}
+	return exitCode
+}
 
-	// Create updater and process the Containerfile
-	updater := NewContainerfileUpdater(containerfilePath)
+// readInput reads the content to update in stdout mode, from stdin for the "-" path
+func (r *updateRun) readInput(path string) ([]byte, error) {
+	if path != stdinPath {
+		return os.ReadFile(path)
+	}
+	in := r.in
+	if in == nil {
+		in = os.Stdin
+	}
+	data, err := io.ReadAll(in)
+	if data == nil {
+		// nil input means "read the file"
+		data = []byte{}
+	}
+	return data, err
+}
+
+// newUpdater creates the updater of one file with the run's settings
+func (r *updateRun) newUpdater(path, format string) *ContainerfileUpdater {
+	updater := NewContainerfileUpdaterWithConfig(path, r.cfg)
+	updater.checkOnly = r.checkOnly
+	updater.strict = r.strict
+	updater.validate = r.validate
+	updater.selection = r.selection
+	updater.format = format
+	updater.targets = r.targets
+	updater.metrics = r.metrics
+	updater.audit = r.audit
+	updater.backup = r.backup
+	updater.pathPolicy = r.confine
+	updater.digests = r.digests
+	updater.resolver = r.resolver
+	updater.pinSyntax = r.pinSyntax
+	updater.annotate = r.annotate
+	updater.releaseNotes = r.notes
+	updater.referrers = r.referrers
+	updater.deadline = r.until
+	return updater
+}
+
+// updateFile updates a single file and commits it when configured. It returns the file's
+// report, changed commands and exit code, or an error when committing failed.
+func (r *updateRun) updateFile(repo *GitRepository, lock *LockFile, path string) (*RunReport, []*FromCommand, int, error) {
+	failed := func(err error) *RunReport {
+		return &RunReport{Containerfile: path, CheckOnly: r.checkOnly, Error: err.Error(), Images: []ImageReport{}}
+	}
+
+	if err := r.confine.check(path); err != nil {
+		slog.Error("Refusing to update file", "path", path, "error", err)
+		return failed(err), nil, exitError, nil
+	}
+	format, err := resolveFormat(r.format, path, r.cfg)
+	if err != nil {
+		slog.Error("Invalid --format", "error", err)
+		return failed(err), nil, exitError, nil
+	}
+
+	// Create updater and process the file
+	updater := r.newUpdater(path, format)
+	updater.progress = r.progress
+	var updated bytes.Buffer
+	if r.stdout {
+		if updater.input, err = r.readInput(path); err != nil {
+			slog.Error("Failed to read input", "path", path, "error", err)
+			return failed(err), nil, exitError, nil
+		}
+		updater.output = &updated
+	}
 	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
-		log.Fatalf("Failed to update Containerfile: %v", err)
+		slog.Error("Failed to update file", "path", path, "error", err)
+		return failed(err), nil, exitError, nil
+	}
+
+	if r.stdout {
+		content := r.content
+		if content == nil {
+			content = os.Stdout
+		}
+		// Without changes nothing was written; pass the input through unchanged
+		if updated.Len() == 0 {
+			updated.Write(updater.input)
+		}
+		if _, err := updated.WriteTo(content); err != nil {
+			slog.Error("Failed to write updated content", "error", err)
+			return failed(err), nil, exitError, nil
+		}
+	}
+
+	lock.record(path, updater.fromCommands, time.Now())
+
+	changed := updater.ChangedCommands()
+	// Grouped change requests commit on their own branches once every file is done
+	if r.gitCommit && !r.checkOnly && len(changed) > 0 && !r.grouped() {
+		commitPath, err := filepath.Abs(path)
+		if err != nil {
+			commitPath = path
+		}
+		message, err := r.templates.commitMessage(path, changed)
+		if err != nil {
+			return nil, nil, exitError, err
+		}
+		if err := repo.Commit(message, commitPath); err != nil {
+			return nil, nil, exitError, err
+		}
 	}
+	return updater.Report(), changed, updater.ExitCode(), nil
 }
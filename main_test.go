@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Helper function to disable logging during tests
@@ -62,6 +63,16 @@ func (du *ContainerfileUpdater) mockFetchImageDigest(ctx context.Context, imageR
 	return "sha256:default-test-digest", nil
 }
 
+// mockDigestSource adapts a MockDigestFetcher to DigestSource, so whole runs can resolve
+// through it
+type mockDigestSource struct {
+	fetcher *MockDigestFetcher
+}
+
+func (s mockDigestSource) Lookup(imageRef *ImageReference) (string, error) {
+	return (&ContainerfileUpdater{}).mockFetchImageDigest(context.Background(), imageRef, s.fetcher)
+}
+
 func TestParseImageReference(t *testing.T) {
 	restore := disableLogging()
 	defer restore()
@@ -400,7 +411,7 @@ ENV APP_ENV=production
 	}
 
 	// Reconstruct containerfile
-	err = updater.reconstructAndWriteContainerfile(result, fromCommands)
+	err = updater.reconstructAndWriteContainerfile(fromCommands)
 	if err != nil {
 		t.Fatalf("Failed to reconstruct containerfile: %v", err)
 	}
@@ -448,6 +459,40 @@ ENV APP_ENV=production
 	}
 }
 
+func TestUpdateThroughDigestSource(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	tmpDir := t.TempDir()
+	containerfilePath := filepath.Join(tmpDir, "Containerfile")
+	content := "FROM ubuntu:20.04 AS base\nFROM ghcr.io/org/tool:1.0 AS tool\nFROM base\n"
+	if err := os.WriteFile(containerfilePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test containerfile: %v", err)
+	}
+
+	fetcher := NewMockDigestFetcher()
+	fetcher.SetDigest("library/ubuntu:20.04", "sha256:test-ubuntu-digest")
+	fetcher.SetError("ghcr.io/org/tool:1.0", fmt.Errorf("manifest unknown"))
+
+	updater := NewContainerfileUpdater(containerfilePath)
+	updater.digests = mockDigestSource{fetcher}
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Failed to update containerfile: %v", err)
+	}
+
+	updated, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read updated containerfile: %v", err)
+	}
+	expected := "FROM library/ubuntu@sha256:test-ubuntu-digest AS base\nFROM ghcr.io/org/tool:1.0 AS tool\nFROM base\n"
+	if string(updated) != expected {
+		t.Errorf("Containerfile content mismatch.\nExpected:\n%s\nGot:\n%s", expected, updated)
+	}
+	if updater.failedCount() != 1 {
+		t.Errorf("Expected the lookup error to fail one image, got %d failures", updater.failedCount())
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	restore := disableLogging()
 	defer restore()
@@ -711,3 +756,362 @@ FROM runtime`
 		}
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	fetchErr := fmt.Errorf("manifest unknown")
+
+	tests := []struct {
+		name         string
+		checkOnly    bool
+		strict       bool
+		fromCommands []*FromCommand
+		expected     int
+	}{
+		{
+			name:         "No FROM commands",
+			fromCommands: nil,
+			expected:     exitOK,
+		},
+		{
+			name:         "Updates applied",
+			fromCommands: []*FromCommand{{Changed: true}, {}},
+			expected:     exitUpdatesNeeded,
+		},
+		{
+			name:         "Check mode with no changes",
+			checkOnly:    true,
+			fromCommands: []*FromCommand{{}, {}},
+			expected:     exitOK,
+		},
+		{
+			name:         "Check mode with updates available",
+			checkOnly:    true,
+			fromCommands: []*FromCommand{{Changed: true}, {}},
+			expected:     exitUpdatesNeeded,
+		},
+		{
+			name:         "Check mode with a failed fetch",
+			checkOnly:    true,
+			fromCommands: []*FromCommand{{Changed: true}, {Err: fetchErr}},
+			expected:     exitError,
+		},
+		{
+			name:         "Partial failure while updating",
+			fromCommands: []*FromCommand{{Changed: true}, {Err: fetchErr}},
+			expected:     exitError,
+		},
+		{
+			name:         "Partial failure in strict mode",
+			strict:       true,
+			fromCommands: []*FromCommand{{Changed: true}, {Err: fetchErr}},
+			expected:     exitError,
+		},
+		{
+			name:         "Every fetch failed while updating",
+			fromCommands: []*FromCommand{{Err: fetchErr}, {Err: fetchErr}},
+			expected:     exitError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updater := NewContainerfileUpdater("test")
+			updater.checkOnly = tt.checkOnly
+			updater.strict = tt.strict
+			updater.fromCommands = tt.fromCommands
+
+			if got := updater.ExitCode(); got != tt.expected {
+				t.Errorf("ExitCode: got %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStrictModeLeavesPartialUpdatesUnwritten(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/app:1.0")
+
+	original := "FROM " + host + "/app:1.0\nFROM " + host + "/missing:1.0\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, out: io.Discard,
+		backup: BackupPolicy{Disabled: true}, strict: true}
+	if code := run.run(); code != exitError {
+		t.Errorf("Expected exit code %d in strict mode, got %d", exitError, code)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	if string(content) != original {
+		t.Errorf("Strict mode rewrote a partially resolved file:\n%s", content)
+	}
+
+	// Without --strict the resolvable image is pinned
+	run.strict = false
+	if code := run.run(); code != exitError {
+		t.Errorf("Expected exit code %d, got %d", exitError, code)
+	}
+	if content, _ := os.ReadFile(path); string(content) == original {
+		t.Error("Expected the resolvable image to be pinned without --strict")
+	}
+}
+
+func TestCheckModeDoesNotWrite(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	originalContent := `FROM ubuntu:20.04 AS base
+RUN apt-get update
+`
+
+	tmpDir := t.TempDir()
+	containerfilePath := filepath.Join(tmpDir, "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to create test containerfile: %v", err)
+	}
+
+	updater := NewContainerfileUpdater(containerfilePath)
+	updater.checkOnly = true
+
+	result, err := updater.parseContainerfile()
+	if err != nil {
+		t.Fatalf("Failed to parse containerfile: %v", err)
+	}
+
+	fromCommands, err := updater.extractFromCommands(result.AST)
+	if err != nil {
+		t.Fatalf("Failed to extract FROM commands: %v", err)
+	}
+	updater.fromCommands = fromCommands
+
+	for _, cmd := range fromCommands {
+		cmd.Image.Digest = "sha256:test-ubuntu-digest"
+	}
+
+	if err := updater.reconstructAndWriteContainerfile(fromCommands); err != nil {
+		t.Fatalf("Failed to reconstruct containerfile: %v", err)
+	}
+
+	content, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read containerfile: %v", err)
+	}
+	if string(content) != originalContent {
+		t.Errorf("Check mode modified the Containerfile:\n%s", content)
+	}
+
+	if _, err := os.Stat(containerfilePath + ".backup"); !os.IsNotExist(err) {
+		t.Error("Check mode should not create a backup")
+	}
+
+	if got := updater.ExitCode(); got != exitUpdatesNeeded {
+		t.Errorf("ExitCode: got %d, want %d", got, exitUpdatesNeeded)
+	}
+}
+
+func TestCurrentPinsAreNotRewritten(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/app:v1")
+
+	originalContent := "FROM " + host + "/app:v1@" + digest.String() + "\n"
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to create test containerfile: %v", err)
+	}
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(containerfilePath, modified, modified); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	info, err := os.Stat(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to stat containerfile: %v", err)
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("Containerfile was rewritten although its pin is current")
+	}
+	if _, err := os.Stat(containerfilePath + ".backup"); !os.IsNotExist(err) {
+		t.Error("No backup should be made when nothing changes")
+	}
+	if !updater.Report().Unchanged {
+		t.Error("Report should mark the file unchanged")
+	}
+
+	// A new digest is written as before
+	pushRandomImage(t, server, host+"/app:v1")
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(containerfilePath + ".backup"); err != nil {
+		t.Errorf("Expected a backup before rewriting: %v", err)
+	}
+	if updater.Report().Unchanged {
+		t.Error("Report should not mark an updated file unchanged")
+	}
+}
+
+func TestFromFlagsAndContinuations(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	originalContent := `FROM --platform=$BUILDPLATFORM \
+    gcr.io/foo/bar:tag \
+    AS builder
+FROM --platform=linux/amd64/alpine alpine AS runtime
+FROM --platform=linux/arm64 \
+    # the runtime base
+    debian:12
+`
+
+	expectedContent := `FROM --platform=$BUILDPLATFORM \
+    gcr.io/foo/bar@sha256:test-digest \
+    AS builder
+FROM --platform=linux/amd64/alpine library/alpine@sha256:test-digest AS runtime
+FROM --platform=linux/arm64 \
+    # the runtime base
+    library/debian@sha256:test-digest
+`
+
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to create test containerfile: %v", err)
+	}
+
+	updater := NewContainerfileUpdater(containerfilePath)
+	result, err := updater.parseContainerfile()
+	if err != nil {
+		t.Fatalf("Failed to parse containerfile: %v", err)
+	}
+	fromCommands, err := updater.extractFromCommands(result.AST)
+	if err != nil {
+		t.Fatalf("Failed to extract FROM commands: %v", err)
+	}
+
+	platforms := []string{"$BUILDPLATFORM", "linux/amd64/alpine", "linux/arm64"}
+	if len(fromCommands) != len(platforms) {
+		t.Fatalf("Expected %d FROM commands, got %d", len(platforms), len(fromCommands))
+	}
+	for i, cmd := range fromCommands {
+		if cmd.Platform != platforms[i] {
+			t.Errorf("FROM %d: expected platform %q, got %q", i, platforms[i], cmd.Platform)
+		}
+		cmd.Image.Digest = "sha256:test-digest"
+	}
+
+	if err := updater.reconstructAndWriteContainerfile(fromCommands); err != nil {
+		t.Fatalf("Failed to reconstruct containerfile: %v", err)
+	}
+	content, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read containerfile: %v", err)
+	}
+	if string(content) != expectedContent {
+		t.Errorf("Containerfile content mismatch.\nExpected:\n%s\nGot:\n%s", expectedContent, content)
+	}
+}
+
+func TestBuildKitSyntaxFeatures(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	tests := []struct {
+		name     string
+		original string
+		expected string
+	}{
+		{
+			name:     "byte order mark",
+			original: "\ufeffFROM alpine:3.20 AS build\nFROM debian:12\n",
+			expected: "\ufeffFROM library/alpine@sha256:test-digest AS build\nFROM library/debian@sha256:test-digest\n",
+		},
+		{
+			name: "escape directive",
+			original: "# escape=`\n" +
+				"FROM --platform=windows/amd64 `\n" +
+				"    mcr.microsoft.com/windows/servercore:ltsc2022`\n" +
+				"    AS build\n" +
+				"RUN copy C:\\src\\app.exe C:\\app\\\n" +
+				"FROM mcr.microsoft.com/windows/nanoserver:ltsc2022\n",
+			expected: "# escape=`\n" +
+				"FROM --platform=windows/amd64 `\n" +
+				"    mcr.microsoft.com/windows/servercore@sha256:test-digest`\n" +
+				"    AS build\n" +
+				"RUN copy C:\\src\\app.exe C:\\app\\\n" +
+				"FROM mcr.microsoft.com/windows/nanoserver@sha256:test-digest\n",
+		},
+		{
+			name: "heredocs",
+			original: "# syntax=docker/dockerfile:1\n" +
+				"FROM alpine:3.20 AS build\n" +
+				"RUN <<EOF\n" +
+				"echo FROM alpine:3.20 is only text\n" +
+				"# not a comment to BuildKit\n" +
+				"EOF\n" +
+				"COPY <<-CONF /etc/app.conf\n" +
+				"\tFROM debian:12\n" +
+				"\tCONF\n" +
+				"FROM debian:12\n",
+			expected: "# syntax=docker/dockerfile:1\n" +
+				"FROM library/alpine@sha256:test-digest AS build\n" +
+				"RUN <<EOF\n" +
+				"echo FROM alpine:3.20 is only text\n" +
+				"# not a comment to BuildKit\n" +
+				"EOF\n" +
+				"COPY <<-CONF /etc/app.conf\n" +
+				"\tFROM debian:12\n" +
+				"\tCONF\n" +
+				"FROM library/debian@sha256:test-digest\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(path, []byte(tt.original), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+
+			updater := NewContainerfileUpdater(path)
+			fromCommands, err := updater.extractImages()
+			if err != nil {
+				t.Fatalf("Failed to extract images: %v", err)
+			}
+			if len(fromCommands) != 2 {
+				t.Fatalf("Expected 2 images, got %d", len(fromCommands))
+			}
+			for _, cmd := range fromCommands {
+				cmd.Image.Digest = "sha256:test-digest"
+			}
+			if err := updater.reconstructAndWriteContainerfile(fromCommands); err != nil {
+				t.Fatalf("Failed to reconstruct Containerfile: %v", err)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read Containerfile: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Containerfile content mismatch.\nExpected:\n%q\nGot:\n%q", tt.expected, content)
+			}
+		})
+	}
+}
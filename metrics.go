@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes every exported metric
+const metricsNamespace = "containerfile_updater"
+
+// Metrics collects the Prometheus metrics exposed in watch and webhook mode. A nil
+// *Metrics records nothing, so one-shot runs don't pay for instrumentation.
+type Metrics struct {
+	registry       *prometheus.Registry
+	imagesChecked  *prometheus.CounterVec
+	updatesApplied prometheus.Counter
+	registryErrors *prometheus.CounterVec
+	fetchDuration  *prometheus.HistogramVec
+	rateLimitHits  *prometheus.CounterVec
+	runs           *prometheus.CounterVec
+	lastRun        prometheus.Gauge
+}
+
+// NewMetrics creates the metrics on their own registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		imagesChecked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "images_checked_total",
+			Help:      "Image references whose latest digest was resolved.",
+		}, []string{"format"}),
+		updatesApplied: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "updates_applied_total",
+			Help:      "Pinned digests rewritten to a new digest.",
+		}),
+		registryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "registry_errors_total",
+			Help:      "Failed digest lookups by registry.",
+		}, []string{"registry"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "fetch_duration_seconds",
+			Help:      "Time taken to resolve a digest by registry.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"registry"}),
+		rateLimitHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limit_hits_total",
+			Help:      "HTTP 429 responses received from registries.",
+		}, []string{"registry"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "runs_total",
+			Help:      "Completed update runs by exit code.",
+		}, []string{"exit_code"}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "last_run_timestamp_seconds",
+			Help:      "Unix time the last update run completed.",
+		}),
+	}
+	m.registry.MustRegister(m.imagesChecked, m.updatesApplied, m.registryErrors, m.fetchDuration, m.rateLimitHits, m.runs, m.lastRun)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeFetch records the outcome and latency of a digest lookup
+func (m *Metrics) observeFetch(registry, format string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	registry = normalizeRegistry(registry)
+	m.fetchDuration.WithLabelValues(registry).Observe(duration.Seconds())
+	if err != nil {
+		m.registryErrors.WithLabelValues(registry).Inc()
+		return
+	}
+	m.imagesChecked.WithLabelValues(format).Inc()
+}
+
+// observeUpdates records digests rewritten by a run
+func (m *Metrics) observeUpdates(count int) {
+	if m == nil {
+		return
+	}
+	m.updatesApplied.Add(float64(count))
+}
+
+// observeRun records a completed run
+func (m *Metrics) observeRun(exitCode int) {
+	if m == nil {
+		return
+	}
+	m.runs.WithLabelValues(strconv.Itoa(exitCode)).Inc()
+	m.lastRun.SetToCurrentTime()
+}
+
+// wrapTransport counts rate-limited responses of a registry's transport. Retries inside
+// go-containerregistry hide 429s from callers, so they are counted per response.
+func (m *Metrics) wrapTransport(registry string, next http.RoundTripper) http.RoundTripper {
+	if m == nil {
+		return next
+	}
+	return &metricsTransport{next: next, hits: m.rateLimitHits.WithLabelValues(normalizeRegistry(registry))}
+}
+
+// metricsTransport counts HTTP 429 responses
+type metricsTransport struct {
+	next http.RoundTripper
+	hits prometheus.Counter
+}
+
+// RoundTrip forwards the request and counts rate-limited responses
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		t.hits.Inc()
+	}
+	return resp, err
+}
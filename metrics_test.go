@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics returns the metrics in the Prometheus text format
+func scrapeMetrics(t *testing.T, m *Metrics) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetricsRecordRun(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/app:1.0")
+
+	content := "FROM " + host + "/app:1.0\nFROM " + host + "/missing:1.0\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, out: io.Discard, metrics: NewMetrics()}
+	run.metrics.observeRun(run.run())
+
+	body := scrapeMetrics(t, run.metrics)
+	for _, want := range []string{
+		`containerfile_updater_images_checked_total{format="containerfile"} 1`,
+		`containerfile_updater_updates_applied_total 1`,
+		`containerfile_updater_registry_errors_total{registry="` + host + `"} 1`,
+		`containerfile_updater_fetch_duration_seconds_count{registry="` + host + `"} 2`,
+		`containerfile_updater_runs_total{exit_code="2"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsCountRateLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	m := NewMetrics()
+	client := &http.Client{Transport: m.wrapTransport("registry.example.com", http.DefaultTransport)}
+	for range 2 {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if body := scrapeMetrics(t, m); !strings.Contains(body, `containerfile_updater_rate_limit_hits_total{registry="registry.example.com"} 2`) {
+		t.Errorf("Expected two rate limit hits, got:\n%s", body)
+	}
+
+	// A nil Metrics records nothing and leaves the transport untouched
+	var disabled *Metrics
+	if disabled.wrapTransport("registry.example.com", http.DefaultTransport) != http.DefaultTransport {
+		t.Error("Expected nil metrics to return the transport unchanged")
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// validateMirror checks that a mirror is a registry host with an optional path prefix
+func validateMirror(mirror string) error {
+	if strings.Contains(mirror, "://") {
+		return fmt.Errorf("mirror %q must not include a scheme", mirror)
+	}
+	host, _, _ := strings.Cut(mirror, "/")
+	if _, err := name.NewRegistry(host); err != nil {
+		return fmt.Errorf("invalid mirror %q: %w", mirror, err)
+	}
+	return nil
+}
+
+// mirrorImage returns the registry host and repository an image is served under by its
+// registry's mirror, or an empty host when no mirror is configured
+func (du *ContainerfileUpdater) mirrorImage(image *ImageReference) (string, string) {
+	rc := du.config.Registry(image.Registry)
+	if rc == nil || rc.Mirror == "" {
+		return "", ""
+	}
+	host, prefix, _ := strings.Cut(strings.TrimSuffix(rc.Mirror, "/"), "/")
+	return host, path.Join(prefix, image.Repository)
+}
+
+// copiesToMirror reports whether digests of an image are copied to its registry's mirror
+func (du *ContainerfileUpdater) copiesToMirror(image *ImageReference) bool {
+	rc := du.config.Registry(image.Registry)
+	return rc != nil && rc.Mirror != "" && rc.CopyMirror
+}
+
+// resolveImageDigest resolves the digest of an image through its registry's mirror when one
+// is configured, falling back to the registry itself if the mirror can't answer. A mirror
+// digests are copied to is only as current as the last copy, so the registry is asked.
+func (du *ContainerfileUpdater) resolveImageDigest(ctx context.Context, image *ImageReference) (string, error) {
+	if host, repository := du.mirrorImage(image); host != "" && !du.copiesToMirror(image) {
+		digest, err := du.resolveDigest(ctx, host, fmt.Sprintf("%s/%s:%s", host, repository, image.Tag))
+		if err == nil {
+			return digest, nil
+		}
+		slog.Warn("Mirror lookup failed, falling back to the registry", "image", image.Original, "mirror", host, "error", err)
+	}
+	return du.resolveDigest(ctx, image.Registry, image.TaggedName())
+}
+
+// copyToMirror copies a digest to the image registry's mirror when copyMirror is set and the
+// mirror doesn't have it yet, tagging it with the image's tag, so references written to the
+// mirror always resolve. It returns why the digest can't be pinned, or an empty string.
+// Like crane copy, every platform of an index is copied, but the source and the mirror each
+// get their own credentials and transport.
+func (du *ContainerfileUpdater) copyToMirror(runCtx context.Context, cmd *FromCommand, digest string) string {
+	if du.checkOnly || !du.copiesToMirror(cmd.Image) {
+		return ""
+	}
+	host, repository := du.mirrorImage(cmd.Image)
+	ctx, cancel, err := du.lookupContext(runCtx, host)
+	if err != nil {
+		return fmt.Sprintf("could not check mirror %s: %v", host, err)
+	}
+	_, err = du.resolveDigest(ctx, host, fmt.Sprintf("%s/%s@%s", host, repository, digest))
+	cancel()
+	if err == nil {
+		return ""
+	}
+	if !isNotFound(err) {
+		return fmt.Sprintf("could not check mirror %s: %v", host, err)
+	}
+
+	if err := du.copyImage(runCtx, cmd.Image.Registry, cmd.Image.Name()+"@"+digest, host, fmt.Sprintf("%s/%s:%s", host, repository, cmd.Image.Tag)); err != nil {
+		return fmt.Sprintf("could not copy to mirror %s: %v", host, err)
+	}
+	slog.Info("Copied digest to mirror", "image", cmd.Image.Original, "digest", digest, "mirror", host)
+	return ""
+}
+
+// copyImage copies an image or index with all its platforms from one registry to another.
+// Copying layers can take much longer than a lookup, so only the run's deadline applies.
+func (du *ContainerfileUpdater) copyImage(ctx context.Context, srcRegistry, src, dstRegistry, dst string) error {
+	srcRef, err := name.ParseReference(src, referenceOptions(du.config, srcRegistry)...)
+	if err != nil {
+		return err
+	}
+	dstRef, err := name.ParseReference(dst, referenceOptions(du.config, dstRegistry)...)
+	if err != nil {
+		return err
+	}
+	srcOptions, err := du.remoteOptions(ctx, srcRegistry)
+	if err != nil {
+		return err
+	}
+	dstOptions, err := du.remoteOptions(ctx, dstRegistry)
+	if err != nil {
+		return err
+	}
+
+	descriptor, err := remote.Get(srcRef, srcOptions...)
+	if err != nil {
+		return err
+	}
+	if descriptor.MediaType.IsIndex() {
+		index, err := descriptor.ImageIndex()
+		if err != nil {
+			return err
+		}
+		return remote.WriteIndex(dstRef, index, dstOptions...)
+	}
+	image, err := descriptor.Image()
+	if err != nil {
+		return err
+	}
+	return remote.Write(dstRef, image, dstOptions...)
+}
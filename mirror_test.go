@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorResolution(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	upstream, upstreamHost := newTestRegistry(t, false)
+	mirror, mirrorHost := newTestRegistry(t, false)
+	// Distinct images reveal which registry answered
+	upstreamDigest := pushRandomImage(t, upstream, upstreamHost+"/team/app:1.0")
+	mirrorDigest := pushRandomImage(t, mirror, mirrorHost+"/cache/team/app:1.0")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(upstreamHost).Insecure = true
+	cfg.RegistryOrCreate(upstreamHost).Mirror = mirrorHost + "/cache"
+	cfg.RegistryOrCreate(mirrorHost).Insecure = true
+
+	update := func(t *testing.T) string {
+		t.Helper()
+		containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+		if err := os.WriteFile(containerfilePath, []byte("FROM "+upstreamHost+"/team/app:1.0\n"), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+		updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		content, err := os.ReadFile(containerfilePath)
+		if err != nil {
+			t.Fatalf("Failed to read Containerfile: %v", err)
+		}
+		return string(content)
+	}
+
+	t.Run("Queries the mirror", func(t *testing.T) {
+		expected := "FROM " + upstreamHost + "/team/app@" + mirrorDigest.String() + "\n"
+		if got := update(t); got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("Writes the mirror reference", func(t *testing.T) {
+		cfg.RegistryOrCreate(upstreamHost).WriteMirror = true
+		defer func() { cfg.RegistryOrCreate(upstreamHost).WriteMirror = false }()
+
+		expected := "FROM " + mirrorHost + "/cache/team/app@" + mirrorDigest.String() + "\n"
+		if got := update(t); got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("Falls back to the registry", func(t *testing.T) {
+		mirror.Close()
+		expected := "FROM " + upstreamHost + "/team/app@" + upstreamDigest.String() + "\n"
+		if got := update(t); got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestCopyToMirror(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	upstream, upstreamHost := newTestRegistry(t, false)
+	_, mirrorHost := newTestRegistry(t, false)
+	digest := pushRandomImage(t, upstream, upstreamHost+"/team/app:1.0")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(upstreamHost).Insecure = true
+	cfg.RegistryOrCreate(upstreamHost).Mirror = mirrorHost + "/cache"
+	cfg.RegistryOrCreate(upstreamHost).WriteMirror = true
+	cfg.RegistryOrCreate(upstreamHost).CopyMirror = true
+	cfg.RegistryOrCreate(mirrorHost).Insecure = true
+
+	update := func(checkOnly bool) (string, *ContainerfileUpdater) {
+		t.Helper()
+		containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+		if err := os.WriteFile(containerfilePath, []byte("FROM "+upstreamHost+"/team/app:1.0\n"), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+		updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+		updater.checkOnly = checkOnly
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		content, err := os.ReadFile(containerfilePath)
+		if err != nil {
+			t.Fatalf("Failed to read Containerfile: %v", err)
+		}
+		return string(content), updater
+	}
+	mirrorDigest := func() (string, error) {
+		updater := NewContainerfileUpdaterWithConfig("", cfg)
+		return updater.resolveDigest(context.Background(), mirrorHost, mirrorHost+"/cache/team/app:1.0")
+	}
+
+	// Check runs leave the mirror alone
+	update(true)
+	if _, err := mirrorDigest(); !isNotFound(err) {
+		t.Fatalf("Expected the mirror to be empty after a check, got %v", err)
+	}
+
+	// The digest is copied and tagged before the mirror reference is written
+	expected := "FROM " + mirrorHost + "/cache/team/app@" + digest.String() + "\n"
+	if got, _ := update(false); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got, err := mirrorDigest(); err != nil || got != digest.String() {
+		t.Errorf("Expected the mirror to serve %s, got %q (%v)", digest, got, err)
+	}
+
+	// A failed copy holds the update back
+	cfg.RegistryOrCreate(upstreamHost).Mirror = "127.0.0.1:1/cache"
+	content, updater := update(false)
+	if content != "FROM "+upstreamHost+"/team/app:1.0\n" || !strings.Contains(updater.fromCommands[0].HeldReason, "mirror 127.0.0.1:1") {
+		t.Errorf("Expected the update to be held back, got %q (%q)", content, updater.fromCommands[0].HeldReason)
+	}
+}
+
+func TestValidateMirror(t *testing.T) {
+	for _, mirror := range []string{"mirror.corp:5000", "harbor.corp/dockerhub", "localhost:5000"} {
+		if err := validateMirror(mirror); err != nil {
+			t.Errorf("validateMirror(%q): unexpected error %v", mirror, err)
+		}
+	}
+	for _, mirror := range []string{"https://mirror.corp", "mirror corp"} {
+		if err := validateMirror(mirror); err == nil {
+			t.Errorf("validateMirror(%q): expected error", mirror)
+		}
+	}
+}
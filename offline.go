@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// digestFileVersion is the format version written to digest files
+const digestFileVersion = 1
+
+// DigestSource resolves digests without contacting registries. It stands in for them in
+// offline mode and in the golden-file tests.
+type DigestSource interface {
+	// Lookup returns the digest an image's tag points to
+	Lookup(image *ImageReference) (string, error)
+}
+
+// DigestFile maps image references to digests resolved ahead of time, so updates can run
+// without registry access in air-gapped environments
+type DigestFile struct {
+	Version int               `json:"version"`
+	Digests map[string]string `json:"digests"` // Keyed by registry/repository:tag
+}
+
+// digestKey returns the fully qualified reference an image is looked up by
+func digestKey(image *ImageReference) string {
+	return fmt.Sprintf("%s/%s:%s", image.Registry, image.Repository, image.Tag)
+}
+
+// LoadDigestFile reads a digest file written by export-digests
+func LoadDigestFile(path string) (*DigestFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digest file: %w", err)
+	}
+
+	var digests DigestFile
+	if err := json.Unmarshal(data, &digests); err != nil {
+		return nil, fmt.Errorf("failed to parse digest file %s: %w", path, err)
+	}
+	if digests.Version != digestFileVersion {
+		return nil, fmt.Errorf("unsupported digest file version %d in %s", digests.Version, path)
+	}
+	return &digests, nil
+}
+
+// Lookup returns the recorded digest of an image
+func (d *DigestFile) Lookup(image *ImageReference) (string, error) {
+	digest, ok := d.Digests[digestKey(image)]
+	if !ok {
+		return "", fmt.Errorf("no digest for %s in digest file", digestKey(image))
+	}
+	return digest, nil
+}
+
+// runExportDigests implements the export-digests subcommand
+func runExportDigests(args []string) int {
+	fs := flag.NewFlagSet("export-digests", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	digestFile := fs.String("digest-file", "", "Write the digests to this file instead of stdout")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also export the frontend image of # syntax= directives")
+	scanRun := fs.Bool("scan-run", false, "Also export images pulled inside RUN instructions")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export-digests [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Resolve the digest of every image and write them as JSON for use with --offline --digest-file.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("info"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to update", "error", err)
+		return exitError
+	}
+	if *scanRun {
+		cfg.RunImages.Enabled = true
+	}
+
+	exitCode := exitOK
+	digests := &DigestFile{Version: digestFileVersion, Digests: make(map[string]string)}
+	for _, path := range paths {
+		fileFormat, err := resolveFormat(*format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		exporter := NewContainerfileUpdaterWithConfig(path, cfg)
+		exporter.format = fileFormat
+		exporter.pinSyntax = *pinSyntax
+		if !exporter.exportDigests(digests) {
+			exitCode = exitError
+		}
+	}
+
+	data, err := json.MarshalIndent(digests, "", "  ")
+	if err != nil {
+		slog.Error("Failed to encode digests", "error", err)
+		return exitError
+	}
+	data = append(data, '\n')
+	if *digestFile == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = writeFileAtomic(*digestFile, data)
+	}
+	if err != nil {
+		slog.Error("Failed to write digests", "error", err)
+		return exitError
+	}
+	return exitCode
+}
+
+// exportDigests resolves the digest of every image in the updater's file into digests,
+// reporting whether all of them resolved
+func (du *ContainerfileUpdater) exportDigests(digests *DigestFile) bool {
+	commands, err := du.extractImages()
+	if err != nil {
+		slog.Error("Failed to extract images", "path", du.containerfilePath, "error", err)
+		return false
+	}
+
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	ok := true
+	for _, cmd := range commands {
+		key := digestKey(cmd.Image)
+		if _, done := digests.Digests[key]; done || cmd.SkipReason != "" {
+			continue
+		}
+
+		digest, err := du.exportDigest(runCtx, cmd.Image)
+		if err != nil {
+			slog.Error("Failed to fetch digest", "image", cmd.Image.Original, "error", err)
+			ok = false
+			continue
+		}
+		slog.Debug("Exported digest", "image", key, "digest", digest)
+		digests.Digests[key] = digest
+	}
+	return ok
+}
+
+// exportDigest resolves the digest of one image within the run's context
+func (du *ContainerfileUpdater) exportDigest(runCtx context.Context, image *ImageReference) (string, error) {
+	ctx, cancel, err := du.lookupContext(runCtx, image.Registry)
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+	return du.fetchImageDigest(ctx, image)
+}
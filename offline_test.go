@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportDigestsAndOfflineUpdate(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/app:1.0")
+	db := pushRandomImage(t, server, host+"/db:2.0")
+
+	dir := t.TempDir()
+	containerfile := filepath.Join(dir, "Containerfile")
+	content := "FROM " + host + "/app:1.0\nFROM " + host + "/db:2.0\nFROM " + host + "/app:1.0\n"
+	if err := os.WriteFile(containerfile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	digests := &DigestFile{Version: digestFileVersion, Digests: make(map[string]string)}
+	exporter := NewContainerfileUpdaterWithConfig(containerfile, cfg)
+	if !exporter.exportDigests(digests) {
+		t.Fatal("exportDigests failed")
+	}
+	expected := map[string]string{
+		host + "/app:1.0": app.String(),
+		host + "/db:2.0":  db.String(),
+	}
+	if len(digests.Digests) != len(expected) {
+		t.Errorf("Expected %d digests, got %v", len(expected), digests.Digests)
+	}
+	for key, digest := range expected {
+		if digests.Digests[key] != digest {
+			t.Errorf("Digest of %s: got %s, want %s", key, digests.Digests[key], digest)
+		}
+	}
+
+	// The registry is gone; the update only uses the digest file
+	server.Close()
+	run := &updateRun{paths: []string{containerfile}, cfg: cfg, format: formatAuto, output: outputText,
+		digests: digests, backup: BackupPolicy{Disabled: true}, out: &bytes.Buffer{}}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	data, err := os.ReadFile(containerfile)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	pinned := "FROM " + host + "/app@" + app.String() + "\nFROM " + host + "/db@" + db.String() + "\nFROM " + host + "/app@" + app.String() + "\n"
+	if string(data) != pinned {
+		t.Errorf("Unexpected Containerfile:\n%s\nexpected:\n%s", data, pinned)
+	}
+}
+
+func TestDigestFileLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digests.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1, "digests": {"docker.io/library/alpine:3.20": "sha256:abc"}}`), 0644); err != nil {
+		t.Fatalf("Failed to write digest file: %v", err)
+	}
+	digests, err := LoadDigestFile(path)
+	if err != nil {
+		t.Fatalf("LoadDigestFile failed: %v", err)
+	}
+
+	du := NewContainerfileUpdater("Containerfile")
+	alpine, _ := du.parseImageReference("alpine:3.20")
+	if digest, err := digests.Lookup(alpine); err != nil || digest != "sha256:abc" {
+		t.Errorf("Lookup(alpine:3.20): got %q, %v", digest, err)
+	}
+	debian, _ := du.parseImageReference("debian:12")
+	if _, err := digests.Lookup(debian); err == nil {
+		t.Error("Expected error for an image missing from the digest file")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 3}`), 0644); err != nil {
+		t.Fatalf("Failed to write digest file: %v", err)
+	}
+	if _, err := LoadDigestFile(path); err == nil {
+		t.Error("Expected error for an unknown digest file version")
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// PathPolicy restricts the files an update reads and writes, so running on untrusted
+// content such as a pull request can't overwrite files elsewhere through symbolic links.
+// Besides the rewritten files it covers every output of a run: the lock file, the report,
+// the attestation, signatures, backups and the audit log.
+type PathPolicy struct {
+	Root       string // Directory every file must resolve inside of (anywhere if empty)
+	NoSymlinks bool   // Refuse files reached through a symbolic link
+}
+
+// Validate checks that the root is an existing directory
+func (p PathPolicy) Validate() error {
+	if p.Root == "" {
+		return nil
+	}
+	info, err := os.Stat(p.Root)
+	if err != nil {
+		return fmt.Errorf("root: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("root %s is not a directory", p.Root)
+	}
+	return nil
+}
+
+// check verifies that a file may be updated: it must be a regular file, not be a
+// symbolic link or lie below one when those are refused, and resolve inside the root
+func (p PathPolicy) check(path string) error {
+	if path == stdinPath {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if p.NoSymlinks && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symbolic link, which --no-follow-symlinks refuses", path)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if info, err = os.Stat(target); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return p.contains(path, target)
+}
+
+// checkOutput verifies that an output of the run may be written: an existing file must pass
+// check, and a new one must be created in a directory inside the root, not below a link
+func (p PathPolicy) checkOutput(path string) error {
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		return p.check(path)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	return p.contains(path, filepath.Join(dir, filepath.Base(path)))
+}
+
+// contains verifies that path, resolving to target, lies inside the root, and when links
+// are refused that no link between the root and path redirects it
+func (p PathPolicy) contains(path, target string) error {
+	if p.Root == "" {
+		return nil
+	}
+
+	root, err := filepath.Abs(p.Root)
+	if err != nil {
+		return err
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	if !isWithin(resolvedRoot, target) {
+		return fmt.Errorf("%s resolves to %s, outside of the root %s", path, target, p.Root)
+	}
+	if p.NoSymlinks {
+		// Links between the root and the file change the path it resolves to
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return err
+		}
+		if resolvedRel, _ := filepath.Rel(resolvedRoot, target); rel != resolvedRel {
+			return fmt.Errorf("%s is reached through a symbolic link, which --no-follow-symlinks refuses", path)
+		}
+	}
+	return nil
+}
+
+// writeOutput writes an output of the run, such as the report, once the path policy allows it
+func (r *updateRun) writeOutput(path string, data []byte) error {
+	if err := r.confine.checkOutput(path); err != nil {
+		return fmt.Errorf("refusing to write: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// signOutput signs an output of the run, once the path policy allows writing its signature
+func (r *updateRun) signOutput(path string) (string, error) {
+	signing := r.cfg.Signing
+	if err := r.confine.checkOutput(signing.signaturePath(path)); err != nil {
+		return "", fmt.Errorf("refusing to write: %w", err)
+	}
+	return signing.signFile(path)
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPathPolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	for name, content := range map[string]string{"Containerfile": "FROM alpine\n", "sub/Containerfile": "FROM alpine\n"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"escape.Containerfile": outside,
+		"inside.Containerfile": "Containerfile",
+		"linked":               "sub",
+		"null.Containerfile":   os.DevNull,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		policy PathPolicy
+		path   string
+		err    string
+	}{
+		{PathPolicy{}, "escape.Containerfile", ""},
+		{PathPolicy{}, "null.Containerfile", "not a regular file"},
+		{PathPolicy{}, "sub", "not a regular file"},
+		{PathPolicy{Root: root}, "Containerfile", ""},
+		{PathPolicy{Root: root}, "inside.Containerfile", ""},
+		{PathPolicy{Root: root}, "linked/Containerfile", ""},
+		{PathPolicy{Root: root}, "escape.Containerfile", "outside of the root"},
+		{PathPolicy{NoSymlinks: true}, "inside.Containerfile", "is a symbolic link"},
+		{PathPolicy{NoSymlinks: true}, "linked/Containerfile", ""},
+		{PathPolicy{Root: root, NoSymlinks: true}, "sub/Containerfile", ""},
+		{PathPolicy{Root: root, NoSymlinks: true}, "linked/Containerfile", "reached through a symbolic link"},
+	}
+	for _, tt := range tests {
+		err := tt.policy.check(filepath.Join(root, tt.path))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%+v.check(%s) failed: %v", tt.policy, tt.path, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%+v.check(%s): expected an error containing %q, got %v", tt.policy, tt.path, tt.err, err)
+		}
+	}
+
+	outputs := []struct {
+		policy PathPolicy
+		path   string
+		err    string
+	}{
+		{PathPolicy{Root: root}, "report.json", ""},
+		{PathPolicy{Root: root}, "linked/report.json", ""},
+		{PathPolicy{Root: root}, "escape.Containerfile", "outside of the root"},
+		{PathPolicy{Root: root}, "../report.json", "outside of the root"},
+		{PathPolicy{Root: root, NoSymlinks: true}, "sub/report.json", ""},
+		{PathPolicy{Root: root, NoSymlinks: true}, "linked/report.json", "reached through a symbolic link"},
+		{PathPolicy{NoSymlinks: true}, "inside.Containerfile", "is a symbolic link"},
+	}
+	for _, tt := range outputs {
+		err := tt.policy.checkOutput(filepath.Join(root, tt.path))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%+v.checkOutput(%s) failed: %v", tt.policy, tt.path, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%+v.checkOutput(%s): expected an error containing %q, got %v", tt.policy, tt.path, tt.err, err)
+		}
+	}
+
+	if err := (PathPolicy{Root: outside}).Validate(); err == nil {
+		t.Error("Expected a root that isn't a directory to be rejected")
+	}
+
+	t.Run("Updates leave files outside the root alone", func(t *testing.T) {
+		restore := disableLogging()
+		defer restore()
+		var out strings.Builder
+		run := &updateRun{
+			paths:   []string{filepath.Join(root, "escape.Containerfile")},
+			cfg:     NewConfig(),
+			format:  formatAuto,
+			output:  outputJSON,
+			backup:  BackupPolicy{Disabled: true},
+			confine: PathPolicy{Root: root},
+			out:     &out,
+		}
+		if exitCode := run.run(); exitCode != exitError {
+			t.Errorf("Expected exit code %d, got %d", exitError, exitCode)
+		}
+		if !strings.Contains(out.String(), "outside of the root") {
+			t.Errorf("Expected the file to be refused, got %s", out.String())
+		}
+		if data, _ := os.ReadFile(outside); string(data) != "FROM alpine\n" {
+			t.Errorf("Expected the file outside the root to be untouched, got %q", data)
+		}
+	})
+
+	t.Run("Outputs stay inside the root", func(t *testing.T) {
+		restore := disableLogging()
+		defer restore()
+		// Nothing to update, so only the outputs are written
+		path := filepath.Join(root, "scratch.Containerfile")
+		if err := os.WriteFile(path, []byte("FROM scratch\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		report := filepath.Join(filepath.Dir(outside), "report.json")
+		lock := filepath.Join(filepath.Dir(outside), defaultLockFile)
+		for _, run := range []*updateRun{{report: report}, {lockFile: lock}} {
+			run.paths = []string{path}
+			run.cfg = NewConfig()
+			run.format = formatAuto
+			run.output = outputText
+			run.backup = BackupPolicy{Disabled: true}
+			run.confine = PathPolicy{Root: root}
+			run.out = io.Discard
+			if exitCode := run.run(); exitCode != exitError {
+				t.Errorf("Expected exit code %d, got %d", exitError, exitCode)
+			}
+		}
+		for _, output := range []string{report, lock} {
+			if _, err := os.Stat(output); err == nil {
+				t.Errorf("Expected %s outside the root not to be written", filepath.Base(output))
+			}
+		}
+
+		backupDir := filepath.Join(filepath.Dir(outside), "backups")
+		if _, err := (BackupPolicy{Dir: backupDir}).create(path, time.Now(), PathPolicy{Root: root}); err == nil || !strings.Contains(err.Error(), "outside of the root") {
+			t.Errorf("Expected the backup outside the root to be refused, got %v", err)
+		}
+	})
+
+	t.Run("Backups don't follow planted links", func(t *testing.T) {
+		src := filepath.Join(root, "Containerfile")
+		if err := os.Symlink(outside, src+".backup"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (BackupPolicy{}).create(src, time.Now(), PathPolicy{}); err == nil {
+			t.Error("Expected the backup through a symbolic link to be refused")
+		}
+	})
+}
@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// checkPinAge warns about a pin older than the maximum pin age of its cooldown rule, going
+// by the creation time of the image. Following the tag can't renew such a pin once its
+// tag stops moving, so the highest tag of the same version scheme is proposed instead.
+func (du *ContainerfileUpdater) checkPinAge(ctx context.Context, cmd *FromCommand, digest string) {
+	i := du.cooldown.ruleFor(cmd.Image)
+	if i < 0 || du.cooldown.maxPinAges[i] == 0 || digest == "" {
+		return
+	}
+	created, err := du.imageCreated(ctx, cmd, digest)
+	if err != nil {
+		slog.Warn("Failed to check pin age", "image", cmd.Image.Original, "error", err)
+		return
+	}
+	age := time.Since(created)
+	if !du.cooldown.expired(i, age) {
+		return
+	}
+	cmd.ExpiredPin = formatAge(age)
+
+	if du.digests == nil && cmd.Image.Tag != "" {
+		tags, err := du.listTags(ctx, cmd.Image)
+		if err != nil {
+			slog.Debug("Failed to list tags for a newer pin", "image", cmd.Image.Original, "error", err)
+		} else if latest := latestTag(cmd.Image.Tag, tags); latest != cmd.Image.Tag {
+			cmd.ProposedTag = latest
+		}
+	}
+	slog.Warn("Pinned image is older than the maximum pin age", "image", cmd.Image.Original, "digest", digest,
+		"age", cmd.ExpiredPin, "maxPinAge", du.cooldown.rules[i].MaxPinAge, "proposedTag", cmd.ProposedTag)
+}
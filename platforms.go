@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Actions taken when a candidate digest lacks a required platform
+const (
+	platformActionHold  = "hold"  // Keep the current pin (default)
+	platformActionWarn  = "warn"  // Pin the digest anyway and report the missing platforms
+	platformActionError = "error" // Fail the image, checking every resolved digest rather than only updates
+)
+
+// PlatformConfig lists the platforms every candidate digest must provide, so an upstream
+// that stops publishing an architecture doesn't silently break those builds
+type PlatformConfig struct {
+	Require   []string       `yaml:"require"`   // Platforms such as linux/amd64 and linux/arm64/v8
+	Action    string         `yaml:"action"`    // hold (default), warn or error
+	CheckFrom bool           `yaml:"checkFrom"` // Also require the fixed --platform of a FROM when nothing is configured
+	Files     []PlatformFile `yaml:"files"`     // Files built for one platform, pinned to its manifest
+}
+
+// PlatformFile maps the files of a split build, such as Containerfile.arm64, to the platform
+// they are built for, so their images are pinned to that platform's manifest rather than
+// the index every platform shares
+type PlatformFile struct {
+	Path     string `yaml:"path"`     // Pattern of the files, as in envFiles, e.g. *.arm64
+	Platform string `yaml:"platform"` // Platform such as linux/arm64
+}
+
+// validatePlatformConfig rejects unparseable platforms and unknown actions
+func validatePlatformConfig(cfg PlatformConfig) error {
+	for _, platform := range cfg.Require {
+		if err := validatePlatform(platform); err != nil {
+			return err
+		}
+	}
+	for _, file := range cfg.Files {
+		if _, err := compileEnvFilePatterns([]string{file.Path}); err != nil || file.Path == "" {
+			return fmt.Errorf("invalid platform file pattern %q", file.Path)
+		}
+		if err := validatePlatform(file.Platform); err != nil {
+			return fmt.Errorf("platform file %s: %w", file.Path, err)
+		}
+	}
+	switch cfg.Action {
+	case "", platformActionHold, platformActionWarn, platformActionError:
+		return nil
+	}
+	return fmt.Errorf("unknown platform action %q (expected %s, %s or %s)", cfg.Action, platformActionHold, platformActionWarn, platformActionError)
+}
+
+// validatePlatform rejects platforms that aren't in the os/arch[/variant] form
+func validatePlatform(platform string) error {
+	if _, err := v1.ParsePlatform(platform); err != nil || !strings.Contains(platform, "/") {
+		return fmt.Errorf("invalid platform %q (expected os/arch[/variant])", platform)
+	}
+	return nil
+}
+
+// filePlatform returns the platform of the first platform file pattern matching a path,
+// relative to the working directory, or an empty string for files built for every platform
+func filePlatform(path string, cfg *Config) string {
+	for _, file := range cfg.Platforms.Files {
+		if isEnvFile(path, []string{file.Path}) {
+			return file.Platform
+		}
+	}
+	return ""
+}
+
+// pinnedPlatform returns the platform whose manifest an image is pinned to, or an empty
+// string to pin the index. In a platform file a FROM with a fixed --platform is pinned for
+// that platform, while one using a variable such as $BUILDPLATFORM keeps the index, as it
+// may run on any platform.
+func (du *ContainerfileUpdater) pinnedPlatform(cmd *FromCommand) string {
+	if du.platform == "" {
+		return ""
+	}
+	if cmd.Platform != "" {
+		if strings.Contains(cmd.Platform, "$") {
+			return ""
+		}
+		return cmd.Platform
+	}
+	return du.platform
+}
+
+// platformDigest returns the digest of a platform's manifest within an index. A digest of a
+// single image is returned as it is.
+func (du *ContainerfileUpdater) platformDigest(ctx context.Context, image *ImageReference, digest, platform string) (string, error) {
+	want, err := v1.ParsePlatform(platform)
+	if err != nil {
+		return "", err
+	}
+	manifests, isIndex, err := du.indexManifests(ctx, image, digest)
+	if err != nil {
+		return "", err
+	}
+	if !isIndex {
+		return digest, nil
+	}
+	for _, child := range manifests {
+		if child.Platform != nil && platformAvailable(*want, []v1.Platform{*child.Platform}) {
+			return child.Digest.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%s@%s has no manifest for %s", image.Name(), digest, platform)
+}
+
+// indexManifests returns the manifests listed by the index a digest points to, and whether
+// it is an index at all
+func (du *ContainerfileUpdater) indexManifests(ctx context.Context, image *ImageReference, digest string) ([]v1.Descriptor, bool, error) {
+	raw, err := du.fetchManifest(ctx, image, digest, false)
+	if err != nil {
+		return nil, false, err
+	}
+	var manifest struct {
+		MediaType types.MediaType `json:"mediaType"`
+		Manifests []v1.Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, false, fmt.Errorf("failed to read manifest %s@%s: %w", image.Name(), digest, err)
+	}
+	// The media type is optional in OCI indexes
+	isIndex := manifest.MediaType.IsIndex() || manifest.MediaType == "" && manifest.Manifests != nil
+	return manifest.Manifests, isIndex, nil
+}
+
+// fetchManifest returns the raw manifest of a digest, or with config the raw config of a
+// single image. It goes through the same backend as the image's digests: skopeo for
+// registries using it, and the registry's shared puller, or anonymous access after its
+// credentials were rejected, otherwise. Offline runs and registries resolved by a plugin
+// only provide digests.
+func (du *ContainerfileUpdater) fetchManifest(ctx context.Context, image *ImageReference, digest string, config bool) ([]byte, error) {
+	if du.digests != nil {
+		return nil, fmt.Errorf("reading the manifest of %s needs registry access", image.Original)
+	}
+	if plugin, ok := pluginFetchers[image.Registry]; ok {
+		return nil, fmt.Errorf("registry %s is resolved by plugin %s, which only provides digests", image.Registry, plugin.name)
+	}
+	fullRef := image.Name() + "@" + digest
+	if registryResolver(du.config, image.Registry) == resolverSkopeo {
+		return du.skopeoInspect(ctx, image.Registry, fullRef, config)
+	}
+
+	ref, err := name.NewDigest(fullRef, referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reference %s: %w", fullRef, err)
+	}
+	var options []remote.Option
+	if du.anonymous[image.Registry] {
+		options, err = du.anonymousOptions(ctx, image.Registry)
+	} else {
+		options, err = du.remoteOptions(ctx, image.Registry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config {
+		img, err := remote.Image(ref, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+		}
+		raw, err := img.RawConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config of %s: %w", ref, err)
+		}
+		return raw, nil
+	}
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	return desc.Manifest, nil
+}
+
+// requiredPlatforms returns the platforms an image must provide: the --platform of its FROM
+// when that is fixed, the configured ones otherwise
+func (du *ContainerfileUpdater) requiredPlatforms(cmd *FromCommand) []string {
+	platforms := du.config.Platforms
+	if cmd.Platform != "" && !strings.Contains(cmd.Platform, "$") && (len(platforms.Require) > 0 || platforms.CheckFrom) {
+		return []string{cmd.Platform}
+	}
+	return platforms.Require
+}
+
+// missingPlatforms records the required platforms a digest lacks on the command
+func (du *ContainerfileUpdater) missingPlatforms(ctx context.Context, cmd *FromCommand, digest string, required []string) error {
+	available, err := du.digestPlatforms(ctx, cmd.Image, digest)
+	if err != nil {
+		return err
+	}
+
+	cmd.MissingPlatforms = nil
+	for _, platform := range required {
+		want, err := v1.ParsePlatform(platform)
+		if err != nil {
+			continue
+		}
+		if !platformAvailable(*want, available) {
+			cmd.MissingPlatforms = append(cmd.MissingPlatforms, platform)
+		}
+	}
+	return nil
+}
+
+// verifyPlatforms fails a resolved digest lacking a required platform in error mode, where
+// pinning it would only break the builds on those platforms. Unlike the hold and warn modes
+// it checks digests that didn't change too.
+func (du *ContainerfileUpdater) verifyPlatforms(ctx context.Context, cmd *FromCommand, digest string) error {
+	if du.config.Platforms.Action != platformActionError {
+		return nil
+	}
+	required := du.requiredPlatforms(cmd)
+	if len(required) == 0 {
+		return nil
+	}
+	if err := du.missingPlatforms(ctx, cmd, digest, required); err != nil {
+		return fmt.Errorf("could not check platforms: %w", err)
+	}
+	if len(cmd.MissingPlatforms) > 0 {
+		return fmt.Errorf("%s (%s) lacks required platforms: %s", cmd.Image.Original, digest, strings.Join(cmd.MissingPlatforms, ", "))
+	}
+	return nil
+}
+
+// checkPlatforms holds back an update whose candidate digest lacks a required platform, or
+// only reports it in warn mode. It returns the reason the update was held, or an empty string.
+func (du *ContainerfileUpdater) checkPlatforms(ctx context.Context, cmd *FromCommand, digest string) string {
+	required := du.requiredPlatforms(cmd)
+	if len(required) == 0 || du.config.Platforms.Action == platformActionError {
+		return ""
+	}
+	if err := du.missingPlatforms(ctx, cmd, digest, required); err != nil {
+		return fmt.Sprintf("could not check platforms: %v", err)
+	}
+	if len(cmd.MissingPlatforms) == 0 {
+		return ""
+	}
+
+	reason := "missing platforms: " + strings.Join(cmd.MissingPlatforms, ", ")
+	if du.config.Platforms.Action == platformActionWarn {
+		slog.Warn("New digest drops required platforms", "image", cmd.Image.Original, "digest", digest, "platforms", cmd.MissingPlatforms)
+		return ""
+	}
+	return reason
+}
+
+// platformAvailable reports whether a platform is provided, treating an unset variant as
+// matching any variant
+func platformAvailable(want v1.Platform, available []v1.Platform) bool {
+	for _, platform := range available {
+		if platform.OS == want.OS && platform.Architecture == want.Architecture &&
+			(want.Variant == "" || platform.Variant == want.Variant) {
+			return true
+		}
+	}
+	return false
+}
+
+// digestPlatforms returns the platforms of an index, or the platform of a single image
+func (du *ContainerfileUpdater) digestPlatforms(ctx context.Context, image *ImageReference, digest string) ([]v1.Platform, error) {
+	manifests, isIndex, err := du.indexManifests(ctx, image, digest)
+	if err != nil {
+		return nil, err
+	}
+	if isIndex {
+		var platforms []v1.Platform
+		for _, child := range manifests {
+			if child.Platform != nil {
+				platforms = append(platforms, *child.Platform)
+			}
+		}
+		return platforms, nil
+	}
+
+	raw, err := du.fetchManifest(ctx, image, digest, true)
+	if err != nil {
+		return nil, err
+	}
+	config, err := v1.ParseConfigFile(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config of %s@%s: %w", image.Name(), digest, err)
+	}
+	return []v1.Platform{{OS: config.OS, Architecture: config.Architecture, Variant: config.Variant}}, nil
+}
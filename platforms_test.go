@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestRequiredPlatforms(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	transport := server.Client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// The index only provides amd64 and arm/v7
+	var addenda []mutate.IndexAddendum
+	for _, platform := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm", Variant: "v7"}} {
+		img, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatalf("Failed to create random image: %v", err)
+		}
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &platform}})
+	}
+	index := mutate.AppendManifests(empty.Index, addenda...)
+	ref, err := name.ParseReference(host+"/base:1.0", name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	if err := remote.WriteIndex(ref, index, remote.WithTransport(transport)); err != nil {
+		t.Fatalf("Failed to push index: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		from        string
+		platforms   PlatformConfig
+		wantHeld    string
+		wantErr     string
+		wantMissing []string
+	}{
+		{name: "no requirement", from: "FROM " + host + "/base:1.0"},
+		{name: "all provided", from: "FROM " + host + "/base:1.0", platforms: PlatformConfig{Require: []string{"linux/amd64", "linux/arm"}}},
+		{name: "dropped architecture", from: "FROM " + host + "/base:1.0", platforms: PlatformConfig{Require: []string{"linux/amd64", "linux/arm64"}},
+			wantHeld: "missing platforms: linux/arm64", wantMissing: []string{"linux/arm64"}},
+		{name: "wrong variant", from: "FROM " + host + "/base:1.0", platforms: PlatformConfig{Require: []string{"linux/arm/v6"}},
+			wantHeld: "missing platforms: linux/arm/v6", wantMissing: []string{"linux/arm/v6"}},
+		{name: "warn only", from: "FROM " + host + "/base:1.0", platforms: PlatformConfig{Require: []string{"linux/arm64"}, Action: platformActionWarn},
+			wantMissing: []string{"linux/arm64"}},
+		{name: "FROM platform narrows the requirement", from: "FROM --platform=linux/amd64 " + host + "/base:1.0", platforms: PlatformConfig{Require: []string{"linux/arm64"}}},
+		{name: "error mode fails the image", from: "FROM " + host + "/base:1.0", platforms: PlatformConfig{Require: []string{"linux/arm64"}, Action: platformActionError},
+			wantErr: "lacks required platforms: linux/arm64", wantMissing: []string{"linux/arm64"}},
+		{name: "FROM platform checked on its own", from: "FROM --platform=linux/s390x " + host + "/base:1.0", platforms: PlatformConfig{CheckFrom: true, Action: platformActionError},
+			wantErr: "lacks required platforms: linux/s390x", wantMissing: []string{"linux/s390x"}},
+		{name: "FROM platform provided", from: "FROM --platform=linux/arm/v7 " + host + "/base:1.0", platforms: PlatformConfig{CheckFrom: true, Action: platformActionError}},
+		{name: "variable FROM platform not checked", from: "FROM --platform=$BUILDPLATFORM " + host + "/base:1.0", platforms: PlatformConfig{CheckFrom: true, Action: platformActionError}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			cfg.Platforms = tt.platforms
+
+			containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(containerfilePath, []byte(tt.from+"\n"), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+			updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+			if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			cmd := updater.fromCommands[0]
+			if tt.wantHeld == "" && cmd.HeldReason != "" {
+				t.Errorf("Update held: %s", cmd.HeldReason)
+			}
+			if tt.wantHeld != "" && !strings.Contains(cmd.HeldReason, tt.wantHeld) {
+				t.Errorf("Held reason = %q, want it to contain %q", cmd.HeldReason, tt.wantHeld)
+			}
+			if tt.wantErr == "" && cmd.Err != nil {
+				t.Errorf("Unexpected error: %v", cmd.Err)
+			}
+			if tt.wantErr != "" && (cmd.Err == nil || !strings.Contains(cmd.Err.Error(), tt.wantErr) || cmd.Image.Digest != "") {
+				t.Errorf("Expected an error containing %q and no pin, got %v and %q", tt.wantErr, cmd.Err, cmd.Image.Digest)
+			}
+			if !slices.Equal(cmd.MissingPlatforms, tt.wantMissing) {
+				t.Errorf("MissingPlatforms = %v, want %v", cmd.MissingPlatforms, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestPlatformFiles(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	transport := server.Client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	var addenda []mutate.IndexAddendum
+	for _, platform := range []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64", Variant: "v8"}} {
+		img, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatalf("Failed to create random image: %v", err)
+		}
+		addenda = append(addenda, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &platform}})
+	}
+	index := mutate.AppendManifests(empty.Index, addenda...)
+	ref, err := name.ParseReference(host+"/base:1.0", name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+	if err := remote.WriteIndex(ref, index, remote.WithTransport(transport)); err != nil {
+		t.Fatalf("Failed to push index: %v", err)
+	}
+	indexDigest, err := index.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Chdir(t.TempDir())
+	content := "FROM --platform=$BUILDPLATFORM " + host + "/base:1.0 AS build\nFROM " + host + "/base:1.0\n"
+	for _, path := range []string{"Containerfile.amd64", "Containerfile.arm64", "Containerfile"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Platforms.Files = []PlatformFile{{Path: "*.amd64", Platform: "linux/amd64"}, {Path: "*.arm64", Platform: "linux/arm64"}}
+
+	for path, want := range map[string]v1.Hash{
+		"Containerfile.amd64": manifest.Manifests[0].Digest,
+		"Containerfile.arm64": manifest.Manifests[1].Digest,
+		"Containerfile":       indexDigest,
+	} {
+		updater := NewContainerfileUpdaterWithConfig(path, cfg)
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update of %s failed: %v", path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The build stage runs on the build platform, so it keeps the index
+		expected := "FROM --platform=$BUILDPLATFORM " + host + "/base@" + indexDigest.String() + " AS build\nFROM " + host + "/base@" + want.String() + "\n"
+		if string(data) != expected {
+			t.Errorf("%s:\n%s\nexpected:\n%s", path, data, expected)
+		}
+
+		results, err := NewContainerfileUpdaterWithConfig(path, cfg).VerifyPinnedDigests()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, result := range results {
+			if result.Status != verifyOK {
+				t.Errorf("Expected the pins of %s to verify, got %s: %s", path, result.Status, result.Detail)
+			}
+		}
+	}
+}
+
+func TestValidatePlatformConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     PlatformConfig
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "platforms", cfg: PlatformConfig{Require: []string{"linux/amd64", "linux/arm64/v8"}, Action: platformActionWarn}},
+		{name: "missing architecture", cfg: PlatformConfig{Require: []string{"linux"}}, wantErr: true},
+		{name: "error action", cfg: PlatformConfig{CheckFrom: true, Action: platformActionError}},
+		{name: "unknown action", cfg: PlatformConfig{Action: "fail"}, wantErr: true},
+		{name: "platform files", cfg: PlatformConfig{Files: []PlatformFile{{Path: "*.arm64", Platform: "linux/arm64"}}}},
+		{name: "platform file without a pattern", cfg: PlatformConfig{Files: []PlatformFile{{Platform: "linux/arm64"}}}, wantErr: true},
+		{name: "platform file without an architecture", cfg: PlatformConfig{Files: []PlatformFile{{Path: "*.arm64", Platform: "arm64"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePlatformConfig(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validatePlatformConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlatformsThroughResolver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake skopeo needs a Unix shell")
+	}
+	amd64 := "sha256:" + strings.Repeat("a", 64)
+	arm64 := "sha256:" + strings.Repeat("b", 64)
+	index := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + amd64 + `","size":1,"platform":{"os":"linux","architecture":"amd64"}},` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + arm64 + `","size":1,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "skopeo")
+	argsFile := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\nprintf '%s' '" + index + "'\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(command string) { skopeoCommand = command }(skopeoCommand)
+	skopeoCommand = fake
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate("harbor.example").Resolver = resolverSkopeo
+	updater := NewContainerfileUpdaterWithConfig("Containerfile", cfg)
+	image := &ImageReference{Registry: "harbor.example", Repository: "team/app", Tag: "1.0", Original: "harbor.example/team/app:1.0"}
+	digest := "sha256:" + strings.Repeat("c", 64)
+
+	// Manifests of registries resolved with skopeo are read with skopeo too
+	if got, err := updater.platformDigest(t.Context(), image, digest, "linux/arm64"); err != nil || got != arm64 {
+		t.Errorf("platformDigest() = %s, %v, want %s", got, err, arm64)
+	}
+	platforms, err := updater.digestPlatforms(t.Context(), image, digest)
+	if err != nil || len(platforms) != 2 || platforms[1].Architecture != "arm64" {
+		t.Errorf("digestPlatforms() = %v, %v", platforms, err)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil || strings.Count(string(args), "docker://harbor.example/team/app@"+digest) != 2 {
+		t.Errorf("Expected both lookups through skopeo, got %q", args)
+	}
+
+	// Plugins only resolve digests
+	pluginFetchers["plugin.example"] = &plugin{name: "example"}
+	defer delete(pluginFetchers, "plugin.example")
+	image = &ImageReference{Registry: "plugin.example", Repository: "app", Tag: "1.0", Original: "plugin.example/app:1.0"}
+	if _, err := updater.digestPlatforms(t.Context(), image, digest); err == nil || !strings.Contains(err.Error(), "plugin example") {
+		t.Errorf("Expected the plugin registry to be refused, got %v", err)
+	}
+}
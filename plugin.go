@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pluginPrefix starts the name of every plugin executable found on PATH
+const pluginPrefix = "containerfile-updater-plugin-"
+
+// pluginProtocol is the version of the JSON protocol sent to plugins
+const pluginProtocol = 1
+
+// pluginDescribeTimeout bounds how long a plugin may take to describe itself when loaded
+const pluginDescribeTimeout = 10 * time.Second
+
+// Plugin methods
+const (
+	pluginDescribe = "describe" // What the plugin handles
+	pluginList     = "list"     // Images of a file in one of the plugin's formats
+	pluginResolve  = "resolve"  // Digest of a reference on one of the plugin's registries
+)
+
+// PluginRequest is written as JSON to a plugin's stdin, one request per run
+type PluginRequest struct {
+	Protocol  int    `json:"protocol"`
+	Method    string `json:"method"`
+	Format    string `json:"format,omitempty"`    // list: format the file was detected as
+	Path      string `json:"path,omitempty"`      // list: file being updated
+	Content   string `json:"content,omitempty"`   // list: content of the file
+	Reference string `json:"reference,omitempty"` // resolve: tag or digest reference to resolve
+}
+
+// PluginResponse is read as JSON from a plugin's stdout
+type PluginResponse struct {
+	Error      string         `json:"error,omitempty"`
+	Formats    []PluginFormat `json:"formats,omitempty"`    // describe: file formats handled
+	Registries []string       `json:"registries,omitempty"` // describe: registry hosts resolved
+	Images     []PluginImage  `json:"images,omitempty"`     // list: images found
+	Digest     string         `json:"digest,omitempty"`     // resolve: manifest digest
+}
+
+// PluginFormat is a file format a plugin lists images of
+type PluginFormat struct {
+	Name     string   `json:"name"`     // --format value
+	Patterns []string `json:"patterns"` // .gitignore-style patterns of the files in the format
+}
+
+// PluginImage is an image a plugin found, located by its 1-based line and byte column.
+// The updater rewrites the reference at that position itself.
+type PluginImage struct {
+	Reference string `json:"reference"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+}
+
+// plugin is an executable speaking the plugin protocol
+type plugin struct {
+	name string
+	path string
+}
+
+// pluginFetchers are the plugins resolving digests, keyed by registry host
+var pluginFetchers = map[string]*plugin{}
+
+// call runs the plugin with a request and decodes its response
+func (p *plugin) call(ctx context.Context, request PluginRequest) (*PluginResponse, error) {
+	request.Protocol = pluginProtocol
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, p.path)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, fmt.Errorf("plugin %s failed to %s: %w", p.name, request.Method, err)
+	}
+
+	var response PluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("plugin %s returned invalid JSON for %s: %w", p.name, request.Method, err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("plugin %s failed to %s: %s", p.name, request.Method, response.Error)
+	}
+	return &response, nil
+}
+
+// resolve asks the plugin for the digest of a reference
+func (p *plugin) resolve(ctx context.Context, reference string) (string, error) {
+	response, err := p.call(ctx, PluginRequest{Method: pluginResolve, Reference: reference})
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(response.Digest, "sha256:") {
+		return "", fmt.Errorf("plugin %s returned invalid digest %q for %s", p.name, response.Digest, reference)
+	}
+	return response.Digest, nil
+}
+
+// findPlugins returns the plugin executables in the directories of a PATH value. The first
+// one found wins when several directories hold a plugin of the same name.
+func findPlugins(pathList string) []*plugin {
+	var plugins []*plugin
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(pathList) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), pluginPrefix)
+			if !ok || name == "" || entry.IsDir() {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				if name, ok = strings.CutSuffix(name, ".exe"); !ok {
+					continue
+				}
+			} else if info, err := entry.Info(); err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, &plugin{name: name, path: filepath.Join(dir, entry.Name())})
+		}
+	}
+	return plugins
+}
+
+// Plugins on PATH, loaded by the first command that needs them
+var (
+	pluginsOnce   sync.Once
+	pluginFormats int // Formats the plugins on PATH registered
+)
+
+// usePlugins loads the plugins on PATH for a command that reads files or resolves digests.
+// It is called once logging is configured, so commands that need neither never run a
+// plugin. It returns the number of formats the plugins added.
+func usePlugins() int {
+	pluginsOnce.Do(func() {
+		pluginFormats = loadPlugins(os.Getenv("PATH"))
+	})
+	return pluginFormats
+}
+
+// loadPlugins describes the plugins on PATH and registers their formats and registries,
+// returning the number of formats registered. A plugin that fails to describe itself is
+// skipped with a warning.
+func loadPlugins(pathList string) int {
+	formats := 0
+	for _, p := range findPlugins(pathList) {
+		ctx, cancel := context.WithTimeout(context.Background(), pluginDescribeTimeout)
+		response, err := p.call(ctx, PluginRequest{Method: pluginDescribe})
+		cancel()
+		if err != nil {
+			slog.Warn("Ignoring plugin", "plugin", p.path, "error", err)
+			continue
+		}
+
+		for _, format := range response.Formats {
+			fu, err := newPluginFormat(p, format)
+			if err == nil {
+				if _, exists := lookupFileUpdater(format.Name); exists || format.Name == formatAuto {
+					err = fmt.Errorf("format %q already exists", format.Name)
+				}
+			}
+			if err != nil {
+				slog.Warn("Ignoring plugin format", "plugin", p.name, "error", err)
+				continue
+			}
+			RegisterFileUpdater(fu)
+			formats++
+		}
+		for _, registry := range response.Registries {
+			if existing, ok := pluginFetchers[registry]; ok {
+				slog.Warn("Ignoring plugin registry", "plugin", p.name, "registry", registry, "error", fmt.Sprintf("already resolved by %s", existing.name))
+				continue
+			}
+			pluginFetchers[registry] = p
+		}
+		slog.Debug("Loaded plugin", "plugin", p.path, "formats", len(response.Formats), "registries", response.Registries)
+	}
+	return formats
+}
+
+// pluginFormat is a FileUpdater whose files are listed by a plugin
+type pluginFormat struct {
+	plugin   *plugin
+	name     string
+	patterns []ignoreRule
+}
+
+// newPluginFormat validates a format described by a plugin
+func newPluginFormat(p *plugin, format PluginFormat) (*pluginFormat, error) {
+	if format.Name == "" || len(format.Patterns) == 0 {
+		return nil, fmt.Errorf("format needs a name and file patterns")
+	}
+	patterns, err := compileEnvFilePatterns(format.Patterns)
+	if err != nil {
+		return nil, fmt.Errorf("format %s: %w", format.Name, err)
+	}
+	return &pluginFormat{plugin: p, name: format.Name, patterns: patterns}, nil
+}
+
+func (f *pluginFormat) Name() string {
+	return f.name
+}
+
+func (f *pluginFormat) Detect(path string) bool {
+	display := displayPath(path)
+	for _, pattern := range f.patterns {
+		if pattern.re.MatchString(display) {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginDocument is a file handed to a plugin to list its images
+type pluginDocument struct {
+	path    string
+	content []byte
+}
+
+func (f *pluginFormat) Parse(path string, content []byte) (any, error) {
+	return &pluginDocument{path: path, content: content}, nil
+}
+
+func (f *pluginFormat) ListImages(du *ContainerfileUpdater, parsed any) ([]*FromCommand, error) {
+	doc := parsed.(*pluginDocument)
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+	// Listing gets the time of one lookup, so a hung plugin can't stall the run
+	ctx, cancel := context.WithTimeout(runCtx, du.timeout)
+	defer cancel()
+	response, err := f.plugin.call(ctx, PluginRequest{Method: pluginList, Format: f.name, Path: doc.path, Content: string(doc.content)})
+	if err != nil {
+		return nil, err
+	}
+
+	lines, _ := splitLines(string(doc.content))
+	var images []*FromCommand
+	for _, found := range response.Images {
+		start := found.Column - 1
+		if found.Line < 1 || found.Line > len(lines) || start < 0 || !strings.HasPrefix(lines[found.Line-1][min(start, len(lines[found.Line-1])):], found.Reference) {
+			slog.Warn("Ignoring image at a position that doesn't hold it", "plugin", f.plugin.name, "line", found.Line, "column", found.Column, "image", found.Reference)
+			continue
+		}
+		image, err := du.parseImageReference(found.Reference)
+		if err != nil {
+			slog.Warn("Failed to parse image", "plugin", f.plugin.name, "line", found.Line, "error", err)
+			continue
+		}
+		cmd := &FromCommand{
+			Image:       image,
+			LineStart:   found.Line,
+			LineEnd:     found.Line,
+			Annotations: commentAnnotations(lines, found.Line, "#", "//"),
+			editor:      spanEditor(start),
+		}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images, nil
+}
+
+func (f *pluginFormat) Rewrite(lines []string, cmd *FromCommand) ([]string, bool) {
+	return cmd.editor(lines, cmd)
+}
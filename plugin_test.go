@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pluginDigest is the digest the test plugin resolves every reference to
+const pluginDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+// writeTestPlugin writes a shell script plugin handling .imgs files, whose images are on
+// the first line, and resolving the registry.internal.example registry
+func writeTestPlugin(t *testing.T, dir, name string) string {
+	t.Helper()
+	script := `#!/bin/sh
+request=$(cat)
+case "$request" in
+*'"method":"describe"'*)
+	echo '{"formats":[{"name":"image-set","patterns":["*.imgs"]}],"registries":["registry.internal.example"]}' ;;
+*'"method":"list"'*)
+	echo '{"images":[{"reference":"registry.internal.example/app:1.0","line":1,"column":7}]}' ;;
+*'"method":"resolve"'*)
+	echo '{"digest":"` + pluginDigest + `"}' ;;
+*)
+	echo '{"error":"unknown method"}' ;;
+esac
+`
+	path := filepath.Join(dir, pluginPrefix+name)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	return path
+}
+
+func TestFindPlugins(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell script plugins need a Unix shell")
+	}
+	first, second := t.TempDir(), t.TempDir()
+	want := writeTestPlugin(t, first, "images")
+	writeTestPlugin(t, second, "images")
+	writeTestPlugin(t, second, "other")
+	if err := os.WriteFile(filepath.Join(second, pluginPrefix+"notes"), []byte("text"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	plugins := findPlugins(strings.Join([]string{first, second, filepath.Join(first, "missing")}, string(os.PathListSeparator)))
+	var names []string
+	for _, p := range plugins {
+		names = append(names, p.name)
+	}
+	if strings.Join(names, ",") != "images,other" {
+		t.Fatalf("findPlugins() = %v, want the executable plugins once each", names)
+	}
+	if plugins[0].path != want {
+		t.Errorf("Plugin path = %s, want the first on PATH %s", plugins[0].path, want)
+	}
+}
+
+func TestPluginFormatAndRegistry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell script plugins need a Unix shell")
+	}
+	restore := disableLogging()
+	defer restore()
+	builtin := fileUpdaters
+	defer func() { fileUpdaters = builtin; pluginFetchers = map[string]*plugin{} }()
+
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "images")
+	loadPlugins(dir)
+	if got := detectFormat("deploy/prod.imgs"); got != "image-set" {
+		t.Fatalf("detectFormat() = %q, want the plugin's format", got)
+	}
+	if _, ok := pluginFetchers["registry.internal.example"]; !ok {
+		t.Fatal("Plugin registry not registered")
+	}
+
+	path := filepath.Join(t.TempDir(), "prod.imgs")
+	if err := os.WriteFile(path, []byte("image registry.internal.example/app:1.0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write image set: %v", err)
+	}
+	updater := NewContainerfileUpdaterWithConfig(path, NewConfig())
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read image set: %v", err)
+	}
+	if want := "image registry.internal.example/app@" + pluginDigest + "\n"; string(data) != want {
+		t.Errorf("Got %q, want %q", data, want)
+	}
+}
+
+func TestPluginListTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell script plugins need a Unix shell")
+	}
+	hung := filepath.Join(t.TempDir(), pluginPrefix+"hung")
+	if err := os.WriteFile(hung, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	format := &pluginFormat{name: "image-set", plugin: &plugin{name: "hung", path: hung}}
+	updater := NewContainerfileUpdaterWithConfig("prod.imgs", NewConfig())
+	updater.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := format.ListImages(updater, &pluginDocument{path: "prod.imgs", content: []byte("image alpine:3.20\n")})
+	if err == nil || !strings.Contains(err.Error(), "failed to list") {
+		t.Errorf("Expected the list call to fail, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Listing took %s, want it bounded by the lookup timeout", elapsed)
+	}
+}
+
+func TestPluginErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell script plugins need a Unix shell")
+	}
+	dir := t.TempDir()
+	p := &plugin{name: "images", path: writeTestPlugin(t, dir, "images")}
+	if _, err := p.call(t.Context(), PluginRequest{Method: "unknown"}); err == nil || !strings.Contains(err.Error(), "unknown method") {
+		t.Errorf("Expected the plugin's error, got %v", err)
+	}
+
+	broken := filepath.Join(dir, pluginPrefix+"broken")
+	if err := os.WriteFile(broken, []byte("#!/bin/sh\necho oops >&2\nexit 3\n"), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	p = &plugin{name: "broken", path: broken}
+	if _, err := p.resolve(t.Context(), "registry.internal.example/app:1.0"); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("Expected the plugin's stderr in the error, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profilesKey is the config key holding the named profiles
+const profilesKey = "profiles"
+
+// profileNames returns the names of the profiles in a config, sorted
+func (c *Config) profileNames() []string {
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// validateProfiles checks that every profile is a mapping of known settings, so a typo in
+// one profile is reported by runs using any of them
+func validateProfiles(profiles map[string]yaml.Node) error {
+	for name, profile := range profiles {
+		if profile.Kind != yaml.MappingNode {
+			return fmt.Errorf("profile %s must be a mapping of settings", name)
+		}
+		if _, nested := yamlMappingValue(&profile, profilesKey); nested != nil {
+			return fmt.Errorf("profile %s: profiles can't be nested", name)
+		}
+		if err := decodeConfigNode(&profile, &Config{}); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// mergeYAMLNodes merges an overlay into a base node, returning the merged node. Neither
+// node is modified.
+func mergeYAMLNodes(base, overlay *yaml.Node) *yaml.Node {
+	if base.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		return overlay
+	}
+	merged := *base
+	merged.Content = slices.Clone(base.Content)
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		replaced := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = mergeYAMLNodes(merged.Content[j+1], value)
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
+
+// decodeConfigNode decodes a YAML node into a config, rejecting unknown fields like the
+// config file itself
+func decodeConfigNode(node *yaml.Node, cfg *Config) error {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// withProfile returns the config of a config file's document with the named profile
+// merged over it
+func (c *Config) withProfile(data []byte, name string) (*Config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		available := "the config file defines none"
+		if names := c.profileNames(); len(names) > 0 {
+			available = "expected " + strings.Join(names, ", ")
+		}
+		return nil, fmt.Errorf("unknown profile %q (%s)", name, available)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	merged := &profile
+	if len(doc.Content) > 0 {
+		merged = mergeYAMLNodes(doc.Content[0], &profile)
+	}
+
+	cfg := NewConfig()
+	if err := decodeConfigNode(merged, cfg); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigProfile(t *testing.T) {
+	content := `registries:
+  ghcr.io:
+    auth:
+      token: ghcr
+timeout: 1m
+cooldown:
+  - image: "*"
+    minimumReleaseAge: 1d
+profiles:
+  dev:
+    cooldown: []
+  prod:
+    registries:
+      ghcr.io:
+        mirror: mirror.corp.example/ghcr
+      docker.io:
+        mirror: mirror.corp.example/dockerhub
+    images:
+      allow: [mirror.corp.example/*]
+    cooldown:
+      - image: "*"
+        minimumReleaseAge: 7d
+`
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Without a profile", func(t *testing.T) {
+		cfg, err := LoadConfigProfile(configPath, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.Registry("docker.io") != nil || cfg.Registry("ghcr.io").Mirror != "" || len(cfg.Cooldown) != 1 || cfg.Cooldown[0].MinimumReleaseAge != "1d" {
+			t.Errorf("Expected the settings outside the profiles, got %+v", cfg)
+		}
+	})
+
+	t.Run("Profiles merge mappings and replace lists", func(t *testing.T) {
+		cfg, err := LoadConfigProfile(configPath, "prod")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ghcr := cfg.Registry("ghcr.io")
+		if ghcr == nil || ghcr.Auth == nil || ghcr.Auth.Token != "ghcr" || ghcr.Mirror != "mirror.corp.example/ghcr" {
+			t.Errorf("Expected the ghcr.io credentials with the profile's mirror, got %+v", ghcr)
+		}
+		if hub := cfg.Registry("docker.io"); hub == nil || hub.Mirror != "mirror.corp.example/dockerhub" {
+			t.Errorf("Expected the profile's docker.io mirror, got %+v", hub)
+		}
+		if len(cfg.Cooldown) != 1 || cfg.Cooldown[0].MinimumReleaseAge != "7d" {
+			t.Errorf("Expected the profile's cooldown, got %+v", cfg.Cooldown)
+		}
+		if len(cfg.Images.Allow) != 1 || cfg.Timeout.String() != "1m0s" {
+			t.Errorf("Expected the allowlist and the file's timeout, got %+v and %s", cfg.Images, cfg.Timeout)
+		}
+
+		if cfg, err = LoadConfigProfile(configPath, "dev"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(cfg.Cooldown) != 0 {
+			t.Errorf("Expected the dev profile to clear the cooldown, got %+v", cfg.Cooldown)
+		}
+	})
+
+	t.Run("Unknown profiles are rejected", func(t *testing.T) {
+		_, err := LoadConfigProfile(configPath, "staging")
+		if err == nil || !strings.Contains(err.Error(), "expected dev, prod") {
+			t.Errorf("Expected an unknown profile error listing the profiles, got %v", err)
+		}
+	})
+
+	t.Run("Unknown fields in any profile are rejected", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(path, []byte("profiles:\n  dev: {}\n  prod:\n    registires: {}\n"), 0644)
+		_, err := LoadConfigProfile(path, "dev")
+		if err == nil || !strings.Contains(err.Error(), "profile prod") {
+			t.Errorf("Expected an error about the prod profile, got %v", err)
+		}
+	})
+
+	t.Run("Profiles need a config file", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+		if _, err := LoadConfigProfile("", "prod"); err == nil {
+			t.Error("Expected an error for a profile without a config file")
+		}
+	})
+}
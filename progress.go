@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// progressBarWidth is the number of cells in the progress bar
+const progressBarWidth = 30
+
+// Progress draws a single-line progress bar of files processed and images resolved.
+// A nil *Progress draws nothing.
+type Progress struct {
+	w     io.Writer
+	total int
+
+	mu      sync.Mutex
+	files   int
+	images  int
+	current string
+}
+
+// isTerminal reports whether a file is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// NewProgress creates a progress bar for the given number of files
+func NewProgress(w io.Writer, totalFiles int) *Progress {
+	return &Progress{w: w, total: totalFiles}
+}
+
+// StartFile marks a file as being processed
+func (p *Progress) StartFile(path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = path
+	p.render()
+}
+
+// ImageDone counts a resolved (or skipped) image
+func (p *Progress) ImageDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.images++
+	p.render()
+}
+
+// FileDone counts a processed file
+func (p *Progress) FileDone() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files++
+	p.render()
+}
+
+// Finish ends the progress line so later output starts on a fresh line
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = ""
+	p.render()
+	fmt.Fprintln(p.w)
+}
+
+// render redraws the progress line in place; callers hold the lock
+func (p *Progress) render() {
+	filled := 0
+	if p.total > 0 {
+		filled = p.files * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+	// \033[K clears what is left of a longer previous line
+	fmt.Fprintf(p.w, "\r[%s] %d/%d files, %d images %s\033[K", bar, p.files, p.total, p.images, p.current)
+}
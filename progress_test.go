@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	progress := NewProgress(&buf, 2)
+
+	progress.StartFile("Containerfile")
+	progress.ImageDone()
+	progress.ImageDone()
+	progress.FileDone()
+
+	frames := strings.Split(buf.String(), "\r")
+	last := frames[len(frames)-1]
+	want := "[" + strings.Repeat("#", progressBarWidth/2) + strings.Repeat("-", progressBarWidth/2) + "] 1/2 files, 2 images Containerfile"
+	if !strings.HasPrefix(last, want) {
+		t.Errorf("Unexpected progress line %q, want prefix %q", last, want)
+	}
+
+	progress.Finish()
+	if !strings.HasSuffix(buf.String(), "\n") {
+		t.Error("Expected Finish to end the progress line")
+	}
+
+	// A nil progress bar is a no-op
+	var disabled *Progress
+	disabled.StartFile("Containerfile")
+	disabled.ImageDone()
+	disabled.FileDone()
+	disabled.Finish()
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// quadletImagePattern matches the Image= key of a podman quadlet unit, capturing the value
+var quadletImagePattern = regexp.MustCompile(`^\s*Image\s*=\s*(\S+)\s*$`)
+
+// isQuadletPath reports whether a file extension is one of the podman quadlet units that
+// name an image to pull
+func isQuadletPath(ext string) bool {
+	return ext == ".container" || ext == ".image"
+}
+
+// extractQuadletImages returns the Image= values of the [Container] and [Image] sections of
+// a podman systemd quadlet unit. Values naming another .image or .build unit are left alone.
+func (du *ContainerfileUpdater) extractQuadletImages(lines []string) ([]*FromCommand, error) {
+	var images []*FromCommand
+	section := ""
+	for index, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = trimmed
+			continue
+		}
+		if section != "[Container]" && section != "[Image]" {
+			continue
+		}
+
+		match := quadletImagePattern.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		value := line[match[2]:match[3]]
+		if strings.HasSuffix(value, ".image") || strings.HasSuffix(value, ".build") {
+			slog.Debug("Skipping image built or pulled by another quadlet unit", "line", index+1, "image", value)
+			continue
+		}
+		image, err := du.parseImageReference(value)
+		if err != nil {
+			slog.Warn("Failed to parse image", "line", index+1, "error", err)
+			continue
+		}
+
+		slog.Debug("Found image in quadlet unit", "line", index+1, "image", value)
+		cmd := &FromCommand{
+			Image:       image,
+			LineStart:   index + 1,
+			LineEnd:     index + 1,
+			Annotations: commentAnnotations(lines, index+1, "#", ";"),
+			editor:      spanEditor(match[2]),
+		}
+		if strings.Contains(value, "%") {
+			cmd.SkipReason = "uses systemd specifiers"
+			cmd.Unpinnable = true
+		}
+		du.applySkipRules(cmd)
+		images = append(images, cmd)
+	}
+	return images, nil
+}
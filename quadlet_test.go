@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuadletImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/app:1.0")
+
+	content := strings.Join([]string{
+		"[Unit]",
+		"Description=App",
+		"",
+		"[Container]",
+		"Image=" + host + "/app:1.0",
+		"PublishPort=8080:8080",
+		"",
+		"[Install]",
+		"WantedBy=default.target",
+		"",
+	}, "\n")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.container")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write quadlet: %v", err)
+	}
+	// Images built or pulled by other units are theirs to pin
+	other := filepath.Join(dir, "worker.container")
+	if err := os.WriteFile(other, []byte("[Container]\nImage=worker.build\n"), 0644); err != nil {
+		t.Fatalf("Failed to write quadlet: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	if updater.format != formatQuadlet {
+		t.Fatalf("Expected the quadlet format, got %q", updater.format)
+	}
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read quadlet: %v", err)
+	}
+	want := strings.Replace(content, host+"/app:1.0", host+"/app@"+digest.String(), 1)
+	if string(data) != want {
+		t.Errorf("Unexpected content:\n%s\nwant:\n%s", data, want)
+	}
+
+	updater = NewContainerfileUpdaterWithConfig(other, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(updater.fromCommands) != 0 {
+		t.Errorf("Expected no images in a unit using a .build unit, got %d", len(updater.fromCommands))
+	}
+}
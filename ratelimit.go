@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// validateRateLimits rejects negative request rates and bursts in the config file
+func validateRateLimits(cfg *Config) error {
+	if cfg.RateLimit < 0 || cfg.RateBurst < 0 {
+		return fmt.Errorf("rateLimit and rateBurst must not be negative")
+	}
+	for host, registry := range cfg.Registries {
+		if registry.RateLimit < 0 || registry.RateBurst < 0 {
+			return fmt.Errorf("registry %s: rateLimit and rateBurst must not be negative", host)
+		}
+	}
+	return nil
+}
+
+// tokenBucket allows rate requests per second on average, and up to burst at once
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(max(burst, 1)), tokens: float64(max(burst, 1)), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token taken by reserve that was never used
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// wait blocks until a request is allowed, or the context ends
+func (b *tokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	delay := b.reserve()
+	if delay == 0 {
+		return 0, nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		// Waiting would outlast the lookup, so leave the token to someone else
+		b.cancel()
+		return delay, fmt.Errorf("registry rate limit allows no request before the lookup times out")
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		b.cancel()
+		return delay, ctx.Err()
+	}
+}
+
+// rateLimiters holds one token bucket per registry host. The buckets belong to the
+// configuration rather than to an updater, so every file of a run (and every run in
+// --watch mode) draws from the same budget.
+type rateLimiters struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// forRegistry returns the bucket limiting requests to a registry host, or nil when the
+// registry isn't rate limited
+func (rl *rateLimiters) forRegistry(cfg *Config, registry string) *tokenBucket {
+	rate, burst := cfg.RateLimit, cfg.RateBurst
+	if rc := cfg.Registry(registry); rc != nil && rc.RateLimit > 0 {
+		rate, burst = rc.RateLimit, rc.RateBurst
+	}
+	if rate <= 0 {
+		return nil
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.buckets == nil {
+		rl.buckets = make(map[string]*tokenBucket)
+	}
+	bucket, ok := rl.buckets[registry]
+	if !ok {
+		bucket = newTokenBucket(rate, burst)
+		rl.buckets[registry] = bucket
+	}
+	return bucket
+}
+
+// rateLimitedTransport holds requests back until the registry's bucket allows them
+type rateLimitedTransport struct {
+	registry string
+	bucket   *tokenBucket
+	next     http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay, err := t.bucket.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if delay > 0 {
+		slog.Debug("Waited for registry rate limit", "registry", t.registry, "delay", delay)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(20, 2)
+
+	// The burst goes out at once, after that requests are spaced 50ms apart
+	start := time.Now()
+	for range 5 {
+		if _, err := bucket.wait(context.Background()); err != nil {
+			t.Fatalf("wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond || elapsed > time.Second {
+		t.Errorf("5 requests at 20/s with a burst of 2 took %v, want about 150ms", elapsed)
+	}
+
+	// A lookup that would time out before its turn fails without taking the token
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := bucket.wait(ctx); err == nil {
+		t.Errorf("Expected an error when the wait outlasts the context")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if delay := bucket.reserve(); delay != 0 {
+		t.Errorf("Token was not returned, next request waits %v", delay)
+	}
+}
+
+func TestRateLimitSharedAcrossFiles(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/base:1.0")
+
+	var requests atomic.Int32
+	var last atomic.Int64
+	var minGap atomic.Int64
+	minGap.Store(int64(time.Hour))
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UnixNano()
+		if previous := last.Swap(now); previous != 0 && now-previous < minGap.Load() {
+			minGap.Store(now - previous)
+		}
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	})
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.RegistryOrCreate(host).RateLimit = 20
+
+	// Each file gets its own updater, as in a recursive run
+	dir := t.TempDir()
+	for _, file := range []string{"a.Containerfile", "b.Containerfile", "c.Containerfile"} {
+		path := filepath.Join(dir, file)
+		if err := os.WriteFile(path, []byte("FROM "+host+"/base:1.0\n"), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+		updater := NewContainerfileUpdaterWithConfig(path, cfg)
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if err := updater.fromCommands[0].Err; err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+	}
+
+	if requests.Load() < 3 {
+		t.Fatalf("Expected at least 3 requests, got %d", requests.Load())
+	}
+	// 20 requests per second leave 50ms between requests, with some slack for the timer
+	if gap := time.Duration(minGap.Load()); gap < 40*time.Millisecond {
+		t.Errorf("Requests to the same registry were %v apart, want at least 50ms", gap)
+	}
+}
+
+func TestValidateRateLimits(t *testing.T) {
+	cfg := NewConfig()
+	cfg.RateLimit = 0.5
+	if err := validateRateLimits(cfg); err != nil {
+		t.Errorf("Valid config: %v", err)
+	}
+	cfg.RegistryOrCreate("docker.io").RateBurst = -1
+	if err := validateRateLimits(cfg); err == nil {
+		t.Errorf("Expected an error for a negative burst")
+	}
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// referenceFormatShorthands are the built-in reference formats, named like the pin modes
+var referenceFormatShorthands = map[string]string{
+	pinDigest:     "{{.Name}}@{{.Digest}}",
+	pinTagDigest:  "{{.Name}}:{{.Tag}}@{{.Digest}}",
+	"full":        "{{.Registry}}/{{.Repository}}:{{.Tag}}@{{.Digest}}",
+	"full-digest": "{{.Registry}}/{{.Repository}}@{{.Digest}}",
+}
+
+// How Docker Hub references are qualified when they are written
+const (
+	qualificationShort   = "short"           // alpine, or user/app outside the official images
+	qualificationLibrary = "library"         // library/alpine, the default
+	qualificationFull    = "fully-qualified" // docker.io/library/alpine, unambiguous under podman's short-name rules
+)
+
+// validateQualification rejects unknown qualification levels
+func validateQualification(qualification string) error {
+	switch qualification {
+	case "", qualificationShort, qualificationLibrary, qualificationFull:
+		return nil
+	}
+	return fmt.Errorf("unknown qualification %q (expected %s, %s or %s)", qualification, qualificationShort, qualificationLibrary, qualificationFull)
+}
+
+// ReferenceData is what reference formats are rendered with
+type ReferenceData struct {
+	Registry   string // Registry host, e.g. docker.io
+	Repository string // Repository within the registry, e.g. library/golang
+	Name       string // Repository with its registry, qualified as configured, e.g. library/golang or ghcr.io/org/app
+	Tag        string // Tag the digest was resolved from
+	Digest     string // Digest being pinned
+}
+
+// referenceFormats holds the templates pinned references are written with
+type referenceFormats struct {
+	global        *template.Template            // For every registry without its own (nil for the built-in forms)
+	registries    map[string]*template.Template // Keyed by registry host
+	qualification string                        // How Docker Hub names are written (empty for library)
+}
+
+// newReferenceFormats parses the global and per-registry reference formats of a config,
+// returning nil when none is configured and Docker Hub names keep their default form
+func newReferenceFormats(cfg *Config) (*referenceFormats, error) {
+	if err := validateQualification(cfg.Qualification); err != nil {
+		return nil, err
+	}
+	formats := &referenceFormats{registries: make(map[string]*template.Template)}
+	if cfg.Qualification != qualificationLibrary {
+		formats.qualification = cfg.Qualification
+	}
+	var err error
+	if cfg.ReferenceFormat != "" {
+		if formats.global, err = parseReferenceFormat(cfg.ReferenceFormat); err != nil {
+			return nil, err
+		}
+	}
+	for host, registry := range cfg.Registries {
+		if registry == nil || registry.ReferenceFormat == "" {
+			continue
+		}
+		if formats.registries[host], err = parseReferenceFormat(registry.ReferenceFormat); err != nil {
+			return nil, fmt.Errorf("registry %s: %w", host, err)
+		}
+	}
+	if formats.global == nil && len(formats.registries) == 0 && formats.qualification == "" {
+		return nil, nil
+	}
+	return formats, nil
+}
+
+// parseReferenceFormat parses a reference template or shorthand, checking that it renders
+// a valid reference that keeps the digest
+func parseReferenceFormat(format string) (*template.Template, error) {
+	if shorthand, ok := referenceFormatShorthands[format]; ok {
+		format = shorthand
+	}
+	parsed, err := template.New("referenceFormat").Funcs(templateFuncs).Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference format %q: %w", format, err)
+	}
+
+	sample := &ImageReference{Registry: "registry.example.com", Repository: "team/app", Tag: "1.0", Digest: "sha256:" + strings.Repeat("0", 64)}
+	rendered, err := renderReference(parsed, sample, sample.Name())
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference format %q: %w", format, err)
+	}
+	if !strings.HasSuffix(rendered, "@"+sample.Digest) {
+		return nil, fmt.Errorf("invalid reference format %q: must end with @{{.Digest}}", format)
+	}
+	if _, err := name.ParseReference(rendered); err != nil {
+		return nil, fmt.Errorf("invalid reference format %q: renders %q: %w", format, rendered, err)
+	}
+	return parsed, nil
+}
+
+// renderReference renders a reference format for an image written under a name
+func renderReference(format *template.Template, image *ImageReference, name string) (string, error) {
+	var b strings.Builder
+	err := format.Execute(&b, ReferenceData{
+		Registry:   image.Registry,
+		Repository: image.Repository,
+		Name:       name,
+		Tag:        image.Tag,
+		Digest:     image.Digest,
+	})
+	return strings.TrimSpace(b.String()), err
+}
+
+// forRegistry returns the format references to a registry are written with, or nil for
+// the built-in forms
+func (f *referenceFormats) forRegistry(registry string) *template.Template {
+	if f == nil {
+		return nil
+	}
+	if format, ok := f.registries[registry]; ok {
+		return format
+	}
+	return f.global
+}
+
+// render writes a pinned reference in the format configured for its registry, reporting
+// false when there is none or it failed to render
+func (f *referenceFormats) render(image *ImageReference) (string, bool) {
+	format := f.forRegistry(image.Registry)
+	if format == nil {
+		return "", false
+	}
+	reference, err := renderReference(format, image, f.name(image))
+	if err != nil {
+		slog.Warn("Failed to render reference format, using the default", "image", image.Original, "error", err)
+		return "", false
+	}
+	return reference, true
+}
+
+// name returns the repository of an image with its registry, with Docker Hub names
+// qualified as configured
+func (f *referenceFormats) name(image *ImageReference) string {
+	if f == nil || image.Registry != "docker.io" {
+		return image.Name()
+	}
+	switch f.qualification {
+	case qualificationShort:
+		return strings.TrimPrefix(image.Repository, "library/")
+	case qualificationFull:
+		return image.Registry + "/" + image.Repository
+	}
+	return image.Name()
+}
+
+// qualifies reports whether the name of an image is written in a configured qualification
+// rather than the form it was read in, so existing pins are brought into it
+func (f *referenceFormats) qualifies(image *ImageReference) bool {
+	return f != nil && f.qualification != "" && image.Registry == "docker.io"
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReferenceFormat(t *testing.T) {
+	image := &ImageReference{Registry: "docker.io", Repository: "library/golang", Tag: "1.24", Digest: "sha256:" + strings.Repeat("b", 64)}
+	tests := []struct {
+		format   string
+		expected string
+		wantErr  bool
+	}{
+		{"digest", "library/golang@" + image.Digest, false},
+		{"tag-digest", "library/golang:1.24@" + image.Digest, false},
+		{"full", "docker.io/library/golang:1.24@" + image.Digest, false},
+		{"full-digest", "docker.io/library/golang@" + image.Digest, false},
+		{`{{.Name | trimPrefix "library/"}}:{{.Tag}}@{{.Digest}}`, "golang:1.24@" + image.Digest, false},
+		{"{{.Name}}:{{.Tag}}", "", true},
+		{"{{.Name}}@{{.Digest}} {{.Tag}}", "", true},
+		{"{{.Name", "", true},
+		{"{{.Missing}}@{{.Digest}}", "", true},
+		{"UPPER/{{.Repository}}@{{.Digest}}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			format, err := parseReferenceFormat(tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error for %q", tt.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			reference, err := renderReference(format, image, image.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reference != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, reference)
+			}
+		})
+	}
+}
+
+func TestReferenceFormats(t *testing.T) {
+	cfg := NewConfig()
+	if formats, err := newReferenceFormats(cfg); err != nil || formats != nil {
+		t.Fatalf("Expected no formats without configuration, got %v (%v)", formats, err)
+	}
+
+	cfg.ReferenceFormat = "full"
+	cfg.RegistryOrCreate("ghcr.io").ReferenceFormat = "tag-digest"
+	formats, err := newReferenceFormats(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := "sha256:" + strings.Repeat("c", 64)
+	for image, expected := range map[*ImageReference]string{
+		{Registry: "docker.io", Repository: "library/alpine", Tag: "3", Digest: digest}: "docker.io/library/alpine:3@" + digest,
+		{Registry: "ghcr.io", Repository: "org/app", Tag: "v1", Digest: digest}:         "ghcr.io/org/app:v1@" + digest,
+	} {
+		if reference, ok := formats.render(image); !ok || reference != expected {
+			t.Errorf("Expected %q, got %q (ok=%t)", expected, reference, ok)
+		}
+	}
+
+	cfg.RegistryOrCreate("quay.io").ReferenceFormat = "{{.Name}}"
+	if _, err := newReferenceFormats(cfg); err == nil || !strings.Contains(err.Error(), "quay.io") {
+		t.Errorf("Expected an error naming the registry, got %v", err)
+	}
+}
+
+func TestQualification(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("d", 64)
+	official := &ImageReference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "24.04", Digest: digest, Original: "ubuntu:24.04"}
+	user := &ImageReference{Registry: "docker.io", Repository: "grafana/grafana", Tag: "11", Digest: digest, Original: "grafana/grafana:11"}
+	other := &ImageReference{Registry: "ghcr.io", Repository: "org/app", Tag: "v1", Digest: digest, Original: "ghcr.io/org/app:v1"}
+	tests := []struct {
+		qualification string
+		pin           string
+		expected      []string
+	}{
+		{"", "", []string{"library/ubuntu@" + digest, "grafana/grafana@" + digest, "ghcr.io/org/app@" + digest}},
+		{qualificationLibrary, "", []string{"library/ubuntu@" + digest, "grafana/grafana@" + digest, "ghcr.io/org/app@" + digest}},
+		{qualificationShort, "", []string{"ubuntu@" + digest, "grafana/grafana@" + digest, "ghcr.io/org/app@" + digest}},
+		{qualificationFull, "", []string{"docker.io/library/ubuntu@" + digest, "docker.io/grafana/grafana@" + digest, "ghcr.io/org/app@" + digest}},
+		{qualificationFull, pinTagDigest, []string{"docker.io/library/ubuntu:24.04@" + digest, "docker.io/grafana/grafana:11@" + digest, "ghcr.io/org/app:v1@" + digest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.qualification+"/"+tt.pin, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Qualification = tt.qualification
+			formats, err := newReferenceFormats(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, image := range []*ImageReference{official, user, other} {
+				cmd := &FromCommand{Image: image, PreviousDigest: digest, formats: formats}
+				if tt.pin != "" {
+					cmd.Annotations = &ImageAnnotations{Pin: tt.pin}
+				}
+				if reference := formatReference(cmd); reference != tt.expected[i] {
+					t.Errorf("Expected %q, got %q", tt.expected[i], reference)
+				}
+				// Pins written in another form are rewritten even when their digest is current
+				if want := formats == nil || image.Registry != "docker.io"; NewContainerfileUpdaterWithConfig("Containerfile", cfg).pinCurrent(cmd) != want {
+					t.Errorf("Expected pinCurrent %t for %s", want, image.Original)
+				}
+			}
+		})
+	}
+
+	cfg := NewConfig()
+	cfg.Qualification = "qualified"
+	if _, err := newReferenceFormats(cfg); err == nil {
+		t.Error("Expected an error for an unknown qualification")
+	}
+}
+
+func TestReferenceFormatUpdate(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	digest := pushRandomImage(t, server, host+"/team/app:1.0")
+	pinned := pushRandomImage(t, server, host+"/team/pinned:latest")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	content := "FROM " + host + "/team/app:1.0\n" +
+		"FROM " + host + "/team/pinned@" + pinned.String() + "\n" +
+		"# containerfile-updater: pin=digest\nFROM " + host + "/team/app:1.0 AS annotated\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.RegistryOrCreate(host).ReferenceFormat = "tag-digest"
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, backup: BackupPolicy{Disabled: true}, out: io.Discard}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	updated, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Existing pins are brought into the configured form, pin annotations take precedence
+	expected := "FROM " + host + "/team/app:1.0@" + digest.String() + "\n" +
+		"FROM " + host + "/team/pinned:latest@" + pinned.String() + "\n" +
+		"# containerfile-updater: pin=digest\nFROM " + host + "/team/app@" + digest.String() + " AS annotated\n"
+	if string(updated) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, updated)
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Kinds of supply-chain artifacts attached to a digest, besides the attestation kinds
+const (
+	referrerSignature   = "signature"
+	referrerAttestation = "attestation" // In-toto attestation of another predicate type
+	referrerOther       = "other"
+)
+
+// signatureArtifactTypes are the artifact and media types of image signatures
+var signatureArtifactTypes = []string{
+	"application/vnd.dev.cosign.artifact.sig.v1+json",
+	"application/vnd.dev.cosign.simplesigning.v1+json",
+	"application/vnd.cncf.notary.signature",
+}
+
+// Referrer is a supply-chain artifact attached to a digest, such as an SBOM or signature
+type Referrer struct {
+	Kind         string `json:"kind"` // sbom, provenance, signature, attestation or other
+	ArtifactType string `json:"artifactType,omitempty"`
+	Digest       string `json:"digest"`
+}
+
+// classifyReferrer determines the kind of a referrer descriptor
+func classifyReferrer(desc v1.Descriptor) string {
+	if kind := classifyDescriptor(desc); kind != "" {
+		return kind
+	}
+	artifactType := strings.ToLower(firstNonEmpty(desc.ArtifactType, string(desc.MediaType)))
+	for _, signature := range signatureArtifactTypes {
+		if artifactType == signature {
+			return referrerSignature
+		}
+	}
+	for _, key := range predicateTypeAnnotations {
+		if desc.Annotations[key] != "" {
+			return referrerAttestation
+		}
+	}
+	if strings.Contains(artifactType, "in-toto") || strings.Contains(artifactType, "dsse") {
+		return referrerAttestation
+	}
+	return referrerOther
+}
+
+// summarizeReferrers counts referrers by kind, e.g. "1 sbom, 2 signature"
+func summarizeReferrers(referrers []Referrer) string {
+	counts := make(map[string]int)
+	var kinds []string
+	for _, referrer := range referrers {
+		if counts[referrer.Kind] == 0 {
+			kinds = append(kinds, referrer.Kind)
+		}
+		counts[referrer.Kind]++
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", counts[kind], kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// collectReferrers lists the artifacts attached to the new digest of every updated image.
+// Lookups are best effort.
+func (du *ContainerfileUpdater) collectReferrers() {
+	if !du.referrers || du.digests != nil {
+		// Offline mode can't reach registries
+		return
+	}
+
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	for _, cmd := range du.fromCommands {
+		if !cmd.Changed || cmd.Image.Digest == "" {
+			continue
+		}
+		ctx, cancel, err := du.lookupContext(runCtx, cmd.Image.Registry)
+		if err == nil {
+			cmd.Referrers, err = du.listReferrers(ctx, cmd.Image, cmd.Image.Digest)
+			cancel()
+		}
+		if err != nil {
+			slog.Warn("Failed to list referrers", "image", cmd.Image.Original, "error", err)
+			continue
+		}
+		slog.Debug("Found referrers", "image", cmd.Image.Original, "referrers", summarizeReferrers(cmd.Referrers))
+	}
+}
+
+// listReferrers returns the artifacts attached to a digest through the OCI referrers API,
+// its tag schema fallback and cosign's .sig, .att and .sbom tags
+func (du *ContainerfileUpdater) listReferrers(ctx context.Context, image *ImageReference, digest string) ([]Referrer, error) {
+	options, err := du.remoteOptions(ctx, image.Registry)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := name.NewDigest(image.Name()+"@"+digest, referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reference %s@%s: %w", image.Name(), digest, err)
+	}
+
+	index, err := remote.Referrers(ref, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list referrers: %w", err)
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read referrers: %w", err)
+	}
+	referrers := []Referrer{}
+	for _, desc := range manifest.Manifests {
+		referrers = append(referrers, Referrer{
+			Kind:         classifyReferrer(desc),
+			ArtifactType: firstNonEmpty(desc.ArtifactType, string(desc.MediaType)),
+			Digest:       desc.Digest.String(),
+		})
+	}
+
+	cosignTag := strings.Replace(digest, ":", "-", 1)
+	for _, convention := range []struct{ suffix, kind string }{
+		{".sig", referrerSignature},
+		{".att", referrerAttestation},
+		{".sbom", attestationSBOM},
+	} {
+		desc, err := remote.Head(ref.Context().Tag(cosignTag+convention.suffix), options...)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to check cosign %s tag: %w", convention.suffix, err)
+		}
+		referrers = append(referrers, Referrer{Kind: convention.kind, ArtifactType: string(desc.MediaType), Digest: desc.Digest.String()})
+	}
+	return referrers, nil
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestClassifyReferrer(t *testing.T) {
+	tests := []struct {
+		desc v1.Descriptor
+		want string
+	}{
+		{v1.Descriptor{ArtifactType: "application/spdx+json"}, attestationSBOM},
+		{v1.Descriptor{ArtifactType: "application/vnd.dev.sigstore.bundle.v0.3+json", Annotations: map[string]string{"dev.sigstore.bundle.predicateType": "https://slsa.dev/provenance/v1"}}, attestationProvenance},
+		{v1.Descriptor{ArtifactType: "application/vnd.cncf.notary.signature"}, referrerSignature},
+		{v1.Descriptor{MediaType: "application/vnd.dev.cosign.simplesigning.v1+json"}, referrerSignature},
+		{v1.Descriptor{ArtifactType: "application/vnd.in-toto+json"}, referrerAttestation},
+		{v1.Descriptor{ArtifactType: "application/vnd.example.readme"}, referrerOther},
+	}
+	for _, tt := range tests {
+		if got := classifyReferrer(tt.desc); got != tt.want {
+			t.Errorf("classifyReferrer(%+v) = %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeReferrers(t *testing.T) {
+	referrers := []Referrer{{Kind: referrerSignature}, {Kind: attestationSBOM}, {Kind: referrerSignature}}
+	if got := summarizeReferrers(referrers); got != "1 sbom, 2 signature" {
+		t.Errorf("summarizeReferrers() = %q", got)
+	}
+}
+
+func TestReferrersInReports(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	old := pushRandomImage(t, server, host+"/app:v1")
+	latest := pushRandomImage(t, server, host+"/app:v1")
+
+	repo, err := name.NewRepository(host+"/app", name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse repository: %v", err)
+	}
+	pushAttestation(t, server, repo.Tag(strings.Replace(latest.String(), ":", "-", 1)+".sig"), nil, nil, "")
+	pushAttestation(t, server, repo.Tag("spdx"), nil, subjectDescriptor(t, server, host+"/app:v1"), "application/spdx+json")
+
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM "+host+"/app:v1@"+old.String()+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+	du.referrers = true
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+
+	report := du.Report()
+	if got := summarizeReferrers(report.Images[0].Referrers); got != "1 sbom, 1 signature" {
+		t.Fatalf("Report referrers = %q (%+v)", got, report.Images[0].Referrers)
+	}
+	body := buildChangeRequestBody(du.fromCommands)
+	if want := "- `" + host + "/app:v1`: 1 sbom, 1 signature"; !strings.Contains(body, "### Supply chain") || !strings.Contains(body, want) {
+		t.Errorf("Body missing supply chain line %q:\n%s", want, body)
+	}
+}
@@ -0,0 +1,262 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyDirect disables proxying for a registry
+const proxyDirect = "direct"
+
+// registryTransports builds and caches the HTTP transport used for each registry host
+type registryTransports struct {
+	config *Config
+
+	mu    sync.Mutex
+	cache map[string]http.RoundTripper
+}
+
+// newRegistryTransports creates a transport cache for the given configuration
+func newRegistryTransports(cfg *Config) *registryTransports {
+	return &registryTransports{
+		config: cfg,
+		cache:  make(map[string]http.RoundTripper),
+	}
+}
+
+// forRegistry returns the transport for a registry host, building it on first use
+func (rt *registryTransports) forRegistry(registry string) (http.RoundTripper, error) {
+	key := normalizeRegistry(registry)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if transport, ok := rt.cache[key]; ok {
+		return transport, nil
+	}
+
+	transport, err := newRegistryTransport(rt.config, rt.config.Registry(key))
+	if err != nil {
+		return nil, err
+	}
+	if bucket := rt.config.limiters.forRegistry(rt.config, key); bucket != nil {
+		transport = &rateLimitedTransport{registry: key, bucket: bucket, next: transport}
+	}
+	rt.cache[key] = transport
+	return transport, nil
+}
+
+// registryPullers keeps one remote.Puller per registry host. A puller caches the
+// authenticated transport of every repository it reads from, so lookups of images from the
+// same repository reuse its connections and bearer token instead of pinging the registry
+// and exchanging a token each time. Like the rate limiters they belong to the configuration
+// and are shared by every updater of a run.
+type registryPullers struct {
+	mu      sync.Mutex
+	pullers map[string]*remote.Puller
+}
+
+// forRegistry returns the puller for a registry host, creating it with the given
+// credentials and transport on first use
+func (rp *registryPullers) forRegistry(registry string, keychain authn.Keychain, transport http.RoundTripper) (*remote.Puller, error) {
+	key := normalizeRegistry(registry)
+	if rp != nil {
+		rp.mu.Lock()
+		defer rp.mu.Unlock()
+		if puller, ok := rp.pullers[key]; ok {
+			return puller, nil
+		}
+	}
+
+	puller, err := remote.NewPuller(remote.WithAuthFromKeychain(keychain), remote.WithTransport(transport))
+	if err != nil || rp == nil {
+		return puller, err
+	}
+	if rp.pullers == nil {
+		rp.pullers = make(map[string]*remote.Puller)
+	}
+	rp.pullers[key] = puller
+	return puller, nil
+}
+
+// forget drops the puller of a registry host. A puller never retries a failed ping or token
+// exchange for a repository, so it is dropped when a lookup fails and the next one
+// authenticates afresh.
+func (rp *registryPullers) forget(registry string) {
+	if rp == nil {
+		return
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	delete(rp.pullers, normalizeRegistry(registry))
+}
+
+// newRegistryTransport builds an HTTP transport honoring a registry's settings
+func newRegistryTransport(cfg *Config, rc *RegistryConfig) (http.RoundTripper, error) {
+	transport := remote.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := proxyFunc(cfg, rc)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	if rc == nil {
+		return transport, nil
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	tlsConfig := transport.TLSClientConfig
+
+	if rc.Insecure {
+		// Self-signed dev registries can't be verified
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if rc.CAFile != "" {
+		pool, err := loadCertPool(rc.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if rc.CertFile != "" || rc.KeyFile != "" {
+		if rc.CertFile == "" || rc.KeyFile == "" {
+			return nil, fmt.Errorf("both certFile and keyFile are required for client certificates")
+		}
+		cert, err := tls.LoadX509KeyPair(rc.CertFile, rc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return transport, nil
+}
+
+// proxyFunc selects the proxy for registry requests. An explicit proxy from the
+// registry or global config replaces HTTP_PROXY/HTTPS_PROXY, while NO_PROXY from
+// the environment is always honored alongside the configured noProxy list.
+func proxyFunc(cfg *Config, rc *RegistryConfig) (func(*http.Request) (*url.URL, error), error) {
+	env := httpproxy.FromEnvironment()
+
+	proxy := cfg.Proxy
+	if rc != nil && rc.Proxy != "" {
+		proxy = rc.Proxy
+	}
+
+	switch proxy {
+	case proxyDirect:
+		return nil, nil
+	case "":
+		if cfg.NoProxy != "" {
+			env.NoProxy = joinNoProxy(env.NoProxy, cfg.NoProxy)
+		}
+		return requestProxyFunc(env.ProxyFunc()), nil
+	}
+
+	if _, err := url.Parse(proxy); err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", proxy, err)
+	}
+
+	explicit := &httpproxy.Config{
+		HTTPProxy:  proxy,
+		HTTPSProxy: proxy,
+		NoProxy:    joinNoProxy(env.NoProxy, cfg.NoProxy),
+	}
+	return requestProxyFunc(explicit.ProxyFunc()), nil
+}
+
+// requestProxyFunc adapts an httpproxy function to http.Transport.Proxy
+func requestProxyFunc(fn func(*url.URL) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}
+}
+
+// joinNoProxy merges comma-separated NO_PROXY lists, skipping empty entries
+func joinNoProxy(lists ...string) string {
+	var entries []string
+	for _, list := range lists {
+		for _, entry := range strings.Split(list, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+// loadCertPool returns the system roots extended with the CAs in a PEM bundle
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
+	}
+	return pool, nil
+}
+
+// referenceOptions returns the name options used when parsing references for a registry
+func referenceOptions(cfg *Config, registry string) []name.Option {
+	if rc := cfg.Registry(registry); rc != nil && rc.Insecure {
+		// Allows falling back to plain HTTP
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+// isAuthFailure reports whether a registry rejected a request's credentials or lack of them
+func isAuthFailure(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden {
+		return true
+	}
+	return slices.ContainsFunc(terr.Errors, func(e transport.Diagnostic) bool {
+		return e.Code == transport.UnauthorizedErrorCode || e.Code == transport.DeniedErrorCode
+	})
+}
+
+// headUnsupported reports whether a failed HEAD request for a manifest should be retried
+// with GET: the registry answered without the digest headers, or refused the method. Errors
+// a GET would run into as well, like a missing manifest or an unreachable host, don't count.
+func headUnsupported(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		return terr.StatusCode == http.StatusMethodNotAllowed || terr.StatusCode == http.StatusNotImplemented
+	}
+	var uerr *url.Error
+	return !errors.As(err, &uerr)
+}
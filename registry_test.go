@@ -0,0 +1,527 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// newTestRegistry starts an in-memory registry and returns its host
+func newTestRegistry(t *testing.T, useTLS bool) (*httptest.Server, string) {
+	t.Helper()
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	var server *httptest.Server
+	if useTLS {
+		server = httptest.NewTLSServer(handler)
+	} else {
+		server = httptest.NewServer(handler)
+	}
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(strings.TrimPrefix(server.URL, "https://"), "http://")
+	return server, host
+}
+
+// pushRandomImage pushes a random image to the test registry and returns its digest
+func pushRandomImage(t *testing.T, server *httptest.Server, reference string) v1.Hash {
+	t.Helper()
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("Failed to create random image: %v", err)
+	}
+
+	ref, err := name.ParseReference(reference, name.Insecure)
+	if err != nil {
+		t.Fatalf("Failed to parse reference: %v", err)
+	}
+
+	transport := server.Client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if err := remote.Write(ref, img, remote.WithTransport(transport)); err != nil {
+		t.Fatalf("Failed to push image: %v", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Failed to compute digest: %v", err)
+	}
+	return digest
+}
+
+func TestFetchImageDigestInsecureRegistry(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	for _, useTLS := range []bool{true, false} {
+		name := "Plain HTTP"
+		if useTLS {
+			name = "Self-signed TLS"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			server, host := newTestRegistry(t, useTLS)
+			expected := pushRandomImage(t, server, host+"/app:v1")
+
+			imageRef := &ImageReference{Registry: host, Repository: "app", Tag: "v1"}
+
+			// Without the insecure setting the self-signed certificate is rejected.
+			// (Loopback registries are always allowed to fall back to plain HTTP.)
+			if useTLS {
+				updater := NewContainerfileUpdater("test")
+				if _, err := updater.fetchImageDigest(context.Background(), imageRef); err == nil {
+					t.Error("Expected error for insecure registry without --insecure-registry")
+				}
+			}
+
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			updater := NewContainerfileUpdaterWithConfig("test", cfg)
+
+			digest, err := updater.fetchImageDigest(context.Background(), imageRef)
+			if err != nil {
+				t.Fatalf("Failed to fetch digest: %v", err)
+			}
+			if digest != expected.String() {
+				t.Errorf("Digest: got %s, want %s", digest, expected)
+			}
+		})
+	}
+}
+
+// headerStrippingWriter drops the Docker-Content-Digest header from a response
+type headerStrippingWriter struct {
+	http.ResponseWriter
+}
+
+func (w headerStrippingWriter) WriteHeader(status int) {
+	w.Header().Del("Docker-Content-Digest")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func TestFetchImageDigestHeadFallback(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	tests := []struct {
+		name        string
+		stripHead   bool
+		wantMethods string
+	}{
+		{name: "HEAD returns the digest", wantMethods: "HEAD,HEAD"},
+		// After the first fallback the registry is only asked with GET
+		{name: "HEAD without digest", stripHead: true, wantMethods: "HEAD,GET,GET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, host := newTestRegistry(t, false)
+			expected := pushRandomImage(t, server, host+"/app:v1")
+
+			var methods []string
+			handler := server.Config.Handler
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.URL.Path, "/manifests/") {
+					handler.ServeHTTP(w, r)
+					return
+				}
+				methods = append(methods, r.Method)
+				if tt.stripHead && r.Method == http.MethodHead {
+					w = headerStrippingWriter{w}
+				}
+				handler.ServeHTTP(w, r)
+			})
+
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			updater := NewContainerfileUpdaterWithConfig("test", cfg)
+			imageRef := &ImageReference{Registry: host, Repository: "app", Tag: "v1"}
+
+			for range 2 {
+				digest, err := updater.fetchImageDigest(context.Background(), imageRef)
+				if err != nil {
+					t.Fatalf("Failed to fetch digest: %v", err)
+				}
+				if digest != expected.String() {
+					t.Errorf("Digest: got %s, want %s", digest, expected)
+				}
+			}
+			if got := strings.Join(methods, ","); got != tt.wantMethods {
+				t.Errorf("Manifest requests = %s, want %s", got, tt.wantMethods)
+			}
+
+			// A missing tag fails on HEAD without retrying with GET
+			methods = nil
+			missing := &ImageReference{Registry: host, Repository: "app", Tag: "missing"}
+			if _, err := updater.fetchImageDigest(context.Background(), missing); err == nil || !isNotFound(err) {
+				t.Errorf("Expected a not found error, got %v", err)
+			}
+			if !tt.stripHead && len(methods) != 1 {
+				t.Errorf("Manifest requests for a missing tag = %v, want a single HEAD", methods)
+			}
+		})
+	}
+}
+
+func TestPullerSharedAcrossImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	for _, tag := range []string{"1.0", "2.0", "3.0"} {
+		pushRandomImage(t, server, host+"/app:"+tag)
+	}
+
+	// Require a bearer token, counting pings and token exchanges
+	var pings, tokens atomic.Int32
+	var failToken atomic.Bool
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			tokens.Add(1)
+			if failToken.Load() {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			io.WriteString(w, `{"token": "secret"}`)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			if r.URL.Path == "/v2/" {
+				pings.Add(1)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	})
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+
+	// Each file gets its own updater, as in a recursive run
+	dir := t.TempDir()
+	lookup := func(tag string) error {
+		path := filepath.Join(dir, tag+".Containerfile")
+		if err := os.WriteFile(path, []byte("FROM "+host+"/app:"+tag+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+		updater := NewContainerfileUpdaterWithConfig(path, cfg)
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		return updater.fromCommands[0].Err
+	}
+	for _, tag := range []string{"1.0", "2.0"} {
+		if err := lookup(tag); err != nil {
+			t.Fatalf("Lookup of %s failed: %v", tag, err)
+		}
+	}
+	if pings.Load() != 1 || tokens.Load() != 1 {
+		t.Errorf("Expected one ping and token exchange, got %d and %d", pings.Load(), tokens.Load())
+	}
+
+	// A failed token exchange isn't kept: the next lookup authenticates again. The run
+	// starts without a token so the first lookup has to exchange one.
+	cfg.pullers = &registryPullers{}
+	failToken.Store(true)
+	if err := lookup("3.0"); err == nil {
+		t.Fatal("Expected the lookup to fail while tokens can't be exchanged")
+	}
+	failToken.Store(false)
+	if err := lookup("3.0"); err != nil {
+		t.Fatalf("Lookup after the token endpoint recovered failed: %v", err)
+	}
+}
+
+func TestAnonymousFallback(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	tests := []struct {
+		name        string
+		credentials bool
+		private     bool
+		tag         string
+		wantErr     string
+	}{
+		{name: "expired credentials for a public image", credentials: true, tag: "1.0"},
+		{name: "expired credentials for a missing image", credentials: true, tag: "missing", wantErr: "404 Not Found"},
+		{name: "expired credentials for a private image", credentials: true, private: true, tag: "1.0", wantErr: "rejected the credentials"},
+		{name: "no credentials for a private image", private: true, tag: "1.0", wantErr: "requires authentication"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, host := newTestRegistry(t, false)
+			expected := pushRandomImage(t, server, host+"/app:1.0")
+
+			// Every credential is rejected; anonymous pulls only work for public images
+			var rejected atomic.Int32
+			handler := server.Config.Handler
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorized := r.Header.Get("Authorization") != ""
+				if authorized {
+					rejected.Add(1)
+				}
+				if authorized || r.URL.Path == "/v2/" || tt.private {
+					w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			})
+
+			cfg := NewConfig()
+			cfg.RegistryOrCreate(host).Insecure = true
+			if tt.credentials {
+				cfg.RegistryOrCreate(host).Auth = &RegistryAuth{Username: "user", Password: "expired"}
+			}
+			updater := NewContainerfileUpdaterWithConfig("test", cfg)
+			imageRef := &ImageReference{Registry: host, Repository: "app", Tag: tt.tag}
+
+			digest, err := updater.fetchImageDigest(context.Background(), imageRef)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to fetch digest: %v", err)
+			}
+			if digest != expected.String() {
+				t.Errorf("Digest: got %s, want %s", digest, expected)
+			}
+
+			// Once rejected, the credentials aren't sent to the registry again
+			before := rejected.Load()
+			if _, err := updater.resolveDigest(context.Background(), host, host+"/app:1.0"); err != nil {
+				t.Fatalf("Failed to fetch digest again: %v", err)
+			}
+			if rejected.Load() != before {
+				t.Errorf("Credentials were sent again after the registry rejected them")
+			}
+		})
+	}
+}
+
+// writePEM writes a single PEM block to a file in dir
+func writePEM(t *testing.T, dir, file, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", file, err)
+	}
+	return path
+}
+
+// newClientCertificate creates a CA and a client certificate signed by it,
+// returning the CA pool and the paths of the client certificate and key
+func newClientCertificate(t *testing.T, dir string) (*x509.CertPool, string, string) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "containerfile-updater"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal client key: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return pool, writePEM(t, dir, "client.crt", "CERTIFICATE", clientDER), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestFetchImageDigestCustomCAAndClientCertificate(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	tmpDir := t.TempDir()
+	clientCAs, certFile, keyFile := newClientCertificate(t, tmpDir)
+
+	server := httptest.NewUnstartedServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	// Push with the server's own client, which trusts its certificate and presents ours
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	pushTransport := server.Client().Transport.(*http.Transport)
+	pushTransport.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	img, _ := random.Image(256, 1)
+	ref, _ := name.ParseReference(host + "/app:v1")
+	if err := remote.Write(ref, img, remote.WithTransport(pushTransport)); err != nil {
+		t.Fatalf("Failed to push image: %v", err)
+	}
+	expected, _ := img.Digest()
+
+	caFile := writePEM(t, tmpDir, "ca.crt", "CERTIFICATE", server.Certificate().Raw)
+	imageRef := &ImageReference{Registry: host, Repository: "app", Tag: "v1"}
+
+	// Trusting the CA is not enough when the registry requires a client certificate
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).CAFile = caFile
+	updater := NewContainerfileUpdaterWithConfig("test", cfg)
+	if _, err := updater.fetchImageDigest(context.Background(), imageRef); err == nil {
+		t.Error("Expected error without a client certificate")
+	}
+
+	rc := cfg.RegistryOrCreate(host)
+	rc.CertFile = certFile
+	rc.KeyFile = keyFile
+	updater = NewContainerfileUpdaterWithConfig("test", cfg)
+
+	digest, err := updater.fetchImageDigest(context.Background(), imageRef)
+	if err != nil {
+		t.Fatalf("Failed to fetch digest: %v", err)
+	}
+	if digest != expected.String() {
+		t.Errorf("Digest: got %s, want %s", digest, expected)
+	}
+}
+
+func TestNewRegistryTransportErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	emptyCA := filepath.Join(tmpDir, "empty.pem")
+	os.WriteFile(emptyCA, []byte("not a certificate"), 0644)
+
+	tests := []struct {
+		name   string
+		config *RegistryConfig
+	}{
+		{name: "Missing CA bundle", config: &RegistryConfig{CAFile: filepath.Join(tmpDir, "missing.pem")}},
+		{name: "CA bundle without certificates", config: &RegistryConfig{CAFile: emptyCA}},
+		{name: "Certificate without key", config: &RegistryConfig{CertFile: "client.crt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRegistryTransport(NewConfig(), tt.config); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestProxyFunc(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://env-proxy:3128")
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("NO_PROXY", "internal.corp")
+
+	tests := []struct {
+		name     string
+		config   *Config
+		registry *RegistryConfig
+		host     string
+		expected string
+	}{
+		{name: "Environment proxy", config: &Config{}, host: "ghcr.io", expected: "http://env-proxy:3128"},
+		{name: "Environment NO_PROXY", config: &Config{}, host: "registry.internal.corp", expected: ""},
+		{name: "Configured noProxy", config: &Config{NoProxy: ".example.com"}, host: "registry.example.com", expected: ""},
+		{name: "Explicit proxy", config: &Config{Proxy: "http://corp-proxy:8080"}, host: "ghcr.io", expected: "http://corp-proxy:8080"},
+		{name: "Explicit proxy honors NO_PROXY", config: &Config{Proxy: "http://corp-proxy:8080"}, host: "registry.internal.corp", expected: ""},
+		{
+			name:     "Per-registry proxy",
+			config:   &Config{Proxy: "http://corp-proxy:8080"},
+			registry: &RegistryConfig{Proxy: "http://dmz-proxy:3128"},
+			host:     "ghcr.io",
+			expected: "http://dmz-proxy:3128",
+		},
+		{
+			name:     "Per-registry direct",
+			config:   &Config{Proxy: "http://corp-proxy:8080"},
+			registry: &RegistryConfig{Proxy: proxyDirect},
+			host:     "ghcr.io",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn, err := proxyFunc(tt.config, tt.registry)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got string
+			if fn != nil {
+				req, _ := http.NewRequest(http.MethodGet, "https://"+tt.host+"/v2/", nil)
+				proxyURL, err := fn(req)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if proxyURL != nil {
+					got = proxyURL.String()
+				}
+			}
+
+			if got != tt.expected {
+				t.Errorf("Proxy: got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
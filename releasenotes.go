@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// OCI annotations (also used as image labels) describing where an image comes from
+const (
+	annotationSource   = "org.opencontainers.image.source"
+	annotationURL      = "org.opencontainers.image.url"
+	annotationVersion  = "org.opencontainers.image.version"
+	annotationRevision = "org.opencontainers.image.revision"
+)
+
+// ReleaseInfo tells reviewers what a new digest is: the version and source revision it was
+// built from, and a link to the project and its release notes
+type ReleaseInfo struct {
+	Source       string `json:"source,omitempty"`       // Source repository URL
+	Version      string `json:"version,omitempty"`      // Version the image was built from
+	Revision     string `json:"revision,omitempty"`     // Source revision the image was built from
+	ReleaseNotes string `json:"releaseNotes,omitempty"` // Release notes page of the version
+}
+
+// releaseNotesURL returns the release notes page of a version on a known forge, the
+// releases overview when the version is unknown, or the source URL itself otherwise
+func releaseNotesURL(source, version string) string {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	repository := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	base := "https://" + u.Host + "/" + repository
+
+	switch {
+	case u.Host == "github.com" && strings.Count(repository, "/") == 1:
+		if version != "" {
+			return base + "/releases/tag/" + url.PathEscape(version)
+		}
+		return base + "/releases"
+	case u.Host == "gitlab.com" && repository != "":
+		if version != "" {
+			return base + "/-/releases/" + url.PathEscape(version)
+		}
+		return base + "/-/releases"
+	}
+	return source
+}
+
+// describe returns the version and short revision of a release for logs and messages,
+// e.g. "1.2.3 (abc123def456)", or an empty string when neither is known
+func (r *ReleaseInfo) describe() string {
+	if r == nil {
+		return ""
+	}
+	revision := r.Revision
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	switch {
+	case r.Version != "" && revision != "":
+		return r.Version + " (" + revision + ")"
+	case r.Version != "":
+		return r.Version
+	}
+	return revision
+}
+
+// releaseInfo reads the OCI annotations of a digest, filling in what they lack from the
+// labels of its image config, and derives the release notes link. It returns nil if the
+// image names no source, version or revision.
+func (du *ContainerfileUpdater) releaseInfo(ctx context.Context, cmd *FromCommand) (*ReleaseInfo, error) {
+	image := cmd.Image
+	options, err := du.remoteOptions(ctx, image.Registry)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := name.NewDigest(image.Name()+"@"+image.Digest, referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reference %s@%s: %w", image.Name(), image.Digest, err)
+	}
+
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	var metadata map[string]string
+	if desc.MediaType.IsIndex() {
+		index, err := desc.ImageIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", ref, err)
+		}
+		manifest, err := index.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", ref, err)
+		}
+		metadata = manifest.Annotations
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image %s: %w", ref, err)
+		}
+		manifest, err := img.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", ref, err)
+		}
+		metadata = manifest.Annotations
+	}
+
+	// Builds often only set labels; an index's labels live in its platform images.
+	// Annotations describe the published artifact and win over inherited labels.
+	if (metadata[annotationSource] == "" && metadata[annotationURL] == "") || metadata[annotationVersion] == "" || metadata[annotationRevision] == "" {
+		img, err := remote.Image(ref, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch image %s: %w", ref, err)
+		}
+		config, err := img.ConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config of %s: %w", ref, err)
+		}
+		labels := maps.Clone(config.Config.Labels)
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		maps.Copy(labels, metadata)
+		metadata = labels
+	}
+
+	return newReleaseInfo(metadata), nil
+}
+
+// newReleaseInfo builds the release information described by OCI annotations or labels,
+// or returns nil if they name no source, version or revision
+func newReleaseInfo(metadata map[string]string) *ReleaseInfo {
+	info := &ReleaseInfo{
+		Source:   firstNonEmpty(metadata[annotationSource], metadata[annotationURL]),
+		Version:  metadata[annotationVersion],
+		Revision: metadata[annotationRevision],
+	}
+	if info.Source == "" && info.Version == "" && info.Revision == "" {
+		return nil
+	}
+	if info.Source != "" {
+		info.ReleaseNotes = releaseNotesURL(info.Source, info.Version)
+	}
+	return info
+}
+
+// collectReleaseInfo looks up the version and revision of every updated image. The source
+// and release notes links are kept for images whose tag changed, or for every updated
+// image with --release-notes. Lookups are best effort.
+func (du *ContainerfileUpdater) collectReleaseInfo() {
+	if du.digests != nil {
+		// Offline mode can't reach registries
+		return
+	}
+
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	for _, cmd := range du.fromCommands {
+		if !cmd.Changed {
+			continue
+		}
+		info, err := du.lookupReleaseInfo(runCtx, cmd)
+		if err != nil {
+			slog.Warn("Failed to look up release information", "image", cmd.Image.Original, "error", err)
+			continue
+		}
+		if info != nil && cmd.TrackedTag == "" && !du.releaseNotes {
+			info.Source, info.ReleaseNotes = "", ""
+			if info.describe() == "" {
+				info = nil
+			}
+		}
+		if info != nil {
+			slog.Info("New digest release", "line", cmd.LineStart, "image", cmd.Image.TaggedName(), "version", info.Version, "revision", info.Revision)
+		}
+		cmd.Release = info
+	}
+}
+
+// lookupReleaseInfo looks up the release information of one image within the run's context
+func (du *ContainerfileUpdater) lookupReleaseInfo(runCtx context.Context, cmd *FromCommand) (*ReleaseInfo, error) {
+	ctx, cancel, err := du.lookupContext(runCtx, cmd.Image.Registry)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	return du.releaseInfo(ctx, cmd)
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestReleaseNotesURL(t *testing.T) {
+	tests := []struct {
+		source  string
+		version string
+		want    string
+	}{
+		{source: "https://github.com/golang/go", version: "1.22.0", want: "https://github.com/golang/go/releases/tag/1.22.0"},
+		{source: "https://github.com/golang/go.git", want: "https://github.com/golang/go/releases"},
+		{source: "https://gitlab.com/group/project", version: "v2", want: "https://gitlab.com/group/project/-/releases/v2"},
+		{source: "https://git.example.com/project", version: "v2", want: "https://git.example.com/project"},
+		{source: "not a url", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := releaseNotesURL(tt.source, tt.version); got != tt.want {
+			t.Errorf("releaseNotesURL(%q, %q) = %q, want %q", tt.source, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestCollectReleaseInfo(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	transport := server.Client().Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	push := func(reference string, img v1.Image) {
+		t.Helper()
+		ref, err := name.ParseReference(reference, name.Insecure)
+		if err != nil {
+			t.Fatalf("Failed to parse reference: %v", err)
+		}
+		if err := remote.Write(ref, img, remote.WithTransport(transport)); err != nil {
+			t.Fatalf("Failed to push image: %v", err)
+		}
+	}
+
+	base, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("Failed to create random image: %v", err)
+	}
+	labeled, err := mutate.Config(base, v1.Config{Labels: map[string]string{
+		annotationSource:  "https://github.com/example/labeled",
+		annotationVersion: "1.2.3",
+	}})
+	if err != nil {
+		t.Fatalf("Failed to set labels: %v", err)
+	}
+	push(host+"/labeled:1", labeled)
+	annotated := mutate.Annotations(base, map[string]string{
+		annotationSource:   "https://github.com/example/annotated",
+		annotationRevision: "abc123",
+	}).(v1.Image)
+	push(host+"/annotated:1", annotated)
+	push(host+"/plain:1", base)
+	push(host+"/tracked:stable", labeled)
+
+	originalContent := "FROM " + host + "/labeled:1\n" +
+		"FROM " + host + "/annotated:1\n" +
+		"FROM " + host + "/plain:1\n" +
+		"# containerfile-updater: track=stable\n" +
+		"FROM " + host + "/tracked:1\n"
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	for _, releaseNotes := range []bool{false, true} {
+		containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+		if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+
+		updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+		updater.releaseNotes = releaseNotes
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		releases := make(map[string]*ReleaseInfo)
+		for _, cmd := range updater.fromCommands {
+			releases[cmd.Image.Repository] = cmd.Release
+		}
+		if !releaseNotes {
+			// Version and revision are always reported, links only for tag changes
+			if got := releases["labeled"]; got == nil || got.Version != "1.2.3" || got.Source != "" || got.ReleaseNotes != "" {
+				t.Errorf("Labeled image release without --release-notes = %+v", got)
+			}
+			if got := releases["annotated"]; got == nil || got.Revision != "abc123" || got.Source != "" {
+				t.Errorf("Annotated image release without --release-notes = %+v", got)
+			}
+			if got := releases["tracked"]; got == nil || got.ReleaseNotes == "" {
+				t.Errorf("Release notes not looked up for the tracked tag change: %+v", got)
+			}
+
+			body := buildChangeRequestBody(updater.ChangedCommands())
+			if !strings.Contains(body, "| `1.2.3` |") || !strings.Contains(body, "| `abc123` |") || !strings.Contains(body, "  - revision: `abc123`") {
+				t.Errorf("Change request body missing versions and revisions:\n%s", body)
+			}
+			if strings.Contains(body, "/labeled:1`: [") {
+				t.Errorf("Change request body links release notes without --release-notes:\n%s", body)
+			}
+			message := buildCommitMessage(containerfilePath, updater.ChangedCommands())
+			if !strings.Contains(message, "  version: 1.2.3\n") || !strings.Contains(message, "  revision: abc123\n") {
+				t.Errorf("Commit message missing versions and revisions:\n%s", message)
+			}
+			continue
+		}
+
+		if got := releases["labeled"]; got == nil || got.ReleaseNotes != "https://github.com/example/labeled/releases/tag/1.2.3" {
+			t.Errorf("Labeled image release = %+v", got)
+		}
+		if got := releases["annotated"]; got == nil || got.Revision != "abc123" || got.ReleaseNotes != "https://github.com/example/annotated/releases" {
+			t.Errorf("Annotated image release = %+v", got)
+		}
+		if releases["plain"] != nil {
+			t.Errorf("Image without a source got release information: %+v", releases["plain"])
+		}
+
+		body := buildChangeRequestBody(updater.ChangedCommands())
+		if !strings.Contains(body, "[1.2.3](https://github.com/example/labeled/releases/tag/1.2.3)") {
+			t.Errorf("Change request body missing release notes link:\n%s", body)
+		}
+	}
+}
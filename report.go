@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats for the run report
+const (
+	outputText = "text" // Log lines and a summary table
+	outputJSON = "json" // Machine-readable report on stdout
+)
+
+// UpdateReport is the machine-readable outcome of an update run over every file
+type UpdateReport struct {
+	Updater   BuildInfo    `json:"updater"` // Build of the updater that resolved the digests
+	CheckOnly bool         `json:"checkOnly"`
+	Files     []*RunReport `json:"files"`
+	Summary   RunSummary   `json:"summary"`
+}
+
+// RunReport is the machine-readable outcome of updating one file
+type RunReport struct {
+	Containerfile string        `json:"containerfile"`
+	CheckOnly     bool          `json:"checkOnly"`
+	Error         string        `json:"error,omitempty"` // Why the file could not be processed
+	Unchanged     bool          `json:"unchanged"`       // Whether every pin was current, so the file was left alone
+	Images        []ImageReport `json:"images"`
+	Graph         *StageGraph   `json:"graph,omitempty"` // Build stages and their dependencies (Containerfiles only)
+	Findings      []Finding     `json:"findings,omitempty"`
+}
+
+// RunSummary totals the outcome of a run across files
+type RunSummary struct {
+	Files      int              `json:"files"`
+	Images     int              `json:"images"`
+	Updated    int              `json:"updated"` // Updates applied, or available in check mode
+	Unchanged  int              `json:"unchanged"`
+	Skipped    int              `json:"skipped"`
+	Held       int              `json:"held"`
+	Errors     int              `json:"errors"`               // Failed image lookups and files that could not be processed
+	Violations int              `json:"violations,omitempty"` // Base images outside the catalog, also counted as skipped
+	Changes    []ChangeSummary  `json:"changes"`
+	Failures   []FailureSummary `json:"failures,omitempty"` // Images that failed to resolve, once per image
+}
+
+// FailureSummary is an image that failed to resolve, listed once however many files use it
+type FailureSummary struct {
+	Image     string   `json:"image"`
+	Error     string   `json:"error"`
+	Locations []string `json:"locations"` // file:line of every use
+}
+
+// ChangeSummary is a digest delta listed in the run summary
+type ChangeSummary struct {
+	File           string `json:"file"`
+	Line           int    `json:"line"`
+	Image          string `json:"image"`
+	PreviousDigest string `json:"previousDigest,omitempty"`
+	Digest         string `json:"digest"`
+	Version        string `json:"version,omitempty"`  // Version label of the new digest
+	Revision       string `json:"revision,omitempty"` // Source revision label of the new digest
+}
+
+// ImageReport is the outcome for a single FROM image
+type ImageReport struct {
+	Line                int          `json:"line"`
+	Original            string       `json:"original"`
+	Image               string       `json:"image"`
+	PreviousDigest      string       `json:"previousDigest,omitempty"`
+	Digest              string       `json:"digest,omitempty"`
+	Changed             bool         `json:"changed"`
+	Skipped             string       `json:"skipped,omitempty"`
+	Held                string       `json:"held,omitempty"`
+	Violation           string       `json:"violation,omitempty"`
+	Error               string       `json:"error,omitempty"`
+	Suggestions         []string     `json:"suggestions,omitempty"` // Tags close to a missing one
+	Attestations        []string     `json:"attestations,omitempty"`
+	MissingAttestations []string     `json:"missingAttestations,omitempty"`
+	MissingPlatforms    []string     `json:"missingPlatforms,omitempty"`
+	NewVulnerabilities  []string     `json:"newVulnerabilities,omitempty"`
+	ExpiredPin          string       `json:"expiredPin,omitempty"`  // Age of a pin past its maximum pin age
+	ProposedTag         string       `json:"proposedTag,omitempty"` // Newer tag proposed to renew it
+	Platform            string       `json:"platform,omitempty"`    // Platform whose manifest is pinned instead of the index
+	Release             *ReleaseInfo `json:"release,omitempty"`
+	Referrers           []Referrer   `json:"referrers,omitempty"`
+}
+
+// validateOutputFormat rejects unknown --output values. Commands supporting more than
+// text and JSON pass the other formats they accept.
+func validateOutputFormat(format string, extra ...string) error {
+	formats := append([]string{outputText, outputJSON}, extra...)
+	if slices.Contains(formats, format) {
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (expected %s or %s)", format, strings.Join(formats[:len(formats)-1], ", "), formats[len(formats)-1])
+}
+
+// Report summarizes the FROM commands processed during the last run
+func (du *ContainerfileUpdater) Report() *RunReport {
+	report := &RunReport{
+		Containerfile: du.containerfilePath,
+		CheckOnly:     du.checkOnly,
+		Unchanged:     du.changedCount() == 0,
+		Images:        []ImageReport{},
+		Graph:         du.graph.withAffected(du.fromCommands),
+		Findings:      du.Findings(),
+	}
+
+	for _, cmd := range du.fromCommands {
+		image := ImageReport{
+			Line:                cmd.LineStart,
+			Original:            cmd.Image.Original,
+			Image:               cmd.Image.TaggedName(),
+			PreviousDigest:      cmd.PreviousDigest,
+			Digest:              cmd.Image.Digest,
+			Changed:             cmd.Changed,
+			Skipped:             cmd.SkipReason,
+			Held:                cmd.HeldReason,
+			Violation:           cmd.Violation,
+			Attestations:        cmd.Attestations,
+			MissingAttestations: cmd.MissingAttestations,
+			MissingPlatforms:    cmd.MissingPlatforms,
+			NewVulnerabilities:  cmd.NewVulnerabilities,
+			ExpiredPin:          cmd.ExpiredPin,
+			ProposedTag:         cmd.ProposedTag,
+			Platform:            cmd.PinnedPlatform,
+			Release:             cmd.Release,
+			Referrers:           cmd.Referrers,
+		}
+		if cmd.Err != nil {
+			image.Error = cmd.Err.Error()
+			image.Suggestions = tagSuggestions(cmd.Err)
+		}
+		report.Images = append(report.Images, image)
+	}
+	return report
+}
+
+// summarizeReports totals the per-file reports of a run
+func summarizeReports(reports []*RunReport) RunSummary {
+	summary := RunSummary{Files: len(reports), Changes: []ChangeSummary{}}
+	failures := make(map[string]int)
+	for _, report := range reports {
+		if report.Error != "" {
+			summary.Errors++
+		}
+		for _, image := range report.Images {
+			summary.Images++
+			if image.Violation != "" {
+				summary.Violations++
+			}
+			switch {
+			case image.Error != "":
+				summary.Errors++
+				location := fmt.Sprintf("%s:%d", displayPath(report.Containerfile), image.Line)
+				if i, ok := failures[image.Image]; ok {
+					summary.Failures[i].Locations = append(summary.Failures[i].Locations, location)
+					break
+				}
+				failures[image.Image] = len(summary.Failures)
+				summary.Failures = append(summary.Failures, FailureSummary{Image: image.Image, Error: image.Error, Locations: []string{location}})
+			case image.Skipped != "":
+				summary.Skipped++
+			case image.Held != "":
+				summary.Held++
+			case image.Changed:
+				summary.Updated++
+				change := ChangeSummary{
+					File:           displayPath(report.Containerfile),
+					Line:           image.Line,
+					Image:          image.Image,
+					PreviousDigest: image.PreviousDigest,
+					Digest:         image.Digest,
+				}
+				if image.Release != nil {
+					change.Version, change.Revision = image.Release.Version, image.Release.Revision
+				}
+				summary.Changes = append(summary.Changes, change)
+			default:
+				summary.Unchanged++
+			}
+		}
+	}
+	return summary
+}
+
+// writeSummary prints the run summary and the changed images as text tables
+func writeSummary(w io.Writer, summary RunSummary, checkOnly bool) {
+	updated := "Updated"
+	if checkOnly {
+		updated = "Updates available"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Files processed:\t%d\n", summary.Files)
+	fmt.Fprintf(tw, "Images found:\t%d\n", summary.Images)
+	fmt.Fprintf(tw, "%s:\t%d\n", updated, summary.Updated)
+	fmt.Fprintf(tw, "Unchanged:\t%d\n", summary.Unchanged)
+	fmt.Fprintf(tw, "Skipped:\t%d\n", summary.Skipped)
+	fmt.Fprintf(tw, "Held back:\t%d\n", summary.Held)
+	fmt.Fprintf(tw, "Errors:\t%d\n", summary.Errors)
+	if summary.Violations > 0 {
+		fmt.Fprintf(tw, "Not in catalog:\t%d\n", summary.Violations)
+	}
+	tw.Flush()
+
+	if len(summary.Changes) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "LOCATION\tIMAGE\tOLD\tNEW\tVERSION")
+		for _, change := range summary.Changes {
+			version := (&ReleaseInfo{Version: change.Version, Revision: change.Revision}).describe()
+			fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\t%s\n", change.File, change.Line, change.Image, shortDigest(change.PreviousDigest), shortDigest(change.Digest), version)
+		}
+		tw.Flush()
+	}
+
+	// One entry per image, however many files failed on it
+	if len(summary.Failures) > 0 {
+		fmt.Fprintln(w, "\nFailed images:")
+		for _, failure := range summary.Failures {
+			fmt.Fprintf(w, "  %s: %s\n", failure.Image, failure.Error)
+			fmt.Fprintf(w, "    used at %s\n", strings.Join(failure.Locations, ", "))
+		}
+	}
+}
+
+// writeJSONReport writes a report as indented JSON
+func writeJSONReport(w io.Writer, report any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
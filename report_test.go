@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeReports(t *testing.T) {
+	reports := []*RunReport{
+		{
+			Containerfile: "Containerfile",
+			Images: []ImageReport{
+				{Line: 1, Image: "golang:1.24", PreviousDigest: "sha256:aaa", Digest: "sha256:bbb", Changed: true},
+				{Line: 3, Image: "alpine:3.20", Digest: "sha256:ccc"},
+				{Line: 5, Image: "example/tool:latest", Skipped: "ignored by annotation"},
+			},
+		},
+		{
+			Containerfile: "compose.yaml",
+			Images: []ImageReport{
+				{Line: 4, Image: "postgres:16", Error: "unauthorized"},
+				{Line: 7, Image: "redis:7", Held: "missing attestations: provenance"},
+			},
+		},
+		{Containerfile: "broken/Containerfile", Error: "failed to parse Containerfile"},
+	}
+
+	got := summarizeReports(reports)
+	want := RunSummary{
+		Files:     3,
+		Images:    5,
+		Updated:   1,
+		Unchanged: 1,
+		Skipped:   1,
+		Held:      1,
+		Errors:    2,
+		Changes: []ChangeSummary{
+			{File: "Containerfile", Line: 1, Image: "golang:1.24", PreviousDigest: "sha256:aaa", Digest: "sha256:bbb"},
+		},
+		Failures: []FailureSummary{
+			{Image: "postgres:16", Error: "unauthorized", Locations: []string{"compose.yaml:4"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	var buf bytes.Buffer
+	writeSummary(&buf, got, true)
+	for _, line := range []string{
+		"Files processed:    3",
+		"Updates available:  1",
+		"Errors:             2",
+		"Containerfile:1  golang:1.24  aaa  bbb",
+		"postgres:16: unauthorized\n    used at compose.yaml:4",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Summary missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestWriteJSONUpdateReport(t *testing.T) {
+	du := NewContainerfileUpdater("Containerfile")
+	image, err := du.parseImageReference("alpine:3.20")
+	if err != nil {
+		t.Fatalf("parseImageReference failed: %v", err)
+	}
+	du.fromCommands = []*FromCommand{{Image: image, LineStart: 1, Err: errors.New("timeout")}}
+
+	files := []*RunReport{du.Report()}
+	var buf bytes.Buffer
+	if err := writeJSONReport(&buf, &UpdateReport{Files: files, Summary: summarizeReports(files)}); err != nil {
+		t.Fatalf("writeJSONReport failed: %v", err)
+	}
+
+	var decoded UpdateReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if len(decoded.Files) != 1 || decoded.Files[0].Images[0].Error != "timeout" {
+		t.Errorf("Unexpected files in report: %+v", decoded.Files)
+	}
+	if decoded.Summary.Errors != 1 || decoded.Summary.Changes == nil {
+		t.Errorf("Unexpected summary in report: %+v", decoded.Summary)
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// resolutionDateFormat is the layout of the resolved= date in resolution comments
+const resolutionDateFormat = "2006-01-02"
+
+// resolutionCommentPattern matches a resolution comment, with or without its leading #, e.g.
+//
+//	# tag=20.04 resolved=2025-01-15
+//	FROM ubuntu@sha256:…
+var resolutionCommentPattern = regexp.MustCompile(`^\s*(?:#\s*)?tag=(\S+)\s+resolved=(\d{4}-\d{2}-\d{2})\s*$`)
+
+// parseResolutionComment returns the tag recorded by a resolution comment
+func parseResolutionComment(comment string) (string, bool) {
+	match := resolutionCommentPattern.FindStringSubmatch(comment)
+	if match == nil || !tagPattern.MatchString(match[1]) {
+		return "", false
+	}
+	return match[1], true
+}
+
+// resolutionComment formats the comment recorded above a pinned FROM instruction
+func resolutionComment(indent, tag, date string) string {
+	return fmt.Sprintf("%s# tag=%s resolved=%s", indent, tag, date)
+}
+
+// resolutionTag returns the tag recorded in the comment directly above a FROM instruction
+// whose reference names no tag, so images pinned by digest alone keep following their tag
+func resolutionTag(cmd *FromCommand) (string, bool) {
+	if cmd.Node == nil || len(cmd.Node.PrevComment) == 0 || cmd.Image.ExplicitTag() {
+		return "", false
+	}
+	return parseResolutionComment(cmd.Node.PrevComment[len(cmd.Node.PrevComment)-1])
+}
+
+// resolutionCommentEditor wraps a FROM editor to maintain a "# tag=… resolved=…" comment
+// directly above the instruction. The date only moves when the pinned reference changes, so
+// rerunning against an up-to-date file leaves it alone.
+func resolutionCommentEditor(edit lineEditor, date string) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		lines, changed := edit(lines, cmd)
+		if cmd.Annotations != nil && cmd.Annotations.Pin == pinTagOnly {
+			// Nothing was resolved
+			return lines, changed
+		}
+		index := cmd.LineStart - 1
+		if index < 0 || index >= len(lines) {
+			return lines, changed
+		}
+
+		line := lines[index]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if index > 0 {
+			if tag, ok := parseResolutionComment(lines[index-1]); ok {
+				if tag == cmd.Image.Tag && !changed {
+					return lines, false
+				}
+				lines[index-1] = resolutionComment(indent, cmd.Image.Tag, date)
+				return lines, true
+			}
+		}
+		return slices.Insert(lines, index, resolutionComment(indent, cmd.Image.Tag, date)), true
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func TestResolutionComments(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	first := pushRandomImage(t, server, host+"/base:1.0")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	update := func(content string) string {
+		t.Helper()
+		if content != "" {
+			if err := os.WriteFile(containerfilePath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+		}
+		updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+		updater.annotate = true
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		data, err := os.ReadFile(containerfilePath)
+		if err != nil {
+			t.Fatalf("Failed to read Containerfile: %v", err)
+		}
+		return string(data)
+	}
+
+	today := time.Now().UTC().Format(resolutionDateFormat)
+	expected := "# tag=1.0 resolved=" + today + "\nFROM " + host + "/base@" + first.String() + "\n"
+	if got := update("FROM " + host + "/base:1.0\n"); got != expected {
+		t.Fatalf("First run content mismatch.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+
+	// The comment supplies the tag the bare digest lost, and an unchanged pin keeps its date
+	stale := "# tag=1.0 resolved=2025-01-15\nFROM " + host + "/base@" + first.String() + "\n"
+	if got := update(stale); got != stale {
+		t.Errorf("Unchanged pin was rewritten.\nExpected:\n%s\nGot:\n%s", stale, got)
+	}
+
+	second := pushRandomImage(t, server, host+"/base:1.0")
+	expected = "# tag=1.0 resolved=" + today + "\nFROM " + host + "/base@" + second.String() + "\n"
+	if got := update(""); got != expected {
+		t.Errorf("Moved tag content mismatch.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestResolutionCommentEditor(t *testing.T) {
+	cmd := &FromCommand{
+		Image:     &ImageReference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "20.04", Digest: "sha256:abc", Original: "ubuntu:20.04"},
+		LineStart: 3,
+		LineEnd:   3,
+	}
+	lines := []string{"ARG BASE", "", "  FROM ubuntu:20.04 AS build"}
+	edit := resolutionCommentEditor(fromReferenceEditor(parser.DefaultEscapeToken), "2025-01-15")
+
+	lines, changed := edit(slices.Clone(lines), cmd)
+	expected := []string{"ARG BASE", "", "  # tag=20.04 resolved=2025-01-15", "  FROM library/ubuntu@sha256:abc AS build"}
+	if !changed || !slices.Equal(lines, expected) {
+		t.Errorf("edit() = %q, %v, want %q, true", lines, changed, expected)
+	}
+
+	cmd.Annotations = &ImageAnnotations{Pin: pinTagOnly}
+	lines, changed = edit([]string{"FROM ubuntu:20.04"}, &FromCommand{Image: cmd.Image, LineStart: 1, LineEnd: 1, Annotations: cmd.Annotations})
+	if changed || !slices.Equal(lines, []string{"FROM ubuntu:20.04"}) {
+		t.Errorf("tag-only edit() = %q, %v, want no comment", lines, changed)
+	}
+}
+
+func TestParseResolutionComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		tag     string
+		ok      bool
+	}{
+		{comment: "# tag=20.04 resolved=2025-01-15", tag: "20.04", ok: true},
+		{comment: "tag=3.20 resolved=2025-01-15", tag: "3.20", ok: true},
+		{comment: "# tag=20.04", ok: false},
+		{comment: "# containerfile-updater: pin=tag-digest", ok: false},
+		{comment: "# tag=bad/tag resolved=2025-01-15", ok: false},
+	}
+
+	for _, tt := range tests {
+		tag, ok := parseResolutionComment(tt.comment)
+		if tag != tt.tag || ok != tt.ok {
+			t.Errorf("parseResolutionComment(%q) = %q, %v, want %q, %v", tt.comment, tag, ok, tt.tag, tt.ok)
+		}
+	}
+}
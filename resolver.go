@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"sync"
+)
+
+// defaultJobs is how many images are resolved at once when a run covers several files
+const defaultJobs = 8
+
+// digestResolver resolves every image reference once per run and shares the digest with
+// each file using it, so base images repeated across many files cost one lookup. Unlike
+// the rate limiters and tag lists it belongs to a single run: --watch mode must see tags
+// move between runs.
+type digestResolver struct {
+	mu      sync.Mutex
+	results map[string]*resolution
+}
+
+// resolution is the outcome of one lookup, complete once done is closed
+type resolution struct {
+	done     chan struct{}
+	digest   string
+	err      error
+	reported bool // Whether a file using the image logged its failure
+}
+
+// newDigestResolver creates an empty resolver
+func newDigestResolver() *digestResolver {
+	return &digestResolver{results: make(map[string]*resolution)}
+}
+
+// resolverKey identifies the tag of an image across files, whichever way they spell it
+func resolverKey(image *ImageReference) string {
+	return image.Registry + "/" + image.Repository + ":" + image.Tag
+}
+
+// resolve returns the digest of an image, calling lookup only the first time the image is
+// asked for. Concurrent callers wait for the lookup in flight. Failures are remembered
+// like digests, so an image that is missing or refuses the credentials isn't asked for
+// again by every file using it. A nil resolver always looks up.
+func (dr *digestResolver) resolve(image *ImageReference, lookup func() (string, error)) (string, error) {
+	if dr == nil {
+		return lookup()
+	}
+
+	key := resolverKey(image)
+	dr.mu.Lock()
+	result, ok := dr.results[key]
+	if !ok {
+		result = &resolution{done: make(chan struct{})}
+		dr.results[key] = result
+	}
+	dr.mu.Unlock()
+
+	if ok {
+		<-result.done
+		return result.digest, result.err
+	}
+	result.digest, result.err = lookup()
+	close(result.done)
+	return result.digest, result.err
+}
+
+// firstFailure reports whether a failed lookup of an image is reported for the first time in
+// the run, so files sharing a broken image log it once. A nil resolver always reports.
+func (dr *digestResolver) firstFailure(image *ImageReference) bool {
+	if dr == nil {
+		return true
+	}
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	// Other failures, such as a platform missing from a resolved index, aren't shared
+	result, ok := dr.results[resolverKey(image)]
+	if !ok || result.err == nil {
+		return true
+	}
+	first := !result.reported
+	result.reported = true
+	return first
+}
+
+// sharedLookup is an image to resolve before the files are updated
+type sharedLookup struct {
+	path   string // First file using the image
+	format string
+	image  *ImageReference
+}
+
+// resolveShared collects the unique images of every file and resolves them up to r.jobs
+// at a time, before any file is rewritten. The files are then updated from the shared
+// results. Files that fail to parse are left for updateFile to report.
+func (r *updateRun) resolveShared() {
+	seen := make(map[string]bool)
+	var lookups []sharedLookup
+	for _, path := range r.paths {
+		if path == stdinPath {
+			continue
+		}
+		format, err := resolveFormat(r.format, path, r.cfg)
+		if err != nil {
+			continue
+		}
+		commands, err := r.newUpdater(path, format).extractImages()
+		if err != nil {
+			continue
+		}
+		for _, cmd := range commands {
+			key := resolverKey(cmd.Image)
+			if cmd.SkipReason != "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			lookups = append(lookups, sharedLookup{path: path, format: format, image: cmd.Image})
+		}
+	}
+	if len(lookups) == 0 {
+		return
+	}
+	slog.Info("Resolving images shared across files", "images", len(lookups), "files", len(r.paths))
+
+	queue := make(chan sharedLookup)
+	var wg sync.WaitGroup
+	for range min(cmp.Or(r.jobs, defaultJobs), len(lookups)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Updaters aren't safe for concurrent use; each worker has its own
+			var worker *ContainerfileUpdater
+			for lookup := range queue {
+				if worker == nil {
+					worker = r.newUpdater(lookup.path, lookup.format)
+				}
+				worker.format = lookup.format
+				worker.prefetchDigest(lookup.image)
+			}
+		}()
+	}
+	for _, lookup := range lookups {
+		queue <- lookup
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// prefetchDigest resolves an image into the run's resolver. Failures are logged when the
+// files using the image are updated.
+func (du *ContainerfileUpdater) prefetchDigest(image *ImageReference) {
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+	ctx, cancel, err := du.lookupContext(runCtx, image.Registry)
+	if err != nil {
+		return
+	}
+	defer cancel()
+	if _, err := du.fetchImageDigest(ctx, image); err != nil {
+		slog.Debug("Failed to resolve shared image", "image", image.Original, "error", err)
+	}
+}
@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+func TestSharedResolver(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	// Count the tag lookups each repository receives
+	var mu sync.Mutex
+	lookups := make(map[string]int)
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if repository, reference, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/"); ok && !strings.HasPrefix(reference, "sha256:") {
+			mu.Lock()
+			lookups[repository+":"+reference]++
+			mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	base := pushRandomImage(t, server, host+"/base:1.0")
+	dir := t.TempDir()
+	var paths []string
+	for i := range 12 {
+		pushRandomImage(t, server, fmt.Sprintf("%s/app%d:1.0", host, i))
+		path := filepath.Join(dir, fmt.Sprintf("Containerfile.%d", i))
+		content := fmt.Sprintf("FROM %s/base:1.0 AS build\nFROM %s/app%d:1.0\n", host, host, i)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	mu.Lock()
+	clear(lookups)
+	mu.Unlock()
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	for _, jobs := range []int{4, 1} {
+		run := &updateRun{paths: paths, cfg: cfg, format: formatAuto, output: outputText, checkOnly: true, jobs: jobs, out: io.Discard}
+		if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+			t.Fatalf("jobs=%d: expected exit code %d, got %d", jobs, exitUpdatesNeeded, exitCode)
+		}
+		if lookups["base:1.0"] != 1 || lookups["app0:1.0"] != 1 || lookups["app11:1.0"] != 1 {
+			t.Errorf("jobs=%d: expected one lookup per image, got %v", jobs, lookups)
+		}
+		clear(lookups)
+	}
+
+	// The shared result is written to every file
+	run := &updateRun{paths: paths, cfg: cfg, format: formatAuto, output: outputText, backup: BackupPolicy{Disabled: true}, out: io.Discard}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "/base@"+base.String()+" AS build") {
+			t.Errorf("%s not pinned to the shared digest:\n%s", filepath.Base(path), data)
+		}
+	}
+}
+
+func TestSharedFailures(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	var mu sync.Mutex
+	lookups := 0
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing/manifests/1.0") {
+			mu.Lock()
+			lookups++
+			mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	dir := t.TempDir()
+	var paths []string
+	for i := range 3 {
+		path := filepath.Join(dir, fmt.Sprintf("Containerfile.%d", i))
+		if err := os.WriteFile(path, []byte("FROM "+host+"/missing:1.0\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	for _, jobs := range []int{4, 1} {
+		var out strings.Builder
+		run := &updateRun{paths: paths, cfg: cfg, format: formatAuto, output: outputText, checkOnly: true, jobs: jobs, out: &out}
+		if exitCode := run.run(); exitCode != exitError {
+			t.Fatalf("jobs=%d: expected exit code %d, got %d", jobs, exitError, exitCode)
+		}
+		if lookups != 1 {
+			t.Errorf("jobs=%d: expected the failed image to be looked up once, got %d lookups", jobs, lookups)
+		}
+		lookups = 0
+
+		// The summary lists the image once with every file using it
+		if got := strings.Count(out.String(), "\n  "+host+"/missing:1.0: "); got != 1 {
+			t.Errorf("jobs=%d: expected one failure entry, got %d:\n%s", jobs, got, out.String())
+		}
+		locations := "used at " + displayPath(paths[0]) + ":1, " + displayPath(paths[1]) + ":1, " + displayPath(paths[2]) + ":1"
+		if !strings.Contains(out.String(), locations) {
+			t.Errorf("jobs=%d: expected %q in the summary:\n%s", jobs, locations, out.String())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// RewriteRule moves written references to another registry, e.g. from docker.io/* to an
+// internal proxy at registry.corp/dockerhub-proxy/*
+type RewriteRule struct {
+	From string `yaml:"from"` // registry/repository glob; each "*" captures part of the name
+	To   string `yaml:"to"`   // Replacement, with each "*" filled by the corresponding capture
+}
+
+// registryRewriter applies the first matching rewrite rule to an image name
+type registryRewriter struct {
+	patterns []*regexp.Regexp
+	targets  []string
+}
+
+// newRegistryRewriter compiles rewrite rules, checking that every rule produces valid names
+func newRegistryRewriter(rules []RewriteRule) (*registryRewriter, error) {
+	rewriter := &registryRewriter{}
+	for _, rule := range rules {
+		wildcards := strings.Count(rule.From, "*")
+		if strings.Count(rule.To, "*") != wildcards {
+			return nil, fmt.Errorf("rewrite %s -> %s: both sides need the same number of *", rule.From, rule.To)
+		}
+		if _, err := name.NewRepository(strings.ReplaceAll(rule.To, "*", "x")); err != nil || !strings.Contains(rule.To, "/") {
+			return nil, fmt.Errorf("rewrite %s -> %s: target must be a registry/repository name", rule.From, rule.To)
+		}
+
+		var expr strings.Builder
+		expr.WriteString("^")
+		for i, part := range strings.Split(rule.From, "*") {
+			if i > 0 {
+				expr.WriteString("(.+)")
+			}
+			expr.WriteString(regexp.QuoteMeta(part))
+		}
+		expr.WriteString("$")
+		rewriter.patterns = append(rewriter.patterns, regexp.MustCompile(expr.String()))
+		rewriter.targets = append(rewriter.targets, rule.To)
+	}
+	return rewriter, nil
+}
+
+// Rewrite returns the registry and repository an image should be written with, or an
+// empty registry when no rule matches
+func (r *registryRewriter) Rewrite(image *ImageReference) (string, string) {
+	if r == nil {
+		return "", ""
+	}
+	qualified := image.Registry + "/" + image.Repository
+	for i, pattern := range r.patterns {
+		match := pattern.FindStringSubmatch(qualified)
+		if match == nil {
+			continue
+		}
+		target := r.targets[i]
+		for _, capture := range match[1:] {
+			target = strings.Replace(target, "*", capture, 1)
+		}
+		registry, repository, _ := strings.Cut(target, "/")
+		return registry, repository
+	}
+	return "", ""
+}
+
+// applyRewrite moves the written reference of a freshly pinned image to another registry,
+// by the first matching rewrite rule or to the registry's mirror when writeMirror is set
+func (du *ContainerfileUpdater) applyRewrite(cmd *FromCommand) {
+	registry, repository := du.rewriter.Rewrite(cmd.Image)
+	if registry == "" {
+		if rc := du.config.Registry(cmd.Image.Registry); rc != nil && rc.WriteMirror {
+			registry, repository = du.mirrorImage(cmd.Image)
+		}
+	}
+	if registry == "" {
+		return
+	}
+
+	cmd.RewrittenFrom = cmd.Image.Name()
+	cmd.Image.Registry = normalizeRegistry(registry)
+	cmd.Image.Repository = repository
+	slog.Debug("Rewriting reference", "image", cmd.Image.Original, "reference", cmd.Image.Name())
+}
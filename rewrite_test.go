@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryRewriter(t *testing.T) {
+	rewriter, err := newRegistryRewriter([]RewriteRule{
+		{From: "docker.io/*", To: "registry.corp/dockerhub-proxy/*"},
+		{From: "ghcr.io/*/tools/*", To: "registry.corp/ghcr/*/*"},
+	})
+	if err != nil {
+		t.Fatalf("newRegistryRewriter failed: %v", err)
+	}
+
+	du := NewContainerfileUpdater("Containerfile")
+	tests := map[string]string{
+		"alpine:3.20":                   "registry.corp/dockerhub-proxy/library/alpine",
+		"bitnami/redis:7":               "registry.corp/dockerhub-proxy/bitnami/redis",
+		"ghcr.io/example/tools/lint:1":  "registry.corp/ghcr/example/lint",
+		"ghcr.io/example/app:1":         "",
+		"registry.corp/internal/base:1": "",
+	}
+	for reference, expected := range tests {
+		image, err := du.parseImageReference(reference)
+		if err != nil {
+			t.Fatalf("parseImageReference(%q) failed: %v", reference, err)
+		}
+		registry, repository := rewriter.Rewrite(image)
+		got := ""
+		if registry != "" {
+			got = registry + "/" + repository
+		}
+		if got != expected {
+			t.Errorf("Rewrite(%q): got %q, want %q", reference, got, expected)
+		}
+	}
+
+	for _, rule := range []RewriteRule{
+		{From: "docker.io/*", To: "registry.corp/proxy"},
+		{From: "docker.io/*", To: "*"},
+		{From: "docker.io/*", To: "Registry Corp/*"},
+	} {
+		if _, err := newRegistryRewriter([]RewriteRule{rule}); err == nil {
+			t.Errorf("Expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestRewriteReconstruction(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/team/app:1.0")
+
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	originalContent := "FROM " + host + "/team/app:1.0 AS app\n" +
+		"# containerfile-updater: pin=tag-only\n" +
+		"FROM " + host + "/team/app:1.0\n"
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Rewrites = []RewriteRule{{From: host + "/team/*", To: "registry.corp/proxy/*"}}
+	updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	content, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	expectedContent := "FROM registry.corp/proxy/app@" + app.String() + " AS app\n" +
+		"# containerfile-updater: pin=tag-only\n" +
+		"FROM registry.corp/proxy/app:1.0\n"
+	if string(content) != expectedContent {
+		t.Errorf("Containerfile content mismatch.\nExpected:\n%s\nGot:\n%s", expectedContent, content)
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// defaultRunImagePatterns find images pulled by common tools inside RUN instructions
+var defaultRunImagePatterns = []string{
+	`\b(?:docker|podman|nerdctl) +(?:image +)?pull +(?:-\S+ +)*(?P<image>[^\s;&|]+)`,
+	`\bcrane +(?:export|pull|digest|manifest|config|copy|cp) +(?:-\S+ +)*(?P<image>[^\s;&|]+)`,
+	`\bskopeo +(?:copy|inspect) +(?:-\S+ +)*docker://(?P<image>[^\s;&|]+)`,
+}
+
+// RunImagesConfig enables pinning images referenced by commands inside RUN instructions
+type RunImagesConfig struct {
+	Enabled  bool     `yaml:"enabled"`  // Scan RUN instructions (also enabled by --scan-run)
+	Patterns []string `yaml:"patterns"` // Extra regular expressions, each with an (?P<image>...) group
+}
+
+// runImageScanner finds image references in RUN instructions
+type runImageScanner struct {
+	patterns []*regexp.Regexp
+}
+
+// newRunImageScanner compiles the built-in patterns followed by the configured ones
+func newRunImageScanner(cfg RunImagesConfig) (*runImageScanner, error) {
+	scanner := &runImageScanner{}
+	for _, pattern := range append(slices.Clone(defaultRunImagePatterns), cfg.Patterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RUN image pattern %q: %w", pattern, err)
+		}
+		if re.SubexpIndex("image") < 0 {
+			return nil, fmt.Errorf("RUN image pattern %q has no (?P<image>...) group", pattern)
+		}
+		scanner.patterns = append(scanner.patterns, re)
+	}
+	return scanner, nil
+}
+
+// runImageMatch is an image reference found on a line
+type runImageMatch struct {
+	start, end int
+	reference  string
+}
+
+// scanLine returns the image references on a line, rightmost first so that rewriting one
+// doesn't move the others
+func (s *runImageScanner) scanLine(line string) []runImageMatch {
+	var matches []runImageMatch
+	for _, re := range s.patterns {
+		group := re.SubexpIndex("image")
+		for _, loc := range re.FindAllStringSubmatchIndex(line, -1) {
+			start, end := loc[2*group], loc[2*group+1]
+			if start < 0 || slices.ContainsFunc(matches, func(m runImageMatch) bool { return m.start == start }) {
+				continue
+			}
+			matches = append(matches, runImageMatch{start: start, end: end, reference: line[start:end]})
+		}
+	}
+	slices.SortFunc(matches, func(a, b runImageMatch) int { return b.start - a.start })
+	return matches
+}
+
+// extractRunImages returns the images referenced by commands inside RUN instructions,
+// including heredoc bodies. References built from variables are left alone.
+func (du *ContainerfileUpdater) extractRunImages(ast *parser.Node) ([]*FromCommand, error) {
+	data, err := du.readContent()
+	if err != nil {
+		return nil, err
+	}
+	lines, _ := splitLines(string(data))
+
+	var images []*FromCommand
+	for _, node := range ast.Children {
+		if !strings.EqualFold(node.Value, "run") {
+			continue
+		}
+
+		annotations, err := parseAnnotations(node.PrevComment)
+		if err != nil {
+			slog.Warn("Ignoring invalid annotation comment", "prefix", annotationPrefix, "line", node.StartLine, "error", err)
+			annotations = &ImageAnnotations{}
+		}
+
+		for lineNumber := node.StartLine; lineNumber <= node.EndLine && lineNumber <= len(lines); lineNumber++ {
+			for _, match := range du.runScanner.scanLine(lines[lineNumber-1]) {
+				if strings.ContainsAny(match.reference, "$") {
+					slog.Debug("Skipping RUN image built from variables", "line", lineNumber, "image", match.reference)
+					continue
+				}
+				image, err := du.parseImageReference(match.reference)
+				if err != nil {
+					continue
+				}
+				if _, err := name.ParseReference(image.TaggedName()); err != nil {
+					slog.Debug("Skipping invalid RUN image reference", "line", lineNumber, "image", match.reference)
+					continue
+				}
+
+				slog.Debug("Found image in RUN instruction", "line", lineNumber, "image", match.reference)
+				cmd := &FromCommand{
+					Image:       image,
+					LineStart:   lineNumber,
+					LineEnd:     lineNumber,
+					Annotations: annotations,
+					editor:      spanEditor(match.start),
+				}
+				du.applySkipRules(cmd)
+				images = append(images, cmd)
+			}
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanRunImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	base := pushRandomImage(t, server, host+"/base:1.0")
+	tool := pushRandomImage(t, server, host+"/tool:2.0")
+	helper := pushRandomImage(t, server, host+"/helper:3.0")
+	custom := pushRandomImage(t, server, host+"/custom:4.0")
+
+	originalContent := "FROM " + host + "/base:1.0\n" +
+		"RUN crane export " + host + "/tool:2.0 - | tar -x && \\\n" +
+		"    podman pull --quiet " + host + "/helper:3.0; docker pull " + host + "/tool:2.0\n" +
+		"RUN docker pull ${REGISTRY}/tool:2.0\n" +
+		"RUN fetch-image " + host + "/custom:4.0\n"
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.RunImages.Patterns = []string{`fetch-image (?P<image>\S+)`}
+	for _, enabled := range []bool{false, true} {
+		containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+		if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+
+		cfg.RunImages.Enabled = enabled
+		updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		expectedContent := "FROM " + host + "/base@" + base.String() + "\n"
+		if enabled {
+			expectedContent += "RUN crane export " + host + "/tool@" + tool.String() + " - | tar -x && \\\n" +
+				"    podman pull --quiet " + host + "/helper@" + helper.String() + "; docker pull " + host + "/tool@" + tool.String() + "\n" +
+				"RUN docker pull ${REGISTRY}/tool:2.0\n" +
+				"RUN fetch-image " + host + "/custom@" + custom.String() + "\n"
+		} else {
+			expectedContent += originalContent[len("FROM "+host+"/base:1.0\n"):]
+		}
+
+		content, err := os.ReadFile(containerfilePath)
+		if err != nil {
+			t.Fatalf("Failed to read Containerfile: %v", err)
+		}
+		if string(content) != expectedContent {
+			t.Errorf("enabled=%v: content mismatch.\nExpected:\n%s\nGot:\n%s", enabled, expectedContent, content)
+		}
+	}
+}
+
+func TestRunImagePatternValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		wantErr  bool
+	}{
+		{name: "defaults only"},
+		{name: "named group", patterns: []string{`oras pull (?P<image>\S+)`}},
+		{name: "missing group", patterns: []string{`oras pull (\S+)`}, wantErr: true},
+		{name: "invalid regexp", patterns: []string{`oras pull (?P<image>`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRunImageScanner(RunImagesConfig{Enabled: true, Patterns: tt.patterns})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newRunImageScanner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"io"
+)
+
+// outputSARIF reports policy findings as a SARIF log for code scanning
+const outputSARIF = "sarif"
+
+// sarifSchema is the schema of SARIF 2.1.0 logs
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// sarifLog is the subset of the SARIF 2.1.0 format code scanning reads
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes the findings of every file as a SARIF log. Paths are relative to the
+// working directory, which code scanning expects to be the repository root.
+func writeSARIF(w io.Writer, files []FileFindings) error {
+	driver := sarifDriver{
+		Name:           "containerfile-updater",
+		Version:        currentBuildInfo().Version,
+		InformationURI: "https://github.com/drGrove/containerfile-updater",
+		Rules:          []sarifRule{},
+	}
+	for _, rule := range findingRules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.id,
+			ShortDescription:     sarifMessage{Text: rule.description},
+			DefaultConfiguration: sarifConfiguration{Level: rule.level},
+		})
+	}
+
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	for _, file := range files {
+		for _, finding := range file.Findings {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  finding.Rule,
+				Level:   finding.Level,
+				Message: sarifMessage{Text: finding.Message},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: file.File},
+					Region:           sarifRegion{StartLine: max(finding.Line, 1)},
+				}}},
+			})
+		}
+	}
+	return writeJSONReport(w, &sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindingsSARIF(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	pinned := pushRandomImage(t, server, host+"/base:1.0")
+	pushRandomImage(t, server, host+"/app:latest")
+	pushRandomImage(t, server, host+"/internal/tool:2")
+
+	content := "FROM " + host + "/base:1.0@" + pinned.String() + " AS build\n" +
+		"FROM " + host + "/app\n" +
+		"FROM " + host + "/internal/tool:2\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Images.Deny = []string{host + "/internal/*"}
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	updater.checkOnly = true
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	type result struct {
+		rule string
+		line int
+	}
+	expected := []result{
+		{rule: ruleUnpinnedImage, line: 2},
+		{rule: ruleLatestTag, line: 2},
+		{rule: ruleDisallowedImage, line: 3},
+		{rule: ruleUnpinnedImage, line: 3},
+	}
+	findings := updater.Findings()
+	if len(findings) != len(expected) {
+		t.Fatalf("Expected %d findings, got %+v", len(expected), findings)
+	}
+	for i, finding := range findings {
+		if got := (result{rule: finding.Rule, line: finding.Line}); got != expected[i] {
+			t.Errorf("Finding %d = %+v, want %+v", i, got, expected[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeSARIF(&out, []FileFindings{{File: displayPath(path), Findings: updater.Report().Findings}}); err != nil {
+		t.Fatalf("writeSARIF failed: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Invalid SARIF: %v\n%s", err, out.String())
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(findingRules) {
+		t.Fatalf("Unexpected SARIF log:\n%s", out.String())
+	}
+	results := log.Runs[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	disallowed := results[2]
+	location := disallowed.Locations[0].PhysicalLocation
+	if disallowed.RuleID != ruleDisallowedImage || disallowed.Level != levelError || location.ArtifactLocation.URI != displayPath(path) || location.Region.StartLine != 3 {
+		t.Errorf("Unexpected result %+v", disallowed)
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	if err := validateOutputFormat(outputSARIF); err == nil {
+		t.Error("Expected sarif to be rejected where it isn't supported")
+	}
+	if err := validateOutputFormat(outputSARIF, outputSARIF); err != nil {
+		t.Errorf("validateOutputFormat() failed: %v", err)
+	}
+	if err := validateOutputFormat("xml", outputSARIF); err == nil || err.Error() != `unknown output format "xml" (expected text, json or sarif)` {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// imageSelection limits a run to the images named with --only, the images used by the
+// build stages named with --stage and, with --only-unpinned, images without a digest,
+// leaving every other pin as written
+type imageSelection struct {
+	images   []*regexp.Regexp
+	stages   []string // Lowercased stage names or indexes
+	unpinned bool     // Only images not pinned to a digest yet
+}
+
+// newImageSelection compiles --only patterns and --stage names. Both flags take
+// comma-separated lists. It returns nil when nothing is selected.
+func newImageSelection(only, stages []string, unpinned bool) (*imageSelection, error) {
+	only, stages = splitList(only), splitList(stages)
+	if len(only) == 0 && len(stages) == 0 && !unpinned {
+		return nil, nil
+	}
+	images, err := compilePatterns(only)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --only pattern: %w", err)
+	}
+	for i, stage := range stages {
+		stages[i] = strings.ToLower(stage)
+	}
+	return &imageSelection{images: images, stages: stages, unpinned: unpinned}, nil
+}
+
+// splitList splits comma-separated flag values and drops empty entries
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// skipReason returns why an image is outside the selection, or an empty string if it is in
+// it. Images must match --only when given, be used by a --stage when given and have no
+// digest with --only-unpinned.
+func (s *imageSelection) skipReason(cmd *FromCommand, graph *StageGraph) string {
+	if s == nil {
+		return ""
+	}
+	if s.unpinned && cmd.Image.Digest != "" {
+		return "already pinned (--only-unpinned)"
+	}
+	if len(s.images) > 0 && matchAny(s.images, selectionCandidates(cmd.Image)) == "" {
+		return "not selected by --only"
+	}
+	if len(s.stages) > 0 && !s.inStages(cmd, graph) {
+		return "not used by stage " + strings.Join(s.stages, ", ")
+	}
+	return ""
+}
+
+// selectionCandidates returns the spellings --only patterns are matched against: those of
+// the allow and deny lists, plus the repository with and without its registry and its
+// short name, so "golang" selects docker.io/library/golang:1.22
+func selectionCandidates(image *ImageReference) []string {
+	return append(referenceCandidates(image),
+		image.Repository,
+		path.Base(image.Repository),
+		image.Registry+"/"+image.Repository,
+		strings.TrimPrefix(image.Repository, "library/"),
+	)
+}
+
+// inStages reports whether an image is used by one of the selected stages: written within
+// the stage, or a build argument its FROM, COPY --from or RUN --mount=from refers to
+func (s *imageSelection) inStages(cmd *FromCommand, graph *StageGraph) bool {
+	if graph == nil {
+		// Only Containerfiles have stages
+		return false
+	}
+	for _, stage := range graph.Stages {
+		if !slices.Contains(s.stages, strings.ToLower(stage.Name)) && !slices.Contains(s.stages, fmt.Sprint(stage.Index)) {
+			continue
+		}
+		if cmd.LineStart >= stage.Line && cmd.LineStart <= stage.endLine {
+			return true
+		}
+		if cmd.Arg == "" {
+			continue
+		}
+		for _, edge := range graph.Edges {
+			if arg, ok := argImageName(edge.FromImage); ok && arg == cmd.Arg && edge.To == stage.ID() {
+				return true
+			}
+		}
+	}
+	return false
+}
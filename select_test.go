@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// selectedImages extracts the images of a Containerfile under a selection and returns
+// which of them would be updated, keyed by reference as written
+func selectedImages(t *testing.T, only, stages []string, unpinned bool, content string) map[string]bool {
+	t.Helper()
+	selection, err := newImageSelection(only, stages, unpinned)
+	if err != nil {
+		t.Fatalf("newImageSelection() failed: %v", err)
+	}
+	du := NewContainerfileUpdaterWithConfig("Containerfile", NewConfig())
+	du.input = []byte(content)
+	du.selection = selection
+	commands, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("Failed to extract images: %v", err)
+	}
+	selected := make(map[string]bool)
+	for _, cmd := range commands {
+		selected[cmd.Image.Original] = cmd.SkipReason == ""
+	}
+	return selected
+}
+
+func TestImageSelection(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	content := "ARG TOOLS=ghcr.io/org/tools:2.0\n" +
+		"FROM golang:1.22 AS builder\n" +
+		"FROM $TOOLS AS tools\n" +
+		"FROM ubuntu:24.04@sha256:" + strings.Repeat("a", 64) + "\n" +
+		"COPY --from=builder /app /app\n"
+
+	tests := []struct {
+		name     string
+		only     []string
+		stages   []string
+		unpinned bool
+		selected map[string]bool
+	}{
+		{
+			name:     "short names",
+			only:     []string{"golang,ubuntu"},
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": false, "golang:1.22": true, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): true},
+		},
+		{
+			name:     "patterns",
+			only:     []string{"ghcr.io/org/*"},
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": true, "golang:1.22": false, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): false},
+		},
+		{
+			name:     "stages",
+			stages:   []string{"Builder", "tools"},
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": true, "golang:1.22": true, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): false},
+		},
+		{
+			name:     "stage index",
+			stages:   []string{"2"},
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": false, "golang:1.22": false, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): true},
+		},
+		{
+			name:     "unpinned",
+			unpinned: true,
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": true, "golang:1.22": true, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): false},
+		},
+		{
+			name:     "unpinned images",
+			only:     []string{"ubuntu", "golang"},
+			unpinned: true,
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": false, "golang:1.22": true, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): false},
+		},
+		{
+			name:     "images and stages",
+			only:     []string{"golang", "ubuntu"},
+			stages:   []string{"builder"},
+			selected: map[string]bool{"ghcr.io/org/tools:2.0": false, "golang:1.22": true, "ubuntu:24.04@sha256:" + strings.Repeat("a", 64): false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := selectedImages(t, tt.only, tt.stages, tt.unpinned, content)
+			for image, want := range tt.selected {
+				if got, ok := selected[image]; !ok || got != want {
+					t.Errorf("%s selected = %v (found %v), want %v", image, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewImageSelection(t *testing.T) {
+	if selection, err := newImageSelection(nil, []string{" , "}, false); selection != nil || err != nil {
+		t.Errorf("Expected no selection for empty lists, got %+v, %v", selection, err)
+	}
+	if _, err := newImageSelection([]string{"re:("}, nil, false); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
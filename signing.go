@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Supported signers
+const (
+	signerCosign = "cosign" // cosign sign-blob with a key, KMS URI or keyless (Fulcio/Rekor)
+	signerKey    = "key"    // Built in, with a PEM private key (ECDSA, Ed25519 or RSA)
+)
+
+// Suffixes of the files signatures are written to, next to the signed file
+const (
+	signatureSuffix = ".sig"           // base64 signature, as written by cosign --output-signature
+	bundleSuffix    = ".sigstore.json" // Sigstore bundle with the signature, certificate and transparency log entry
+)
+
+// defaultSigningTimeout bounds a single cosign invocation, which may wait on Fulcio and Rekor
+const defaultSigningTimeout = 2 * time.Minute
+
+// SigningConfig configures the signatures of the lock file and the JSON report
+type SigningConfig struct {
+	Signer  string        `yaml:"signer"`  // cosign or key; empty disables signing
+	Key     string        `yaml:"key"`     // Key file or KMS URI for cosign (keyless if empty), PEM private key file for key
+	Timeout time.Duration `yaml:"timeout"` // Time allowed per cosign signature (default 2m)
+}
+
+// validateSigningConfig rejects unknown signers and missing keys
+func validateSigningConfig(sc SigningConfig) error {
+	switch sc.Signer {
+	case "":
+		if sc.Key != "" {
+			return fmt.Errorf("signing key needs a signer (%s or %s)", signerCosign, signerKey)
+		}
+	case signerCosign:
+	case signerKey:
+		if sc.Key == "" {
+			return fmt.Errorf("the %s signer needs a signing key", signerKey)
+		}
+	default:
+		return fmt.Errorf("unknown signer %q (expected %s or %s)", sc.Signer, signerCosign, signerKey)
+	}
+	if sc.Timeout < 0 {
+		return fmt.Errorf("signing timeout must not be negative")
+	}
+	return nil
+}
+
+// signaturePath returns the file the signature of a file is written to
+func (sc SigningConfig) signaturePath(path string) string {
+	if sc.Signer == signerCosign {
+		return path + bundleSuffix
+	}
+	return path + signatureSuffix
+}
+
+// signFile signs a file, writing the signature next to it, and returns the signature's path
+func (sc SigningConfig) signFile(path string) (string, error) {
+	signature := sc.signaturePath(path)
+	switch sc.Signer {
+	case signerCosign:
+		if err := sc.cosignSignBlob(path, signature); err != nil {
+			return "", err
+		}
+	case signerKey:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		signer, err := loadSigningKey(sc.Key)
+		if err != nil {
+			return "", err
+		}
+		sig, err := signBlob(signer, data)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign %s: %w", path, err)
+		}
+		if err := writeFileAtomic(signature, []byte(base64.StdEncoding.EncodeToString(sig))); err != nil {
+			return "", fmt.Errorf("failed to write signature: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("no signer configured")
+	}
+	slog.Info("Signed file", "path", path, "signature", signature, "signer", sc.Signer)
+	return signature, nil
+}
+
+// cosignSignBlob signs a file with cosign, writing a Sigstore bundle. Without a key cosign
+// signs keyless, using the ambient OIDC identity such as a GitHub Actions token.
+func (sc SigningConfig) cosignSignBlob(path, bundle string) error {
+	timeout := sc.Timeout
+	if timeout == 0 {
+		timeout = defaultSigningTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	args := []string{"sign-blob", "--yes", "--bundle", bundle}
+	if sc.Key != "" {
+		args = append(args, "--key", sc.Key)
+	}
+	cmd := exec.CommandContext(ctx, signerCosign, append(args, path)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cosign sign-blob failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// loadSigningKey reads an unencrypted PEM private key in PKCS#8, SEC 1 or PKCS#1 form
+func loadSigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %q in %s (encrypted keys need the %s signer)", block.Type, path, signerCosign)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey, ed25519.PrivateKey, *rsa.PrivateKey:
+		return key.(crypto.Signer), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key algorithm %T in %s", key, path)
+	}
+}
+
+// signBlob signs data the way cosign verify-blob and openssl dgst -sha256 check it: a
+// SHA-256 digest for ECDSA (ASN.1) and RSA (PKCS #1 v1.5), the message itself for Ed25519
+func signBlob(signer crypto.Signer, data []byte) ([]byte, error) {
+	if _, ok := signer.(ed25519.PrivateKey); ok {
+		return signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
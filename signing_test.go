@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSigningKey writes a private key as PEM and returns its path
+func writeSigningKey(t *testing.T, dir string, key crypto.Signer) string {
+	t.Helper()
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	var err error
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+	} else if block.Bytes, err = x509.MarshalPKCS8PrivateKey(key); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "signing.key")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSignFile(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`{"version": 1, "files": {}}` + "\n")
+	digest := sha256.Sum256(data)
+	tests := []struct {
+		name   string
+		key    crypto.Signer
+		verify func(sig []byte) bool
+	}{
+		{"ecdsa", ecdsaKey, func(sig []byte) bool { return ecdsa.VerifyASN1(&ecdsaKey.PublicKey, digest[:], sig) }},
+		{"ed25519", ed25519Key, func(sig []byte) bool { return ed25519.Verify(ed25519Key.Public().(ed25519.PublicKey), data, sig) }},
+		{"rsa", rsaKey, func(sig []byte) bool {
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig) == nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, defaultLockFile)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			signing := SigningConfig{Signer: signerKey, Key: writeSigningKey(t, dir, tt.key)}
+			signature, err := signing.signFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signature != path+signatureSuffix {
+				t.Errorf("Expected signature %s, got %s", path+signatureSuffix, signature)
+			}
+			encoded, err := os.ReadFile(signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := base64.StdEncoding.DecodeString(string(encoded))
+			if err != nil {
+				t.Fatalf("Signature is not base64: %v", err)
+			}
+			if !tt.verify(sig) {
+				t.Error("Signature does not verify")
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "encrypted.key")
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("x")}), 0600)
+	if _, err := loadSigningKey(keyPath); err == nil {
+		t.Error("Expected encrypted keys to be rejected")
+	}
+}
+
+func TestValidateSigningConfig(t *testing.T) {
+	tests := []struct {
+		config  SigningConfig
+		wantErr bool
+	}{
+		{SigningConfig{}, false},
+		{SigningConfig{Signer: signerCosign}, false},
+		{SigningConfig{Signer: signerCosign, Key: "awskms:///alias/pins"}, false},
+		{SigningConfig{Signer: signerKey, Key: "signing.key"}, false},
+		{SigningConfig{Signer: signerKey}, true},
+		{SigningConfig{Key: "signing.key"}, true},
+		{SigningConfig{Signer: "gpg"}, true},
+		{SigningConfig{Signer: signerCosign, Timeout: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := validateSigningConfig(tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("validateSigningConfig(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSignedLockFileAndReport(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	pushRandomImage(t, server, host+"/app:latest")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM "+host+"/app:latest\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Signing = SigningConfig{Signer: signerKey, Key: writeSigningKey(t, dir, key)}
+	lockPath := filepath.Join(dir, defaultLockFile)
+	reportPath := filepath.Join(dir, "report.json")
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, backup: BackupPolicy{Disabled: true}, lockFile: lockPath, report: reportPath, out: io.Discard}
+	if exitCode := run.run(); exitCode != exitUpdatesNeeded {
+		t.Fatalf("Expected exit code %d, got %d", exitUpdatesNeeded, exitCode)
+	}
+
+	for _, signed := range []string{lockPath, reportPath} {
+		data, err := os.ReadFile(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := os.ReadFile(signed + signatureSuffix)
+		if err != nil {
+			t.Fatalf("%s was not signed: %v", filepath.Base(signed), err)
+		}
+		sig, _ := base64.StdEncoding.DecodeString(string(encoded))
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+			t.Errorf("Signature of %s does not verify", filepath.Base(signed))
+		}
+	}
+
+	// An unchanged lock file keeps its signature, a missing one is added
+	if err := os.Remove(lockPath + signatureSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if exitCode := run.run(); exitCode != exitOK {
+		t.Fatalf("Expected exit code %d, got %d", exitOK, exitCode)
+	}
+	if _, err := os.Stat(lockPath + signatureSuffix); err != nil {
+		t.Errorf("Unsigned lock file was not signed: %v", err)
+	}
+}
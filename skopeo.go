@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Backends digests of a registry can be resolved with
+const (
+	resolverRegistry = "registry" // go-containerregistry, for every registry
+	resolverSkopeo   = "skopeo"   // The skopeo CLI, whose containers/image library copes with some older Harbor and Nexus versions
+)
+
+// skopeoCommand is the skopeo executable, looked up on PATH
+var skopeoCommand = "skopeo"
+
+// skopeoNotFound are the messages skopeo reports a missing manifest with
+var skopeoNotFound = []string{"manifest unknown", "name unknown"}
+
+// validateResolver rejects unknown digest resolvers
+func validateResolver(resolver string) error {
+	switch resolver {
+	case "", resolverRegistry, resolverSkopeo:
+		return nil
+	}
+	return fmt.Errorf("unknown resolver %q (expected %s or %s)", resolver, resolverRegistry, resolverSkopeo)
+}
+
+// registryResolver returns the backend the digests of a registry are resolved with
+func registryResolver(cfg *Config, registry string) string {
+	if rc := cfg.Registry(registry); rc != nil && rc.Resolver != "" {
+		return rc.Resolver
+	}
+	return resolverRegistry
+}
+
+// skopeoDigest resolves the digest of a reference by fetching its raw manifest with skopeo.
+// Credentials come from the same keychain as registry requests; registries without any
+// fall back to skopeo's own auth files.
+func (du *ContainerfileUpdater) skopeoDigest(ctx context.Context, registry, fullRef string) (string, error) {
+	raw, err := du.skopeoInspect(ctx, registry, fullRef, false)
+	if err != nil {
+		return "", err
+	}
+	return rawDigest(raw)
+}
+
+// rawDigest returns the digest of a raw manifest
+func rawDigest(raw []byte) (string, error) {
+	hash, _, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// skopeoInspect fetches the raw manifest of a reference with skopeo, or with config the raw
+// config of a single image
+func (du *ContainerfileUpdater) skopeoInspect(ctx context.Context, registry, fullRef string, config bool) (raw []byte, err error) {
+	ref, err := name.ParseReference(fullRef, referenceOptions(du.config, registry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reference %s: %w", fullRef, err)
+	}
+
+	args := []string{"inspect", "--raw", "--retry-times", "0"}
+	if config {
+		args = append(args, "--config")
+	}
+	if rc := du.config.Registry(registry); rc != nil && rc.Insecure {
+		args = append(args, "--tls-verify=false")
+	}
+	authArgs, cleanup, err := du.skopeoAuthArgs(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	args = append(append(args, authArgs...), "docker://"+ref.Name())
+
+	start := time.Now()
+	defer func() {
+		digest := ""
+		if err == nil && !config {
+			digest, _ = rawDigest(raw)
+		}
+		du.audit.recordCommand(ctx, registry, "skopeo inspect", "docker://"+ref.Name(), du.auditCredentials(registry), start, digest, err)
+	}()
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, skopeoCommand, args...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		for _, notFound := range skopeoNotFound {
+			if strings.Contains(strings.ToLower(message), notFound) {
+				return nil, &transport.Error{StatusCode: http.StatusNotFound, Errors: []transport.Diagnostic{{Code: transport.ManifestUnknownErrorCode, Message: message}}}
+			}
+		}
+		if message != "" {
+			err = fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, fmt.Errorf("skopeo failed to fetch manifest for %s: %w", ref, err)
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("skopeo returned an empty manifest for %s", ref)
+	}
+	return stdout.Bytes(), nil
+}
+
+// skopeoAuthArgs returns the skopeo arguments passing the credentials of a reference's
+// registry, with a function removing what they left behind. Credentials, bearer tokens
+// included, are written to a temporary auth file, so they don't show up in the process list;
+// registrytoken entries need skopeo 1.9 or later.
+func (du *ContainerfileUpdater) skopeoAuthArgs(ref name.Reference) ([]string, func(), error) {
+	none := func() {}
+	auth, err := du.keychain.Resolve(ref.Context())
+	if err != nil {
+		return nil, none, fmt.Errorf("failed to resolve credentials for %s: %w", ref.Context().RegistryStr(), err)
+	}
+	if auth == authn.Anonymous {
+		return nil, none, nil
+	}
+	config, err := auth.Authorization()
+	if err != nil {
+		return nil, none, err
+	}
+
+	entry := map[string]string{}
+	switch {
+	case config.RegistryToken != "":
+		entry["registrytoken"] = config.RegistryToken
+	case config.Auth != "":
+		entry["auth"] = config.Auth
+	case config.Username != "":
+		entry["auth"] = base64.StdEncoding.EncodeToString([]byte(config.Username + ":" + config.Password))
+	case config.IdentityToken != "":
+		entry["identitytoken"] = config.IdentityToken
+	default:
+		return nil, none, nil
+	}
+	// Auth files use docker.io for Docker Hub, like docker login
+	registry := ref.Context().RegistryStr()
+	if registry == name.DefaultRegistry {
+		registry = "docker.io"
+	}
+	data, err := json.Marshal(map[string]any{"auths": map[string]any{registry: entry}})
+	if err != nil {
+		return nil, none, err
+	}
+
+	dir, err := os.MkdirTemp("", "containerfile-updater-skopeo-")
+	if err != nil {
+		return nil, none, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	path := filepath.Join(dir, "auth.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		cleanup()
+		return nil, none, err
+	}
+	return []string{"--authfile", path}, cleanup, nil
+}
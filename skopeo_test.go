@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testSkopeoManifest is the raw manifest the fake skopeo prints
+const testSkopeoManifest = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+
+// writeFakeSkopeo writes a skopeo stand-in recording its arguments and the auth file it
+// was given, failing like skopeo for tags named missing
+func writeFakeSkopeo(t *testing.T) (path, argsFile, authFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	path = filepath.Join(dir, "skopeo")
+	argsFile = filepath.Join(dir, "args")
+	authFile = filepath.Join(dir, "auth.json")
+	script := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+while [ $# -gt 0 ]; do
+  if [ "$1" = --authfile ]; then cp "$2" ` + authFile + `; fi
+  last=$1
+  shift
+done
+case "$last" in
+  *:missing) echo "reading manifest missing in $last: manifest unknown" >&2; exit 1 ;;
+esac
+printf '%s' '` + testSkopeoManifest + `'
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, argsFile, authFile
+}
+
+func TestSkopeoResolver(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake skopeo needs a Unix shell")
+	}
+	restore := disableLogging()
+	defer restore()
+	fake, argsFile, authFile := writeFakeSkopeo(t)
+	defer func(command string) { skopeoCommand = command }(skopeoCommand)
+	skopeoCommand = fake
+
+	cfg := NewConfig()
+	harbor := cfg.RegistryOrCreate("harbor.example")
+	harbor.Resolver = resolverSkopeo
+	harbor.Insecure = true
+	harbor.Auth = &RegistryAuth{Username: "robot$ci", Password: "secret"}
+	updater := NewContainerfileUpdaterWithConfig("Containerfile", cfg)
+
+	digest, err := updater.resolveDigest(t.Context(), "harbor.example", "harbor.example/team/app:1.0")
+	if err != nil {
+		t.Fatalf("resolveDigest failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte(testSkopeoManifest))
+	if want := "sha256:" + hex.EncodeToString(sum[:]); digest != want {
+		t.Errorf("Expected the digest of the raw manifest %s, got %s", want, digest)
+	}
+
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "--tls-verify=false") || !strings.HasSuffix(strings.TrimSpace(string(args)), "docker://harbor.example/team/app:1.0") {
+		t.Errorf("Unexpected skopeo arguments: %s", args)
+	}
+	if strings.Contains(string(args), "secret") {
+		t.Errorf("Credentials leaked into the arguments: %s", args)
+	}
+	auth, err := os.ReadFile(authFile)
+	if err != nil {
+		t.Fatalf("Expected an auth file: %v", err)
+	}
+	// base64 of robot$ci:secret
+	if !strings.Contains(string(auth), `"harbor.example":{"auth":"cm9ib3QkY2k6c2VjcmV0"}`) {
+		t.Errorf("Unexpected auth file: %s", auth)
+	}
+
+	_, err = updater.resolveDigest(t.Context(), "harbor.example", "harbor.example/team/app:missing")
+	if !isNotFound(err) || !strings.Contains(err.Error(), "manifest unknown") {
+		t.Errorf("Expected a not found error with skopeo's message, got %v", err)
+	}
+}
+
+func TestSkopeoResolverRegistryToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake skopeo needs a Unix shell")
+	}
+	restore := disableLogging()
+	defer restore()
+	fake, argsFile, authFile := writeFakeSkopeo(t)
+	defer func(command string) { skopeoCommand = command }(skopeoCommand)
+	skopeoCommand = fake
+
+	cfg := NewConfig()
+	nexus := cfg.RegistryOrCreate("nexus.example")
+	nexus.Resolver = resolverSkopeo
+	nexus.Auth = &RegistryAuth{Token: "bearer-secret"}
+	updater := NewContainerfileUpdaterWithConfig("Containerfile", cfg)
+
+	if _, err := updater.resolveDigest(t.Context(), "nexus.example", "nexus.example/team/app:1.0"); err != nil {
+		t.Fatalf("resolveDigest failed: %v", err)
+	}
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), "bearer-secret") || strings.Contains(string(args), "--registry-token") {
+		t.Errorf("The bearer token leaked into the arguments: %s", args)
+	}
+	auth, err := os.ReadFile(authFile)
+	if err != nil {
+		t.Fatalf("Expected an auth file: %v", err)
+	}
+	if !strings.Contains(string(auth), `"nexus.example":{"registrytoken":"bearer-secret"}`) {
+		t.Errorf("Unexpected auth file: %s", auth)
+	}
+}
+
+func TestValidateResolver(t *testing.T) {
+	for _, resolver := range []string{"", resolverRegistry, resolverSkopeo} {
+		if err := validateResolver(resolver); err != nil {
+			t.Errorf("validateResolver(%q) failed: %v", resolver, err)
+		}
+	}
+	if err := validateResolver("containers-image"); err == nil {
+		t.Error("Expected an error for an unknown resolver")
+	}
+}
@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Staleness of a pinned image
+const (
+	staleCurrent  = "current"  // The tag still points to the pinned digest
+	staleBehind   = "stale"    // The tag moved on to another digest
+	staleUnpinned = "unpinned" // No digest is pinned, so nothing can fall behind
+)
+
+// Version components a semantic version can fall behind by
+const (
+	deltaMajor = "major"
+	deltaMinor = "minor"
+	deltaPatch = "patch"
+)
+
+// ImageStaleness describes how far a pinned digest is behind the head of its tag
+type ImageStaleness struct {
+	File         string     `json:"file"`
+	Line         int        `json:"line"`
+	Image        string     `json:"image"` // Reference as written
+	Status       string     `json:"status,omitempty"`
+	Tag          string     `json:"tag,omitempty"`
+	Digest       string     `json:"digest,omitempty"`     // Pinned digest
+	HeadDigest   string     `json:"headDigest,omitempty"` // Digest the tag points to now
+	Created      *time.Time `json:"created,omitempty"`    // Creation time of the pinned digest
+	HeadCreated  *time.Time `json:"headCreated,omitempty"`
+	BehindDays   int        `json:"behindDays,omitempty"` // Days between the pinned digest and the head
+	Version      string     `json:"version,omitempty"`    // Version annotation or label of the pinned digest
+	HeadVersion  string     `json:"headVersion,omitempty"`
+	VersionDelta string     `json:"versionDelta,omitempty"` // major, minor or patch between the versions
+	LatestTag    string     `json:"latestTag,omitempty"`    // Highest tag of the same version scheme
+	LatestDelta  string     `json:"latestDelta,omitempty"`  // major, minor or patch between the tag and the latest
+	Skipped      string     `json:"skipped,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// semverPattern matches version tags such as 1.22, v2.4.1 or 3.19.1-alpine
+var semverPattern = regexp.MustCompile(`^(v?)(\d+)(?:\.(\d+))?(?:\.(\d+))?(-[0-9A-Za-z.-]+)?$`)
+
+// tagVersion is a version tag broken into its numeric components
+type tagVersion struct {
+	prefix  string // "v" or empty
+	numbers []int  // One to three components
+	suffix  string // Variant such as -alpine, compared exactly
+}
+
+// parseTagVersion parses a version tag
+func parseTagVersion(tag string) (tagVersion, bool) {
+	match := semverPattern.FindStringSubmatch(tag)
+	if match == nil {
+		return tagVersion{}, false
+	}
+	version := tagVersion{prefix: match[1], suffix: match[5]}
+	for _, component := range match[2:5] {
+		if component == "" {
+			break
+		}
+		number, err := strconv.Atoi(component)
+		if err != nil {
+			return tagVersion{}, false
+		}
+		version.numbers = append(version.numbers, number)
+	}
+	return version, true
+}
+
+// sameScheme reports whether two versions can be compared: same prefix, variant and
+// number of components, so 1.22-alpine is never compared with 1.23.0
+func (v tagVersion) sameScheme(other tagVersion) bool {
+	return v.prefix == other.prefix && v.suffix == other.suffix && len(v.numbers) == len(other.numbers)
+}
+
+// delta returns the most significant component by which v is behind newer, or an empty
+// string when it isn't behind
+func (v tagVersion) delta(newer tagVersion) string {
+	for i, kind := range []string{deltaMajor, deltaMinor, deltaPatch} {
+		if i >= len(v.numbers) || i >= len(newer.numbers) {
+			break
+		}
+		if newer.numbers[i] > v.numbers[i] {
+			return kind
+		}
+		if newer.numbers[i] < v.numbers[i] {
+			return ""
+		}
+	}
+	return ""
+}
+
+// versionDelta compares two version strings, ignoring a v prefix and any variant
+func versionDelta(current, newer string) string {
+	a, ok := parseTagVersion(current)
+	if !ok {
+		return ""
+	}
+	b, ok := parseTagVersion(newer)
+	if !ok {
+		return ""
+	}
+	return a.delta(b)
+}
+
+// latestTag returns the highest tag of the same version scheme as tag, or an empty string
+// when tag isn't a version
+func latestTag(tag string, tags []string) string {
+	current, ok := parseTagVersion(tag)
+	if !ok {
+		return ""
+	}
+	latest, best := tag, current
+	for _, candidate := range tags {
+		version, ok := parseTagVersion(candidate)
+		if ok && version.sameScheme(current) && best.delta(version) != "" {
+			latest, best = candidate, version
+		}
+	}
+	return latest
+}
+
+// StaleImages reports how far every pinned image in the updater's file is behind its tag
+func (du *ContainerfileUpdater) StaleImages(listTags bool) ([]*ImageStaleness, error) {
+	commands, err := du.extractImages()
+	if err != nil {
+		return nil, err
+	}
+
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	results := []*ImageStaleness{}
+	for _, cmd := range commands {
+		staleness := &ImageStaleness{
+			File:    displayPath(du.containerfilePath),
+			Line:    cmd.LineStart,
+			Image:   cmd.Image.Original,
+			Tag:     cmd.Image.Tag,
+			Digest:  cmd.Image.Digest,
+			Skipped: cmd.SkipReason,
+		}
+		results = append(results, staleness)
+		switch {
+		case cmd.SkipReason != "":
+			continue
+		case cmd.Image.Digest == "":
+			staleness.Status = staleUnpinned
+			continue
+		}
+		if err := du.checkStaleness(runCtx, cmd, staleness, listTags); err != nil {
+			slog.Warn("Failed to check image", "image", cmd.Image.Original, "error", err)
+			staleness.Error = err.Error()
+		}
+	}
+	return results, nil
+}
+
+// checkStaleness compares a pinned digest with the head of its tag within the registry's
+// timeout for each lookup
+func (du *ContainerfileUpdater) checkStaleness(runCtx context.Context, cmd *FromCommand, staleness *ImageStaleness, listTags bool) error {
+	ctx, cancel, err := du.lookupContext(runCtx, cmd.Image.Registry)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	staleness.HeadDigest, err = du.resolveImageDigest(ctx, cmd.Image)
+	if err != nil {
+		return err
+	}
+	staleness.Status = staleCurrent
+	if staleness.HeadDigest != staleness.Digest {
+		staleness.Status = staleBehind
+	}
+
+	var pinned ImageInspection
+	if err := du.inspectImage(ctx, cmd, &pinned); err != nil {
+		return err
+	}
+	staleness.Created = pinned.Created
+	staleness.Version = firstNonEmpty(pinned.Annotations[annotationVersion], pinned.Labels[annotationVersion])
+
+	if staleness.Status == staleBehind {
+		head := *cmd
+		headImage := *cmd.Image
+		headImage.Digest = staleness.HeadDigest
+		head.Image = &headImage
+		var inspection ImageInspection
+		if err := du.inspectImage(ctx, &head, &inspection); err != nil {
+			return err
+		}
+		staleness.HeadCreated = inspection.Created
+		staleness.HeadVersion = firstNonEmpty(inspection.Annotations[annotationVersion], inspection.Labels[annotationVersion])
+		staleness.VersionDelta = versionDelta(staleness.Version, staleness.HeadVersion)
+		if staleness.Created != nil && staleness.HeadCreated != nil && staleness.HeadCreated.After(*staleness.Created) {
+			staleness.BehindDays = int(staleness.HeadCreated.Sub(*staleness.Created).Hours() / 24)
+		}
+	}
+
+	if !listTags {
+		return nil
+	}
+	if _, ok := parseTagVersion(cmd.Image.Tag); !ok {
+		return nil
+	}
+	tags, err := du.listTags(ctx, cmd.Image)
+	if err != nil {
+		// The comparison with the tag head stands on its own
+		slog.Warn("Failed to list tags", "image", cmd.Image.Original, "error", err)
+		return nil
+	}
+	if latest := latestTag(cmd.Image.Tag, tags); latest != cmd.Image.Tag {
+		staleness.LatestTag = latest
+		staleness.LatestDelta = versionDelta(cmd.Image.Tag, latest)
+	}
+	return nil
+}
+
+// writeStaleness prints one line per image with how far it is behind
+func writeStaleness(w io.Writer, results []*ImageStaleness) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOCATION\tIMAGE\tSTATUS\tBEHIND\tVERSION\tNEWER TAG")
+	for _, staleness := range results {
+		image, _, _ := strings.Cut(staleness.Image, "@")
+		if staleness.Digest != "" {
+			image += "@" + shortDigest(staleness.Digest)
+		}
+		status, behind, version, newer := staleness.Status, "", "", ""
+		switch {
+		case staleness.Skipped != "":
+			status = "skipped: " + staleness.Skipped
+		case staleness.Error != "":
+			status = "error: " + staleness.Error
+		}
+		if staleness.Status == staleBehind {
+			behind = "-"
+			if staleness.HeadCreated != nil {
+				behind = fmt.Sprintf("%d days", staleness.BehindDays)
+			}
+		}
+		if staleness.Version != "" {
+			version = staleness.Version
+			if staleness.HeadVersion != "" && staleness.HeadVersion != staleness.Version {
+				version += " -> " + staleness.HeadVersion
+			}
+			if staleness.VersionDelta != "" {
+				version += " (" + staleness.VersionDelta + ")"
+			}
+		}
+		if staleness.LatestTag != "" {
+			newer = staleness.LatestTag
+			if staleness.LatestDelta != "" {
+				newer += " (" + staleness.LatestDelta + ")"
+			}
+		}
+		fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\t%s\t%s\n", staleness.File, staleness.Line, image, status, behind, version, newer)
+	}
+	tw.Flush()
+}
+
+// runStale implements the stale subcommand
+func runStale(args []string) int {
+	fs := flag.NewFlagSet("stale", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	output := fs.String("output", outputText, "Output format (text, json)")
+	pinSyntax := fs.Bool("pin-syntax", false, "Also check the frontend image of # syntax= directives")
+	noTags := fs.Bool("no-tags", false, "Don't list repository tags to find newer version tags")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s stale [flags] <path>...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Report how far every pinned digest is behind the head of its tag, by creation time and")
+		fmt.Fprintln(fs.Output(), "version, and which newer version tags exist. Files are not modified.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = every pin is current, 1 = some pins are stale, 2 = errors")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("warn"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+	if err := validateOutputFormat(*output); err != nil {
+		slog.Error("Invalid --output", "error", err)
+		return exitError
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	paths, err := discoverFiles(fs.Args(), cfg)
+	if err != nil {
+		slog.Error("Failed to find files to check", "error", err)
+		return exitError
+	}
+
+	exitCode := exitOK
+	results := []*ImageStaleness{}
+	for _, path := range paths {
+		fileFormat, err := resolveFormat(*format, path, cfg)
+		if err != nil {
+			slog.Error("Invalid --format", "error", err)
+			return exitError
+		}
+
+		checker := NewContainerfileUpdaterWithConfig(path, cfg)
+		checker.format = fileFormat
+		checker.pinSyntax = *pinSyntax
+		fileResults, err := checker.StaleImages(!*noTags)
+		if err != nil {
+			slog.Error("Failed to extract images", "path", path, "error", err)
+			exitCode = exitError
+			continue
+		}
+		for _, staleness := range fileResults {
+			switch {
+			case staleness.Error != "":
+				exitCode = exitError
+			case staleness.Status == staleBehind && exitCode == exitOK:
+				exitCode = exitUpdatesNeeded
+			}
+		}
+		results = append(results, fileResults...)
+	}
+
+	if *output == outputJSON {
+		if err := writeJSONReport(os.Stdout, results); err != nil {
+			slog.Error("Failed to write report", "error", err)
+			return exitError
+		}
+		return exitCode
+	}
+	writeStaleness(os.Stdout, results)
+	return exitCode
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"latest", "1.21", "1.22", "1.22.5", "1.23.1", "1.24-alpine", "2.0-alpine", "v1.25", "1.9"}
+	tests := map[string]string{
+		"1.21":        "1.22",
+		"1.22.0":      "1.23.1",
+		"1.24-alpine": "2.0-alpine",
+		"v1.20":       "v1.25",
+		"1.22":        "1.22",
+		"latest":      "",
+	}
+	for tag, want := range tests {
+		if got := latestTag(tag, tags); got != want {
+			t.Errorf("latestTag(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestVersionDelta(t *testing.T) {
+	tests := []struct{ current, newer, want string }{
+		{"1.22.3", "1.22.5", deltaPatch},
+		{"1.22.3", "1.23.0", deltaMinor},
+		{"v1.22", "2.0", deltaMajor},
+		{"1.22.5", "1.22.3", ""},
+		{"1.22.3", "1.22.3", ""},
+		{"bookworm", "trixie", ""},
+	}
+	for _, tt := range tests {
+		if got := versionDelta(tt.current, tt.newer); got != tt.want {
+			t.Errorf("versionDelta(%q, %q) = %q, want %q", tt.current, tt.newer, got, tt.want)
+		}
+	}
+}
+
+func TestStaleImages(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	old := pushRandomImage(t, server, host+"/app:1.0")
+	pushRandomImage(t, server, host+"/app:1.0")
+	pushRandomImage(t, server, host+"/app:1.2")
+	current := pushRandomImage(t, server, host+"/tool:3")
+
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	content := "FROM " + host + "/app:1.0@" + old.String() + "\n" +
+		"FROM " + host + "/tool:3@" + current.String() + "\n" +
+		"FROM " + host + "/tool:3\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	results, err := NewContainerfileUpdaterWithConfig(path, cfg).StaleImages(true)
+	if err != nil {
+		t.Fatalf("StaleImages() failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	stale := results[0]
+	if stale.Error != "" || stale.Status != staleBehind || stale.HeadDigest == old.String() {
+		t.Errorf("Expected the moved tag to be stale, got %+v", stale)
+	}
+	if stale.LatestTag != "1.2" || stale.LatestDelta != deltaMinor {
+		t.Errorf("Expected newer tag 1.2 (minor), got %q (%s)", stale.LatestTag, stale.LatestDelta)
+	}
+	if results[1].Status != staleCurrent || results[1].LatestTag != "" {
+		t.Errorf("Expected the current pin to be current, got %+v", results[1])
+	}
+	if results[2].Status != staleUnpinned {
+		t.Errorf("Expected the floating tag to be unpinned, got %+v", results[2])
+	}
+
+	var out bytes.Buffer
+	writeStaleness(&out, results)
+	for _, want := range []string{"STATUS", "stale", "1.2 (minor)", "current", "unpinned"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Text output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
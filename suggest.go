@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxTagSuggestions is the number of near-miss tags suggested for a missing tag
+const maxTagSuggestions = 3
+
+// tagNotFoundError is a lookup of a tag its repository doesn't have, with the tags that
+// were likely meant
+type tagNotFoundError struct {
+	err         error
+	suggestions []string
+}
+
+func (e *tagNotFoundError) Error() string {
+	return fmt.Sprintf("%v (did you mean %s?)", e.err, strings.Join(e.suggestions, ", "))
+}
+
+func (e *tagNotFoundError) Unwrap() error {
+	return e.err
+}
+
+// tagSuggestions returns the suggested tags of a lookup error, if any
+func tagSuggestions(err error) []string {
+	var notFound *tagNotFoundError
+	if errors.As(err, &notFound) {
+		return notFound.suggestions
+	}
+	return nil
+}
+
+// withTagSuggestions adds the near misses of a missing tag to its lookup error, so a tag
+// retired upstream can be replaced without browsing the registry. Other errors, and
+// missing tags without near misses, are returned as they are.
+func (du *ContainerfileUpdater) withTagSuggestions(ctx context.Context, image *ImageReference, err error) error {
+	if !isNotFound(err) || du.digests != nil || image.Tag == "" {
+		return err
+	}
+	tags, listErr := du.listTags(ctx, image)
+	if listErr != nil {
+		slog.Debug("Failed to list tags for suggestions", "image", image.Original, "error", listErr)
+		return err
+	}
+	suggestions := suggestTags(image.Tag, tags)
+	if len(suggestions) == 0 {
+		return err
+	}
+	return &tagNotFoundError{err: err, suggestions: suggestions}
+}
+
+// suggestTags returns the tags closest to a missing one: first those extending it, such as
+// 16-alpine3.19 for 16-alpine, then those a few edits away, such as 3.19 for 3.91. Each
+// group lists the newest versions first.
+func suggestTags(missing string, tags []string) []string {
+	type candidate struct {
+		tag      string
+		distance int
+	}
+	limit := max(2, len(missing)/3)
+	var candidates []candidate
+	for _, tag := range tags {
+		switch {
+		case tag == missing:
+		case strings.HasPrefix(tag, missing):
+			candidates = append(candidates, candidate{tag, 0})
+		default:
+			if distance := editDistance(missing, tag); distance <= limit {
+				candidates = append(candidates, candidate{tag, distance})
+			}
+		}
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return cmp.Or(cmp.Compare(a.distance, b.distance), compareNatural(b.tag, a.tag))
+	})
+
+	var suggestions []string
+	for _, c := range candidates[:min(len(candidates), maxTagSuggestions)] {
+		suggestions = append(suggestions, c.tag)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// compareNatural compares strings with runs of digits compared as numbers, so 3.20 sorts
+// after 3.9
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		aDigits, bDigits := leadingDigits(a), leadingDigits(b)
+		if aDigits != "" && bDigits != "" {
+			x, _ := strconv.Atoi(aDigits)
+			y, _ := strconv.Atoi(bDigits)
+			if c := cmp.Compare(x, y); c != 0 {
+				return c
+			}
+			a, b = a[len(aDigits):], b[len(bDigits):]
+			continue
+		}
+		if a[0] != b[0] {
+			return cmp.Compare(a[0], b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// leadingDigits returns the run of digits a string starts with
+func leadingDigits(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end < 0 {
+		return s
+	}
+	return s[:end]
+}
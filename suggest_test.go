@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSuggestTags(t *testing.T) {
+	tags := []string{"16-alpine3.9", "16-alpine3.19", "16-alpine3.20", "16-bookworm", "18-alpine", "3.19", "3.20", "latest", "edge"}
+	tests := []struct {
+		missing string
+		want    []string
+	}{
+		{"16-alpine", []string{"16-alpine3.20", "16-alpine3.19", "16-alpine3.9"}},
+		{"3.91", []string{"3.20", "3.19"}},
+		{"17-alpine", []string{"18-alpine"}},
+		{"lastest", []string{"latest"}},
+		{"2.0.0", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.missing, func(t *testing.T) {
+			if got := suggestTags(tt.missing, tags); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	ordered := []string{"3.9", "3.19", "3.20", "3.20-alpine", "alpine", "alpine3"}
+	for i := 1; i < len(ordered); i++ {
+		if compareNatural(ordered[i-1], ordered[i]) >= 0 || compareNatural(ordered[i], ordered[i-1]) <= 0 {
+			t.Errorf("Expected %s before %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestMissingTagSuggestions(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	for _, tag := range []string{"16-alpine3.19", "16-alpine3.20", "20-alpine"} {
+		pushRandomImage(t, server, host+"/node:"+tag)
+	}
+
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	content := "FROM " + host + "/node:16-alpine\nFROM " + host + "/node:2.0.0\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	updater := NewContainerfileUpdaterWithConfig(path, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	report := updater.Report()
+	suggested, plain := report.Images[0], report.Images[1]
+	if want := []string{"16-alpine3.20", "16-alpine3.19", "20-alpine"}; !slices.Equal(suggested.Suggestions, want) {
+		t.Errorf("Expected suggestions %v, got %v", want, suggested.Suggestions)
+	}
+	if !strings.Contains(suggested.Error, "did you mean 16-alpine3.20, 16-alpine3.19, 20-alpine?") {
+		t.Errorf("Suggestions missing from the error: %s", suggested.Error)
+	}
+	if !isNotFound(updater.fromCommands[0].Err) {
+		t.Errorf("Expected the error to remain a not found error: %v", updater.fromCommands[0].Err)
+	}
+	if plain.Error == "" || plain.Suggestions != nil || strings.Contains(plain.Error, "did you mean") {
+		t.Errorf("Expected a plain not found error without near misses, got %q (%v)", plain.Error, plain.Suggestions)
+	}
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// dockerfileFrontends are the repositories of the Dockerfile frontend, whose syntax the
+// BuildKit parser follows
+var dockerfileFrontends = []string{"docker/dockerfile", "docker/dockerfile-upstream"}
+
+// heredocMarker replaces "<<" when parsing for a frontend without heredocs. It keeps the
+// length of the line and matches no heredoc.
+const heredocMarker = "<\x00"
+
+// frontend is the BuildKit frontend a "# syntax=" directive selects
+type frontend struct {
+	syntax     string // Value of the directive (empty without one)
+	dockerfile bool   // Whether it is a release of the Dockerfile frontend
+	labs       bool   // Whether it is a labs release with experimental syntax
+	heredocs   bool   // Whether it reads heredocs, as the parser does
+}
+
+// selectedFrontend returns the frontend a Containerfile's syntax directive selects. Without
+// a directive the builder's own, current Dockerfile frontend is used.
+func selectedFrontend(content []byte) frontend {
+	syntax, _, _, ok := parser.ParseDirective("syntax", content)
+	if !ok {
+		return frontend{dockerfile: true, heredocs: true}
+	}
+	fe := frontend{syntax: syntax, heredocs: true}
+	ref, err := name.ParseReference(syntax)
+	if err != nil || ref.Context().RegistryStr() != name.DefaultRegistry || !slices.Contains(dockerfileFrontends, ref.Context().RepositoryStr()) {
+		return fe
+	}
+	fe.dockerfile = true
+	tag, ok := ref.(name.Tag)
+	if !ok {
+		// A digest says nothing about the release
+		return fe
+	}
+	fe.labs = tag.TagStr() == "labs" || strings.HasSuffix(tag.TagStr(), "-labs")
+	fe.heredocs = frontendHeredocs(tag.TagStr())
+	return fe
+}
+
+// frontendHeredocs reports whether a release of the Dockerfile frontend reads heredocs,
+// which 1.3-labs introduced and 1.4 made stable. Channels such as 1, latest and labs
+// follow the newest releases.
+func frontendHeredocs(tag string) bool {
+	if tag == "experimental" {
+		// Predates the 1.x releases
+		return false
+	}
+	version, ok := parseTagVersion(tag)
+	if !ok || version.prefix != "" {
+		return true
+	}
+	major := version.numbers[0]
+	if major != 1 || len(version.numbers) == 1 {
+		return major >= 1
+	}
+	minor := version.numbers[1]
+	return minor > 3 || (minor == 3 && version.suffix == "-labs")
+}
+
+// parseDockerfile parses a Containerfile the way the frontend its syntax directive selects
+// does. Frontends predating heredocs read "<<" as shell text, so the lines after it stay
+// instructions instead of heredoc content.
+func parseDockerfile(content []byte) (*parser.Result, error) {
+	if !selectedFrontend(content).heredocs {
+		content = bytes.ReplaceAll(content, []byte("<<"), []byte(heredocMarker))
+	}
+	return parser.Parse(bytes.NewReader(content))
+}
+
+// logFrontend reports a frontend whose syntax the parser may not follow
+func logFrontend(path string, fe frontend) {
+	switch {
+	case !fe.dockerfile:
+		slog.Warn("Syntax directive selects a frontend other than docker/dockerfile, parsing the file as a Dockerfile", "path", path, "syntax", fe.syntax)
+	case fe.labs:
+		slog.Debug("Syntax directive selects the labs frontend, experimental instructions are parsed generically", "path", path, "syntax", fe.syntax)
+	case !fe.heredocs:
+		slog.Debug("Syntax directive selects a frontend without heredocs, parsing << as shell text", "path", path, "syntax", fe.syntax)
+	}
+}
+
+// extractSyntaxImage returns the frontend image named by a "# syntax=" directive, or nil
+// when the Containerfile has none. The directive keeps its tag next to the digest so
+// later runs follow the same frontend channel (e.g. docker/dockerfile:1).
+func (du *ContainerfileUpdater) extractSyntaxImage() (*FromCommand, error) {
+	data, err := du.readContent()
+	if err != nil {
+		return nil, err
+	}
+
+	syntax, _, location, ok := parser.ParseDirective("syntax", data)
+	if !ok || len(location) == 0 {
+		return nil, nil
+	}
+	image, err := du.parseImageReference(syntax)
+	if err != nil {
+		slog.Warn("Ignoring unparsable syntax directive", "syntax", syntax, "error", err)
+		return nil, nil
+	}
+	slog.Debug("Found syntax directive", "line", location[0].Start.Line, "image", syntax)
+
+	cmd := &FromCommand{
+		Image:       image,
+		LineStart:   location[0].Start.Line,
+		LineEnd:     location[0].End.Line,
+		Annotations: &ImageAnnotations{Pin: pinTagDigest},
+		editor:      syntaxEditor,
+	}
+	du.applySkipRules(cmd)
+	return cmd, nil
+}
+
+// syntaxEditor rewrites the image of a "# syntax=" directive, which follows the "="
+func syntaxEditor(lines []string, cmd *FromCommand) ([]string, bool) {
+	index := cmd.LineStart - 1
+	if index < 0 || index >= len(lines) {
+		return lines, false
+	}
+	_, value, ok := strings.Cut(lines[index], "=")
+	if !ok {
+		return lines, false
+	}
+	start := len(lines[index]) - len(strings.TrimLeft(value, " \t"))
+	return spanEditor(start)(lines, cmd)
+}
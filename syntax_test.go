@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPinSyntaxDirective(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	frontend := pushRandomImage(t, server, host+"/dockerfile:1.7")
+	base := pushRandomImage(t, server, host+"/base:1.0")
+
+	originalContent := "# syntax=" + host + "/dockerfile:1.7\n" +
+		"FROM " + host + "/base:1.0\n"
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	for _, pinSyntax := range []bool{false, true} {
+		containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+		if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+			t.Fatalf("Failed to write Containerfile: %v", err)
+		}
+
+		updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+		updater.pinSyntax = pinSyntax
+		if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+
+		expectedContent := "# syntax=" + host + "/dockerfile:1.7\n"
+		if pinSyntax {
+			expectedContent = "# syntax=" + host + "/dockerfile:1.7@" + frontend.String() + "\n"
+		}
+		expectedContent += "FROM " + host + "/base@" + base.String() + "\n"
+
+		content, err := os.ReadFile(containerfilePath)
+		if err != nil {
+			t.Fatalf("Failed to read Containerfile: %v", err)
+		}
+		if string(content) != expectedContent {
+			t.Errorf("pinSyntax=%v: content mismatch.\nExpected:\n%s\nGot:\n%s", pinSyntax, expectedContent, content)
+		}
+	}
+}
+
+func TestSelectedFrontend(t *testing.T) {
+	tests := []struct {
+		syntax     string
+		dockerfile bool
+		labs       bool
+		heredocs   bool
+	}{
+		{"", true, false, true},
+		{"docker/dockerfile:1", true, false, true},
+		{"docker/dockerfile:1.7", true, false, true},
+		{"docker.io/docker/dockerfile:1.4.3", true, false, true},
+		{"docker/dockerfile:1.3", true, false, false},
+		{"docker/dockerfile:1.3-labs", true, true, true},
+		{"docker/dockerfile:1.2.1", true, false, false},
+		{"docker/dockerfile:experimental", true, false, false},
+		{"docker/dockerfile:labs", true, true, true},
+		{"docker/dockerfile-upstream:master-labs", true, true, true},
+		{"docker/dockerfile@sha256:" + strings.Repeat("a", 64), true, false, true},
+		{"ghcr.io/docker/dockerfile:1.2", false, false, true},
+		{"devthefuture/dockerfile-x", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.syntax, func(t *testing.T) {
+			content := "FROM alpine\n"
+			if tt.syntax != "" {
+				content = "# syntax=" + tt.syntax + "\n" + content
+			}
+			fe := selectedFrontend([]byte(content))
+			if fe.dockerfile != tt.dockerfile || fe.labs != tt.labs || fe.heredocs != tt.heredocs {
+				t.Errorf("Expected dockerfile %v, labs %v, heredocs %v, got %+v", tt.dockerfile, tt.labs, tt.heredocs, fe)
+			}
+		})
+	}
+}
+
+func TestFrontendWithoutHeredocs(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	// Before heredocs, the shell's here-document on the RUN line left the FROM below it an
+	// instruction; read as a heredoc, it would vanish into the RUN instruction
+	body := "FROM alpine:3.20\nRUN cat <<EOF >/dev/null\nFROM debian:bookworm\nEOF\n"
+	for syntax, want := range map[string][]string{
+		"docker/dockerfile:1.2": {"alpine:3.20", "debian:bookworm"},
+		"docker/dockerfile:1.4": {"alpine:3.20"},
+	} {
+		t.Run(syntax, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(path, []byte("# syntax="+syntax+"\n"+body), 0644); err != nil {
+				t.Fatal(err)
+			}
+			updater := NewContainerfileUpdater(path)
+			commands, err := updater.extractImages()
+			if err != nil {
+				t.Fatalf("extractImages failed: %v", err)
+			}
+			var got []string
+			for _, cmd := range commands {
+				got = append(got, cmd.Image.Original)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("Expected images %v, got %v", want, got)
+			}
+		})
+	}
+}
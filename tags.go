@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Tag list APIs a registry can be queried with
+const (
+	tagListRegistry = "registry" // Distribution API /v2/<name>/tags/list, for every registry
+	tagListQuay     = "quay"     // Quay's REST API, which only lists active tags
+)
+
+// quayRegistry lists tags through the Quay API unless configured otherwise
+const quayRegistry = "quay.io"
+
+// tagListTTL is how long a listed repository's tags are reused
+const tagListTTL = 10 * time.Minute
+
+// maxTagPages bounds the pages fetched for one repository, against registries that keep
+// linking to the same page
+const maxTagPages = 1000
+
+// tagPageSize is the number of tags requested per page. Registries may return fewer.
+var tagPageSize = 1000
+
+// validateTagList rejects unknown tag list APIs
+func validateTagList(api string) error {
+	switch api {
+	case "", tagListRegistry, tagListQuay:
+		return nil
+	}
+	return fmt.Errorf("unknown tag list API %q (expected %s or %s)", api, tagListRegistry, tagListQuay)
+}
+
+// tagListAPI returns the API the tags of a registry are listed with
+func tagListAPI(cfg *Config, registry string) string {
+	if rc := cfg.Registry(registry); rc != nil && rc.TagList != "" {
+		return rc.TagList
+	}
+	if normalizeRegistry(registry) == quayRegistry {
+		return tagListQuay
+	}
+	return tagListRegistry
+}
+
+// tagLists caches the tag lists of repositories. Like the rate limiters it belongs to the
+// configuration, so files sharing base images list their tags once per run.
+type tagLists struct {
+	mu      sync.Mutex
+	entries map[string]tagListEntry
+}
+
+// tagListEntry is a cached tag list
+type tagListEntry struct {
+	tags    []string
+	fetched time.Time
+}
+
+// get returns the cached tags of a repository if they are fresh
+func (tl *tagLists) get(repository string) ([]string, bool) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	entry, ok := tl.entries[repository]
+	if !ok || time.Since(entry.fetched) > tagListTTL {
+		return nil, false
+	}
+	return entry.tags, true
+}
+
+// put caches the tags of a repository
+func (tl *tagLists) put(repository string, tags []string) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.entries == nil {
+		tl.entries = make(map[string]tagListEntry)
+	}
+	tl.entries[repository] = tagListEntry{tags: tags, fetched: time.Now()}
+}
+
+// listTags returns every tag of an image's repository, following pagination
+func (du *ContainerfileUpdater) listTags(ctx context.Context, image *ImageReference) ([]string, error) {
+	repo, err := name.NewRepository(image.Name(), referenceOptions(du.config, image.Registry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse repository %s: %w", image.Name(), err)
+	}
+	if tags, ok := du.config.tagLists.get(repo.Name()); ok {
+		return tags, nil
+	}
+
+	base, err := du.transports.forRegistry(image.Registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure transport for %s: %w", image.Registry, err)
+	}
+	base = du.audit.wrapTransport(image.Registry, du.auditCredentials(image.Registry), base)
+	base = du.metrics.wrapTransport(image.Registry, base)
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		base = &loggingTransport{next: base}
+	}
+
+	var tags []string
+	if tagListAPI(du.config, image.Registry) == tagListQuay {
+		// The Quay API doesn't take registry credentials, so private repositories fall
+		// back to the distribution API
+		if tags, err = listQuayTags(ctx, &http.Client{Transport: base}, repo); err != nil {
+			slog.Debug("Falling back to the registry tag list", "repository", repo.Name(), "error", err)
+		}
+	}
+	if tags == nil {
+		tags, err = du.listRegistryTags(ctx, base, repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("Listed tags", "repository", repo.Name(), "tags", len(tags))
+	du.config.tagLists.put(repo.Name(), tags)
+	return tags, nil
+}
+
+// listRegistryTags pages through the distribution tag list API. Pages are followed through
+// the Link header, and registries that truncate the list without one are asked for the
+// tags after the last one received. The transport exchanges credentials for a bearer
+// token first, which GHCR and Docker Hub require even for public repositories.
+func (du *ContainerfileUpdater) listRegistryTags(ctx context.Context, base http.RoundTripper, repo name.Repository) ([]string, error) {
+	authenticator, err := du.keychain.Resolve(repo.Registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve credentials for %s: %w", repo.RegistryStr(), err)
+	}
+	rt, err := transport.NewWithContext(ctx, repo.Registry, authenticator, base, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate to %s: %w", repo.RegistryStr(), err)
+	}
+	client := &http.Client{Transport: rt}
+
+	next := &url.URL{
+		Scheme:   repo.Registry.Scheme(),
+		Host:     repo.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
+		RawQuery: url.Values{"n": {strconv.Itoa(tagPageSize)}}.Encode(),
+	}
+	tags := []string{}
+	seen := make(map[string]bool)
+	for page := 0; next != nil; page++ {
+		if page == maxTagPages {
+			return nil, fmt.Errorf("too many pages of tags for %s", repo.Name())
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, next.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repo.Name(), err)
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = transport.CheckError(response, http.StatusOK)
+		if err == nil {
+			err = json.NewDecoder(response.Body).Decode(&body)
+		}
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repo.Name(), err)
+		}
+
+		added := 0
+		for _, tag := range body.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+				added++
+			}
+		}
+
+		current := next
+		next = nil
+		if link := nextLink(response.Header.Get("Link"), current); link != nil {
+			next = link
+		} else if len(body.Tags) >= tagPageSize && added > 0 {
+			last := *current
+			last.RawQuery = url.Values{"n": {strconv.Itoa(tagPageSize)}, "last": {tags[len(tags)-1]}}.Encode()
+			next = &last
+		}
+	}
+	return tags, nil
+}
+
+// nextLink returns the URL of the next page from a Link header, resolved against the
+// page it was returned with. ACR and Harbor send relative links.
+func nextLink(header string, current *url.URL) *url.URL {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok || !strings.Contains(strings.NewReplacer(" ", "", `"`, "").Replace(params), "rel=next") {
+			continue
+		}
+		next, err := current.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return nil
+		}
+		return next
+	}
+	return nil
+}
+
+// listQuayTags pages through Quay's tag API, which unlike its distribution endpoint only
+// lists tags that weren't deleted or expired
+func listQuayTags(ctx context.Context, client *http.Client, repo name.Repository) ([]string, error) {
+	tags := []string{}
+	for page := 1; ; page++ {
+		if page > maxTagPages {
+			return nil, fmt.Errorf("too many pages of tags for %s", repo.Name())
+		}
+		endpoint := url.URL{
+			Scheme: repo.Registry.Scheme(),
+			Host:   repo.RegistryStr(),
+			Path:   fmt.Sprintf("/api/v1/repository/%s/tag/", repo.RepositoryStr()),
+			RawQuery: url.Values{
+				"onlyActiveTags": {"true"},
+				"limit":          {"100"},
+				"page":           {strconv.Itoa(page)},
+			}.Encode(),
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s: %w", repo.Name(), err)
+		}
+		var body struct {
+			Tags []struct {
+				Name string `json:"name"`
+			} `json:"tags"`
+			HasAdditional bool `json:"has_additional"`
+		}
+		if response.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status %s", response.Status)
+		} else {
+			err = json.NewDecoder(response.Body).Decode(&body)
+		}
+		response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s with the Quay API: %w", repo.Name(), err)
+		}
+
+		for _, tag := range body.Tags {
+			tags = append(tags, tag.Name)
+		}
+		if !body.HasAdditional || len(body.Tags) == 0 {
+			return tags, nil
+		}
+	}
+}
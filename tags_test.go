@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNextLink(t *testing.T) {
+	current, _ := url.Parse("https://registry.example.com/v2/app/tags/list?n=2")
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{`<https://registry.example.com/v2/app/tags/list?n=2&last=b>; rel="next"`, "https://registry.example.com/v2/app/tags/list?n=2&last=b"},
+		{`</v2/app/tags/list?last=b&n=2&orderby=>; rel="next"`, "https://registry.example.com/v2/app/tags/list?last=b&n=2&orderby="},
+		{`<https://other.example.com/first>; rel=prev, </v2/app/tags/list?last=d>; rel=next`, "https://registry.example.com/v2/app/tags/list?last=d"},
+		{`</v2/app/tags/list?last=b>; rel="prev"`, ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if next := nextLink(tt.header, current); next != nil {
+			got = next.String()
+		}
+		if got != tt.want {
+			t.Errorf("nextLink(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+// setTagPageSize lowers the tag page size for a test
+func setTagPageSize(t *testing.T, size int) {
+	t.Helper()
+	previous := tagPageSize
+	tagPageSize = size
+	t.Cleanup(func() { tagPageSize = previous })
+}
+
+func TestListTagsWithoutLinks(t *testing.T) {
+	setTagPageSize(t, 2)
+	server, host := newTestRegistry(t, false)
+	for _, tag := range []string{"1.0", "1.1", "2.0", "2.1", "latest"} {
+		pushRandomImage(t, server, host+"/app:"+tag)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig("", cfg)
+	image := &ImageReference{Registry: host, Repository: "app", Tag: "1.0"}
+	tags, err := du.listTags(t.Context(), image)
+	if err != nil {
+		t.Fatalf("listTags failed: %v", err)
+	}
+	if got := strings.Join(tags, ","); got != "1.0,1.1,2.0,2.1,latest" {
+		t.Errorf("listTags() = %s, want every page", got)
+	}
+
+	// Another updater sharing the config reuses the list
+	pushRandomImage(t, server, host+"/app:3.0")
+	tags, err = NewContainerfileUpdaterWithConfig("", cfg).listTags(t.Context(), image)
+	if err != nil || len(tags) != 5 {
+		t.Errorf("Expected the cached tags, got %v (%v)", tags, err)
+	}
+}
+
+func TestListTagsFollowsLinks(t *testing.T) {
+	setTagPageSize(t, 2)
+	all := []string{"a", "b", "c"}
+	pages := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		pages++
+		start := 0
+		if last := r.URL.Query().Get("page"); last != "" {
+			start, _ = strconv.Atoi(last)
+		}
+		end := min(start+2, len(all))
+		if end < len(all) {
+			// Relative link with a cursor only this registry understands, like ACR's
+			w.Header().Set("Link", fmt.Sprintf(`</v2/app/tags/list?page=%d>; rel="next"`, end))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"name": "app", "tags": all[start:end]})
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	tags, err := NewContainerfileUpdaterWithConfig("", cfg).listTags(t.Context(), &ImageReference{Registry: host, Repository: "app"})
+	if err != nil {
+		t.Fatalf("listTags failed: %v", err)
+	}
+	if strings.Join(tags, ",") != "a,b,c" || pages != 2 {
+		t.Errorf("listTags() = %v after %d pages, want a,b,c after 2", tags, pages)
+	}
+}
+
+func TestListQuayTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repository/org/app/tag/" || r.URL.Query().Get("onlyActiveTags") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		body := map[string]any{"tags": []map[string]string{{"name": "v" + page}}, "has_additional": page == "1"}
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.RegistryOrCreate(host).TagList = tagListQuay
+	tags, err := NewContainerfileUpdaterWithConfig("", cfg).listTags(t.Context(), &ImageReference{Registry: host, Repository: "org/app"})
+	if err != nil {
+		t.Fatalf("listTags failed: %v", err)
+	}
+	if strings.Join(tags, ",") != "v1,v2" {
+		t.Errorf("listTags() = %v, want both Quay pages", tags)
+	}
+}
+
+func TestTagListAPI(t *testing.T) {
+	cfg := NewConfig()
+	cfg.RegistryOrCreate("quay.example.com").TagList = tagListQuay
+	cfg.RegistryOrCreate("quay.io").TagList = tagListRegistry
+	if got := tagListAPI(cfg, "quay.example.com"); got != tagListQuay {
+		t.Errorf("Configured registry lists with %s", got)
+	}
+	if got := tagListAPI(cfg, "quay.io"); got != tagListRegistry {
+		t.Errorf("Configuration doesn't override the quay.io default, got %s", got)
+	}
+	if got := tagListAPI(NewConfig(), "quay.io"); got != tagListQuay {
+		t.Errorf("quay.io defaults to %s", got)
+	}
+	if err := validateTagList("hub"); err == nil {
+		t.Error("Expected an unknown tag list API to be invalid")
+	}
+}
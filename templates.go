@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateConfig names text/template files replacing the built-in commit messages and
+// change request titles and bodies
+type TemplateConfig struct {
+	CommitMessage      string `yaml:"commitMessage"`      // Message of the commit of each updated file
+	ChangeRequestTitle string `yaml:"changeRequestTitle"` // Title of the pull/merge request (first line used)
+	ChangeRequestBody  string `yaml:"changeRequestBody"`  // Markdown body of the pull/merge request
+}
+
+// MessageData is what message templates are rendered with
+type MessageData struct {
+	File   string         // Updated file for commit messages; empty for change requests
+	Files  []string       // Every file with updated images
+	Images []MessageImage // Updated images in file order
+}
+
+// MessageImage is one updated image in a message template
+type MessageImage struct {
+	Image     string       // repository:tag as looked up, e.g. library/golang:1.24
+	Name      string       // Repository with its registry, e.g. ghcr.io/org/app
+	Tag       string       // Tag the digest was resolved from
+	File      string       // File the image is in, relative to the working directory
+	Line      int          // Line of the image in the file
+	OldDigest string       // Digest pinned before the update (empty if unpinned)
+	NewDigest string       // Digest now pinned
+	Release   *ReleaseInfo // Version, revision and release notes of the new digest, when known
+	Referrers []Referrer   // SBOMs, signatures and attestations of the new digest, when looked up
+}
+
+// templateFuncs are available to message templates in addition to the built-in functions
+var templateFuncs = template.FuncMap{
+	"short": shortDigest,
+	"join":  strings.Join,
+	"base":  filepath.Base,
+	// trimPrefix takes the prefix first so values can be piped in, e.g. {{.Name | trimPrefix "library/"}}
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+}
+
+// messageTemplates holds the parsed templates; nil templates use the built-in messages
+type messageTemplates struct {
+	commit *template.Template
+	title  *template.Template
+	body   *template.Template
+}
+
+// loadMessageTemplates parses the template files named in the config
+func loadMessageTemplates(cfg TemplateConfig) (*messageTemplates, error) {
+	templates := &messageTemplates{}
+	for _, t := range []struct {
+		path   string
+		target **template.Template
+	}{
+		{cfg.CommitMessage, &templates.commit},
+		{cfg.ChangeRequestTitle, &templates.title},
+		{cfg.ChangeRequestBody, &templates.body},
+	} {
+		if t.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(t.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template: %w", err)
+		}
+		parsed, err := template.New(filepath.Base(t.path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %s: %w", t.path, err)
+		}
+		*t.target = parsed
+	}
+	return templates, nil
+}
+
+// newMessageData collects the template data of the changed images
+func newMessageData(file string, changed []*FromCommand) MessageData {
+	data := MessageData{Images: []MessageImage{}}
+	if file != "" {
+		data.File = displayPath(file)
+	}
+	seen := make(map[string]bool)
+	for _, cmd := range changed {
+		path := displayPath(cmd.Path)
+		if !seen[path] {
+			seen[path] = true
+			data.Files = append(data.Files, path)
+		}
+		data.Images = append(data.Images, MessageImage{
+			Image:     cmd.Image.TaggedName(),
+			Name:      cmd.Image.Name(),
+			Tag:       cmd.Image.Tag,
+			File:      path,
+			Line:      cmd.LineStart,
+			OldDigest: cmd.PreviousDigest,
+			NewDigest: cmd.Image.Digest,
+			Release:   cmd.Release,
+			Referrers: cmd.Referrers,
+		})
+	}
+	return data
+}
+
+// render executes a template with the data of the changed images
+func render(t *template.Template, data MessageData) (string, error) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", t.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// commitMessage renders the commit message for the changed images of a file
+func (mt *messageTemplates) commitMessage(path string, changed []*FromCommand) (string, error) {
+	if mt == nil || mt.commit == nil {
+		return buildCommitMessage(path, changed), nil
+	}
+	message, err := render(mt.commit, newMessageData(path, changed))
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("template %s rendered an empty commit message", mt.commit.Name())
+	}
+	return message, nil
+}
+
+// changeRequest renders the change request for the changed images of every file
+func (mt *messageTemplates) changeRequest(changed []*FromCommand, head, base string) (*ChangeRequest, error) {
+	cr := buildChangeRequest(changed, head, base)
+	if mt == nil {
+		return cr, nil
+	}
+
+	data := newMessageData("", changed)
+	if mt.title != nil {
+		title, err := render(mt.title, data)
+		if err != nil {
+			return nil, err
+		}
+		title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+		if title == "" {
+			return nil, fmt.Errorf("template %s rendered an empty title", mt.title.Name())
+		}
+		cr.Title = title
+	}
+	if mt.body != nil {
+		body, err := render(mt.body, data)
+		if err != nil {
+			return nil, err
+		}
+		cr.Body = body
+	}
+	return cr, nil
+}
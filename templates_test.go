@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageTemplates(t *testing.T) {
+	changed := []*FromCommand{
+		{
+			Image:          &ImageReference{Registry: "docker.io", Repository: "library/golang", Tag: "1.24", Digest: "sha256:2222222222222222222222222222222222222222222222222222222222222222"},
+			Path:           "build/Containerfile",
+			LineStart:      1,
+			PreviousDigest: "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		},
+		{
+			Image:     &ImageReference{Registry: "ghcr.io", Repository: "org/app", Tag: "v2", Digest: "sha256:3333333333333333333333333333333333333333333333333333333333333333"},
+			Path:      "compose.yaml",
+			LineStart: 4,
+			Release:   &ReleaseInfo{Version: "v2.1.0", ReleaseNotes: "https://github.com/org/app/releases/tag/v2.1.0"},
+		},
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write template: %v", err)
+		}
+		return path
+	}
+	cfg := TemplateConfig{
+		CommitMessage: write("commit.tmpl", `chore(deps): pin {{len .Images}} image(s) in {{base .File}}
+{{range .Images}}
+- {{.Name}}:{{.Tag}} {{short .OldDigest}} -> {{short .NewDigest}}{{end}}
+`),
+		ChangeRequestTitle: write("title.tmpl", "\nchore(deps): update {{join .Files \", \"}}\nignored\n"),
+		ChangeRequestBody: write("body.tmpl", `{{range .Images}}{{.File}}:{{.Line}} {{.Image}}{{with .Release}} ({{.Version}}){{end}}
+{{end}}`),
+	}
+
+	templates, err := loadMessageTemplates(cfg)
+	if err != nil {
+		t.Fatalf("loadMessageTemplates() error = %v", err)
+	}
+
+	message, err := templates.commitMessage("build/Containerfile", changed[:1])
+	if err != nil {
+		t.Fatalf("commitMessage() error = %v", err)
+	}
+	wantMessage := "chore(deps): pin 1 image(s) in Containerfile\n\n- library/golang:1.24 111111111111 -> 222222222222\n"
+	if message != wantMessage {
+		t.Errorf("Commit message = %q, want %q", message, wantMessage)
+	}
+
+	cr, err := templates.changeRequest(changed, defaultUpdateBranch, "main")
+	if err != nil {
+		t.Fatalf("changeRequest() error = %v", err)
+	}
+	if want := "chore(deps): update build/Containerfile, compose.yaml"; cr.Title != want {
+		t.Errorf("Title = %q, want %q", cr.Title, want)
+	}
+	if want := "build/Containerfile:1 library/golang:1.24\ncompose.yaml:4 ghcr.io/org/app:v2 (v2.1.0)\n"; cr.Body != want {
+		t.Errorf("Body = %q, want %q", cr.Body, want)
+	}
+	if cr.Head != defaultUpdateBranch || cr.Base != "main" {
+		t.Errorf("Branches = %s -> %s", cr.Head, cr.Base)
+	}
+
+	// Without templates the built-in messages are used
+	var builtin *messageTemplates
+	if message, _ := builtin.commitMessage("build/Containerfile", changed[:1]); message != buildCommitMessage("build/Containerfile", changed[:1]) {
+		t.Errorf("Built-in commit message = %q", message)
+	}
+}
+
+func TestLoadMessageTemplatesErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.tmpl")
+	if err := os.WriteFile(invalid, []byte("{{range .Images}"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	unknownField := filepath.Join(dir, "unknown.tmpl")
+	if err := os.WriteFile(unknownField, []byte("{{.Digest}}"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	if _, err := loadMessageTemplates(TemplateConfig{CommitMessage: invalid}); err == nil {
+		t.Errorf("Expected an error for an unparsable template")
+	}
+	if _, err := loadMessageTemplates(TemplateConfig{ChangeRequestBody: filepath.Join(dir, "missing.tmpl")}); err == nil {
+		t.Errorf("Expected an error for a missing template file")
+	}
+
+	templates, err := loadMessageTemplates(TemplateConfig{CommitMessage: unknownField})
+	if err != nil {
+		t.Fatalf("loadMessageTemplates() error = %v", err)
+	}
+	if _, err := templates.commitMessage("Containerfile", []*FromCommand{{Image: &ImageReference{}, Path: "Containerfile"}}); err == nil {
+		t.Errorf("Expected an error for a template using an unknown field")
+	}
+}
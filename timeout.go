@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultTimeout bounds a single image lookup unless the config file or --timeout says otherwise
+const defaultTimeout = 30 * time.Second
+
+// errDeadlinePassed is the error of lookups never started because the --deadline of the run passed
+var errDeadlinePassed = errors.New("run deadline passed before the lookup started")
+
+// validateTimeouts rejects negative timeouts in the config file
+func validateTimeouts(cfg *Config) error {
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	for host, registry := range cfg.Registries {
+		if registry.Timeout < 0 {
+			return fmt.Errorf("registry %s: timeout must not be negative", host)
+		}
+	}
+	return nil
+}
+
+// requestTimeout returns the time allowed for a lookup on a registry: its own timeout from
+// the config file, or the default for every registry
+func (du *ContainerfileUpdater) requestTimeout(registry string) time.Duration {
+	if rc := du.config.Registry(registry); rc != nil && rc.Timeout > 0 {
+		return rc.Timeout
+	}
+	return du.timeout
+}
+
+// runContext returns the context every lookup of the run derives from, which expires at the
+// --deadline of the run if one is set
+func (du *ContainerfileUpdater) runContext() (context.Context, context.CancelFunc) {
+	if du.deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), du.deadline)
+}
+
+// lookupContext returns the context of one lookup on a registry: it gets the registry's own
+// timeout, and ends no later than the run. Once the run's deadline has passed it returns
+// errDeadlinePassed instead, so the remaining images fail without a request.
+func (du *ContainerfileUpdater) lookupContext(runCtx context.Context, registry string) (context.Context, context.CancelFunc, error) {
+	if runCtx.Err() != nil {
+		return nil, nil, errDeadlinePassed
+	}
+	ctx, cancel := context.WithTimeout(runCtx, du.requestTimeout(registry))
+	return ctx, cancel, nil
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+// newSlowTestRegistry starts an in-memory registry that delays manifest requests of
+// repositories named slow
+func newSlowTestRegistry(t *testing.T, delay time.Duration) (*httptest.Server, string) {
+	t.Helper()
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/slow/manifests/") && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestPerImageTimeouts(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newSlowTestRegistry(t, 500*time.Millisecond)
+	pushRandomImage(t, server, host+"/slow:1.0")
+	fast := pushRandomImage(t, server, host+"/fast:1.0")
+	content := "FROM " + host + "/slow:1.0\nFROM " + host + "/fast:1.0\n"
+
+	tests := []struct {
+		name            string
+		globalTimeout   time.Duration
+		registryTimeout time.Duration
+		deadline        time.Time
+		wantSlowErr     bool
+		wantFastErr     bool
+	}{
+		// The slow lookup must not eat into the time of the next one
+		{name: "slow image times out alone", globalTimeout: 200 * time.Millisecond, wantSlowErr: true},
+		{name: "registry timeout overrides", globalTimeout: 200 * time.Millisecond, registryTimeout: 5 * time.Second},
+		{name: "expired deadline", globalTimeout: 5 * time.Second, deadline: time.Now().Add(-time.Second), wantSlowErr: true, wantFastErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Timeout = tt.globalTimeout
+			cfg.RegistryOrCreate(host).Insecure = true
+			cfg.RegistryOrCreate(host).Timeout = tt.registryTimeout
+
+			containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+			if err := os.WriteFile(containerfilePath, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write Containerfile: %v", err)
+			}
+			updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+			updater.deadline = tt.deadline
+			if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			slow, fastCmd := updater.fromCommands[0], updater.fromCommands[1]
+			if (slow.Err != nil) != tt.wantSlowErr {
+				t.Errorf("Slow image error = %v, wantErr %v", slow.Err, tt.wantSlowErr)
+			}
+			if tt.wantSlowErr && !errors.Is(slow.Err, context.DeadlineExceeded) && !errors.Is(slow.Err, errDeadlinePassed) && !strings.Contains(slow.Err.Error(), "deadline") {
+				t.Errorf("Slow image error should be a timeout, got %v", slow.Err)
+			}
+			if (fastCmd.Err != nil) != tt.wantFastErr {
+				t.Errorf("Fast image error = %v, wantErr %v", fastCmd.Err, tt.wantFastErr)
+			}
+			if !tt.wantFastErr && fastCmd.Image.Digest != fast.String() {
+				t.Errorf("Fast image digest = %s, want %s", fastCmd.Image.Digest, fast)
+			}
+		})
+	}
+}
+
+func TestValidateTimeouts(t *testing.T) {
+	cfg := NewConfig()
+	if err := validateTimeouts(cfg); err != nil {
+		t.Errorf("Empty config: %v", err)
+	}
+	cfg.RegistryOrCreate("registry.example.com").Timeout = -time.Second
+	if err := validateTimeouts(cfg); err == nil {
+		t.Errorf("Expected an error for a negative registry timeout")
+	}
+}
+
+func TestLookupsAfterDeadline(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newSlowTestRegistry(t, 0)
+	digest := pushRandomImage(t, server, host+"/fast:1.0")
+	content := "FROM " + host + "/fast:1.0@" + digest.String() + "\n"
+
+	var requests atomic.Int32
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	})
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	updater.deadline = time.Now().Add(-time.Second)
+
+	results, err := updater.VerifyPinnedDigests()
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if results[0].Status != verifyError || results[0].Detail != errDeadlinePassed.Error() {
+		t.Errorf("Verify result = %s %q, want %s %q", results[0].Status, results[0].Detail, verifyError, errDeadlinePassed)
+	}
+
+	inspections, err := updater.InspectImages()
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if inspections[0].Error != errDeadlinePassed.Error() {
+		t.Errorf("Inspection error = %q, want %q", inspections[0].Error, errDeadlinePassed)
+	}
+
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if !errors.Is(updater.fromCommands[0].Err, errDeadlinePassed) {
+		t.Errorf("Update error = %v, want %v", updater.fromCommands[0].Err, errDeadlinePassed)
+	}
+
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Made %d requests after the deadline passed", n)
+	}
+}
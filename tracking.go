@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+)
+
+// tagPattern matches a valid image tag
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// TrackingRule resolves images matching a pattern through a channel tag instead of the
+// tag they are written with, e.g. always pinning the digest of :stable
+type TrackingRule struct {
+	Image string `yaml:"image"` // Image pattern, as in the allow/deny lists
+	Tag   string `yaml:"tag"`   // Tag whose digest is pinned
+}
+
+// tagTracker picks the tracking tag of an image from the configured rules
+type tagTracker struct {
+	patterns []*regexp.Regexp
+	tags     []string
+}
+
+// newTagTracker compiles tracking rules; the first matching rule wins
+func newTagTracker(rules []TrackingRule) (*tagTracker, error) {
+	tracker := &tagTracker{}
+	for _, rule := range rules {
+		if !tagPattern.MatchString(rule.Tag) {
+			return nil, fmt.Errorf("invalid tracking tag %q for %s", rule.Tag, rule.Image)
+		}
+		patterns, err := compilePatterns([]string{rule.Image})
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracking pattern: %w", err)
+		}
+		tracker.patterns = append(tracker.patterns, patterns[0])
+		tracker.tags = append(tracker.tags, rule.Tag)
+	}
+	return tracker, nil
+}
+
+// TagFor returns the tag an image tracks, or an empty string to keep its own
+func (t *tagTracker) TagFor(image *ImageReference) string {
+	if t == nil {
+		return ""
+	}
+	candidates := referenceCandidates(image)
+	for i, pattern := range t.patterns {
+		if matchAny([]*regexp.Regexp{pattern}, candidates) != "" {
+			return t.tags[i]
+		}
+	}
+	return ""
+}
+
+// applyTracking switches an image to its tracking tag, from its annotation or the config
+// file, so the digest of that tag is resolved and pinned
+func (du *ContainerfileUpdater) applyTracking(cmd *FromCommand) {
+	tag := du.tracker.TagFor(cmd.Image)
+	if cmd.Annotations != nil && cmd.Annotations.Track != "" {
+		tag = cmd.Annotations.Track
+	}
+	if tag == "" || tag == cmd.Image.Tag {
+		return
+	}
+
+	slog.Debug("Tracking tag", "image", cmd.Image.Original, "tag", tag)
+	cmd.TrackedTag = tag
+	cmd.Image.Tag = tag
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTagTracker(t *testing.T) {
+	tracker, err := newTagTracker([]TrackingRule{
+		{Image: "debian:*", Tag: "stable"},
+		{Image: "ghcr.io/example/*", Tag: "edge"},
+		{Image: "*", Tag: "never-reached"},
+	})
+	if err != nil {
+		t.Fatalf("newTagTracker failed: %v", err)
+	}
+
+	du := NewContainerfileUpdater("Containerfile")
+	tests := map[string]string{
+		"debian:11":                "stable",
+		"ghcr.io/example/tool:1.2": "edge",
+		"alpine:3.20":              "never-reached",
+	}
+	for reference, expected := range tests {
+		image, err := du.parseImageReference(reference)
+		if err != nil {
+			t.Fatalf("parseImageReference(%q) failed: %v", reference, err)
+		}
+		if got := tracker.TagFor(image); got != expected {
+			t.Errorf("TagFor(%q): got %q, want %q", reference, got, expected)
+		}
+	}
+
+	if (*tagTracker)(nil).TagFor(&ImageReference{}) != "" {
+		t.Error("Expected a nil tracker to track nothing")
+	}
+	if _, err := newTagTracker([]TrackingRule{{Image: "debian:*", Tag: "bad tag"}}); err == nil {
+		t.Error("Expected error for an invalid tag")
+	}
+	if _, err := newTagTracker([]TrackingRule{{Image: "re:(", Tag: "stable"}}); err == nil {
+		t.Error("Expected error for an invalid pattern")
+	}
+}
+
+func TestTrackedTagReconstruction(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	server, host := newTestRegistry(t, false)
+	stable := pushRandomImage(t, server, host+"/app:stable")
+	pushRandomImage(t, server, host+"/app:1.0")
+	edge := pushRandomImage(t, server, host+"/tool:edge")
+
+	originalContent := "# containerfile-updater: track=stable, pin=tag-digest\n" +
+		"FROM " + host + "/app:1.0 AS app\n" +
+		"FROM " + host + "/tool:1.0\n"
+	expectedContent := "# containerfile-updater: track=stable, pin=tag-digest\n" +
+		"FROM " + host + "/app:stable@" + stable.String() + " AS app\n" +
+		"FROM " + host + "/tool@" + edge.String() + "\n"
+
+	containerfilePath := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(containerfilePath, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Tracking = []TrackingRule{{Image: host + "/tool:*", Tag: "edge"}}
+	updater := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	if err := updater.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	content, err := os.ReadFile(containerfilePath)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	if string(content) != expectedContent {
+		t.Errorf("Containerfile content mismatch.\nExpected:\n%s\nGot:\n%s", expectedContent, content)
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// Verification outcomes for a FROM image
+const (
+	verifyOK       = "ok"       // Digest exists and matches its tag
+	verifyMissing  = "missing"  // Digest or tag no longer exists in the registry
+	verifyMismatch = "mismatch" // Tag now resolves to a different digest
+	verifyError    = "error"    // Registry could not be queried
+	verifyUnpinned = "unpinned" // No digest to verify
+	verifySkipped  = "skipped"  // Ignored by annotation or filter
+	verifyDrift    = "drift"    // Build argument default differs from its base file
+)
+
+// VerifyResult records the outcome of verifying one FROM image
+type VerifyResult struct {
+	Command *FromCommand
+	Status  string
+	Detail  string
+}
+
+// Failed reports whether the result should fail verification
+func (vr *VerifyResult) Failed() bool {
+	switch vr.Status {
+	case verifyMissing, verifyMismatch, verifyError, verifyDrift:
+		return true
+	}
+	return false
+}
+
+// VerifyPinnedDigests checks that every pinned digest still exists in its registry
+// and that pins naming a tag still resolve to the same digest
+func (du *ContainerfileUpdater) VerifyPinnedDigests() ([]*VerifyResult, error) {
+	fromCommands, err := du.extractImages()
+	if err != nil {
+		return nil, err
+	}
+	du.fromCommands = fromCommands
+
+	runCtx, cancelRun := du.runContext()
+	defer cancelRun()
+
+	var results []*VerifyResult
+	for _, cmd := range fromCommands {
+		results = append(results, du.verifyCommand(runCtx, cmd))
+	}
+	return results, nil
+}
+
+// verifyCommand checks a single FROM image against its registry
+func (du *ContainerfileUpdater) verifyCommand(runCtx context.Context, cmd *FromCommand) *VerifyResult {
+	image := cmd.Image
+	switch {
+	case cmd.Base != nil && du.checkConsumers:
+		return verifyConsumer(cmd)
+	case cmd.SkipReason != "":
+		return &VerifyResult{Command: cmd, Status: verifySkipped, Detail: cmd.SkipReason}
+	case image.Digest == "":
+		return &VerifyResult{Command: cmd, Status: verifyUnpinned, Detail: "no digest pinned"}
+	}
+
+	ctx, cancel, err := du.lookupContext(runCtx, image.Registry)
+	if err != nil {
+		return &VerifyResult{Command: cmd, Status: verifyError, Detail: err.Error()}
+	}
+	defer cancel()
+
+	if _, err := du.resolveDigest(ctx, image.Registry, image.PinnedName()); err != nil {
+		if isNotFound(err) {
+			return &VerifyResult{Command: cmd, Status: verifyMissing, Detail: "digest no longer exists in the registry"}
+		}
+		return &VerifyResult{Command: cmd, Status: verifyError, Detail: err.Error()}
+	}
+
+	if !image.ExplicitTag() {
+		return &VerifyResult{Command: cmd, Status: verifyOK, Detail: "digest exists"}
+	}
+
+	current, err := du.fetchImageDigest(ctx, image)
+	if platform := du.pinnedPlatform(cmd); platform != "" && err == nil {
+		current, err = du.platformDigest(ctx, image, current, platform)
+	}
+	if err != nil {
+		if isNotFound(err) {
+			return &VerifyResult{Command: cmd, Status: verifyMissing, Detail: fmt.Sprintf("tag %s no longer exists in the registry", image.Tag)}
+		}
+		return &VerifyResult{Command: cmd, Status: verifyError, Detail: err.Error()}
+	}
+	if current != image.Digest {
+		return &VerifyResult{Command: cmd, Status: verifyMismatch, Detail: fmt.Sprintf("tag %s now points to %s", image.Tag, current)}
+	}
+	return &VerifyResult{Command: cmd, Status: verifyOK, Detail: "digest exists and matches tag"}
+}
+
+// verifyConsumer compares a build argument default with the base file defining it
+func verifyConsumer(cmd *FromCommand) *VerifyResult {
+	base := cmd.Base
+	if cmd.Image.Original != base.Value {
+		return &VerifyResult{Command: cmd, Status: verifyDrift, Detail: fmt.Sprintf("%s:%d sets %s", base.Path, base.Line, base.Value)}
+	}
+	return &VerifyResult{Command: cmd, Status: verifyOK, Detail: fmt.Sprintf("matches %s:%d", base.Path, base.Line)}
+}
+
+// isNotFound reports whether a registry error means the manifest does not exist
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// verifyExitCode maps verification results to the process exit code: tags that
+// moved only need an update, while missing digests or registry errors are fatal
+func verifyExitCode(results []*VerifyResult) int {
+	code := exitOK
+	for _, result := range results {
+		switch result.Status {
+		case verifyMissing, verifyError:
+			return exitError
+		case verifyMismatch, verifyDrift:
+			code = exitUpdatesNeeded
+		}
+	}
+	return code
+}
+
+// writeVerifyReport prints one line per FROM image with its verification status
+func writeVerifyReport(w io.Writer, containerfilePath string, results []*VerifyResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LOCATION\tIMAGE\tSTATUS\tDETAIL")
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+		fmt.Fprintf(tw, "%s:%d\t%s\t%s\t%s\n",
+			filepath.Base(containerfilePath),
+			result.Command.LineStart,
+			result.Command.Image.Original,
+			result.Status,
+			result.Detail,
+		)
+	}
+	tw.Flush()
+
+	if failed > 0 {
+		fmt.Fprintf(w, "\n%d of %d images failed verification\n", failed, len(results))
+	} else {
+		fmt.Fprintf(w, "\nAll pinned digests verified\n")
+	}
+}
+
+// runVerify implements the verify subcommand
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	logging := addLoggingFlags(fs)
+	registry := addRegistryFlags(fs)
+	format := fs.String("format", formatAuto, formatFlagUsage)
+	consumers := fs.Bool("consumers", false, "Check that build argument defaults match the base files defining them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s verify [flags] <containerfile-path>\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Check that every pinned digest still exists and still matches its tag.")
+		fmt.Fprintln(fs.Output(), "\nExit codes: 0 = all pins verified, 1 = a pinned tag has moved or a default differs from its base file, 2 = a digest is missing or could not be checked")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := logging.configure("info"); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging flags: %v\n", err)
+		return exitError
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	containerfilePath := fs.Arg(0)
+	if _, err := os.Stat(containerfilePath); os.IsNotExist(err) {
+		slog.Error("Containerfile not found", "path", containerfilePath)
+		return exitError
+	}
+
+	usePlugins()
+	cfg, err := registry.loadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitError
+	}
+	fileFormat, err := resolveFormat(*format, containerfilePath, cfg)
+	if err != nil {
+		slog.Error("Invalid --format", "error", err)
+		return exitError
+	}
+
+	verifier := NewContainerfileUpdaterWithConfig(containerfilePath, cfg)
+	verifier.format = fileFormat
+	verifier.checkConsumers = *consumers
+	results, err := verifier.VerifyPinnedDigests()
+	if err != nil {
+		slog.Error("Failed to verify Containerfile", "error", err)
+		return exitError
+	}
+
+	writeVerifyReport(os.Stdout, containerfilePath, results)
+	return verifyExitCode(results)
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplicitTag(t *testing.T) {
+	du := NewContainerfileUpdater("")
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"ubuntu", false},
+		{"ubuntu:20.04", true},
+		{"ubuntu@sha256:" + strings.Repeat("a", 64), false},
+		{"ubuntu:20.04@sha256:" + strings.Repeat("a", 64), true},
+		{"localhost:5000/app", false},
+		{"localhost:5000/app:v1", true},
+		{"registry.example.com:5000/team/app@sha256:" + strings.Repeat("a", 64), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			image, err := du.parseImageReference(tt.ref)
+			if err != nil {
+				t.Fatalf("parseImageReference(%q) failed: %v", tt.ref, err)
+			}
+			if got := image.ExplicitTag(); got != tt.want {
+				t.Errorf("ExplicitTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPinnedDigests(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	stable := pushRandomImage(t, server, host+"/app:stable")
+	moved := pushRandomImage(t, server, host+"/app:moving")
+	current := pushRandomImage(t, server, host+"/app:moving")
+	missing := "sha256:" + strings.Repeat("0", 64)
+
+	content := strings.Join([]string{
+		"FROM " + host + "/app:stable@" + stable.String() + " AS ok",
+		"FROM " + host + "/app@" + moved.String() + " AS untagged",
+		"FROM " + host + "/app:moving@" + moved.String() + " AS moved",
+		"FROM " + host + "/app@" + missing + " AS missing",
+		"FROM " + host + "/app:gone@" + stable.String() + " AS gone",
+		"FROM " + host + "/app:stable AS unpinned",
+		"# containerfile-updater: ignore",
+		"FROM " + host + "/app@" + missing + " AS ignored",
+	}, "\n") + "\n"
+
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+
+	results, err := du.VerifyPinnedDigests()
+	if err != nil {
+		t.Fatalf("VerifyPinnedDigests failed: %v", err)
+	}
+
+	want := []string{verifyOK, verifyOK, verifyMismatch, verifyMissing, verifyMissing, verifyUnpinned, verifySkipped}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(results))
+	}
+	for i, status := range want {
+		if results[i].Status != status {
+			t.Errorf("Result %d (%s): expected status %s, got %s (%s)", i, results[i].Command.Image.Original, status, results[i].Status, results[i].Detail)
+		}
+	}
+	if !strings.Contains(results[2].Detail, current.String()) {
+		t.Errorf("Expected mismatch detail to name the current digest, got %q", results[2].Detail)
+	}
+
+	if code := verifyExitCode(results); code != exitError {
+		t.Errorf("Expected exit code %d, got %d", exitError, code)
+	}
+	if code := verifyExitCode(results[:3]); code != exitUpdatesNeeded {
+		t.Errorf("Expected exit code %d for moved tags only, got %d", exitUpdatesNeeded, code)
+	}
+	if code := verifyExitCode(results[:2]); code != exitOK {
+		t.Errorf("Expected exit code %d for verified pins, got %d", exitOK, code)
+	}
+
+	var report bytes.Buffer
+	writeVerifyReport(&report, path, results)
+	if !strings.Contains(report.String(), "Containerfile:3") || !strings.Contains(report.String(), "3 of 7 images failed verification") {
+		t.Errorf("Unexpected report:\n%s", report.String())
+	}
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build provenance, set by release builds with
+// -ldflags "-X main.version=… -X main.commit=… -X main.buildDate=…"
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// develVersion is reported by builds that carry no version
+const develVersion = "(devel)"
+
+// BuildInfo identifies the build of the updater that resolved a set of pins
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with uncommitted changes
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuildInfo combines the values set at link time with the module and VCS
+// information the Go toolchain embeds, which covers go install and plain go build
+func currentBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		info = withEmbeddedInfo(info, embedded)
+	}
+	info.Version = cmp.Or(info.Version, develVersion)
+	return info
+}
+
+// withEmbeddedInfo fills in what the link-time values leave unset from the build info
+// embedded in the binary
+func withEmbeddedInfo(info BuildInfo, embedded *debug.BuildInfo) BuildInfo {
+	if embedded.Main.Version != "" && embedded.Main.Version != develVersion {
+		info.Version = cmp.Or(info.Version, embedded.Main.Version)
+	}
+	for _, setting := range embedded.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Commit = cmp.Or(info.Commit, setting.Value)
+		case "vcs.time":
+			info.BuildDate = cmp.Or(info.BuildDate, setting.Value)
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+// writeBuildInfo prints the build information as text or JSON
+func writeBuildInfo(w io.Writer, info BuildInfo, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	revision := cmp.Or(info.Commit, "unknown")
+	if info.Modified {
+		revision += " (modified)"
+	}
+	fmt.Fprintf(w, "containerfile-updater %s\n", info.Version)
+	fmt.Fprintf(w, "commit:     %s\n", revision)
+	fmt.Fprintf(w, "built:      %s\n", cmp.Or(info.BuildDate, "unknown"))
+	fmt.Fprintf(w, "go version: %s\n", info.GoVersion)
+	fmt.Fprintf(w, "platform:   %s\n", info.Platform)
+	return nil
+}
+
+// runVersion implements the version subcommand
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the build information as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s version [flags]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Print the version, commit, build date and Go version of this build.")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	if err := writeBuildInfo(os.Stdout, currentBuildInfo(), *asJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write build information: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestWithEmbeddedInfo(t *testing.T) {
+	embedded := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.4.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.time", Value: "2026-10-01T12:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		info BuildInfo
+		want BuildInfo
+	}{
+		{
+			name: "embedded only",
+			want: BuildInfo{Version: "v1.4.0", Commit: "0123abcd", BuildDate: "2026-10-01T12:00:00Z", Modified: true},
+		},
+		{
+			name: "link-time values win",
+			info: BuildInfo{Version: "v2.0.0", Commit: "fedcba98", BuildDate: "2026-10-02T00:00:00Z"},
+			want: BuildInfo{Version: "v2.0.0", Commit: "fedcba98", BuildDate: "2026-10-02T00:00:00Z", Modified: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withEmbeddedInfo(tt.info, embedded); got != tt.want {
+				t.Errorf("withEmbeddedInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Local builds carry no module version
+	if got := withEmbeddedInfo(BuildInfo{}, &debug.BuildInfo{Main: debug.Module{Version: develVersion}}); got.Version != "" {
+		t.Errorf("Version = %q, want it left for the caller to default", got.Version)
+	}
+}
+
+func TestWriteBuildInfo(t *testing.T) {
+	info := BuildInfo{Version: "v1.4.0", Commit: "0123abcd", Modified: true, GoVersion: "go1.24.4", Platform: "linux/arm64"}
+
+	var text bytes.Buffer
+	if err := writeBuildInfo(&text, info, false); err != nil {
+		t.Fatalf("writeBuildInfo() error = %v", err)
+	}
+	for _, line := range []string{"containerfile-updater v1.4.0", "commit:     0123abcd (modified)", "built:      unknown", "platform:   linux/arm64"} {
+		if !strings.Contains(text.String(), line+"\n") {
+			t.Errorf("Text output missing %q:\n%s", line, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeBuildInfo(&out, info, true); err != nil {
+		t.Fatalf("writeBuildInfo() error = %v", err)
+	}
+	var decoded BuildInfo
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if decoded != info {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, info)
+	}
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Supported vulnerability scanners
+const (
+	scannerTrivy = "trivy"
+	scannerGrype = "grype"
+)
+
+// defaultScanTimeout bounds a single image scan, which can take far longer than a digest lookup
+const defaultScanTimeout = 10 * time.Minute
+
+// VulnerabilityConfig configures the vulnerability gate for candidate digests
+type VulnerabilityConfig struct {
+	Scanner    string        `yaml:"scanner"`    // trivy or grype; empty disables scanning
+	Server     string        `yaml:"server"`     // Trivy server URL for client/server mode
+	Severities []string      `yaml:"severities"` // Severities that count towards the threshold (default CRITICAL)
+	MaxNew     int           `yaml:"maxNew"`     // New vulnerabilities tolerated compared to the current pin
+	Timeout    time.Duration `yaml:"timeout"`    // Time allowed per image scan (default 10m)
+}
+
+// Vulnerability is a single finding reported by a scanner
+type Vulnerability struct {
+	ID       string
+	Package  string
+	Severity string
+}
+
+// key identifies a finding independently of the image it was found in
+func (v Vulnerability) key() string {
+	return v.ID + "/" + v.Package
+}
+
+// validateVulnerabilityConfig rejects unknown scanners and negative thresholds
+func validateVulnerabilityConfig(vc VulnerabilityConfig) error {
+	switch vc.Scanner {
+	case "", scannerTrivy, scannerGrype:
+	default:
+		return fmt.Errorf("unknown vulnerability scanner %q (expected %s or %s)", vc.Scanner, scannerTrivy, scannerGrype)
+	}
+	if vc.Server != "" && vc.Scanner != scannerTrivy {
+		return fmt.Errorf("vulnerability scanner server is only supported with %s", scannerTrivy)
+	}
+	if vc.MaxNew < 0 {
+		return fmt.Errorf("maxNew must not be negative")
+	}
+	return nil
+}
+
+// severities returns the upper-cased severities that count towards the threshold
+func (vc VulnerabilityConfig) severities() []string {
+	if len(vc.Severities) == 0 {
+		return []string{"CRITICAL"}
+	}
+	severities := make([]string, len(vc.Severities))
+	for i, severity := range vc.Severities {
+		severities[i] = strings.ToUpper(severity)
+	}
+	return severities
+}
+
+// checkVulnerabilities holds back an update whose candidate digest introduces more
+// vulnerabilities at the configured severities than the current pin allows. Images
+// without a current pin are not gated since pinning doesn't change what is pulled.
+func (du *ContainerfileUpdater) checkVulnerabilities(cmd *FromCommand, digest string) string {
+	vc := du.config.Vulnerabilities
+	if vc.Scanner == "" || cmd.PreviousDigest == "" {
+		return ""
+	}
+
+	current, err := du.scanImage(cmd.Image, cmd.PreviousDigest)
+	if err != nil {
+		return fmt.Sprintf("could not scan current digest: %v", err)
+	}
+	candidate, err := du.scanImage(cmd.Image, digest)
+	if err != nil {
+		return fmt.Sprintf("could not scan candidate digest: %v", err)
+	}
+
+	cmd.NewVulnerabilities = newVulnerabilities(current, candidate, vc.severities())
+	if len(cmd.NewVulnerabilities) > vc.MaxNew {
+		return fmt.Sprintf("%d new %s vulnerabilities (%s)",
+			len(cmd.NewVulnerabilities), strings.Join(vc.severities(), "/"), strings.Join(cmd.NewVulnerabilities, ", "))
+	}
+	return ""
+}
+
+// newVulnerabilities returns the IDs of findings at the given severities that
+// appear in the candidate image but not in the current one
+func newVulnerabilities(current, candidate []Vulnerability, severities []string) []string {
+	known := make(map[string]bool, len(current))
+	for _, v := range current {
+		known[v.key()] = true
+	}
+
+	seen := make(map[string]bool)
+	var added []string
+	for _, v := range candidate {
+		if known[v.key()] || seen[v.ID] || !containsFold(severities, v.Severity) {
+			continue
+		}
+		seen[v.ID] = true
+		added = append(added, v.ID)
+	}
+	sort.Strings(added)
+	return added
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanImage runs the configured scanner against an image digest
+func (du *ContainerfileUpdater) scanImage(image *ImageReference, digest string) ([]Vulnerability, error) {
+	vc := du.config.Vulnerabilities
+	timeout := vc.Timeout
+	if timeout == 0 {
+		timeout = defaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ref := image.Name() + "@" + digest
+	insecure := du.config.Registry(image.Registry) != nil && du.config.Registry(image.Registry).Insecure
+	username, password := du.scannerCredentials(image.Registry)
+
+	var cmd *exec.Cmd
+	switch vc.Scanner {
+	case scannerTrivy:
+		args := []string{"image", "--quiet", "--format", "json", "--scanners", "vuln"}
+		if vc.Server != "" {
+			args = append(args, "--server", vc.Server)
+		}
+		if insecure {
+			args = append(args, "--insecure")
+		}
+		cmd = exec.CommandContext(ctx, scannerTrivy, append(args, ref)...)
+		cmd.Env = os.Environ()
+		if username != "" {
+			cmd.Env = append(cmd.Env, "TRIVY_USERNAME="+username, "TRIVY_PASSWORD="+password)
+		}
+	case scannerGrype:
+		cmd = exec.CommandContext(ctx, scannerGrype, "registry:"+ref, "--output", "json", "--quiet")
+		cmd.Env = os.Environ()
+		if username != "" {
+			cmd.Env = append(cmd.Env,
+				"GRYPE_REGISTRY_AUTH_AUTHORITY="+image.Registry,
+				"GRYPE_REGISTRY_AUTH_USERNAME="+username,
+				"GRYPE_REGISTRY_AUTH_PASSWORD="+password,
+			)
+		}
+		if insecure {
+			cmd.Env = append(cmd.Env, "GRYPE_REGISTRY_INSECURE_SKIP_TLS_VERIFY=true", "GRYPE_REGISTRY_INSECURE_USE_HTTP=true")
+		}
+	default:
+		return nil, fmt.Errorf("unknown vulnerability scanner %q", vc.Scanner)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s %s: %w: %s", vc.Scanner, ref, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if vc.Scanner == scannerGrype {
+		return parseGrypeReport(stdout.Bytes())
+	}
+	return parseTrivyReport(stdout.Bytes())
+}
+
+// scannerCredentials resolves basic credentials for a registry so the scanner can pull
+// the same images the updater resolved, returning empty strings if none apply
+func (du *ContainerfileUpdater) scannerCredentials(registry string) (string, string) {
+	reg, err := name.NewRegistry(registry, referenceOptions(du.config, registry)...)
+	if err != nil {
+		return "", ""
+	}
+	authenticator, err := du.keychain.Resolve(reg)
+	if err != nil || authenticator == authn.Anonymous {
+		return "", ""
+	}
+	auth, err := authenticator.Authorization()
+	if err != nil || auth.Username == "" {
+		return "", ""
+	}
+	return auth.Username, auth.Password
+}
+
+// parseTrivyReport extracts findings from `trivy image --format json` output
+func parseTrivyReport(data []byte) ([]Vulnerability, error) {
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID string `json:"VulnerabilityID"`
+				PkgName         string `json:"PkgName"`
+				Severity        string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy report: %w", err)
+	}
+
+	var vulns []Vulnerability
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulns = append(vulns, Vulnerability{ID: v.VulnerabilityID, Package: v.PkgName, Severity: v.Severity})
+		}
+	}
+	return vulns, nil
+}
+
+// parseGrypeReport extracts findings from `grype -o json` output
+func parseGrypeReport(data []byte) ([]Vulnerability, error) {
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID       string `json:"id"`
+				Severity string `json:"severity"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name string `json:"name"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse grype report: %w", err)
+	}
+
+	var vulns []Vulnerability
+	for _, match := range report.Matches {
+		vulns = append(vulns, Vulnerability{ID: match.Vulnerability.ID, Package: match.Artifact.Name, Severity: match.Vulnerability.Severity})
+	}
+	return vulns, nil
+}
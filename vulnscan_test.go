@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseScannerReports(t *testing.T) {
+	trivy := `{"Results":[{"Vulnerabilities":[{"VulnerabilityID":"CVE-1","PkgName":"openssl","Severity":"CRITICAL"}]},{"Vulnerabilities":null}]}`
+	vulns, err := parseTrivyReport([]byte(trivy))
+	if err != nil {
+		t.Fatalf("parseTrivyReport failed: %v", err)
+	}
+	if len(vulns) != 1 || vulns[0] != (Vulnerability{ID: "CVE-1", Package: "openssl", Severity: "CRITICAL"}) {
+		t.Errorf("Unexpected trivy findings: %+v", vulns)
+	}
+
+	grype := `{"matches":[{"vulnerability":{"id":"CVE-2","severity":"Critical"},"artifact":{"name":"zlib"}}]}`
+	vulns, err = parseGrypeReport([]byte(grype))
+	if err != nil {
+		t.Fatalf("parseGrypeReport failed: %v", err)
+	}
+	if len(vulns) != 1 || vulns[0] != (Vulnerability{ID: "CVE-2", Package: "zlib", Severity: "Critical"}) {
+		t.Errorf("Unexpected grype findings: %+v", vulns)
+	}
+
+	if _, err := parseTrivyReport([]byte("not json")); err == nil {
+		t.Error("Expected error for malformed report")
+	}
+}
+
+func TestNewVulnerabilities(t *testing.T) {
+	current := []Vulnerability{
+		{ID: "CVE-1", Package: "openssl", Severity: "CRITICAL"},
+	}
+	candidate := []Vulnerability{
+		{ID: "CVE-1", Package: "openssl", Severity: "CRITICAL"}, // already present
+		{ID: "CVE-3", Package: "zlib", Severity: "Critical"},    // new, grype casing
+		{ID: "CVE-3", Package: "zlib-dev", Severity: "CRITICAL"},
+		{ID: "CVE-2", Package: "curl", Severity: "HIGH"}, // below threshold
+	}
+
+	got := newVulnerabilities(current, candidate, []string{"CRITICAL"})
+	if strings.Join(got, ",") != "CVE-3" {
+		t.Errorf("Expected [CVE-3], got %v", got)
+	}
+
+	got = newVulnerabilities(current, candidate, []string{"CRITICAL", "HIGH"})
+	if strings.Join(got, ",") != "CVE-2,CVE-3" {
+		t.Errorf("Expected [CVE-2 CVE-3], got %v", got)
+	}
+}
+
+func TestValidateVulnerabilityConfig(t *testing.T) {
+	valid := []VulnerabilityConfig{
+		{},
+		{Scanner: scannerTrivy, Server: "http://trivy:4954"},
+		{Scanner: scannerGrype, MaxNew: 2},
+	}
+	for _, vc := range valid {
+		if err := validateVulnerabilityConfig(vc); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", vc, err)
+		}
+	}
+
+	invalid := []VulnerabilityConfig{
+		{Scanner: "clair"},
+		{Scanner: scannerGrype, Server: "http://trivy:4954"},
+		{Scanner: scannerTrivy, MaxNew: -1},
+	}
+	for _, vc := range invalid {
+		if err := validateVulnerabilityConfig(vc); err == nil {
+			t.Errorf("Expected %+v to be invalid", vc)
+		}
+	}
+}
+
+// installFakeTrivy puts a trivy script on PATH that reports a critical finding
+// for references containing the given digest and nothing otherwise
+func installFakeTrivy(t *testing.T, vulnerableDigest string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake scanner is a shell script")
+	}
+
+	dir := t.TempDir()
+	script := fmt.Sprintf(`#!/bin/sh
+case "$*" in
+  *%s*) echo '{"Results":[{"Vulnerabilities":[{"VulnerabilityID":"CVE-2024-0001","PkgName":"openssl","Severity":"CRITICAL"}]}]}' ;;
+  *) echo '{"Results":[]}' ;;
+esac
+`, vulnerableDigest)
+	if err := os.WriteFile(filepath.Join(dir, "trivy"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake trivy: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestVulnerabilityGateHoldsUpdates(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	old := pushRandomImage(t, server, host+"/app:v1")
+	vulnerable := pushRandomImage(t, server, host+"/app:v1")
+	installFakeTrivy(t, vulnerable.String())
+
+	content := "FROM " + host + "/app:v1@" + old.String() + "\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	cfg.Vulnerabilities.Scanner = scannerTrivy
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("Expected Containerfile to keep the current pin, got %q", string(data))
+	}
+
+	cmd := du.fromCommands[0]
+	if !strings.Contains(cmd.HeldReason, "CVE-2024-0001") {
+		t.Errorf("Expected held reason to name the new vulnerability, got %q", cmd.HeldReason)
+	}
+
+	// Tolerating one new finding lets the update through
+	cfg.Vulnerabilities.MaxNew = 1
+	du = NewContainerfileUpdaterWithConfig(path, cfg)
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+	if du.fromCommands[0].HeldReason != "" || du.fromCommands[0].Image.Digest != vulnerable.String() {
+		t.Errorf("Expected update to %s, got %+v", vulnerable, du.fromCommands[0])
+	}
+}
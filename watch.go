@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultWatchInterval is how often watch mode re-pins when --interval isn't set
+const defaultWatchInterval = 6 * time.Hour
+
+// shutdownTimeout bounds how long the health server waits for open requests on exit
+const shutdownTimeout = 5 * time.Second
+
+// Watcher repeats an update run on a fixed interval and tracks the outcome for health checks
+type Watcher struct {
+	interval time.Duration
+	run      func() int
+
+	mu       sync.Mutex
+	runs     int
+	lastRun  time.Time
+	lastExit int
+}
+
+// WatchStatus is the body served by the health endpoint
+type WatchStatus struct {
+	Status       string    `json:"status"`
+	Runs         int       `json:"runs"`
+	LastRun      time.Time `json:"lastRun,omitzero"`
+	LastExitCode int       `json:"lastExitCode"`
+	NextRun      time.Time `json:"nextRun,omitzero"`
+}
+
+// NewWatcher creates a Watcher calling run every interval
+func NewWatcher(interval time.Duration, run func() int) *Watcher {
+	return &Watcher{interval: interval, run: run}
+}
+
+// Run calls the run function immediately and then every interval until the context is
+// cancelled. A run in progress is always allowed to finish so files aren't left half written.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		exitCode := w.run()
+		w.mu.Lock()
+		w.runs++
+		w.lastRun = time.Now()
+		w.lastExit = exitCode
+		w.mu.Unlock()
+		slog.Info("Run finished", "run", w.runs, "exit_code", exitCode, "next_run_in", w.interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status reports the outcome of the last run
+func (w *Watcher) Status() WatchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := WatchStatus{Status: "ok", Runs: w.runs, LastRun: w.lastRun, LastExitCode: w.lastExit}
+	switch {
+	case w.runs == 0:
+		status.Status = "starting"
+	case w.lastExit == exitError:
+		status.Status = "error"
+	}
+	if !w.lastRun.IsZero() {
+		status.NextRun = w.lastRun.Add(w.interval)
+	}
+	return status
+}
+
+// ServeHTTP answers health checks: 503 while the last run failed, 200 otherwise
+func (w *Watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	status := w.Status()
+	rw.Header().Set("Content-Type", "application/json")
+	if status.Status == "error" {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(rw).Encode(status)
+}
+
+// runWatch runs the update on an interval, serving health checks and metrics when an
+// address is set, until SIGINT or SIGTERM
+func runWatch(run *updateRun, interval time.Duration, healthAddr string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	run.metrics = NewMetrics()
+	watcher := NewWatcher(interval, func() int {
+		exitCode := run.run()
+		run.metrics.observeRun(exitCode)
+		return exitCode
+	})
+
+	var server *http.Server
+	if healthAddr != "" {
+		listener, err := net.Listen("tcp", healthAddr)
+		if err != nil {
+			slog.Error("Failed to listen", "addr", healthAddr, "error", err)
+			return exitError
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/healthz", watcher)
+		mux.Handle("/metrics", run.metrics.Handler())
+		server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Health server failed", "error", err)
+			}
+		}()
+		slog.Info("Serving health checks", "addr", listener.Addr().String())
+	}
+
+	slog.Info("Watching files", "paths", run.paths, "interval", interval)
+	watcher.Run(ctx)
+	slog.Info("Shutting down")
+
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to stop health server", "error", err)
+		}
+	}
+	return exitOK
+}
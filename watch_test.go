@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatcherRunsUntilCancelled(t *testing.T) {
+	disableLogging()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	watcher := NewWatcher(time.Millisecond, func() int {
+		runs++
+		if runs == 3 {
+			cancel()
+		}
+		return exitOK
+	})
+
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watcher did not stop after cancellation")
+	}
+	if runs != 3 {
+		t.Errorf("Expected 3 runs, got %d", runs)
+	}
+	if status := watcher.Status(); status.Runs != 3 || status.Status != "ok" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestWatcherHealthEndpoint(t *testing.T) {
+	disableLogging()
+
+	exitCode := exitError
+	watcher := NewWatcher(time.Hour, func() int { return exitCode })
+
+	check := func(wantCode int, wantStatus string) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		watcher.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if recorder.Code != wantCode {
+			t.Errorf("Expected HTTP %d, got %d", wantCode, recorder.Code)
+		}
+		var status WatchStatus
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		if status.Status != wantStatus {
+			t.Errorf("Expected status %q, got %q", wantStatus, status.Status)
+		}
+	}
+
+	check(http.StatusOK, "starting")
+
+	// A cancelled context still lets the first run complete
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	watcher.Run(ctx)
+	check(http.StatusServiceUnavailable, "error")
+
+	exitCode = exitUpdatesNeeded
+	watcher.Run(ctx)
+	check(http.StatusOK, "ok")
+}
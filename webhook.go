@@ -0,0 +1,324 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxWebhookBody caps the size of webhook payloads read into memory
+const maxWebhookBody = 1 << 20
+
+// webhookQueueSize is how many event batches may wait while a run is in progress
+const webhookQueueSize = 64
+
+// RegistryEvent names an image pushed to a registry. An empty tag matches every tag.
+type RegistryEvent struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// newRegistryEvent builds an event from a pushed reference such as
+// "harbor.example.com/library/nginx:1.27", dropping any digest
+func newRegistryEvent(reference string) (RegistryEvent, error) {
+	reference, _, _ = strings.Cut(reference, "@")
+	if reference == "" {
+		return RegistryEvent{}, errors.New("empty image reference")
+	}
+
+	registry, repository := "docker.io", reference
+	if host, rest, ok := strings.Cut(reference, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		registry, repository = host, rest
+	}
+
+	var tag string
+	if i := strings.LastIndex(repository, ":"); i != -1 {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	if registry == "docker.io" && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return RegistryEvent{Registry: normalizeRegistry(registry), Repository: repository, Tag: tag}, nil
+}
+
+// Matches reports whether an image reference is affected by the event
+func (e RegistryEvent) Matches(image *ImageReference) bool {
+	return normalizeRegistry(image.Registry) == e.Registry &&
+		image.Repository == e.Repository &&
+		(e.Tag == "" || image.Tag == e.Tag)
+}
+
+// String formats the event as an image reference
+func (e RegistryEvent) String() string {
+	if e.Tag == "" {
+		return e.Registry + "/" + e.Repository
+	}
+	return e.Registry + "/" + e.Repository + ":" + e.Tag
+}
+
+// harborPayload is the subset of a Harbor webhook used to find pushed images
+type harborPayload struct {
+	Type      string `json:"type"`
+	EventData struct {
+		Resources []struct {
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+	} `json:"event_data"`
+}
+
+// dockerHubPayload is the subset of a Docker Hub webhook used to find pushed images
+type dockerHubPayload struct {
+	PushData struct {
+		Tag string `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+// githubPackage is the package object of GitHub package and registry_package events
+type githubPackage struct {
+	Name           string `json:"name"`
+	Namespace      string `json:"namespace"`
+	PackageType    string `json:"package_type"`
+	PackageVersion struct {
+		PackageURL        string `json:"package_url"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name string `json:"name"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+// parseWebhookEvents extracts pushed images from a Harbor, Docker Hub or GitHub (GHCR)
+// webhook. Payloads that don't announce a push yield no events.
+func parseWebhookEvents(header http.Header, body []byte) ([]RegistryEvent, error) {
+	var references []string
+
+	if githubEvent := header.Get("X-GitHub-Event"); githubEvent != "" {
+		if githubEvent != "package" && githubEvent != "registry_package" {
+			return nil, nil
+		}
+		var payload struct {
+			Package         *githubPackage `json:"package"`
+			RegistryPackage *githubPackage `json:"registry_package"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid GitHub payload: %w", err)
+		}
+		pkg := payload.Package
+		if pkg == nil {
+			pkg = payload.RegistryPackage
+		}
+		if pkg == nil || !strings.EqualFold(pkg.PackageType, "container") {
+			return nil, nil
+		}
+		reference := pkg.PackageVersion.PackageURL
+		if reference == "" {
+			reference = "ghcr.io/" + strings.ToLower(pkg.Namespace+"/"+pkg.Name)
+			if tag := pkg.PackageVersion.ContainerMetadata.Tag.Name; tag != "" {
+				reference += ":" + tag
+			}
+		}
+		references = append(references, reference)
+	} else {
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(body, &probe); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		switch {
+		case probe["event_data"] != nil:
+			var payload harborPayload
+			if err := json.Unmarshal(body, &payload); err != nil {
+				return nil, fmt.Errorf("invalid Harbor payload: %w", err)
+			}
+			if payload.Type != "PUSH_ARTIFACT" && payload.Type != "pushImage" {
+				return nil, nil
+			}
+			for _, resource := range payload.EventData.Resources {
+				references = append(references, resource.ResourceURL)
+			}
+		case probe["push_data"] != nil:
+			var payload dockerHubPayload
+			if err := json.Unmarshal(body, &payload); err != nil {
+				return nil, fmt.Errorf("invalid Docker Hub payload: %w", err)
+			}
+			reference := "docker.io/" + payload.Repository.RepoName
+			if payload.PushData.Tag != "" {
+				reference += ":" + payload.PushData.Tag
+			}
+			references = append(references, reference)
+		default:
+			return nil, errors.New("unrecognized webhook payload")
+		}
+	}
+
+	var events []RegistryEvent
+	for _, reference := range references {
+		event, err := newRegistryEvent(reference)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// WebhookServer accepts registry webhooks and re-runs the update for the pushed images
+type WebhookServer struct {
+	secret string
+	run    func(events []RegistryEvent) int
+	queue  chan []RegistryEvent
+}
+
+// NewWebhookServer creates a WebhookServer that calls run for each batch of pushed images
+func NewWebhookServer(secret string, run func(events []RegistryEvent) int) *WebhookServer {
+	return &WebhookServer{secret: secret, run: run, queue: make(chan []RegistryEvent, webhookQueueSize)}
+}
+
+// authenticate checks a request against the shared secret: GitHub signs the body
+// (X-Hub-Signature-256), Harbor sends it as the Authorization header and Docker Hub,
+// which can't set headers, as the token query parameter
+func (s *WebhookServer) authenticate(r *http.Request, body []byte) bool {
+	if s.secret == "" {
+		return true
+	}
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.secret)) == 1
+}
+
+// ServeHTTP queues the images named by a webhook and answers 202 without waiting for the run
+func (s *WebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if !s.authenticate(r, body) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	events, err := parseWebhookEvents(r.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	select {
+	case s.queue <- events:
+		slog.Info("Queued update for pushed images", "count", len(events))
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "update queue full", http.StatusServiceUnavailable)
+	}
+}
+
+// Run processes queued events one run at a time until the context is cancelled, merging
+// events that arrived during the previous run into a single batch
+func (s *WebhookServer) Run(ctx context.Context) {
+	for {
+		var events []RegistryEvent
+		select {
+		case <-ctx.Done():
+			return
+		case events = <-s.queue:
+		}
+	drain:
+		for {
+			select {
+			case more := <-s.queue:
+				events = append(events, more...)
+			default:
+				break drain
+			}
+		}
+
+		exitCode := s.run(events)
+		slog.Info("Update for pushed images finished", "count", len(events), "exit_code", exitCode)
+	}
+}
+
+// runWebhook serves registry webhooks on addr and updates the images they name until
+// SIGINT or SIGTERM
+func runWebhook(run *updateRun, addr, secret string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	run.metrics = NewMetrics()
+	webhook := NewWebhookServer(secret, func(events []RegistryEvent) int {
+		targeted := *run
+		targeted.targets = events
+		exitCode := targeted.run()
+		run.metrics.observeRun(exitCode)
+		return exitCode
+	})
+	if secret == "" {
+		slog.Warn("No webhook secret configured, accepting unauthenticated requests")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("Failed to listen", "addr", addr, "error", err)
+		return exitError
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", webhook)
+	mux.Handle("/metrics", run.metrics.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Webhook server failed", "error", err)
+			stop()
+		}
+	}()
+	slog.Info("Listening for registry webhooks", "addr", listener.Addr().String())
+
+	webhook.Run(ctx)
+	slog.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to stop webhook server", "error", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWebhookEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   []RegistryEvent
+	}{
+		{
+			name: "harbor push",
+			body: `{"type":"PUSH_ARTIFACT","event_data":{"resources":[{"digest":"sha256:abc","tag":"1.27","resource_url":"harbor.example.com/library/nginx:1.27"}]}}`,
+			want: []RegistryEvent{{Registry: "harbor.example.com", Repository: "library/nginx", Tag: "1.27"}},
+		},
+		{
+			name: "harbor delete",
+			body: `{"type":"DELETE_ARTIFACT","event_data":{"resources":[{"resource_url":"harbor.example.com/library/nginx:1.27"}]}}`,
+		},
+		{
+			name: "docker hub official image",
+			body: `{"push_data":{"tag":"3.20"},"repository":{"repo_name":"alpine"}}`,
+			want: []RegistryEvent{{Registry: "docker.io", Repository: "library/alpine", Tag: "3.20"}},
+		},
+		{
+			name: "docker hub user image",
+			body: `{"push_data":{"tag":"latest"},"repository":{"repo_name":"example/app"}}`,
+			want: []RegistryEvent{{Registry: "docker.io", Repository: "example/app", Tag: "latest"}},
+		},
+		{
+			name:   "github package",
+			header: http.Header{"X-Github-Event": {"package"}},
+			body:   `{"action":"published","package":{"name":"app","namespace":"Example","package_type":"CONTAINER","package_version":{"package_url":"ghcr.io/example/app:v2"}}}`,
+			want:   []RegistryEvent{{Registry: "ghcr.io", Repository: "example/app", Tag: "v2"}},
+		},
+		{
+			name:   "github registry package without url",
+			header: http.Header{"X-Github-Event": {"registry_package"}},
+			body:   `{"registry_package":{"name":"app","namespace":"Example","package_type":"container","package_version":{"container_metadata":{"tag":{"name":"v3"}}}}}`,
+			want:   []RegistryEvent{{Registry: "ghcr.io", Repository: "example/app", Tag: "v3"}},
+		},
+		{
+			name:   "github npm package",
+			header: http.Header{"X-Github-Event": {"package"}},
+			body:   `{"package":{"name":"lib","package_type":"npm"}}`,
+		},
+		{
+			name:   "github ping",
+			header: http.Header{"X-Github-Event": {"ping"}},
+			body:   `{"zen":"Keep it logically awesome."}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			got, err := parseWebhookEvents(header, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseWebhookEvents failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := parseWebhookEvents(http.Header{}, []byte(`{"unknown":true}`)); err == nil {
+		t.Error("Expected error for unrecognized payload")
+	}
+}
+
+func TestRegistryEventMatches(t *testing.T) {
+	du := NewContainerfileUpdater("Containerfile")
+	image, err := du.parseImageReference("nginx:1.27@sha256:abc")
+	if err != nil {
+		t.Fatalf("parseImageReference failed: %v", err)
+	}
+
+	tests := []struct {
+		reference string
+		want      bool
+	}{
+		{"docker.io/nginx:1.27", true},
+		{"index.docker.io/library/nginx", true},
+		{"docker.io/nginx:1.26", false},
+		{"ghcr.io/nginx:1.27", false},
+	}
+	for _, tt := range tests {
+		event, err := newRegistryEvent(tt.reference)
+		if err != nil {
+			t.Fatalf("newRegistryEvent(%s) failed: %v", tt.reference, err)
+		}
+		if got := event.Matches(image); got != tt.want {
+			t.Errorf("%s matches nginx:1.27 = %v, want %v", tt.reference, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookServerAuthentication(t *testing.T) {
+	disableLogging()
+
+	body := `{"push_data":{"tag":"3.20"},"repository":{"repo_name":"alpine"}}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name   string
+		url    string
+		header http.Header
+		want   int
+	}{
+		{"no credentials", "/webhook", nil, http.StatusUnauthorized},
+		{"wrong token", "/webhook?token=nope", nil, http.StatusUnauthorized},
+		{"query token", "/webhook?token=s3cret", nil, http.StatusAccepted},
+		{"authorization header", "/webhook", http.Header{"Authorization": {"s3cret"}}, http.StatusAccepted},
+		{"github signature", "/webhook", http.Header{"X-Hub-Signature-256": {signature}}, http.StatusAccepted},
+		{"bad github signature", "/webhook", http.Header{"X-Hub-Signature-256": {"sha256=00"}}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewWebhookServer("s3cret", func([]RegistryEvent) int { return exitOK })
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(body))
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			if recorder.Code != tt.want {
+				t.Errorf("Expected HTTP %d, got %d", tt.want, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestWebhookUpdatesOnlyPushedImages(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	app := pushRandomImage(t, server, host+"/app:1.0")
+	pushRandomImage(t, server, host+"/tool:1.0")
+
+	content := "FROM " + host + "/app:1.0\nFROM " + host + "/tool:1.0\n"
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	run := &updateRun{paths: []string{path}, cfg: cfg, format: formatAuto, output: outputText, out: io.Discard}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	webhook := NewWebhookServer("", func(events []RegistryEvent) int {
+		defer cancel()
+		targeted := *run
+		targeted.targets = events
+		return targeted.run()
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(
+		`{"type":"PUSH_ARTIFACT","event_data":{"resources":[{"resource_url":"`+host+`/app:1.0"}]}}`))
+	recorder := httptest.NewRecorder()
+	webhook.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected HTTP 202, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	webhook.Run(ctx)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	expected := "FROM " + host + "/app@" + app.String() + "\nFROM " + host + "/tool:1.0\n"
+	if string(data) != expected {
+		t.Errorf("Unexpected Containerfile:\n%s\nexpected:\n%s", string(data), expected)
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dockerURLPrefix marks a container image in a step's uses: or an action's runs.image
+const dockerURLPrefix = "docker://"
+
+// isGitHubWorkflowPath reports whether a path is a GitHub Actions workflow or action metadata file
+func isGitHubWorkflowPath(path string) bool {
+	slashed := strings.ToLower(strings.ReplaceAll(path, "\\", "/"))
+	if strings.Contains(slashed, ".github/workflows/") {
+		return true
+	}
+	base := slashed[strings.LastIndex(slashed, "/")+1:]
+	return base == "action.yml" || base == "action.yaml"
+}
+
+// extractWorkflowImages finds the job containers, service containers and docker://
+// step references of a GitHub Actions workflow, and the image of a Docker action. Images
+// passed to builds through env variables, matrices and build-args are pinned too, see
+// extractCIVariableImages.
+func (du *ContainerfileUpdater) extractWorkflowImages(docs []*yaml.Node) ([]*FromCommand, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	root := docs[0]
+
+	var images []*FromCommand
+	add := func(cmd *FromCommand) {
+		if cmd != nil {
+			images = append(images, cmd)
+		}
+	}
+
+	// Docker container actions: runs.image: docker://...
+	_, runs := yamlMappingValue(root, "runs")
+	if imageKey, image := yamlMappingValue(runs, "image"); image != nil {
+		add(du.dockerURLCommand(imageKey, image))
+	}
+
+	_, env := yamlMappingValue(root, "env")
+	images = append(images, du.extractCIVariableImages(env)...)
+
+	_, jobs := yamlMappingValue(root, "jobs")
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return images, nil
+	}
+	for i := 0; i+1 < len(jobs.Content); i += 2 {
+		job := jobs.Content[i+1]
+
+		_, strategy := yamlMappingValue(job, "strategy")
+		_, matrix := yamlMappingValue(strategy, "matrix")
+		images = append(images, du.extractMatrixImages(matrix)...)
+		_, env := yamlMappingValue(job, "env")
+		images = append(images, du.extractCIVariableImages(env)...)
+
+		// container: is either the image or a mapping with an image key
+		if key, container := yamlMappingValue(job, "container"); container != nil {
+			add(du.containerImageCommand(key, container))
+		}
+
+		_, services := yamlMappingValue(job, "services")
+		if services != nil && services.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(services.Content); j += 2 {
+				add(du.containerImageCommand(services.Content[j], services.Content[j+1]))
+			}
+		}
+
+		_, steps := yamlMappingValue(job, "steps")
+		if steps != nil && steps.Kind == yaml.SequenceNode {
+			for _, step := range steps.Content {
+				if usesKey, uses := yamlMappingValue(step, "uses"); uses != nil {
+					add(du.dockerURLCommand(usesKey, uses))
+				}
+				_, env := yamlMappingValue(step, "env")
+				images = append(images, du.extractCIVariableImages(env)...)
+				_, with := yamlMappingValue(step, "with")
+				images = append(images, du.extractBuildArgImages(yamlMappingValue(with, "build-args"))...)
+			}
+		}
+	}
+	return images, nil
+}
+
+// containerImageCommand handles a job or service container given as an image string
+// or as a mapping with an image key
+func (du *ContainerfileUpdater) containerImageCommand(key, container *yaml.Node) *FromCommand {
+	if container.Kind == yaml.ScalarNode {
+		return du.yamlImageCommand(key, container)
+	}
+	imageKey, image := yamlMappingValue(container, "image")
+	if image == nil {
+		return nil
+	}
+	return du.yamlImageCommand(imageKey, image)
+}
+
+// dockerURLCommand handles a docker://image reference, ignoring other uses: values
+func (du *ContainerfileUpdater) dockerURLCommand(key, value *yaml.Node) *FromCommand {
+	if value.Kind != yaml.ScalarNode || !strings.HasPrefix(value.Value, dockerURLPrefix) {
+		return nil
+	}
+	return du.yamlReferenceCommand(key, value, strings.TrimPrefix(value.Value, dockerURLPrefix))
+}
@@ -0,0 +1,206 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractWorkflowImages(t *testing.T) {
+	disableLogging()
+
+	content := `name: CI
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    container: golang:1.24
+    services:
+      postgres:
+        image: postgres:16
+        ports:
+          - 5432:5432
+      redis:
+        # containerfile-updater: ignore
+        image: redis:7
+    steps:
+      - uses: actions/checkout@v5
+      - uses: docker://alpine:3.20
+        with:
+          args: echo hi
+  matrix:
+    runs-on: ubuntu-latest
+    container:
+      image: ${{ matrix.image }}
+      options: --user root
+`
+	dir := filepath.Join(t.TempDir(), ".github", "workflows")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create workflows directory: %v", err)
+	}
+	path := filepath.Join(dir, "ci.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write workflow: %v", err)
+	}
+
+	du := NewContainerfileUpdater(path)
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+
+	want := []struct {
+		original string
+		line     int
+		skip     string
+	}{
+		{"golang:1.24", 6, ""},
+		{"postgres:16", 9, ""},
+		{"redis:7", 14, "ignored by annotation"},
+		{"alpine:3.20", 17, ""},
+		{"${{ matrix.image }}", 23, "uses variable interpolation"},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("Expected %d images, got %d", len(want), len(images))
+	}
+	for i, w := range want {
+		if images[i].Image.Original != w.original || images[i].LineStart != w.line || images[i].SkipReason != w.skip {
+			t.Errorf("Image %d: expected %s at line %d (skip %q), got %s at line %d (skip %q)",
+				i, w.original, w.line, w.skip, images[i].Image.Original, images[i].LineStart, images[i].SkipReason)
+		}
+	}
+}
+
+func TestUpdateWorkflowAndAction(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	tool := pushRandomImage(t, server, host+"/tool:1.0")
+	db := pushRandomImage(t, server, host+"/db:2.0")
+
+	dir := t.TempDir()
+	workflow := `jobs:
+  lint:
+    runs-on: ubuntu-latest
+    services:
+      db:
+        image: '` + host + `/db:2.0'
+    steps:
+      - name: Lint
+        uses: docker://` + host + `/tool:1.0 # linter
+`
+	workflowPath := filepath.Join(dir, "lint.yml")
+	if err := os.WriteFile(workflowPath, []byte(workflow), 0644); err != nil {
+		t.Fatalf("Failed to write workflow: %v", err)
+	}
+
+	action := `name: Tool
+runs:
+  using: docker
+  image: docker://` + host + `/tool:1.0
+`
+	actionPath := filepath.Join(dir, "action.yml")
+	if err := os.WriteFile(actionPath, []byte(action), 0644); err != nil {
+		t.Fatalf("Failed to write action: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	for _, path := range []string{workflowPath, actionPath} {
+		du := NewContainerfileUpdaterWithConfig(path, cfg)
+		du.format = formatWorkflow
+		if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+			t.Fatalf("UpdateContainerfileWithLatestDigests(%s) failed: %v", path, err)
+		}
+	}
+
+	replacer := strings.NewReplacer(
+		host+"/db:2.0", host+"/db@"+db.String(),
+		host+"/tool:1.0", host+"/tool@"+tool.String(),
+	)
+	for path, original := range map[string]string{workflowPath: workflow, actionPath: action} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if expected := replacer.Replace(original); string(data) != expected {
+			t.Errorf("Unexpected %s:\n%s\nexpected:\n%s", filepath.Base(path), string(data), expected)
+		}
+	}
+}
+
+func TestUpdateWorkflowBuildArgs(t *testing.T) {
+	disableLogging()
+
+	server, host := newTestRegistry(t, false)
+	base := pushRandomImage(t, server, host+"/base:1.0")
+	next := pushRandomImage(t, server, host+"/base:2.0")
+	builder := pushRandomImage(t, server, host+"/builder:1.0")
+
+	workflow := `env:
+  BUILDER_IMAGE: ` + host + `/builder:1.0
+  GO_VERSION: "1.24"
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        base_image: [` + host + `/base:1.0, "` + host + `/base:2.0"]
+        arch: [amd64, arm64]
+        exclude:
+          - base_image: ` + host + `/base:1.0
+            arch: arm64
+    steps:
+      - uses: docker/build-push-action@v6
+        with:
+          build-args: |
+            BASE_IMAGE=${{ matrix.base_image }}
+            RUNTIME_IMAGE=` + host + `/base:2.0
+            VERSION=1.0
+      - uses: docker/build-push-action@v6
+        with:
+          build-args: BUILDER_IMAGE=` + host + `/builder:1.0
+`
+	dir := filepath.Join(t.TempDir(), ".github", "workflows")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create workflows directory: %v", err)
+	}
+	path := filepath.Join(dir, "build.yml")
+	if err := os.WriteFile(path, []byte(workflow), 0644); err != nil {
+		t.Fatalf("Failed to write workflow: %v", err)
+	}
+
+	cfg := NewConfig()
+	cfg.RegistryOrCreate(host).Insecure = true
+	du := NewContainerfileUpdaterWithConfig(path, cfg)
+	images, err := du.extractImages()
+	if err != nil {
+		t.Fatalf("extractImages failed: %v", err)
+	}
+	var lines []int
+	for _, image := range images {
+		lines = append(lines, image.LineStart)
+	}
+	if expected := []int{2, 9, 9, 12, 19, 23}; !slices.Equal(lines, expected) {
+		t.Fatalf("Expected images at lines %v, got %v", expected, lines)
+	}
+
+	if err := du.UpdateContainerfileWithLatestDigests(); err != nil {
+		t.Fatalf("UpdateContainerfileWithLatestDigests failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read workflow: %v", err)
+	}
+	expected := strings.NewReplacer(
+		host+"/base:1.0", host+"/base@"+base.String(),
+		host+"/base:2.0", host+"/base@"+next.String(),
+		host+"/builder:1.0", host+"/builder@"+builder.String(),
+	).Replace(workflow)
+	if string(data) != expected {
+		t.Errorf("Unexpected workflow:\n%s\nexpected:\n%s", string(data), expected)
+	}
+}
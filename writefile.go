@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// writeFileAtomic replaces a file's content without ever leaving it truncated: the data
+// is written to a temporary file in the same directory, synced and renamed over the
+// original. The original mode and, where permitted, owner are kept. A file whose content
+// is already identical is left untouched so its mtime doesn't change, and a missing file is
+// created with mode 0644.
+func writeFileAtomic(path string, data []byte) error {
+	// Write through symlinks to their target instead of replacing the link
+	target, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return replaceFile(path, data, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if current, err := os.ReadFile(target); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	return replaceFile(target, data, info)
+}
+
+// replaceFile writes data to a temporary file next to target and renames it into place,
+// applying the mode and owner of the original file when given (nil for a new file)
+func replaceFile(target string, data []byte, info os.FileInfo) error {
+
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	mode := os.FileMode(0644)
+	if info != nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if info != nil {
+		if err := preserveOwner(tmp, info); err != nil {
+			// Only root may give files away; the content matters more than the owner
+			slog.Warn("Failed to preserve file owner", "path", target, "error", err)
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	renamed = true
+
+	// Persist the rename itself
+	return syncDir(dir)
+}
+
+// lineStyle records how a file terminates its lines so it can be written back the same way
+type lineStyle struct {
+	eol   string   // Ending of lines a rewrite adds: that of the first line, "\n" or "\r\n"
+	lines []string // The lines as read, matched against rewritten ones to find their endings
+	eols  []string // Ending of each line as read, "" for an unterminated last line
+	bom   bool     // Whether the content starts with a UTF-8 byte order mark
+}
+
+// utf8BOM is the byte order mark some Windows editors write at the start of a file
+const utf8BOM = "\ufeff"
+
+// splitLines breaks content into lines without their terminators. Each line's ending is
+// recorded so files mixing CRLF and LF keep both, and a byte order mark is set aside so
+// the first line can be edited like any other.
+func splitLines(content string) ([]string, lineStyle) {
+	style := lineStyle{eol: "\n"}
+	if strings.HasPrefix(content, utf8BOM) {
+		style.bom = true
+		content = content[len(utf8BOM):]
+	}
+
+	var lines []string
+	for content != "" {
+		line, rest, found := strings.Cut(content, "\n")
+		eol := ""
+		if found {
+			eol = "\n"
+			if trimmed, ok := strings.CutSuffix(line, "\r"); ok {
+				line, eol = trimmed, "\r\n"
+			}
+		}
+		lines = append(lines, line)
+		style.eols = append(style.eols, eol)
+		content = rest
+	}
+	if len(style.eols) > 0 && style.eols[0] != "" {
+		style.eol = style.eols[0]
+	}
+	// Rewrites edit the returned lines in place, so keep a copy to compare against
+	style.lines = slices.Clone(lines)
+	return lines, style
+}
+
+// join reassembles lines with their recorded endings, final newline and byte order mark
+func (s lineStyle) join(lines []string) string {
+	var b strings.Builder
+	if s.bom {
+		b.WriteString(utf8BOM)
+	}
+	for i, eol := range s.endings(lines) {
+		b.WriteString(lines[i])
+		b.WriteString(eol)
+	}
+	return b.String()
+}
+
+// endings returns the ending of each of the lines of a rewrite. Lines kept as read keep
+// their own, edited lines take that of the line they replace and added lines that of the
+// line above them. The last line ends like the file did.
+func (s lineStyle) endings(lines []string) []string {
+	endings := make([]string, len(lines))
+	i, j := 0, 0
+	for i < len(lines) {
+		if j < len(s.lines) && lines[i] == s.lines[j] {
+			endings[i] = s.eols[j]
+			i, j = i+1, j+1
+			continue
+		}
+		added, removed := s.resync(lines, i, j)
+		for k := range added {
+			switch {
+			case k < removed:
+				endings[i+k] = s.eols[j+k]
+			case i+k > 0:
+				endings[i+k] = endings[i+k-1]
+			}
+		}
+		i, j = i+added, j+removed
+	}
+
+	for i := range endings {
+		if endings[i] == "" {
+			endings[i] = s.eol
+		}
+	}
+	if n := len(endings); n > 0 {
+		endings[n-1] = ""
+		if m := len(s.eols); m > 0 {
+			endings[n-1] = s.eols[m-1]
+		}
+	}
+	return endings
+}
+
+// resync finds the nearest point after lines[i] and s.lines[j] differ where the rewrite
+// and the lines as read agree again, returning how many lines were added and removed
+// before it. Without one, the rest of both differs.
+func (s lineStyle) resync(lines []string, i, j int) (added, removed int) {
+	if j < len(s.lines) {
+		for d := 1; d <= len(lines)-i+len(s.lines)-j; d++ {
+			for a := max(0, d-(len(s.lines)-j-1)); a <= min(d, len(lines)-i-1); a++ {
+				if lines[i+a] == s.lines[j+d-a] {
+					return a, d - a
+				}
+			}
+		}
+	}
+	return len(lines) - i, len(s.lines) - j
+}
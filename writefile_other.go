@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+//go:build !unix
+
+package main
+
+import "os"
+
+// preserveOwner is a no-op where files don't carry Unix ownership
+func preserveOwner(f *os.File, original os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op where directories can't be opened for syncing
+func syncDir(dir string) error {
+	return nil
+}
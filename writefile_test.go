@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	if err := os.Chmod(path, 0750); err != nil {
+		t.Fatalf("Failed to chmod Containerfile: %v", err)
+	}
+
+	if err := writeFileAtomic(path, []byte("FROM alpine:3.20\n")); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	if string(data) != "FROM alpine:3.20\n" {
+		t.Errorf("Unexpected content: %q", string(data))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat Containerfile: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0750 {
+		t.Errorf("Expected mode 0750, got %o", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to remain, got %v", entries)
+	}
+
+	// Identical content leaves the file and its mtime alone
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+	if err := writeFileAtomic(path, []byte("FROM alpine:3.20\n")); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("Expected mtime %v to be kept, got %v", past, info.ModTime())
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "base.Containerfile")
+	if err := os.WriteFile(target, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+	link := filepath.Join(dir, "Containerfile")
+	if err := os.Symlink("base.Containerfile", link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := writeFileAtomic(link, []byte("FROM alpine:3.20\n")); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the symlink to be kept")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "FROM alpine:3.20\n" {
+		t.Errorf("Expected the symlink target to be updated, got %q", string(data))
+	}
+}
+
+func TestSplitLinesRoundTrip(t *testing.T) {
+	tests := map[string]struct {
+		lines []string
+		eols  []string
+		bom   bool
+	}{
+		"":                            {},
+		"FROM alpine\n":               {[]string{"FROM alpine"}, []string{"\n"}, false},
+		"FROM alpine\nRUN true":       {[]string{"FROM alpine", "RUN true"}, []string{"\n", ""}, false},
+		"FROM alpine\r\nRUN true\r\n": {[]string{"FROM alpine", "RUN true"}, []string{"\r\n", "\r\n"}, false},
+		"FROM alpine\r\n\r\nRUN true": {[]string{"FROM alpine", "", "RUN true"}, []string{"\r\n", "\r\n", ""}, false},
+		"FROM alpine\n\n":             {[]string{"FROM alpine", ""}, []string{"\n", "\n"}, false},
+		"\ufeffFROM alpine\r\n":       {[]string{"FROM alpine"}, []string{"\r\n"}, true},
+		"FROM alpine\r\nRUN true\n":   {[]string{"FROM alpine", "RUN true"}, []string{"\r\n", "\n"}, false},
+	}
+	for content, expected := range tests {
+		lines, style := splitLines(content)
+		if !reflect.DeepEqual(lines, expected.lines) || !reflect.DeepEqual(style.eols, expected.eols) || style.bom != expected.bom {
+			t.Errorf("splitLines(%q): got %q %+v, want %q %q", content, lines, style, expected.lines, expected.eols)
+		}
+		if joined := style.join(lines); joined != content {
+			t.Errorf("join of %q: got %q", content, joined)
+		}
+	}
+}
+
+func TestJoinMixedLineEndings(t *testing.T) {
+	// Written on Windows, then extended on Linux
+	const content = "FROM alpine:3.20 AS base\r\nRUN true\r\n\nFROM golang:1.24\nCOPY --from=base / /\n"
+	tests := []struct {
+		name string
+		edit func(lines []string) []string
+		want string
+	}{
+		{
+			name: "edited lines",
+			edit: func(lines []string) []string {
+				lines[0] = "FROM alpine@sha256:aaaa AS base"
+				lines[3] = "FROM golang@sha256:bbbb"
+				return lines
+			},
+			want: "FROM alpine@sha256:aaaa AS base\r\nRUN true\r\n\nFROM golang@sha256:bbbb\nCOPY --from=base / /\n",
+		},
+		{
+			name: "added lines",
+			edit: func(lines []string) []string {
+				lines = slices.Insert(lines, 3, "# golang:1.24 resolved 2025-01-01")
+				return slices.Insert(lines, 0, "# alpine:3.20 resolved 2025-01-01")
+			},
+			want: "# alpine:3.20 resolved 2025-01-01\r\nFROM alpine:3.20 AS base\r\nRUN true\r\n\n# golang:1.24 resolved 2025-01-01\nFROM golang:1.24\nCOPY --from=base / /\n",
+		},
+		{
+			name: "removed lines",
+			edit: func(lines []string) []string {
+				return slices.Delete(lines, 1, 3)
+			},
+			want: "FROM alpine:3.20 AS base\r\nFROM golang:1.24\nCOPY --from=base / /\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, style := splitLines(content)
+			if got := style.join(tt.edit(lines)); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReconstructPreservesLineEndings(t *testing.T) {
+	restore := disableLogging()
+	defer restore()
+
+	path := filepath.Join(t.TempDir(), "Containerfile")
+	if err := os.WriteFile(path, []byte("FROM alpine:3.20 AS base\r\nRUN true\r\n\r\nFROM base"), 0644); err != nil {
+		t.Fatalf("Failed to write Containerfile: %v", err)
+	}
+
+	updater := NewContainerfileUpdater(path)
+	result, err := updater.parseContainerfile()
+	if err != nil {
+		t.Fatalf("Failed to parse Containerfile: %v", err)
+	}
+	fromCommands, err := updater.extractFromCommands(result.AST)
+	if err != nil {
+		t.Fatalf("Failed to extract FROM commands: %v", err)
+	}
+	for _, cmd := range fromCommands {
+		cmd.Image.Digest = "sha256:test-alpine-digest"
+	}
+	if err := updater.reconstructAndWriteContainerfile(fromCommands); err != nil {
+		t.Fatalf("Failed to reconstruct Containerfile: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read Containerfile: %v", err)
+	}
+	expected := "FROM library/alpine@sha256:test-alpine-digest AS base\r\nRUN true\r\n\r\nFROM base"
+	if string(data) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(data))
+	}
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives a file the owner and group of the original file
+func preserveOwner(f *os.File, original os.FileInfo) error {
+	stat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if int(stat.Uid) == os.Getuid() && int(stat.Gid) == os.Getgid() {
+		return nil
+	}
+	return f.Chown(int(stat.Uid), int(stat.Gid))
+}
+
+// syncDir flushes a directory entry so a rename survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAMLDocuments reads every document of a YAML file into node trees, keeping
+// positions and comments. Line numbers are relative to the start of the file.
+func parseYAMLDocuments(path string, data []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+			docs = append(docs, doc.Content[0])
+		}
+	}
+	return docs, nil
+}
+
+// yamlMappingValue returns the key and value nodes for a key in a mapping node
+func yamlMappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// yamlScalar returns the value of a scalar key in a mapping node, or an empty string
+func yamlScalar(node *yaml.Node, key string) string {
+	_, value := yamlMappingValue(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
+
+// yamlComments returns the comment lines above the given nodes without their leading "#"
+func yamlComments(nodes ...*yaml.Node) []string {
+	var comments []string
+	for _, node := range nodes {
+		if node == nil || node.HeadComment == "" {
+			continue
+		}
+		for _, line := range strings.Split(node.HeadComment, "\n") {
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))
+			if line != "" {
+				comments = append(comments, line)
+			}
+		}
+	}
+	return comments
+}
+
+// yamlLastLine returns the last line spanned by a node's own content
+func yamlLastLine(node *yaml.Node) int {
+	last := node.Line
+	for _, child := range node.Content {
+		if line := yamlLastLine(child); line > last {
+			last = line
+		}
+	}
+	return last
+}
+
+// yamlImageCommand turns a YAML scalar holding an image reference into a FromCommand.
+// Values the updater can't rewrite in place are returned skipped, or nil if unusable.
+func (du *ContainerfileUpdater) yamlImageCommand(key, value *yaml.Node) *FromCommand {
+	if value.Kind != yaml.ScalarNode {
+		return nil
+	}
+	return du.yamlReferenceCommand(key, value, value.Value)
+}
+
+// yamlReferenceCommand is yamlImageCommand for a reference embedded in a scalar,
+// such as the image of a docker:// URL
+func (du *ContainerfileUpdater) yamlReferenceCommand(key, value *yaml.Node, reference string) *FromCommand {
+	if value.Kind != yaml.ScalarNode || reference == "" {
+		return nil
+	}
+	if value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		slog.Warn("Skipping multi-line image value", "line", value.Line)
+		return nil
+	}
+
+	imageRef, err := du.parseImageReference(reference)
+	if err != nil {
+		slog.Warn("Failed to parse image", "line", value.Line, "error", err)
+		return nil
+	}
+
+	cmd := &FromCommand{
+		Image:       imageRef,
+		LineStart:   value.Line,
+		LineEnd:     value.Line,
+		Annotations: du.yamlAnnotations(value.Line, key),
+		editor:      yamlScalarEditor(value, len(value.Value)-len(reference)),
+	}
+	if strings.Contains(reference, "$") {
+		cmd.SkipReason = "uses variable interpolation"
+		cmd.Unpinnable = true
+	}
+	du.applySkipRules(cmd)
+	return cmd
+}
+
+// yamlAnnotations parses containerfile-updater directives from the comments above the given nodes
+func (du *ContainerfileUpdater) yamlAnnotations(line int, nodes ...*yaml.Node) *ImageAnnotations {
+	annotations, err := parseAnnotations(yamlComments(nodes...))
+	if err != nil {
+		slog.Warn("Ignoring invalid annotation comment", "prefix", annotationPrefix, "line", line, "error", err)
+		return &ImageAnnotations{}
+	}
+	return annotations
+}
+
+// applySkipRules records the digest the image is pinned to and switches it to its tracking
+// or catalog tag, then sets the skip reason from annotations, registry event targets, the
+// catalog and the image filter unless one is already set. Images of formats without
+// annotation comments get empty annotations.
+func (du *ContainerfileUpdater) applySkipRules(cmd *FromCommand) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = &ImageAnnotations{}
+	}
+	cmd.PreviousDigest = cmd.Image.Digest
+	cmd.formats = du.formats
+	du.applyTracking(cmd)
+	du.applyCatalog(cmd)
+	switch {
+	case cmd.SkipReason != "":
+	case cmd.Annotations.Ignore:
+		cmd.SkipReason = "ignored by annotation"
+	case len(du.targets) > 0 && !slices.ContainsFunc(du.targets, func(e RegistryEvent) bool { return e.Matches(cmd.Image) }):
+		cmd.SkipReason = "not pushed by registry event"
+	case matchAny(du.ignoredImages, referenceCandidates(cmd.Image)) != "":
+		cmd.SkipReason = "ignored by " + ignoreFileName
+	case cmd.Violation != "":
+		cmd.SkipReason = cmd.Violation
+	default:
+		cmd.SkipReason = firstNonEmpty(du.selection.skipReason(cmd, du.graph), du.imageFilter.SkipReason(cmd.Image))
+	}
+	if cmd.SkipReason != "" {
+		slog.Info("Skipping image", "image", cmd.Image.Original, "reason", cmd.SkipReason)
+	}
+}
+
+// setYAMLField returns the lines with a scalar field of a block mapping set to value,
+// replacing the existing value in place or appending a new key after the mapping's
+// last line. An empty value removes the field.
+func setYAMLField(lines []string, mapping *yaml.Node, field, value string) ([]string, bool) {
+	key, current := yamlMappingValue(mapping, field)
+	if key != nil {
+		index := key.Line - 1
+		if index < 0 || index >= len(lines) {
+			return lines, false
+		}
+		if value == "" {
+			return append(lines[:index:index], lines[index+1:]...), true
+		}
+		if current.Value == value {
+			return lines, false
+		}
+		if current.Kind == yaml.ScalarNode && current.Value != "" && current.Line == key.Line {
+			lines[index] = replaceYAMLScalar(lines[index], current, value)
+		} else {
+			lines[index] = lines[index][:key.Column-1] + field + ": " + value
+		}
+		return lines, true
+	}
+
+	if value == "" || len(mapping.Content) == 0 {
+		return lines, false
+	}
+
+	// Insert after the mapping's last line, indented like its first key
+	index := yamlLastLine(mapping)
+	if index > len(lines) {
+		return lines, false
+	}
+	line := strings.Repeat(" ", mapping.Content[0].Column-1) + field + ": " + value
+	lines = append(lines[:index], append([]string{line}, lines[index:]...)...)
+	return lines, true
+}
+
+// replaceYAMLScalar replaces a single-line scalar's text on its line, keeping any quotes
+func replaceYAMLScalar(line string, node *yaml.Node, value string) string {
+	start := node.Column - 1
+	if start < 0 || start >= len(line) {
+		return line
+	}
+
+	switch node.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		quote := line[start : start+1]
+		end := strings.Index(line[start+1:], quote)
+		if end < 0 {
+			return line
+		}
+		return line[:start+1] + value + line[start+1+end:]
+	default:
+		end := start + len(node.Value)
+		if end > len(line) {
+			return line
+		}
+		return line[:start] + value + line[end:]
+	}
+}
+
+// yamlScalarEditor rewrites a reference found skip bytes into the value of a YAML scalar.
+// The parser reports where the scalar starts as a character column, which is converted to
+// a byte offset of the line being edited.
+func yamlScalarEditor(value *yaml.Node, skip int) lineEditor {
+	return func(lines []string, cmd *FromCommand) ([]string, bool) {
+		index := cmd.LineStart - 1
+		if index < 0 || index >= len(lines) {
+			return lines, false
+		}
+		start := columnOffset(lines[index], value.Column) + skip
+		if value.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+			start++
+		}
+		return spanEditor(start)(lines, cmd)
+	}
+}
+
+// columnOffset returns the byte offset of a 1-based character column of a line
+func columnOffset(line string, column int) int {
+	characters := 0
+	for offset := range line {
+		characters++
+		if characters == column {
+			return offset
+		}
+	}
+	return len(line)
+}
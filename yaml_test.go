@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAMLString parses a YAML document for helper tests
+func parseYAMLString(t *testing.T, content string) *yaml.Node {
+	t.Helper()
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	return doc.Content[0]
+}
+
+func TestSetYAMLField(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		value   string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "replace plain",
+			content: "image:\n  repository: nginx\n  digest: sha256:old # keep\nother: true\n",
+			value:   "sha256:new",
+			want:    "image:\n  repository: nginx\n  digest: sha256:new # keep\nother: true\n",
+			changed: true,
+		},
+		{
+			name:    "replace quoted",
+			content: "image:\n  digest: \"sha256:old\"\n",
+			value:   "sha256:new",
+			want:    "image:\n  digest: \"sha256:new\"\n",
+			changed: true,
+		},
+		{
+			name:    "replace empty",
+			content: "image:\n  digest:\n  tag: v1\n",
+			value:   "sha256:new",
+			want:    "image:\n  digest: sha256:new\n  tag: v1\n",
+			changed: true,
+		},
+		{
+			name:    "insert",
+			content: "image:\n  repository: nginx\n  tag: v1\nother: true\n",
+			value:   "sha256:new",
+			want:    "image:\n  repository: nginx\n  tag: v1\n  digest: sha256:new\nother: true\n",
+			changed: true,
+		},
+		{
+			name:    "remove",
+			content: "image:\n  repository: nginx\n  digest: sha256:old\n",
+			value:   "",
+			want:    "image:\n  repository: nginx\n",
+			changed: true,
+		},
+		{
+			name:    "unchanged",
+			content: "image:\n  digest: sha256:same\n",
+			value:   "sha256:same",
+			want:    "image:\n  digest: sha256:same\n",
+			changed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mapping := yamlMappingValue(parseYAMLString(t, tt.content), "image")
+			lines := strings.Split(strings.TrimSuffix(tt.content, "\n"), "\n")
+
+			got, changed := setYAMLField(lines, mapping, "digest", tt.value)
+			if changed != tt.changed {
+				t.Errorf("Expected changed=%v, got %v", tt.changed, changed)
+			}
+			if result := strings.Join(got, "\n") + "\n"; result != tt.want {
+				t.Errorf("Unexpected result:\n%s\nexpected:\n%s", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLComments(t *testing.T) {
+	root := parseYAMLString(t, "# first\n#   second  \nimage: nginx\n")
+	key, _ := yamlMappingValue(root, "image")
+
+	got := yamlComments(nil, key)
+	if strings.Join(got, "|") != "first|second" {
+		t.Errorf("Unexpected comments: %q", got)
+	}
+}